@@ -3,11 +3,28 @@ import { Controller, useForm } from 'react-hook-form';
 import { Trans, useTranslation } from 'react-i18next';
 
 import { validateAnswer, validateDomain, validateRequiredValue } from '../../../helpers/validators';
+import { UINT32_RANGE } from '../../../helpers/constants';
 import { Input } from '../../ui/Controls/Input';
+import { Select } from '../../ui/Controls/Select';
+
+/**
+ * The explicit record types of DNS rewrites.  An empty type means that the type
+ * is inferred from the answer.
+ */
+const REWRITE_TYPES = ['A', 'AAAA', 'CNAME', 'MX', 'TXT', 'SRV', 'PTR', 'CAA', 'HTTPS'];
+
+/**
+ * The record types the answers of which are IP addresses, domain names, or the
+ * special values.
+ */
+const SIMPLE_REWRITE_TYPES = ['', 'A', 'AAAA', 'CNAME'];
 
 interface RewriteFormValues {
     domain: string;
     answer: string;
+    type?: string;
+    ttl?: number | string;
+    comment?: string;
 }
 
 type Props = {
@@ -24,18 +41,27 @@ const Form = ({ processingAdd, currentRewrite, toggleRewritesModal, onSubmit }:
         handleSubmit,
         reset,
         control,
+        watch,
         formState: { isDirty, isSubmitting },
     } = useForm<RewriteFormValues>({
         mode: 'onBlur',
         defaultValues: {
             domain: currentRewrite?.domain || '',
             answer: currentRewrite?.answer || '',
+            type: currentRewrite?.type || '',
+            ttl: currentRewrite?.ttl || '',
+            comment: currentRewrite?.comment || '',
         },
     });
 
-    const handleFormSubmit = async (data: RewriteFormValues) => {
+    const type = watch('type');
+
+    const handleFormSubmit = async ({ ttl, ...data }: RewriteFormValues) => {
         if (onSubmit) {
-            await onSubmit(data);
+            await onSubmit({
+                ...data,
+                ttl: ttl ? Number(ttl) : 0,
+            });
         }
     };
 
@@ -78,13 +104,30 @@ const Form = ({ processingAdd, currentRewrite, toggleRewritesModal, onSubmit }:
                         </span>
                     </li>
                 </ol>
+                <div className="form__group">
+                    <Controller
+                        name="type"
+                        control={control}
+                        render={({ field }) => (
+                            <Select {...field} data-testid="rewrites_type" label={t('rewrite_type')}>
+                                <option value="">{t('rewrite_type_auto')}</option>
+                                {REWRITE_TYPES.map((rrType) => (
+                                    <option key={rrType} value={rrType}>
+                                        {rrType}
+                                    </option>
+                                ))}
+                            </Select>
+                        )}
+                    />
+                </div>
                 <div className="form__group">
                     <Controller
                         name="answer"
                         control={control}
                         rules={{
                             validate: {
-                                validate: validateAnswer,
+                                validate: (value) =>
+                                    SIMPLE_REWRITE_TYPES.includes(type || '') ? validateAnswer(value) : undefined,
                                 required: validateRequiredValue,
                             },
                         }}
@@ -99,14 +142,51 @@ const Form = ({ processingAdd, currentRewrite, toggleRewritesModal, onSubmit }:
                         )}
                     />
                 </div>
+                <div className="form__group">
+                    <Controller
+                        name="ttl"
+                        control={control}
+                        rules={{
+                            min: { value: UINT32_RANGE.MIN, message: t('form_error_positive') },
+                            max: { value: UINT32_RANGE.MAX, message: t('form_error_positive') },
+                        }}
+                        render={({ field, fieldState }) => (
+                            <Input
+                                {...field}
+                                type="number"
+                                data-testid="rewrites_ttl"
+                                placeholder={t('rewrite_ttl_placeholder')}
+                                min={UINT32_RANGE.MIN}
+                                max={UINT32_RANGE.MAX}
+                                error={fieldState.error?.message}
+                            />
+                        )}
+                    />
+                </div>
+                <div className="form__group">
+                    <Controller
+                        name="comment"
+                        control={control}
+                        render={({ field }) => (
+                            <Input
+                                {...field}
+                                type="text"
+                                data-testid="rewrites_comment"
+                                placeholder={t('rewrite_comment_placeholder')}
+                            />
+                        )}
+                    />
+                </div>
             </div>
 
             <ul>
-                {['rewrite_ip_address', 'rewrite_domain_name', 'rewrite_A', 'rewrite_AAAA'].map((str) => (
-                    <li key={str}>
-                        <Trans components={[<code key="0">text</code>]}>{str}</Trans>
-                    </li>
-                ))}
+                {['rewrite_ip_address', 'rewrite_domain_name', 'rewrite_A', 'rewrite_AAAA', 'rewrite_typed'].map(
+                    (str) => (
+                        <li key={str}>
+                            <Trans components={[<code key="0">text</code>]}>{str}</Trans>
+                        </li>
+                    ),
+                )}
             </ul>
 
             <div className="modal-footer">
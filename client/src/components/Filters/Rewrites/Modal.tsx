@@ -4,6 +4,7 @@ import { Trans, withTranslation } from 'react-i18next';
 import ReactModal from 'react-modal';
 
 import { MODAL_TYPE } from '../../../helpers/constants';
+import { RewriteEntry } from '../../../initialState';
 
 import Form from './Form';
 
@@ -14,7 +15,7 @@ interface ModalProps {
     processingAdd: boolean;
     processingDelete: boolean;
     modalType: string;
-    currentRewrite?: { answer: string, domain: string; };
+    currentRewrite?: RewriteEntry;
 }
 
 const Modal = (props: ModalProps) => {
@@ -64,12 +64,29 @@ class Table extends Component<TableProps> {
             accessor: 'domain',
             Cell: this.cellWrap,
         },
+        {
+            Header: this.props.t('rewrite_type'),
+            accessor: 'type',
+            maxWidth: 100,
+            Cell: this.cellWrap,
+        },
         {
             Header: this.props.t('answer'),
             accessor: 'answer',
             sortMethod: sortIp,
             Cell: this.cellWrap,
         },
+        {
+            Header: this.props.t('rewrite_ttl'),
+            accessor: 'ttl',
+            maxWidth: 100,
+            Cell: this.cellWrap,
+        },
+        {
+            Header: this.props.t('rewrite_comment'),
+            accessor: 'comment',
+            Cell: this.cellWrap,
+        },
         {
             Header: this.props.t('actions_table_header'),
             accessor: 'actions',
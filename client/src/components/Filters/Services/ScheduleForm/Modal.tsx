@@ -8,7 +8,15 @@ import { Timezone } from './Timezone';
 import { TimeSelect } from './TimeSelect';
 
 import { TimePeriod } from './TimePeriod';
-import { getFullDayName, getShortDayName } from './helpers';
+import {
+    DayRange,
+    getDayRanges,
+    getFullDayName,
+    getShortDayName,
+    rangesOverlap,
+    Schedule,
+    setDayRanges,
+} from './helpers';
 import { LOCAL_TIMEZONE_VALUE } from '../../../../helpers/constants';
 
 export const DAYS_OF_WEEK = ['sun', 'mon', 'tue', 'wed', 'thu', 'fri', 'sat'];
@@ -17,16 +25,15 @@ const INITIAL_START_TIME_MS = 0;
 const INITIAL_END_TIME_MS = 86340000;
 
 interface ModalProps {
-    schedule: {
-        time_zone: string;
-    };
+    schedule: Schedule;
     currentDay?: string;
+    currentIndex?: number;
     isOpen: boolean;
     onClose: (...args: unknown[]) => unknown;
-    onSubmit: (values: any) => void;
+    onSubmit: (values: Schedule) => void;
 }
 
-export const Modal = ({ isOpen, currentDay, schedule, onClose, onSubmit }: ModalProps) => {
+export const Modal = ({ isOpen, currentDay, currentIndex, schedule, onClose, onSubmit }: ModalProps) => {
     const [t] = useTranslation();
 
     const intialTimezone =
@@ -47,10 +54,20 @@ export const Modal = ({ isOpen, currentDay, schedule, onClose, onSubmit }: Modal
             const newDays = new Set([currentDay]);
             setDays(newDays);
 
-            setStartTime(schedule[currentDay].start);
-            setEndTime(schedule[currentDay].end);
+            const range = getDayRanges(schedule, currentDay)[currentIndex];
+            if (range) {
+                setStartTime(range.start);
+                setEndTime(range.end);
+            }
         }
-    }, [currentDay]);
+    }, [currentDay, currentIndex]);
+
+    // otherRanges returns the ranges of the day except the edited one.
+    const otherRanges = (day: string): DayRange[] =>
+        getDayRanges(schedule, day).filter((_, i) => day !== currentDay || i !== currentIndex);
+
+    const newRange = { start: startTime, end: endTime };
+    const overlaps = Array.from(days).some((day) => otherRanges(day).some((r) => rangesOverlap(r, newRange)));
 
     useEffect(() => {
         if (startTime >= endTime) {
@@ -79,17 +96,22 @@ export const Modal = ({ isOpen, currentDay, schedule, onClose, onSubmit }: Modal
     const onFormSubmit = (e: any) => {
         e.preventDefault();
 
-        const newSchedule = schedule;
+        if (overlaps) {
+            return;
+        }
+
+        let newSchedule = schedule;
+
+        if (currentDay && !days.has(currentDay)) {
+            newSchedule = setDayRanges(newSchedule, currentDay, otherRanges(currentDay));
+        }
 
         Array.from(days).forEach((day) => {
-            newSchedule[day] = {
-                start: startTime,
-                end: endTime,
-            };
+            newSchedule = setDayRanges(newSchedule, day, [...otherRanges(day), newRange]);
         });
 
         if (timezone !== intialTimezone) {
-            newSchedule.time_zone = timezone;
+            newSchedule = { ...newSchedule, time_zone: timezone };
         }
 
         onSubmit(newSchedule);
@@ -135,6 +157,10 @@ export const Modal = ({ isOpen, currentDay, schedule, onClose, onSubmit }: Modal
                             </div>
 
                             {wrongPeriod && <div className="schedule__error">{t('schedule_invalid_select')}</div>}
+
+                            {!wrongPeriod && overlaps && (
+                                <div className="schedule__error">{t('schedule_overlap')}</div>
+                            )}
                         </div>
 
                         <div className="schedule__info">
@@ -173,7 +199,7 @@ export const Modal = ({ isOpen, currentDay, schedule, onClose, onSubmit }: Modal
                             <button
                                 type="button"
                                 className="btn btn-success btn-standard"
-                                disabled={days.size === 0 || wrongPeriod}
+                                disabled={days.size === 0 || wrongPeriod || overlaps}
                                 onClick={onFormSubmit}>
                                 {currentDay ? t('schedule_save') : t('schedule_add')}
                             </button>
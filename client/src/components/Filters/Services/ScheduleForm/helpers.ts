@@ -45,3 +45,56 @@ export const convertTimeToMs = (hours: any, minutes: any) => {
 
     return selectedTime.getTime();
 };
+
+export type DayRange = {
+    start: number;
+    end: number;
+};
+
+export type ScheduleException = {
+    date: string;
+    ranges: DayRange[];
+};
+
+/**
+ * Schedule is the weekly schedule as returned by the API.  A day with a single
+ * range may be an object instead of an array.
+ */
+export type Schedule = {
+    time_zone: string;
+    exceptions?: ScheduleException[];
+    sun?: DayRange | DayRange[];
+    mon?: DayRange | DayRange[];
+    tue?: DayRange | DayRange[];
+    wed?: DayRange | DayRange[];
+    thu?: DayRange | DayRange[];
+    fri?: DayRange | DayRange[];
+    sat?: DayRange | DayRange[];
+};
+
+export const getDayRanges = (schedule: Schedule | undefined, day: string): DayRange[] => {
+    const value = schedule?.[day];
+    if (!value) {
+        return [];
+    }
+
+    return Array.isArray(value) ? value : [value];
+};
+
+/**
+ * Returns a copy of schedule with the ranges of the day replaced, keeping the
+ * time zone, the exceptions, and the other days intact.
+ */
+export const setDayRanges = (schedule: Schedule, day: string, ranges: DayRange[]): Schedule => {
+    const newSchedule = { ...schedule };
+
+    if (ranges.length === 0) {
+        delete newSchedule[day];
+    } else {
+        newSchedule[day] = [...ranges].sort((a, b) => a.start - b.start);
+    }
+
+    return newSchedule;
+};
+
+export const rangesOverlap = (a: DayRange, b: DayRange) => a.start < b.end && b.start < a.end;
@@ -2,87 +2,85 @@ import React, { useState } from 'react';
 import { useTranslation } from 'react-i18next';
 import cn from 'classnames';
 
-import { Modal } from './Modal';
-import { getFullDayName, getShortDayName } from './helpers';
+import { DAYS_OF_WEEK, Modal } from './Modal';
+import { getDayRanges, getFullDayName, getShortDayName, Schedule, setDayRanges } from './helpers';
 import { LOCAL_TIMEZONE_VALUE } from '../../../../helpers/constants';
 
 import { TimePeriod } from './TimePeriod';
 import './styles.css';
 
 interface ScheduleFormProps {
-    schedule?: {
-        time_zone: string;
-    };
-    onScheduleSubmit: (values: any) => void;
+    schedule?: Schedule;
+    onScheduleSubmit: (values: Schedule) => void;
     clientForm?: boolean;
 }
 
+type CurrentRange = {
+    day: string;
+    index: number;
+};
+
 export const ScheduleForm = ({ schedule, onScheduleSubmit, clientForm }: ScheduleFormProps) => {
     const [t] = useTranslation();
     const [modalOpen, setModalOpen] = useState(false);
-    const [currentDay, setCurrentDay] = useState();
+    const [currentRange, setCurrentRange] = useState<CurrentRange>();
 
     const onModalOpen = () => setModalOpen(true);
     const onModalClose = () => setModalOpen(false);
 
-    const filteredScheduleKeys = schedule ? Object.keys(schedule).filter((v) => v !== 'time_zone') : [];
-    const scheduleMap = new Map();
-    filteredScheduleKeys.forEach((day) => scheduleMap.set(day, schedule[day]));
+    const currentSchedule: Schedule = schedule || { time_zone: LOCAL_TIMEZONE_VALUE };
+    const exceptions = currentSchedule.exceptions || [];
 
-    const onSubmit = (values: any) => {
+    const onSubmit = (values: Schedule) => {
         onScheduleSubmit(values);
         onModalClose();
     };
 
-    const onDelete = (day: any) => {
-        scheduleMap.delete(day);
+    const onDelete = (day: string, index: number) => {
+        const ranges = getDayRanges(currentSchedule, day).filter((_, i) => i !== index);
 
-        const scheduleWeek = Object.fromEntries(Array.from(scheduleMap.entries()));
+        onScheduleSubmit(setDayRanges(currentSchedule, day, ranges));
+    };
 
+    const onDeleteException = (date: string) => {
         onScheduleSubmit({
-            time_zone: schedule.time_zone,
-            ...scheduleWeek,
+            ...currentSchedule,
+            exceptions: exceptions.filter((e) => e.date !== date),
         });
     };
 
-    const onEdit = (day: any) => {
-        setCurrentDay(day);
+    const onEdit = (day: string, index: number) => {
+        setCurrentRange({ day, index });
         onModalOpen();
     };
 
     const onAdd = () => {
-        setCurrentDay(undefined);
+        setCurrentRange(undefined);
         onModalOpen();
     };
 
     return (
         <div>
             <div className="schedule__current-timezone">
-                {t('schedule_current_timezone', { value: schedule?.time_zone || LOCAL_TIMEZONE_VALUE })}
+                {t('schedule_current_timezone', { value: currentSchedule.time_zone || LOCAL_TIMEZONE_VALUE })}
             </div>
 
             <div className="schedule__rows">
-                {filteredScheduleKeys.map((day) => {
-                    const data = schedule[day];
-
-                    if (!data) {
-                        return undefined;
-                    }
-
-                    return (
-                        <div key={day} className="schedule__row">
+                {DAYS_OF_WEEK.map((day) =>
+                    getDayRanges(currentSchedule, day).map((range, index) => (
+                        <div key={`${day}-${range.start}`} className="schedule__row">
                             <div className="schedule__day">{getFullDayName(t, day)}</div>
 
                             <div className="schedule__day schedule__day--mobile">{getShortDayName(t, day)}</div>
 
-                            <TimePeriod startTimeMs={data.start} endTimeMs={data.end} />
+                            <TimePeriod startTimeMs={range.start} endTimeMs={range.end} />
 
                             <div className="schedule__actions">
                                 <button
                                     type="button"
                                     className="btn btn-icon btn-outline-primary btn-sm schedule__button"
                                     title={t('edit_table_action')}
-                                    onClick={() => onEdit(day)}>
+                                    onClick={() => onEdit(day, index)}>
                                     <svg className="icons icon12">
                                         <use xlinkHref="#edit" />
                                     </svg>
@@ -92,17 +90,59 @@ export const ScheduleForm = ({ schedule, onScheduleSubmit, clientForm }: Schedul
                                     type="button"
                                     className="btn btn-icon btn-outline-secondary btn-sm schedule__button"
                                     title={t('delete_table_action')}
-                                    onClick={() => onDelete(day)}>
+                                    onClick={() => onDelete(day, index)}>
                                     <svg className="icons">
                                         <use xlinkHref="#delete" />
                                     </svg>
                                 </button>
                             </div>
                         </div>
-                    );
-                })}
+                    )),
+                )}
             </div>
 
+            {exceptions.length > 0 && (
+                <>
+                    <div className="schedule__current-timezone">{t('schedule_exceptions')}</div>
+
+                    <div className="schedule__rows">
+                        {exceptions.map((exception) => (
+                            <div key={exception.date} className="schedule__row">
+                                <div className="schedule__day">{exception.date}</div>
+
+                                <div className="schedule__day schedule__day--mobile">{exception.date}</div>
+
+                                <div>
+                                    {exception.ranges.length > 0 ? (
+                                        exception.ranges.map((range) => (
+                                            <TimePeriod
+                                                key={range.start}
+                                                startTimeMs={range.start}
+                                                endTimeMs={range.end}
+                                            />
+                                        ))
+                                    ) : (
+                                        <span>—</span>
+                                    )}
+                                </div>
+
+                                <div className="schedule__actions">
+                                    <button
+                                        type="button"
+                                        className="btn btn-icon btn-outline-secondary btn-sm schedule__button"
+                                        title={t('delete_table_action')}
+                                        onClick={() => onDeleteException(exception.date)}>
+                                        <svg className="icons">
+                                            <use xlinkHref="#delete" />
+                                        </svg>
+                                    </button>
+                                </div>
+                            </div>
+                        ))}
+                    </div>
+                </>
+            )}
+
             <button
                 type="button"
                 className={cn(
@@ -119,8 +159,9 @@ export const ScheduleForm = ({ schedule, onScheduleSubmit, clientForm }: Schedul
                     isOpen={modalOpen}
                     onClose={onModalClose}
                     onSubmit={onSubmit}
-                    schedule={schedule}
-                    currentDay={currentDay}
+                    schedule={currentSchedule}
+                    currentDay={currentRange?.day}
+                    currentIndex={currentRange?.index}
                 />
             )}
         </div>
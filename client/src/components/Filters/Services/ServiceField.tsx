@@ -2,6 +2,8 @@ import React from 'react';
 import cn from 'classnames';
 import { FieldValues, ControllerRenderProps } from 'react-hook-form';
 
+import { ServiceIcon } from './ServiceIcon';
+
 type Props = ControllerRenderProps<FieldValues> & {
     placeholder: string;
     disabled?: boolean;
@@ -31,7 +33,7 @@ export const ServiceField = React.forwardRef<HTMLInputElement, Props>(
                 <span className="service__text" title={placeholder}>
                     {placeholder}
                 </span>
-                {icon && <div dangerouslySetInnerHTML={{ __html: window.atob(icon) }} className="service__icon" />}
+                {icon && <ServiceIcon icon={icon} />}
             </label>
 
             {!disabled && error && <span className="form__message form__message--error">{error}</span>}
@@ -0,0 +1,31 @@
+import React from 'react';
+import cn from 'classnames';
+
+const BASE64_RE = /^[A-Za-z0-9+/]+=*$/;
+
+type Props = {
+    icon: string;
+    className?: string;
+    title?: string;
+};
+
+/**
+ * Renders the base64-encoded SVG icon of a blocked service.  The icons of the
+ * custom services may come from remote catalogs, so the SVG is only used as a
+ * CSS mask and is never inserted into the document.
+ */
+export const ServiceIcon = ({ icon, className, title }: Props) => {
+    if (!icon || !BASE64_RE.test(icon)) {
+        return null;
+    }
+
+    const url = `url("data:image/svg+xml;base64,${icon}")`;
+
+    return (
+        <div
+            className={cn('service__icon service__icon--mask', className)}
+            style={{ WebkitMaskImage: url, maskImage: url }}
+            title={title}
+        />
+    );
+};
@@ -22,6 +22,7 @@ import CellWrap from '../../../ui/CellWrap';
 import LogsSearchLink from '../../../ui/LogsSearchLink';
 
 import Modal from '../Modal';
+import { ServiceIcon } from '../../../Filters/Services/ServiceIcon';
 import { LocalStorageHelper, LOCAL_STORAGE_KEYS } from '../../../../helpers/localStorageHelper';
 import { Client, NormalizedTopClients, RootState } from '../../../../initialState';
 
@@ -240,12 +241,10 @@ const ClientsTable = ({
 
                                 if (serviceInfo?.icon_svg) {
                                     return (
-                                        <div
+                                        <ServiceIcon
                                             key={serviceInfo.name}
-                                            dangerouslySetInnerHTML={{
-                                                __html: window.atob(serviceInfo.icon_svg),
-                                            }}
-                                            className="service__icon service__icon--table"
+                                            icon={serviceInfo.icon_svg}
+                                            className="service__icon--table"
                                             title={serviceInfo.name}
                                         />
                                     );
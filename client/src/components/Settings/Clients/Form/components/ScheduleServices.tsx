@@ -2,6 +2,7 @@ import React from 'react';
 import { Trans } from 'react-i18next';
 import { useFormContext } from 'react-hook-form';
 import { ScheduleForm } from '../../../../Filters/Services/ScheduleForm';
+import { Schedule } from '../../../../Filters/Services/ScheduleForm/helpers';
 import { ClientForm } from '../types';
 
 export const ScheduleServices = () => {
@@ -9,7 +10,7 @@ export const ScheduleServices = () => {
 
     const blockedServicesSchedule = watch('blocked_services_schedule');
 
-    const handleScheduleSubmit = (values: any) => {
+    const handleScheduleSubmit = (values: Schedule) => {
         setValue('blocked_services_schedule', values);
     };
 
@@ -10,6 +10,7 @@ import { RootState } from '../../../../initialState';
 import { Input } from '../../../ui/Controls/Input';
 import { validateRequiredValue } from '../../../../helpers/validators';
 import { ClientForm } from './types';
+import { Schedule } from '../../../Filters/Services/ScheduleForm/helpers';
 import { BlockedServices, ClientIds, MainSettings, ScheduleServices, UpstreamDns } from './components';
 
 import '../Service.css';
@@ -40,9 +41,7 @@ type Props = {
     onClose: () => void;
     useGlobalSettings?: boolean;
     useGlobalServices?: boolean;
-    blockedServicesSchedule?: {
-        time_zone: string;
-    };
+    blockedServicesSchedule?: Schedule;
     processingAdding: boolean;
     processingUpdating: boolean;
     tagsOptions: { label: string; value: string }[];
@@ -1,12 +1,12 @@
+import { Schedule } from '../../../Filters/Services/ScheduleForm/helpers';
+
 export type ClientForm = {
     name: string;
     tags: { value: string; label: string }[];
     ids: { name: string }[];
     use_global_settings: boolean;
     use_global_blocked_services: boolean;
-    blocked_services_schedule: {
-        time_zone: string;
-    };
+    blocked_services_schedule: Schedule;
     safe_search: {
         enabled: boolean;
         [key: string]: boolean;
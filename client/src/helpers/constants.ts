@@ -374,6 +374,7 @@ export const SPECIAL_FILTER_ID = {
     PARENTAL: -3,
     SAFE_BROWSING: -4,
     SAFE_SEARCH: -5,
+    CLIENT_FILTERING_RULES: -6,
 };
 
 export const BLOCK_ACTIONS = {
@@ -852,6 +852,8 @@ export const getSpecialFilterName = (filterId: any) => {
             return i18n.t('safe_browsing');
         case SPECIAL_FILTER_ID.SAFE_SEARCH:
             return i18n.t('safe_search');
+        case SPECIAL_FILTER_ID.CLIENT_FILTERING_RULES:
+            return i18n.t('client_filter_rules');
         default:
             return i18n.t('unknown_filter', { filterId });
     }
@@ -8,6 +8,7 @@ import {
 } from './helpers/constants';
 import { DEFAULT_BLOCKING_IPV4, DEFAULT_BLOCKING_IPV6 } from './reducers/dnsConfig';
 import { Filter } from './helpers/helpers';
+import { Schedule } from './components/Filters/Services/ScheduleForm/helpers';
 
 export type InstallInterface = {
     flags: string;
@@ -79,16 +80,7 @@ export type EncryptionData = {
 
 export type Client = {
     blocked_services: string[];
-    blocked_services_schedule: {
-        sun?: { start: number; end: number };
-        mon?: { start: number; end: number };
-        tue?: { start: number; end: number };
-        wed?: { start: number; end: number };
-        thu?: { start: number; end: number };
-        fri?: { start: number; end: number };
-        sat?: { start: number; end: number };
-        time_zone: string;
-    };
+    blocked_services_schedule: Schedule;
     filtering_enabled: boolean;
     ids: string[];
     ignore_querylog: boolean;
@@ -163,6 +155,15 @@ export type SettingsData = {
     };
 };
 
+export type RewriteEntry = {
+    answer: string;
+    domain: string;
+    enabled: boolean;
+    type?: string;
+    ttl?: number;
+    comment?: string;
+};
+
 export type RewritesData = {
     processing: boolean;
     processingAdd: boolean;
@@ -170,16 +171,8 @@ export type RewritesData = {
     processingUpdate: boolean;
     isModalOpen: boolean;
     modalType: string;
-    currentRewrite?: {
-        answer: string;
-        domain: string;
-        enabled: boolean;
-    };
-    list: {
-        answer: string;
-        domain: string;
-        enabled: boolean;
-    }[];
+    currentRewrite?: RewriteEntry;
+    list: RewriteEntry[];
     settings: {
         enabled: boolean;
     };
@@ -0,0 +1,398 @@
+// Package blockpage contains the HTTP and HTTPS server showing a page that
+// explains why a domain has been blocked.  The server is used with the
+// [filtering.BlockingModeCustomIP] blocking mode, when the blocked domains are
+// resolved to the address of AdGuard Home.
+package blockpage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/bluele/gcache"
+)
+
+const (
+	// readTimeout is the maximum duration for reading the entire request,
+	// including the body.
+	readTimeout = 10 * time.Second
+
+	// writeTimeout is the maximum duration before timing out writes of the
+	// response.
+	writeTimeout = 10 * time.Second
+
+	// defaultCacheSize is the default maximum number of the recorded blocked
+	// requests.
+	defaultCacheSize = 10_000
+
+	// unblockRequestPath is the path the form to request unblocking of a
+	// domain is submitted to.
+	unblockRequestPath = "/adguardhome/unblock_request"
+
+	// maxUnblockFormSize is the maximum size of the body of the form to
+	// request unblocking.
+	maxUnblockFormSize = 8 * 1024
+)
+
+// ListNamer returns the names of filter lists.
+type ListNamer interface {
+	// FilterListName returns the name of the filter list with the given ID or
+	// an empty string if there is no such list.
+	FilterListName(id rulelist.APIID) (name string)
+}
+
+// Unblocker saves the requests of the clients to unblock domains.
+type Unblocker interface {
+	// SubmitUnblockRequest saves the request of the client with the given
+	// address to unblock domain.  It returns an error if the request is
+	// invalid or can't be accepted.
+	SubmitUnblockRequest(
+		ctx context.Context,
+		client netip.Addr,
+		domain string,
+		justification string,
+	) (err error)
+}
+
+// Config is the configuration of the block page [Server].
+type Config struct {
+	// Logger is used for logging the operation of the server.  It must not be
+	// nil.
+	Logger *slog.Logger
+
+	// ListNamer is used to show the names of the filter lists containing the
+	// blocking rules.  It must not be nil.
+	ListNamer ListNamer
+
+	// Unblocker is used to save the requests to unblock domains submitted from
+	// the block page.  If it's nil, the form to request unblocking is not
+	// shown.
+	Unblocker Unblocker
+
+	// HTTPReg is used to register the HTTP API of the server.  It must not be
+	// nil.
+	HTTPReg aghhttp.Registrar
+
+	// DataDir is the directory where the certificate authority used for the
+	// HTTPS block page is stored.  It must not be empty.
+	DataDir string
+
+	// UnblockURL is the URL of the page to request unblocking of a domain.  The
+	// domain is added to it as the "domain" query parameter.  If it's empty or
+	// Unblocker is set, the link to request unblocking is not shown.
+	UnblockURL string
+
+	// HTTPAddrs are the addresses to serve the block page over HTTP on.
+	HTTPAddrs []netip.AddrPort
+
+	// HTTPSAddrs are the addresses to serve the block page over HTTPS on.
+	HTTPSAddrs []netip.AddrPort
+
+	// CacheSize is the maximum number of the recorded blocked requests.  If
+	// it's zero, a default value is used.
+	CacheSize int
+}
+
+// Server serves the block page.
+type Server struct {
+	logger     *slog.Logger
+	listNamer  ListNamer
+	unblocker  Unblocker
+	ca         *authority
+	blocked    gcache.Cache
+	unblockURL string
+	httpAddrs  []netip.AddrPort
+	httpsAddrs []netip.AddrPort
+
+	// servers are the running HTTP servers.  It's only accessed from Start
+	// and Shutdown.
+	servers []*http.Server
+}
+
+// New returns a new properly initialized block page server.  c must not be
+// nil.
+func New(ctx context.Context, c *Config) (s *Server, err error) {
+	s = &Server{
+		logger:     c.Logger,
+		listNamer:  c.ListNamer,
+		unblocker:  c.Unblocker,
+		unblockURL: c.UnblockURL,
+		httpAddrs:  c.HTTPAddrs,
+		httpsAddrs: c.HTTPSAddrs,
+	}
+
+	cacheSize := c.CacheSize
+	if cacheSize == 0 {
+		cacheSize = defaultCacheSize
+	}
+
+	s.blocked = gcache.New(cacheSize).LRU().Build()
+
+	s.ca, err = newAuthority(ctx, c.Logger, c.DataDir, s.isBlocked)
+	if err != nil {
+		return nil, fmt.Errorf("initializing certificate authority: %w", err)
+	}
+
+	c.HTTPReg.Register(http.MethodGet, "/control/block_page/ca", s.handleCA)
+
+	return s, nil
+}
+
+// Start starts serving the block page on the configured addresses.  It
+// returns an error if any of the addresses can't be listened on.
+func (s *Server) Start(ctx context.Context) (err error) {
+	for _, addr := range s.httpAddrs {
+		err = s.serve(ctx, addr, false)
+		if err != nil {
+			return fmt.Errorf("starting http server on %s: %w", addr, err)
+		}
+	}
+
+	for _, addr := range s.httpsAddrs {
+		err = s.serve(ctx, addr, true)
+		if err != nil {
+			return fmt.Errorf("starting https server on %s: %w", addr, err)
+		}
+	}
+
+	return nil
+}
+
+// serve starts serving the block page on addr in a separate goroutine.
+func (s *Server) serve(ctx context.Context, addr netip.AddrPort, isHTTPS bool) (err error) {
+	l, err := net.Listen("tcp", addr.String())
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	logger := s.logger.With("addr", addr, "https", isHTTPS)
+	srv := &http.Server{
+		Handler:           http.HandlerFunc(s.handleBlockPage),
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readTimeout,
+		WriteTimeout:      writeTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelDebug),
+	}
+
+	if isHTTPS {
+		srv.TLSConfig = s.ca.tlsConfig()
+	}
+
+	s.servers = append(s.servers, srv)
+
+	go func() {
+		defer slogutil.RecoverAndLog(ctx, logger)
+
+		var serveErr error
+		if isHTTPS {
+			serveErr = srv.ServeTLS(l, "", "")
+		} else {
+			serveErr = srv.Serve(l)
+		}
+
+		if !errors.Is(serveErr, http.ErrServerClosed) {
+			logger.ErrorContext(ctx, "serving block page", slogutil.KeyError, serveErr)
+		}
+	}()
+
+	logger.InfoContext(ctx, "serving block page")
+
+	return nil
+}
+
+// Shutdown stops serving the block page.
+func (s *Server) Shutdown(ctx context.Context) (err error) {
+	var errs []error
+	for _, srv := range s.servers {
+		err = srv.Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	s.servers = nil
+
+	return errors.Join(errs...)
+}
+
+// recordKey is the key of a recorded blocked request.
+type recordKey struct {
+	// host is the blocked domain name in lower case.
+	host string
+
+	// client is the address of the client that has sent the request.  It's
+	// invalid for the record of the last blocked request for host from any
+	// client.
+	client netip.Addr
+}
+
+// record is the information about a blocked request.
+type record struct {
+	// rule is the text of the blocking rule, if any.
+	rule string
+
+	// serviceName is the name of the blocked service, if any.
+	serviceName string
+
+	// reason is the reason of blocking.
+	reason filtering.Reason
+
+	// listID is the ID of the filter list containing rule.
+	listID rulelist.APIID
+}
+
+// RecordBlocked saves the result of filtering of a request for host from
+// client, so that the block page can explain why it has been blocked.  It is
+// safe for concurrent use.
+func (s *Server) RecordBlocked(
+	ctx context.Context,
+	client netip.Addr,
+	host string,
+	res *filtering.Result,
+) {
+	rec := &record{
+		serviceName: res.ServiceName,
+		reason:      res.Reason,
+	}
+
+	if len(res.Rules) > 0 {
+		rec.rule = res.Rules[0].Text
+		rec.listID = res.Rules[0].FilterListID
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, k := range []recordKey{{
+		host:   host,
+		client: client.Unmap(),
+	}, {
+		host: host,
+	}} {
+		err := s.blocked.Set(k, rec)
+		if err != nil {
+			// Shouldn't happen, since the cache has no loader and no
+			// expiration.
+			s.logger.DebugContext(ctx, "recording blocked host", slogutil.KeyError, err)
+		}
+	}
+}
+
+// find returns the record of the last blocked request for host from client or,
+// if there is none, from any client.  rec is nil if host hasn't been blocked.
+func (s *Server) find(client netip.Addr, host string) (rec *record) {
+	for _, k := range []recordKey{{
+		host:   host,
+		client: client.Unmap(),
+	}, {
+		host: host,
+	}} {
+		val, err := s.blocked.Get(k)
+		if err == nil {
+			return val.(*record)
+		}
+	}
+
+	return nil
+}
+
+// isBlocked returns true if there is a record of a blocked request for host in
+// lower case from any client.
+func (s *Server) isBlocked(host string) (ok bool) {
+	return s.blocked.Has(recordKey{host: host})
+}
+
+// handleBlockPage is the handler serving the block page for any path on any
+// host.
+func (s *Server) handleBlockPage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	var client netip.Addr
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		client = addrPort.Addr()
+	}
+
+	data := s.pageData(host, s.find(client, host))
+
+	code := http.StatusForbidden
+	if r.Method == http.MethodPost && r.URL.Path == unblockRequestPath && data.UnblockForm {
+		code = s.submitUnblockRequest(w, r, client, data)
+	}
+
+	h := w.Header()
+	h.Set(httphdr.CacheControl, "no-store")
+	h.Set(httphdr.ContentType, "text/html; charset=utf-8")
+	w.WriteHeader(code)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	err := pageTmpl.Execute(w, data)
+	if err != nil {
+		s.logger.DebugContext(ctx, "writing block page", "host", host, slogutil.KeyError, err)
+	}
+}
+
+// submitUnblockRequest saves the request to unblock the host from data
+// submitted with the block page form and sets the message shown to the client.
+// code is the HTTP status code of the response.
+func (s *Server) submitUnblockRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	client netip.Addr,
+	data *pageData,
+) (code int) {
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnblockFormSize)
+	err := r.ParseForm()
+	if err == nil {
+		err = s.unblocker.SubmitUnblockRequest(ctx, client, data.Host, r.PostForm.Get("justification"))
+	}
+
+	if err != nil {
+		s.logger.DebugContext(ctx, "submitting unblock request", "host", data.Host, slogutil.KeyError, err)
+
+		data.Message = "The request hasn't been submitted: " + err.Error()
+		data.IsError = true
+
+		return http.StatusBadRequest
+	}
+
+	data.Message = "The request has been submitted.  The domain will be unblocked once an administrator approves it."
+	data.UnblockForm = false
+
+	return http.StatusOK
+}
+
+// handleCA is the handler for the GET /control/block_page/ca HTTP API.  It
+// returns the certificate of the authority issuing the certificates of the
+// HTTPS block page, so that it can be installed on the clients.
+func (s *Server) handleCA(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set(httphdr.ContentType, "application/x-pem-file")
+	h.Set(httphdr.ContentDisposition, `attachment; filename="adguardhome_block_page_ca.pem"`)
+
+	_, err := w.Write(s.ca.certPEM)
+	if err != nil {
+		s.logger.DebugContext(r.Context(), "writing ca certificate", slogutil.KeyError, err)
+	}
+}
@@ -0,0 +1,285 @@
+package blockpage
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testListID is the ID of the filter list used in tests.
+const testListID rulelist.APIID = 42
+
+// testListNamer is a [ListNamer] for tests.
+type testListNamer struct{}
+
+// type check
+var _ ListNamer = testListNamer{}
+
+// FilterListName implements the [ListNamer] interface for testListNamer.
+func (testListNamer) FilterListName(id rulelist.APIID) (name string) {
+	if id == testListID {
+		return "Test List"
+	}
+
+	return ""
+}
+
+// testUnblocker is an [Unblocker] for tests.
+type testUnblocker struct {
+	onSubmitUnblockRequest func(
+		ctx context.Context,
+		client netip.Addr,
+		domain string,
+		justification string,
+	) (err error)
+}
+
+// type check
+var _ Unblocker = (*testUnblocker)(nil)
+
+// SubmitUnblockRequest implements the [Unblocker] interface for
+// *testUnblocker.
+func (u *testUnblocker) SubmitUnblockRequest(
+	ctx context.Context,
+	client netip.Addr,
+	domain string,
+	justification string,
+) (err error) {
+	return u.onSubmitUnblockRequest(ctx, client, domain, justification)
+}
+
+// newTestServer returns a new block page server storing its data in dataDir.
+func newTestServer(tb testing.TB, dataDir string) (s *Server) {
+	tb.Helper()
+
+	s, err := New(testutil.ContextWithTimeout(tb, testTimeout), &Config{
+		Logger:     slogutil.NewDiscardLogger(),
+		ListNamer:  testListNamer{},
+		HTTPReg:    aghhttp.EmptyRegistrar{},
+		DataDir:    dataDir,
+		UnblockURL: "http://adguard.example/unblock",
+	})
+	require.NoError(tb, err)
+
+	return s
+}
+
+func TestServer_handleBlockPage(t *testing.T) {
+	s := newTestServer(t, t.TempDir())
+
+	clientAddr := netip.MustParseAddr("192.0.2.1")
+	otherAddr := netip.MustParseAddr("192.0.2.2")
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s.RecordBlocked(ctx, clientAddr, "Ads.Example.", &filtering.Result{
+		Rules: []*filtering.ResultRule{{
+			Text:         "||ads.example^",
+			FilterListID: testListID,
+		}},
+		Reason:     filtering.FilteredBlockList,
+		IsFiltered: true,
+	})
+
+	s.RecordBlocked(ctx, otherAddr, "ads.example", &filtering.Result{
+		ServiceName: "Example Service",
+		Reason:      filtering.FilteredBlockedService,
+		IsFiltered:  true,
+	})
+
+	testCases := []struct {
+		name         string
+		host         string
+		remote       netip.Addr
+		wantContains []string
+		wantMissing  []string
+	}{{
+		name:   "same_client",
+		host:   "ads.example",
+		remote: clientAddr,
+		wantContains: []string{
+			"ads.example",
+			"||ads.example^",
+			"Test List",
+			"http://adguard.example/unblock?domain=ads.example",
+		},
+		wantMissing: []string{"Example Service"},
+	}, {
+		name:         "other_client",
+		host:         "ads.example:443",
+		remote:       netip.MustParseAddr("192.0.2.3"),
+		wantContains: []string{"Access to Example Service has been blocked."},
+		wantMissing:  []string{"Test List"},
+	}, {
+		name:         "unknown",
+		host:         "unknown.example",
+		remote:       clientAddr,
+		wantContains: []string{"unknown.example", "has been blocked by AdGuard Home"},
+		wantMissing:  []string{"Filter list"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://"+tc.host+"/path", nil)
+			r.RemoteAddr = netip.AddrPortFrom(tc.remote, 12345).String()
+
+			w := httptest.NewRecorder()
+			s.handleBlockPage(w, r)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+
+			body := w.Body.String()
+			for _, want := range tc.wantContains {
+				assert.Contains(t, body, want)
+			}
+
+			for _, missing := range tc.wantMissing {
+				assert.NotContains(t, body, missing)
+			}
+		})
+	}
+}
+
+func TestServer_handleBlockPage_unblockRequest(t *testing.T) {
+	clientAddr := netip.MustParseAddr("192.0.2.1")
+
+	var gotDomain, gotJustification string
+	s, err := New(testutil.ContextWithTimeout(t, testTimeout), &Config{
+		Logger:    slogutil.NewDiscardLogger(),
+		ListNamer: testListNamer{},
+		Unblocker: &testUnblocker{
+			onSubmitUnblockRequest: func(
+				_ context.Context,
+				client netip.Addr,
+				domain string,
+				justification string,
+			) (err error) {
+				assert.Equal(t, clientAddr, client)
+
+				if justification == "" {
+					return errors.Error("no justification")
+				}
+
+				gotDomain, gotJustification = domain, justification
+
+				return nil
+			},
+		},
+		HTTPReg:    aghhttp.EmptyRegistrar{},
+		DataDir:    t.TempDir(),
+		UnblockURL: "http://adguard.example/unblock",
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		method        string
+		justification string
+		wantContains  string
+		wantCode      int
+	}{{
+		name:         "form",
+		method:       http.MethodGet,
+		wantContains: `<form method="post" action="` + unblockRequestPath + `">`,
+		wantCode:     http.StatusForbidden,
+	}, {
+		name:          "submitted",
+		method:        http.MethodPost,
+		justification: "needed for work",
+		wantContains:  "The request has been submitted.",
+		wantCode:      http.StatusOK,
+	}, {
+		name:          "error",
+		method:        http.MethodPost,
+		justification: "",
+		wantContains:  "The request hasn&#39;t been submitted: no justification",
+		wantCode:      http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{"justification": []string{tc.justification}}
+			r := httptest.NewRequest(
+				tc.method,
+				"http://ads.example"+unblockRequestPath,
+				strings.NewReader(form.Encode()),
+			)
+			r.Header.Set(httphdr.ContentType, "application/x-www-form-urlencoded")
+			r.RemoteAddr = netip.AddrPortFrom(clientAddr, 12345).String()
+
+			w := httptest.NewRecorder()
+			s.handleBlockPage(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+
+			body := w.Body.String()
+			assert.Contains(t, body, tc.wantContains)
+			assert.NotContains(t, body, "http://adguard.example/unblock")
+		})
+	}
+
+	assert.Equal(t, "ads.example", gotDomain)
+	assert.Equal(t, "needed for work", gotJustification)
+}
+
+func TestAuthority(t *testing.T) {
+	dataDir := t.TempDir()
+	s := newTestServer(t, dataDir)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(s.ca.certPEM))
+
+	_, err := s.ca.getCertificate(&tls.ClientHelloInfo{ServerName: "ads.example"})
+	require.ErrorIs(t, err, errNotBlocked)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s.RecordBlocked(ctx, netip.MustParseAddr("192.0.2.1"), "ads.example", &filtering.Result{
+		Reason: filtering.FilteredBlockList,
+	})
+
+	cert, err := s.ca.getCertificate(&tls.ClientHelloInfo{ServerName: "Ads.Example"})
+	require.NoError(t, err)
+
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		DNSName: "ads.example",
+		Roots:   roots,
+	})
+	require.NoError(t, err)
+
+	cached, err := s.ca.getCertificate(&tls.ClientHelloInfo{ServerName: "ads.example"})
+	require.NoError(t, err)
+
+	assert.Same(t, cert, cached)
+
+	_, err = s.ca.getCertificate(&tls.ClientHelloInfo{ServerName: "bad name"})
+	assert.Error(t, err)
+
+	_, err = s.ca.getCertificate(&tls.ClientHelloInfo{ServerName: ""})
+	assert.ErrorIs(t, err, errNoServerName)
+
+	_, err = s.ca.getCertificate(&tls.ClientHelloInfo{ServerName: "bank.example"})
+	assert.ErrorIs(t, err, errNotBlocked)
+
+	// The authority must be loaded from the data directory on restart.
+	restarted := newTestServer(t, dataDir)
+	assert.Equal(t, s.ca.certPEM, restarted.ca.certPEM)
+}
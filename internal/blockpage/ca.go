@@ -0,0 +1,376 @@
+package blockpage
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/bluele/gcache"
+)
+
+const (
+	// caCertFile is the name of the file with the PEM-encoded certificate of
+	// the certificate authority.
+	caCertFile = "ca.pem"
+
+	// caKeyFile is the name of the file with the PEM-encoded private key of the
+	// certificate authority.
+	caKeyFile = "ca.key"
+
+	// caValidity is the validity period of the generated certificate
+	// authority.
+	caValidity = 10 * 365 * 24 * time.Hour
+
+	// leafValidity is the validity period of the certificates issued for the
+	// blocked domains.
+	leafValidity = 30 * 24 * time.Hour
+
+	// leafCacheSize is the maximum number of the cached issued certificates.
+	leafCacheSize = 1_000
+)
+
+const (
+	// errNoServerName is returned when the client doesn't send the server
+	// name.
+	errNoServerName errors.Error = "no server name"
+
+	// errNotBlocked is returned when the client requests a certificate for a
+	// host that hasn't been blocked recently.
+	errNotBlocked errors.Error = "host hasn't been blocked"
+)
+
+// PEM block types.
+const (
+	pemTypeCert = "CERTIFICATE"
+	pemTypeKey  = "PRIVATE KEY"
+)
+
+// authority is the locally generated certificate authority issuing the
+// certificates for the HTTPS block page.  The certificate of the authority
+// must be installed on the clients to avoid the browser warnings.  Since the
+// clients trust it, it only issues the certificates for the blocked hosts.
+type authority struct {
+	// isBlocked returns true if host has been blocked recently.  It must not be
+	// nil.
+	isBlocked func(host string) (ok bool)
+
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	leafKey *ecdsa.PrivateKey
+	leaves  gcache.Cache
+	certPEM []byte
+}
+
+// newAuthority loads the certificate authority from dir or generates and
+// stores a new one, if there is none or it has expired.  isBlocked must not be
+// nil, see [authority.isBlocked].
+func newAuthority(
+	ctx context.Context,
+	l *slog.Logger,
+	dir string,
+	isBlocked func(host string) (ok bool),
+) (a *authority, err error) {
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating leaf key: %w", err)
+	}
+
+	a = &authority{
+		isBlocked: isBlocked,
+		leafKey:   leafKey,
+		leaves:    gcache.New(leafCacheSize).LRU().Build(),
+	}
+
+	certPath, keyPath := filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile)
+	err = a.load(certPath, keyPath)
+	switch {
+	case err == nil && time.Now().Before(a.cert.NotAfter):
+		return a, nil
+	case err == nil:
+		l.WarnContext(ctx, "certificate authority has expired; generating new one")
+	case errors.Is(err, fs.ErrNotExist):
+		l.InfoContext(ctx, "generating certificate authority", "dir", dir)
+	default:
+		return nil, fmt.Errorf("loading: %w", err)
+	}
+
+	err = a.generate()
+	if err != nil {
+		return nil, fmt.Errorf("generating: %w", err)
+	}
+
+	err = a.store(dir, certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("storing: %w", err)
+	}
+
+	return a, nil
+}
+
+// load reads the certificate and the private key of the authority from the
+// files.
+func (a *authority) load(certPath, keyPath string) (err error) {
+	// #nosec G304 -- Trust the paths constructed from the configured data
+	// directory.
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		// Don't wrap the error, because it's checked with errors.Is.
+		return err
+	}
+
+	// #nosec G304 -- Trust the paths constructed from the configured data
+	// directory.
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		// Don't wrap the error, because it's checked with errors.Is.
+		return err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil || certBlock.Type != pemTypeCert {
+		return fmt.Errorf("%s: no certificate", certPath)
+	}
+
+	a.cert, err = x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil || keyBlock.Type != pemTypeKey {
+		return fmt.Errorf("%s: no private key", keyPath)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("parsing private key: %w", err)
+	}
+
+	var ok bool
+	a.key, ok = key.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("private key: unexpected type %T", key)
+	}
+
+	a.certPEM = certPEM
+
+	return nil
+}
+
+// generate generates a new self-signed certificate authority.
+func (a *authority) generate() (err error) {
+	a.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "AdGuard Home Block Page CA",
+			Organization: []string{"AdGuard Home"},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, a.key.Public(), a.key)
+	if err != nil {
+		return fmt.Errorf("creating certificate: %w", err)
+	}
+
+	a.cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	a.certPEM = pem.EncodeToMemory(&pem.Block{Type: pemTypeCert, Bytes: der})
+
+	return nil
+}
+
+// store writes the certificate and the private key of the authority to the
+// files in dir.
+func (a *authority) store(dir, certPath, keyPath string) (err error) {
+	err = os.MkdirAll(dir, aghos.DefaultPermDir)
+	if err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(a.key)
+	if err != nil {
+		return fmt.Errorf("encoding private key: %w", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: pemTypeKey, Bytes: keyDER})
+	err = writeFile(keyPath, keyPEM)
+	if err != nil {
+		return fmt.Errorf("writing private key: %w", err)
+	}
+
+	err = writeFile(certPath, a.certPEM)
+	if err != nil {
+		return fmt.Errorf("writing certificate: %w", err)
+	}
+
+	return nil
+}
+
+// writeFile atomically replaces the contents of the file with data.
+func writeFile(filePath string, data []byte) (err error) {
+	f, err := aghrenameio.NewPendingFile(filePath, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer func() { err = aghrenameio.WithDeferredCleanup(err, f) }()
+
+	_, err = f.Write(data)
+	if err != nil {
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+
+	return nil
+}
+
+// tlsConfig returns the TLS configuration issuing the certificates for the
+// requested server names.
+func (a *authority) tlsConfig() (conf *tls.Config) {
+	return &tls.Config{
+		GetCertificate: a.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// getCertificate returns the certificate for the server name requested by the
+// client, issuing it if necessary.  It's used as [tls.Config.GetCertificate].
+// The handshake is refused for the hosts that haven't been blocked recently, so
+// that the authority can't be used to impersonate arbitrary hosts.
+func (a *authority) getCertificate(hello *tls.ClientHelloInfo) (cert *tls.Certificate, err error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return nil, errNoServerName
+	} else if err = validateHost(name); err != nil {
+		return nil, fmt.Errorf("server name: %w", err)
+	} else if !a.isBlocked(name) {
+		return nil, fmt.Errorf("server name %q: %w", name, errNotBlocked)
+	}
+
+	if val, cacheErr := a.leaves.Get(name); cacheErr == nil {
+		cert = val.(*tls.Certificate)
+		if time.Now().Before(cert.Leaf.NotAfter) {
+			return cert, nil
+		}
+	}
+
+	cert, err = a.issue(name)
+	if err != nil {
+		return nil, fmt.Errorf("issuing certificate for %q: %w", name, err)
+	}
+
+	err = a.leaves.Set(name, cert)
+	if err != nil {
+		// Shouldn't happen, since the cache has no loader and no expiration.
+		return nil, fmt.Errorf("caching certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// issue issues a new certificate for the domain name or the IP address.
+func (a *authority) issue(name string) (cert *tls.Certificate, err error) {
+	serial, err := newSerial()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(a.cert.NotAfter) {
+		notAfter = a.cert.NotAfter
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: name,
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if ip, parseErr := netip.ParseAddr(name); parseErr == nil {
+		tmpl.IPAddresses = append(tmpl.IPAddresses, ip.AsSlice())
+	} else {
+		tmpl.DNSNames = append(tmpl.DNSNames, name)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, a.leafKey.Public(), a.key)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, a.cert.Raw},
+		PrivateKey:  a.leafKey,
+		Leaf:        leaf,
+	}, nil
+}
+
+// newSerial returns a new random serial number for a certificate.
+func newSerial() (serial *big.Int, err error) {
+	// Use 128 bits, as recommended by RFC 5280.
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err = rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+
+	return serial, nil
+}
+
+// validateHost returns an error if host isn't a valid domain name or IP
+// address.
+func validateHost(host string) (err error) {
+	if _, err = netip.ParseAddr(host); err == nil {
+		return nil
+	}
+
+	return netutil.ValidateHostname(host)
+}
@@ -0,0 +1,175 @@
+package blockpage
+
+import (
+	"html/template"
+	"net/url"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+)
+
+// pageData is the data for the block page template.
+type pageData struct {
+	// Host is the blocked domain name.
+	Host string
+
+	// Reason is the human-readable reason of blocking.
+	Reason string
+
+	// Rule is the text of the blocking rule, if any.
+	Rule string
+
+	// ListName is the name of the filter list containing Rule, if any.
+	ListName string
+
+	// UnblockURL is the URL of the page to request unblocking of Host.  If it's
+	// empty, the link is not shown.
+	UnblockURL string
+
+	// UnblockRequestPath is the path to submit the form to request unblocking
+	// of Host to.
+	UnblockRequestPath string
+
+	// Message is the result of the submission of the form to request
+	// unblocking, if any.
+	Message string
+
+	// IsError is true if Message describes an error.
+	IsError bool
+
+	// UnblockForm defines if the form to request unblocking of Host is shown.
+	UnblockForm bool
+}
+
+// pageData returns the data for the block page of host.  rec may be nil if the
+// blocked request for host hasn't been recorded.
+func (s *Server) pageData(host string, rec *record) (data *pageData) {
+	data = &pageData{
+		Host:               host,
+		Reason:             "This domain has been blocked by AdGuard Home.",
+		UnblockRequestPath: unblockRequestPath,
+		UnblockForm:        s.unblocker != nil,
+	}
+
+	if s.unblockURL != "" && s.unblocker == nil {
+		data.UnblockURL = unblockURL(s.unblockURL, host)
+	}
+
+	if rec == nil {
+		return data
+	}
+
+	data.Reason = reasonText(rec)
+	data.Rule = rec.rule
+	if rec.rule != "" {
+		data.ListName = s.listName(rec.listID)
+	}
+
+	return data
+}
+
+// listName returns the human-readable name of the filter list with the given
+// ID.
+func (s *Server) listName(id rulelist.APIID) (name string) {
+	switch id {
+	case rulelist.APIIDCustom:
+		return "Custom filtering rules"
+	case rulelist.APIIDClientCustom:
+		return "Custom filtering rules of the client"
+	case rulelist.APIIDBlockedService:
+		return "Blocked services"
+	default:
+		return s.listNamer.FilterListName(id)
+	}
+}
+
+// reasonText returns the human-readable reason of blocking for rec.
+func reasonText(rec *record) (text string) {
+	switch rec.reason {
+	case filtering.FilteredBlockList:
+		return "This domain has been blocked by a filtering rule."
+	case filtering.FilteredBlockedService:
+		if rec.serviceName != "" {
+			return "Access to " + rec.serviceName + " has been blocked."
+		}
+
+		return "Access to this service has been blocked."
+	case filtering.FilteredParental:
+		return "This domain has been blocked by the parental control."
+	case filtering.FilteredSafeBrowsing:
+		return "This domain has been blocked as a known malicious or phishing one."
+	default:
+		return "This domain has been blocked by AdGuard Home (" + rec.reason.String() + ")."
+	}
+}
+
+// unblockURL returns the URL of the page to request unblocking of host.
+func unblockURL(base, host string) (u string) {
+	parsed, err := url.Parse(base)
+	if err != nil {
+		// Don't show the link, since the URL has been validated.
+		return ""
+	}
+
+	q := parsed.Query()
+	q.Set("domain", host)
+	parsed.RawQuery = q.Encode()
+
+	return parsed.String()
+}
+
+// pageTmpl is the template of the block page.
+var pageTmpl = template.Must(template.New("blockpage").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Blocked by AdGuard Home</title>
+<style>
+body { font-family: sans-serif; background: #f5f5f5; color: #333; margin: 0; }
+main { max-width: 40em; margin: 10vh auto; padding: 2em; background: #fff; border-radius: 8px; }
+h1 { font-size: 1.5em; margin-top: 0; }
+dt { font-weight: bold; margin-top: 1em; }
+dd { margin: 0.25em 0 0; word-break: break-all; }
+code { background: #f0f0f0; padding: 0.1em 0.3em; }
+.message { margin-top: 1.5em; padding: 0.5em 1em; background: #e8f5ec; border-radius: 4px; }
+.message.error { background: #fbe9e9; }
+textarea { box-sizing: border-box; width: 100%; min-height: 6em; margin-top: 0.5em; font: inherit; }
+button { margin-top: 0.5em; padding: 0.5em 1em; background: #67b279; color: #fff; border: 0; border-radius: 4px; font: inherit; cursor: pointer; }
+a.button { display: inline-block; margin-top: 1.5em; padding: 0.5em 1em; background: #67b279; color: #fff; text-decoration: none; border-radius: 4px; }
+</style>
+</head>
+<body>
+<main>
+<h1>Access to {{.Host}} is blocked</h1>
+<p>{{.Reason}}</p>
+<dl>
+<dt>Domain</dt>
+<dd>{{.Host}}</dd>
+{{- if .Rule}}
+<dt>Rule</dt>
+<dd><code>{{.Rule}}</code></dd>
+{{- end}}
+{{- if .ListName}}
+<dt>Filter list</dt>
+<dd>{{.ListName}}</dd>
+{{- end}}
+</dl>
+{{- if .Message}}
+<p class="message{{if .IsError}} error{{end}}">{{.Message}}</p>
+{{- end}}
+{{- if .UnblockForm}}
+<form method="post" action="{{.UnblockRequestPath}}">
+<label for="justification">Explain why this domain should be unblocked:</label>
+<textarea id="justification" name="justification" maxlength="1024" required></textarea>
+<button type="submit">Request unblocking</button>
+</form>
+{{- end}}
+{{- if .UnblockURL}}
+<a class="button" href="{{.UnblockURL}}">Request unblocking</a>
+{{- end}}
+</main>
+</body>
+</html>
+`))
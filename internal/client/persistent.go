@@ -9,6 +9,7 @@ import (
 	"net/netip"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghslog"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
@@ -61,6 +62,9 @@ type Persistent struct {
 	// SafeSearch handles search engine hosts rewrites.
 	SafeSearch filtering.SafeSearch
 
+	// ClientRules are the compiled UserRules.  It's nil if there are no rules.
+	ClientRules *filtering.ClientRules
+
 	// BlockedServices is the configuration of blocked services of a client.  It
 	// must not be nil after initialization.
 	BlockedServices *filtering.BlockedServices
@@ -71,6 +75,21 @@ type Persistent struct {
 	// Tags is a list of client tags that categorize the client.
 	Tags []string
 
+	// FilterGroups are the names of the filter groups selected for the client
+	// in addition to the ones selected by its tags.
+	FilterGroups []string
+
+	// Schedules are the filtering settings applied to the client within the
+	// time ranges of their schedules.  Items must not be nil.
+	Schedules []*filtering.ScheduledSettings
+
+	// Checkers are the names of the named checkers applied to the client if it
+	// uses its own settings.
+	Checkers []string
+
+	// UserRules are the custom filtering rules applied only to the client.
+	UserRules []string
+
 	// Upstreams is a list of custom upstream DNS servers for the client.  If
 	// it's empty, the custom upstream cache is disabled, regardless of the
 	// value of UpstreamsCacheEnabled.
@@ -94,6 +113,10 @@ type Persistent struct {
 	// (IP, subnet, MAC, or ClientID).
 	ClientIDs []ClientID
 
+	// ProtectionPausedUntil is the time until which the protection is paused
+	// for the client.  If it's zero, the protection isn't paused.
+	ProtectionPausedUntil time.Time
+
 	// UID is the unique identifier of the persistent client.
 	UID UID
 
@@ -162,6 +185,19 @@ func (c *Persistent) validate(ctx context.Context, l *slog.Logger, allTags []str
 		}
 	}
 
+	if slices.Contains(c.FilterGroups, "") {
+		return fmt.Errorf("filter groups: %w", errors.ErrEmptyValue)
+	}
+
+	if slices.Contains(c.Checkers, "") {
+		return fmt.Errorf("checkers: %w", errors.ErrEmptyValue)
+	}
+
+	err = filtering.ValidateScheduledSettings(c.Schedules)
+	if err != nil {
+		return fmt.Errorf("schedules: %w", err)
+	}
+
 	// TODO(s.chzhen):  Move to the constructor.
 	slices.Sort(c.Tags)
 
@@ -295,6 +331,10 @@ func (c *Persistent) ShallowClone() (clone *Persistent) {
 
 	clone.BlockedServices = c.BlockedServices.Clone()
 	clone.Tags = slices.Clone(c.Tags)
+	clone.FilterGroups = slices.Clone(c.FilterGroups)
+	clone.Schedules = filtering.CloneScheduledSettings(c.Schedules)
+	clone.Checkers = slices.Clone(c.Checkers)
+	clone.UserRules = slices.Clone(c.UserRules)
 	clone.Upstreams = slices.Clone(c.Upstreams)
 
 	clone.IPs = slices.Clone(c.IPs)
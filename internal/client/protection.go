@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// isProtectionPaused returns true if the protection is paused for the
+// persistent client c or for any of its tags.  c must not be nil.
+func (s *Storage) isProtectionPaused(c *Persistent) (ok bool) {
+	now := s.clock.Now()
+	if now.Before(c.ProtectionPausedUntil) {
+		return true
+	}
+
+	if len(c.Tags) == 0 {
+		return false
+	}
+
+	s.tagPausesMu.RLock()
+	defer s.tagPausesMu.RUnlock()
+
+	for _, t := range c.Tags {
+		if now.Before(s.tagPauses[t]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PauseClientProtection pauses the protection for the persistent client with
+// the given name until the given time.  If until is zero, the protection is
+// resumed.
+func (s *Storage) PauseClientProtection(ctx context.Context, name string, until time.Time) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.index.findByName(name)
+	if !ok {
+		return fmt.Errorf("client %q is not found", name)
+	}
+
+	// Replace the client instead of changing it in place, since it's read
+	// during filtering without locking.
+	p := stored.ShallowClone()
+	p.ProtectionPausedUntil = until
+
+	s.index.remove(stored)
+	s.index.add(p)
+
+	s.logger.DebugContext(ctx, "paused client protection", "name", name, "until", until)
+
+	return nil
+}
+
+// PauseTagProtection pauses the protection for all persistent clients with the
+// tag until the given time.  If until is zero, the protection is resumed.
+func (s *Storage) PauseTagProtection(ctx context.Context, tag string, until time.Time) (err error) {
+	if _, ok := slices.BinarySearch(s.allowedTags, tag); !ok {
+		return fmt.Errorf("tag: %w: %q", errors.ErrBadEnumValue, tag)
+	}
+
+	s.tagPausesMu.Lock()
+	defer s.tagPausesMu.Unlock()
+
+	if until.IsZero() {
+		delete(s.tagPauses, tag)
+	} else {
+		s.tagPauses[tag] = until
+	}
+
+	s.logger.DebugContext(ctx, "paused tag protection", "tag", tag, "until", until)
+
+	return nil
+}
+
+// TagProtectionPauses returns the times until which the protection is paused
+// for the clients with the tags.  The expired pauses are not included.
+func (s *Storage) TagProtectionPauses() (pauses map[string]time.Time) {
+	now := s.clock.Now()
+
+	s.tagPausesMu.RLock()
+	defer s.tagPausesMu.RUnlock()
+
+	pauses = maps.Clone(s.tagPauses)
+	maps.DeleteFunc(pauses, func(_ string, until time.Time) (ok bool) {
+		return !now.Before(until)
+	})
+
+	return pauses
+}
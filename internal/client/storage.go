@@ -114,6 +114,11 @@ type StorageConfig struct {
 	// configuration file.  Each client must not be nil.
 	InitialClients []*Persistent
 
+	// InitialTagPauses are the times until which the protection is paused for
+	// the clients with the tags, parsed from the configuration file.  The keys
+	// must be allowed tags.
+	InitialTagPauses map[string]time.Time
+
 	// ARPClientsUpdatePeriod defines how often [SourceARP] runtime client
 	// information is updated.
 	ARPClientsUpdatePeriod time.Duration
@@ -135,6 +140,17 @@ type Storage struct {
 	// index contains information about persistent clients.
 	index *index
 
+	// tagPausesMu protects tagPauses.  It's separate from mu, since tagPauses
+	// are read on each request from a client with tags.
+	tagPausesMu *sync.RWMutex
+
+	// tagPauses are the times until which the protection is paused for the
+	// clients with the tags.  It's protected by tagPausesMu.
+	tagPauses map[string]time.Time
+
+	// clock is used to check if the protection is paused.  It must not be nil.
+	clock timeutil.Clock
+
 	// runtimeIndex contains information about runtime clients.
 	runtimeIndex *runtimeIndex
 
@@ -177,6 +193,9 @@ func NewStorage(ctx context.Context, conf *StorageConfig) (s *Storage, err error
 		logger:                 conf.Logger,
 		mu:                     &sync.Mutex{},
 		index:                  newIndex(),
+		tagPausesMu:            &sync.RWMutex{},
+		tagPauses:              map[string]time.Time{},
+		clock:                  conf.Clock,
 		runtimeIndex:           newRuntimeIndex(),
 		upstreamManager:        newUpstreamManager(conf.BaseLogger, conf.Clock),
 		dhcp:                   conf.DHCP,
@@ -195,6 +214,14 @@ func NewStorage(ctx context.Context, conf *StorageConfig) (s *Storage, err error
 		}
 	}
 
+	for tag, until := range conf.InitialTagPauses {
+		err = s.PauseTagProtection(ctx, tag, until)
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return nil, err
+		}
+	}
+
 	s.ReloadARP(ctx)
 
 	return s, nil
@@ -810,8 +837,20 @@ func (s *Storage) ApplyClientFiltering(id string, addr netip.Addr, setts *filter
 		setts.BlockedServices = c.BlockedServices.Clone()
 	}
 
+	if s.isProtectionPaused(c) {
+		s.logger.Debug("protection is paused", "client_name", c.Name)
+
+		setts.ProtectionEnabled = false
+	}
+
 	setts.ClientName = c.Name
 	setts.ClientTags = slices.Clone(c.Tags)
+	setts.FilterGroups = slices.Clone(c.FilterGroups)
+	setts.ClientSchedules = c.Schedules
+	if c.ClientRules != nil {
+		setts.ClientRules = append(setts.ClientRules, c.ClientRules)
+	}
+
 	if !c.UseOwnSettings {
 		return
 	}
@@ -821,4 +860,5 @@ func (s *Storage) ApplyClientFiltering(id string, addr netip.Addr, setts *filter
 	setts.ClientSafeSearch = c.SafeSearch
 	setts.SafeBrowsingEnabled = c.SafeBrowsingEnabled
 	setts.ParentalEnabled = c.ParentalEnabled
+	setts.Checkers = slices.Clone(c.Checkers)
 }
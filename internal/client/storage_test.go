@@ -15,6 +15,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/hostsfile"
@@ -1470,3 +1471,86 @@ func BenchmarkStorage_Find(b *testing.B) {
 	//	BenchmarkStorage_Find/subnet-8            	 7209050	       167.5 ns/op	     256 B/op	       2 allocs/op
 	//	BenchmarkStorage_Find/mac_address-8       	 5776131	       199.7 ns/op	     256 B/op	       3 allocs/op
 }
+
+func TestStorage_PauseProtection(t *testing.T) {
+	var (
+		laptopIP = netip.MustParseAddr("192.0.2.1")
+		tabletIP = netip.MustParseAddr("192.0.2.2")
+	)
+
+	now := time.Now()
+	clock := &faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	}
+
+	s := newTestStorage(t, clock)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	err := s.Add(ctx, &client.Persistent{
+		Name: "laptop",
+		IPs:  []netip.Addr{laptopIP},
+		UID:  client.MustNewUID(),
+	})
+	require.NoError(t, err)
+
+	err = s.Add(ctx, &client.Persistent{
+		Name: "tablet",
+		IPs:  []netip.Addr{tabletIP},
+		Tags: []string{"user_child"},
+		UID:  client.MustNewUID(),
+	})
+	require.NoError(t, err)
+
+	isEnabled := func(addr netip.Addr) (ok bool) {
+		setts := &filtering.Settings{ProtectionEnabled: true}
+		s.ApplyClientFiltering("", addr, setts)
+
+		return setts.ProtectionEnabled
+	}
+
+	require.True(t, isEnabled(laptopIP))
+	require.True(t, isEnabled(tabletIP))
+
+	t.Run("client", func(t *testing.T) {
+		err = s.PauseClientProtection(ctx, "laptop", now.Add(time.Hour))
+		require.NoError(t, err)
+
+		assert.False(t, isEnabled(laptopIP))
+		assert.True(t, isEnabled(tabletIP))
+
+		err = s.PauseClientProtection(ctx, "laptop", time.Time{})
+		require.NoError(t, err)
+
+		assert.True(t, isEnabled(laptopIP))
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		err = s.PauseTagProtection(ctx, "user_child", now.Add(time.Hour))
+		require.NoError(t, err)
+
+		assert.True(t, isEnabled(laptopIP))
+		assert.False(t, isEnabled(tabletIP))
+		assert.Equal(t, map[string]time.Time{
+			"user_child": now.Add(time.Hour),
+		}, s.TagProtectionPauses())
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		err = s.PauseClientProtection(ctx, "laptop", now.Add(time.Minute))
+		require.NoError(t, err)
+
+		now = now.Add(2 * time.Hour)
+
+		assert.True(t, isEnabled(laptopIP))
+		assert.True(t, isEnabled(tabletIP))
+		assert.Empty(t, s.TagProtectionPauses())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err = s.PauseClientProtection(ctx, "unknown", now.Add(time.Hour))
+		testutil.AssertErrorMsg(t, `client "unknown" is not found`, err)
+
+		err = s.PauseTagProtection(ctx, "bad_tag", now.Add(time.Hour))
+		testutil.AssertErrorMsg(t, `tag: bad enum value: "bad_tag"`, err)
+	})
+}
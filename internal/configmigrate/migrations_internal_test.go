@@ -289,13 +289,11 @@ func assertEqualExcept(tb testing.TB, oldConf, newConf yobj, oldKeys, newKeys []
 
 func testDiskConf(schemaVersion int) (diskConf yobj) {
 	filters := []filtering.FilterYAML{{
-		URL:        "https://filters.adtidy.org/android/filters/111_optimized.txt",
-		Name:       "Latvian filter",
-		RulesCount: 100,
+		URL:  "https://filters.adtidy.org/android/filters/111_optimized.txt",
+		Name: "Latvian filter",
 	}, {
-		URL:        "https://easylist.to/easylistgermany/easylistgermany.txt",
-		Name:       "Germany filter",
-		RulesCount: 200,
+		URL:  "https://easylist.to/easylistgermany/easylistgermany.txt",
+		Name: "Germany filter",
 	}}
 	diskConf = yobj{
 		"language":       "en",
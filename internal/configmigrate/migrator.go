@@ -144,6 +144,7 @@ func (m *Migrator) upgradeConfigSchema(
 		30: m.migrateTo31,
 		31: m.migrateTo32,
 		32: m.migrateTo33,
+		33: m.migrateTo34,
 	}
 
 	for i, migrate := range upgrades[current:target] {
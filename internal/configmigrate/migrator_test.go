@@ -211,6 +211,10 @@ func TestMigrateConfig_Migrate(t *testing.T) {
 		yamlEqFunc:    require.YAMLEq,
 		name:          "v33",
 		targetVersion: 33,
+	}, {
+		yamlEqFunc:    require.YAMLEq,
+		name:          "v34",
+		targetVersion: 34,
 	}}
 
 	for _, tc := range testCases {
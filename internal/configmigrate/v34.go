@@ -0,0 +1,193 @@
+package configmigrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// migrateTo34 performs the following changes:
+//
+//	# BEFORE:
+//	'filtering':
+//	  'blocked_services':
+//	    'schedule':
+//	      'time_zone': 'Local'
+//	      'mon':
+//	        'start': '8h'
+//	        'end': '17h'
+//	      'tue':
+//	        'start': '0s'
+//	        'end': '0s'
+//	      # …
+//	    # …
+//	  # …
+//	# …
+//
+//	# AFTER:
+//	'filtering':
+//	  'blocked_services':
+//	    'schedule':
+//	      'time_zone': 'Local'
+//	      'mon':
+//	      - 'start': '8h'
+//	        'end': '17h'
+//	      # …
+//	    # …
+//	  # …
+//	# …
+//
+// The same changes are performed for the schedules of the blocked services of
+// persistent clients, the scheduled settings of persistent clients, and the
+// scheduled settings of client tags.  Empty day ranges are removed.
+func (m *Migrator) migrateTo34(_ context.Context, diskConf yobj) (err error) {
+	diskConf["schema_version"] = 34
+
+	filtering, ok, err := fieldVal[yobj](diskConf, "filtering")
+	if err != nil {
+		return err
+	} else if ok {
+		err = migrateFilteringSchedules(filtering)
+		if err != nil {
+			return fmt.Errorf("filtering: %w", err)
+		}
+	}
+
+	clients, ok, err := fieldVal[yobj](diskConf, "clients")
+	if !ok {
+		return err
+	}
+
+	persistent, ok, err := fieldVal[yarr](clients, "persistent")
+	if !ok {
+		return err
+	}
+
+	for i, p := range persistent {
+		c, isObj := p.(yobj)
+		if !isObj {
+			return fmt.Errorf("persistent client at index %d: unexpected type %T", i, p)
+		}
+
+		err = migrateBlockedServicesSchedule(c)
+		if err != nil {
+			return fmt.Errorf("persistent client at index %d: %w", i, err)
+		}
+
+		err = migrateScheduledSettings(c)
+		if err != nil {
+			return fmt.Errorf("persistent client at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateFilteringSchedules migrates the schedules of the global blocked
+// services and of the scheduled settings of client tags within the filtering
+// configuration.
+func migrateFilteringSchedules(filtering yobj) (err error) {
+	err = migrateBlockedServicesSchedule(filtering)
+	if err != nil {
+		return err
+	}
+
+	tagSchedules, ok, err := fieldVal[yarr](filtering, "tag_schedules")
+	if !ok {
+		return err
+	}
+
+	for i, ts := range tagSchedules {
+		obj, isObj := ts.(yobj)
+		if !isObj {
+			return fmt.Errorf("tag_schedules: at index %d: unexpected type %T", i, ts)
+		}
+
+		err = migrateScheduledSettings(obj)
+		if err != nil {
+			return fmt.Errorf("tag_schedules: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateBlockedServicesSchedule migrates the schedule of the blocked services
+// within obj, if any.
+func migrateBlockedServicesSchedule(obj yobj) (err error) {
+	svcs, ok, err := fieldVal[yobj](obj, "blocked_services")
+	if !ok {
+		return err
+	}
+
+	err = migrateWeeklySchedule(svcs)
+	if err != nil {
+		return fmt.Errorf("blocked_services: %w", err)
+	}
+
+	return nil
+}
+
+// migrateScheduledSettings migrates the schedules of the scheduled settings
+// within obj, if any.
+func migrateScheduledSettings(obj yobj) (err error) {
+	schedules, ok, err := fieldVal[yarr](obj, "schedules")
+	if !ok {
+		return err
+	}
+
+	for i, s := range schedules {
+		ss, isObj := s.(yobj)
+		if !isObj {
+			return fmt.Errorf("schedules: at index %d: unexpected type %T", i, s)
+		}
+
+		err = migrateWeeklySchedule(ss)
+		if err != nil {
+			return fmt.Errorf("schedules: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateWeeklySchedule converts the single day range of each day of the week
+// of the schedule within obj into a list of day ranges.
+func migrateWeeklySchedule(obj yobj) (err error) {
+	sched, ok, err := fieldVal[yobj](obj, "schedule")
+	if !ok {
+		return err
+	}
+
+	for _, day := range []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"} {
+		r, isObj := sched[day].(yobj)
+		if !isObj {
+			// Either there is no range or it's already a list.
+			continue
+		}
+
+		if isZeroDuration(r["start"]) && isZeroDuration(r["end"]) {
+			delete(sched, day)
+		} else {
+			sched[day] = yarr{r}
+		}
+	}
+
+	return nil
+}
+
+// isZeroDuration returns true if v is either missing or a zero duration.
+func isZeroDuration(v any) (ok bool) {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case int:
+		return v == 0
+	case string:
+		d, err := time.ParseDuration(v)
+
+		return err == nil && d == 0
+	default:
+		return false
+	}
+}
@@ -84,6 +84,9 @@ type Interface interface {
 	// due to an assumption that a DHCP client must always have an IP address.
 	IPByHost(host string) (ip netip.Addr)
 
+	// AddStaticLease adds a static DHCPv4 lease.  l must not be nil.
+	AddStaticLease(l *dhcpsvc.Lease) (err error)
+
 	WriteDiskConfig(c *ServerConfig)
 }
 
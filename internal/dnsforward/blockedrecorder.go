@@ -0,0 +1,34 @@
+package dnsforward
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+)
+
+// BlockedRecorder records the requests blocked using the
+// [filtering.BlockingModeCustomIP] blocking mode, so that the page served on the
+// custom IP address could explain why they have been blocked.
+type BlockedRecorder interface {
+	// RecordBlocked records that the request for host from client has been
+	// blocked with res.  It must be safe for concurrent use.
+	RecordBlocked(ctx context.Context, client netip.Addr, host string, res *filtering.Result)
+}
+
+// EmptyBlockedRecorder is a [BlockedRecorder] implementation that does
+// nothing.
+type EmptyBlockedRecorder struct{}
+
+// type check
+var _ BlockedRecorder = EmptyBlockedRecorder{}
+
+// RecordBlocked implements the [BlockedRecorder] interface for
+// EmptyBlockedRecorder.
+func (EmptyBlockedRecorder) RecordBlocked(
+	_ context.Context,
+	_ netip.Addr,
+	_ string,
+	_ *filtering.Result,
+) {
+}
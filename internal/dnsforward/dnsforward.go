@@ -130,6 +130,10 @@ type Server struct {
 	// anonymizer masks the client's IP addresses if needed.
 	anonymizer *aghnet.IPMut
 
+	// blockedRecorder records the requests blocked with the custom IP
+	// blocking mode.  It must not be nil.
+	blockedRecorder BlockedRecorder
+
 	// baseLogger is used to create loggers for other entities.  It should not
 	// have a prefix and must not be nil.
 	baseLogger *slog.Logger
@@ -214,6 +218,10 @@ type DNSCreateParams struct {
 	Anonymizer  *aghnet.IPMut
 	EtcHosts    *aghnet.HostsContainer
 
+	// BlockedRecorder records the requests blocked with the custom IP blocking
+	// mode.  If it's nil, [EmptyBlockedRecorder] is used.
+	BlockedRecorder BlockedRecorder
+
 	// Logger is used as a base logger.  It must not be nil.
 	Logger *slog.Logger
 
@@ -242,6 +250,10 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 		p.Anonymizer = aghnet.NewIPMut(nil)
 	}
 
+	if p.BlockedRecorder == nil {
+		p.BlockedRecorder = EmptyBlockedRecorder{}
+	}
+
 	var etcHosts upstream.Resolver
 	if p.EtcHosts != nil {
 		etcHosts = upstream.NewHostsResolver(p.EtcHosts)
@@ -259,6 +271,7 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 		localDomainSuffix: strings.ToLower(localDomainSuffix),
 		etcHosts:          etcHosts,
 		anonymizer:        p.Anonymizer,
+		blockedRecorder:   p.BlockedRecorder,
 		conf: ServerConfig{
 			ServePlainDNS: true,
 		},
@@ -2,6 +2,7 @@ package dnsforward
 
 import (
 	"cmp"
+	"context"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
@@ -1203,11 +1204,22 @@ func TestBlockedCustomIP(t *testing.T) {
 		OnHostByIP: func(ip netip.Addr) (_ string) { panic(testutil.UnexpectedCall(ip)) },
 		OnIPByHost: func(host string) (_ netip.Addr) { panic(testutil.UnexpectedCall(host)) },
 	}
+
+	recordedCh := make(chan *filtering.Result, 2)
+	recorder := &testBlockedRecorder{
+		OnRecordBlocked: func(_ context.Context, _ netip.Addr, host string, res *filtering.Result) {
+			assert.Equal(t, "NULL.example.org", host)
+
+			recordedCh <- res
+		},
+	}
+
 	s, err := NewServer(DNSCreateParams{
-		DHCPServer:  dhcp,
-		DNSFilter:   f,
-		PrivateNets: netutil.SubnetSetFunc(netutil.IsLocallyServed),
-		Logger:      testLogger,
+		DHCPServer:      dhcp,
+		DNSFilter:       f,
+		PrivateNets:     netutil.SubnetSetFunc(netutil.IsLocallyServed),
+		BlockedRecorder: recorder,
+		Logger:          testLogger,
 	})
 	require.NoError(t, err)
 
@@ -1264,6 +1276,11 @@ func TestBlockedCustomIP(t *testing.T) {
 	require.True(t, ok)
 
 	assert.Equal(t, "::1", a6.AAAA.String())
+
+	for range 2 {
+		res, _ := testutil.RequireReceive(t, recordedCh, testTimeout)
+		assert.Equal(t, filtering.FilteredBlockList, res.Reason)
+	}
 }
 
 func TestBlockedByHosts(t *testing.T) {
@@ -1397,6 +1414,17 @@ func TestRewrite(t *testing.T) {
 			Answer:  "example.org",
 			Type:    dns.TypeCNAME,
 			Enabled: true,
+		}, {
+			Domain:     "test.com",
+			Answer:     "10 mx.test.com",
+			RecordType: "MX",
+			TTL:        120,
+			Enabled:    true,
+		}, {
+			Domain:     "test.com",
+			Answer:     "0 issue letsencrypt.org",
+			RecordType: "CAA",
+			Enabled:    true,
 		}},
 		RewritesEnabled: true,
 	}
@@ -1484,6 +1512,29 @@ func TestRewrite(t *testing.T) {
 
 		assert.Equal(t, "example.org.", reply.Answer[0].(*dns.CNAME).Target)
 		assert.Equal(t, dns.TypeA, reply.Answer[1].Header().Rrtype)
+
+		req = createTestMessageWithType("alias.test.com.", dns.TypeMX)
+		reply, eerr = dns.Exchange(req, addr.String())
+		require.NoError(t, eerr)
+
+		require.Len(t, reply.Answer, 2)
+
+		assert.Equal(t, "test.com.", reply.Answer[0].(*dns.CNAME).Target)
+
+		mx := testutil.RequireTypeAssert[*dns.MX](t, reply.Answer[1])
+		assert.Equal(t, "test.com.", mx.Hdr.Name)
+		assert.Equal(t, "mx.test.com.", mx.Mx)
+		assert.Equal(t, uint32(120), mx.Hdr.Ttl)
+
+		req = createTestMessageWithType("test.com.", dns.TypeCAA)
+		reply, eerr = dns.Exchange(req, addr.String())
+		require.NoError(t, eerr)
+
+		require.Len(t, reply.Answer, 1)
+
+		caa := testutil.RequireTypeAssert[*dns.CAA](t, reply.Answer[0])
+		assert.Equal(t, "issue", caa.Tag)
+		assert.Equal(t, "letsencrypt.org", caa.Value)
 	}
 
 	for _, protect := range []bool{true, false} {
@@ -1528,6 +1579,26 @@ func (d *testDHCP) IPByHost(host string) (ip netip.Addr) { return d.OnIPByHost(h
 // IsClientHost implements the [DHCP] interface for *testDHCP.
 func (d *testDHCP) Enabled() (ok bool) { return d.OnEnabled() }
 
+// testBlockedRecorder is a mock implementation of the [BlockedRecorder]
+// interface.
+type testBlockedRecorder struct {
+	OnRecordBlocked func(ctx context.Context, client netip.Addr, host string, res *filtering.Result)
+}
+
+// type check
+var _ BlockedRecorder = (*testBlockedRecorder)(nil)
+
+// RecordBlocked implements the [BlockedRecorder] interface for
+// *testBlockedRecorder.
+func (r *testBlockedRecorder) RecordBlocked(
+	ctx context.Context,
+	client netip.Addr,
+	host string,
+	res *filtering.Result,
+) {
+	r.OnRecordBlocked(ctx, client, host, res)
+}
+
 func TestPTRResponseFromDHCPLeases(t *testing.T) {
 	const localDomain = "lan"
 
@@ -31,6 +31,8 @@ func (s *Server) filterDNSRewriteResponse(
 		return s.ansFromDNSRewriteSVCB(ctx, v, rr, req)
 	case dns.TypeSRV:
 		return s.ansFromDNSRewriteSRV(v, rr, req)
+	case dns.TypeCAA:
+		return s.ansFromDNSRewriteCAA(v, rr, req)
 	default:
 		s.logger.DebugContext(ctx, "unsupported dns rr type, skipping", "res_record", rr)
 
@@ -138,6 +140,56 @@ func (s *Server) ansFromDNSRewriteSRV(
 	return s.genAnswerSRV(req, srv), nil
 }
 
+// ansFromDNSRewriteCAA creates a new answer resource record from the CAA
+// rewrite data.
+func (s *Server) ansFromDNSRewriteCAA(
+	v rules.RRValue,
+	rr rules.RRType,
+	req *dns.Msg,
+) (ans dns.RR, err error) {
+	caa, ok := v.(*filtering.DNSCAA)
+	if !ok {
+		return nil, fmt.Errorf(
+			"value for rr type %s has type %T, not *filtering.DNSCAA",
+			dns.Type(rr),
+			v,
+		)
+	}
+
+	return s.genAnswerCAA(req, caa), nil
+}
+
+// filterLegacyRewrite handles the legacy rewrites of the records other than A,
+// AAAA, and CNAME.  It constructs a DNS response and sets it into pctx.Res.
+// All parameters must not be nil.
+func (s *Server) filterLegacyRewrite(
+	ctx context.Context,
+	req *dns.Msg,
+	res *filtering.Result,
+	pctx *proxy.DNSContext,
+) (err error) {
+	if res.CanonName == "" {
+		return s.filterDNSRewrite(ctx, req, res, pctx)
+	}
+
+	origQ := req.Question[0]
+	cnameAns := s.genAnswerCNAME(req, res.CanonName)
+
+	// The records actually belong to the canonical name.
+	req.Question[0].Name = dns.Fqdn(res.CanonName)
+	err = s.filterDNSRewrite(ctx, req, res, pctx)
+	req.Question[0] = origQ
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	pctx.Res.Question[0] = origQ
+	pctx.Res.Answer = append([]dns.RR{cnameAns}, pctx.Res.Answer...)
+
+	return nil
+}
+
 // filterDNSRewrite handles dnsrewrite filters.  It constructs a DNS response
 // and sets it into pctx.Res.  All parameters must not be nil.
 func (s *Server) filterDNSRewrite(
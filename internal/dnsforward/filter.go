@@ -49,6 +49,10 @@ func (s *Server) filterDNSRequest(
 	case res.IsFiltered:
 		s.logger.DebugContext(ctx, "host is filtered", "host", host, "reason", res.Reason)
 		pctx.Res = s.genDNSFilterMessage(ctx, pctx, res)
+	case res.Reason == filtering.Rewritten && res.DNSRewriteResult != nil:
+		if err = s.filterLegacyRewrite(ctx, req, res, pctx); err != nil {
+			return nil, err
+		}
 	case res.Reason.In(filtering.Rewritten, filtering.FilteredSafeSearch):
 		pctx.Res = s.getCNAMEWithIPs(ctx, req, res.IPList, res.CanonName)
 	case res.Reason.In(filtering.RewrittenRule, filtering.RewrittenAutoHosts):
@@ -57,9 +61,24 @@ func (s *Server) filterDNSRequest(
 		}
 	}
 
+	if res.Reason == filtering.Rewritten && pctx.Res != nil {
+		setAnswerTTL(pctx.Res.Answer, res.TTL)
+	}
+
 	return res, err
 }
 
+// setAnswerTTL sets the TTL of all records in ans to ttl, unless it's zero.
+func setAnswerTTL(ans []dns.RR, ttl uint32) {
+	if ttl == 0 {
+		return
+	}
+
+	for _, rr := range ans {
+		rr.Header().Ttl = ttl
+	}
+}
+
 // isRewrittenCNAME returns true if the request considered to be rewritten with
 // CNAME and has no resolved IPs.
 func isRewrittenCNAME(res *filtering.Result) (ok bool) {
@@ -68,7 +87,8 @@ func isRewrittenCNAME(res *filtering.Result) (ok bool) {
 		filtering.RewrittenRule,
 		filtering.FilteredSafeSearch) &&
 		res.CanonName != "" &&
-		len(res.IPList) == 0
+		len(res.IPList) == 0 &&
+		res.DNSRewriteResult == nil
 }
 
 // checkHostRules checks the host against filters.  It is safe for concurrent
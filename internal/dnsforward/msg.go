@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/netip"
 	"slices"
+	"strings"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -74,10 +75,24 @@ func (s *Server) genDNSFilterMessage(
 		// requested IP version, so produce a NODATA response.
 		return s.getCNAMEWithIPs(ctx, req, ipsFromRules(res.Rules), res.CanonName)
 	default:
+		s.recordBlocked(ctx, dctx, res)
+
 		return s.genForBlockingMode(ctx, req, ipsFromRules(res.Rules))
 	}
 }
 
+// recordBlocked records the request blocked with res, if the custom IP
+// blocking mode is used, so that the block page served on the custom IP could
+// explain why it has been blocked.
+func (s *Server) recordBlocked(ctx context.Context, dctx *proxy.DNSContext, res *filtering.Result) {
+	if mode, _, _ := s.dnsFilter.BlockingMode(); mode != filtering.BlockingModeCustomIP {
+		return
+	}
+
+	host := strings.TrimSuffix(dctx.Req.Question[0].Name, ".")
+	s.blockedRecorder.RecordBlocked(ctx, dctx.Addr.Addr(), host, res)
+}
+
 // getCNAMEWithIPs generates a filtered response to req for with CNAME record
 // and provided ips.
 func (s *Server) getCNAMEWithIPs(
@@ -239,6 +254,16 @@ func (s *Server) genAnswerSRV(req *dns.Msg, srv *rules.DNSSRV) (ans *dns.SRV) {
 	}
 }
 
+// genAnswerCAA returns a CAA answer for req with the data from caa.
+func (s *Server) genAnswerCAA(req *dns.Msg, caa *filtering.DNSCAA) (ans *dns.CAA) {
+	return &dns.CAA{
+		Hdr:   s.hdr(req, dns.TypeCAA),
+		Flag:  caa.Flag,
+		Tag:   caa.Tag,
+		Value: caa.Value,
+	}
+}
+
 func (s *Server) genAnswerTXT(req *dns.Msg, strs []string) (ans *dns.TXT) {
 	return &dns.TXT{
 		Hdr: s.hdr(req, dns.TypeTXT),
@@ -2,12 +2,14 @@ package dnsforward
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/netip"
 	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/miekg/dns"
@@ -138,6 +140,9 @@ func (s *Server) processInitial(ctx context.Context, dctx *dnsContext) (rc resul
 	dctx.protectionEnabled, _ = s.UpdatedProtectionStatus(ctx)
 	dctx.setts = s.clientRequestFilteringSettings(dctx)
 
+	// The protection may be paused for the particular client.
+	dctx.protectionEnabled = dctx.setts.ProtectionEnabled
+
 	return resultCodeSuccess
 }
 
@@ -325,11 +330,11 @@ func (s *Server) processDHCPHosts(ctx context.Context, dctx *dnsContext) (rc res
 	return resultCodeSuccess
 }
 
-// processDHCPAddrs responds to PTR requests if the target IP is leased by the
-// DHCP server.
-func (s *Server) processDHCPAddrs(ctx context.Context, dctx *dnsContext) (rc resultCode) {
-	s.logger.DebugContext(ctx, "started processing dhcp addrs")
-	defer s.logger.DebugContext(ctx, "finished processing dhcp addrs")
+// processLocalPTR responds to PTR requests for the addresses known locally.
+// See [Server.localHostByAddr].
+func (s *Server) processLocalPTR(ctx context.Context, dctx *dnsContext) (rc resultCode) {
+	s.logger.DebugContext(ctx, "started processing local ptr")
+	defer s.logger.DebugContext(ctx, "finished processing local ptr")
 
 	pctx := dctx.proxyCtx
 	if pctx.Res != nil {
@@ -338,39 +343,102 @@ func (s *Server) processDHCPAddrs(ctx context.Context, dctx *dnsContext) (rc res
 
 	req := pctx.Req
 	q := req.Question[0]
-	pref := pctx.RequestedPrivateRDNS
 	// TODO(e.burkov):  Consider answering authoritatively for SOA and NS
 	// queries.
-	if pref == (netip.Prefix{}) || q.Qtype != dns.TypePTR {
+	if q.Qtype != dns.TypePTR {
 		return resultCodeSuccess
 	}
 
-	addr := pref.Addr()
-	host := s.dhcpServer.HostByIP(addr)
+	addr := pctx.RequestedPrivateRDNS.Addr()
+	if !addr.IsValid() {
+		var err error
+		addr, err = netutil.IPFromReversedAddr(q.Name)
+		if err != nil {
+			// Not a full reversed address, so there is nothing to look up.
+			return resultCodeSuccess
+		}
+	}
+
+	host, ttl, res := s.localHostByAddr(dctx, addr)
 	if host == "" {
 		return resultCodeSuccess
 	}
 
-	s.logger.DebugContext(ctx, "dhcp client", "addr", addr, "host", host)
+	s.logger.DebugContext(ctx, "local ptr", "addr", addr, "host", host, "reason", res.Reason)
 
 	resp := s.replyCompressed(req)
 	ptr := &dns.PTR{
 		Hdr: dns.RR_Header{
 			Name:   q.Name,
 			Rrtype: dns.TypePTR,
-			// TODO(e.burkov):  Use [dhcpsvc.Lease.Expiry].  See
-			// https://github.com/AdguardTeam/AdGuardHome/issues/3932.
-			Ttl:   s.dnsFilter.BlockedResponseTTL(),
-			Class: dns.ClassINET,
+			Ttl:    ttl,
+			Class:  dns.ClassINET,
 		},
-		Ptr: dns.Fqdn(strings.Join([]string{host, s.localDomainSuffix}, ".")),
+		Ptr: dns.Fqdn(host),
 	}
 	resp.Answer = append(resp.Answer, ptr)
 	pctx.Res = resp
+	dctx.result = res
 
 	return resultCodeSuccess
 }
 
+// localHostByAddr returns the host name for addr from the local reverse index
+// as well as the TTL of the record and the filtering result to log.  host is
+// empty if addr isn't known locally.
+//
+// The index consists of the A and AAAA rewrites, the DHCP leases, and the
+// system hosts files, in that order of precedence.  When several names within
+// one source map to addr, the first one is used.  The leases are only used for
+// the private addresses, and the other sources only for the clients with both
+// protection and filtering enabled.
+func (s *Server) localHostByAddr(
+	dctx *dnsContext,
+	addr netip.Addr,
+) (host string, ttl uint32, res *filtering.Result) {
+	ttl = s.dnsFilter.BlockedResponseTTL()
+	filteringEnabled := dctx.protectionEnabled && dctx.setts != nil && dctx.setts.FilteringEnabled
+
+	if filteringEnabled {
+		var rwTTL uint32
+		var ok bool
+		host, rwTTL, ok = s.dnsFilter.ReverseRewrite(addr)
+		if ok {
+			if rwTTL != 0 {
+				ttl = rwTTL
+			}
+
+			return host, ttl, &filtering.Result{
+				Reason: filtering.Rewritten,
+			}
+		}
+	}
+
+	if dctx.proxyCtx.RequestedPrivateRDNS != (netip.Prefix{}) {
+		host = s.dhcpServer.HostByIP(addr)
+		if host != "" {
+			// TODO(e.burkov):  Use [dhcpsvc.Lease.Expiry].  See
+			// https://github.com/AdguardTeam/AdGuardHome/issues/3932.
+			return strings.Join([]string{host, s.localDomainSuffix}, "."), ttl, &filtering.Result{}
+		}
+	}
+
+	if filteringEnabled {
+		host = s.dnsFilter.EtcHostsByAddr(addr)
+		if host != "" {
+			return host, ttl, &filtering.Result{
+				Rules: []*filtering.ResultRule{{
+					Text:         fmt.Sprintf("%s %s", addr, host),
+					FilterListID: rulelist.APIIDEtcHosts,
+				}},
+				Reason: filtering.RewrittenAutoHosts,
+			}
+		}
+	}
+
+	return "", 0, nil
+}
+
 // Apply filtering logic
 func (s *Server) processFilteringBeforeRequest(
 	ctx context.Context,
@@ -588,6 +656,10 @@ func (s *Server) processFilteringAfterResponse(ctx context.Context, dctx *dnsCon
 		pctx.Req.Question[0], pctx.Res.Question[0] = dctx.origQuestion, dctx.origQuestion
 
 		rr := s.genAnswerCNAME(pctx.Req, res.CanonName)
+		if res.Reason == filtering.Rewritten {
+			setAnswerTTL([]dns.RR{rr}, res.TTL)
+		}
+
 		answer := append([]dns.RR{rr}, pctx.Res.Answer...)
 		pctx.Res.Answer = answer
 
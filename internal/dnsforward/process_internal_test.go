@@ -4,13 +4,16 @@ import (
 	"cmp"
 	"context"
 	"crypto/tls"
+	"io"
 	"net"
 	"net/netip"
+	"strings"
 	"testing"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/hostsfile"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/AdguardTeam/urlfilter/rules"
@@ -640,6 +643,231 @@ func TestServer_ProcessDHCPHosts(t *testing.T) {
 	}
 }
 
+func TestServer_ProcessLocalPTR(t *testing.T) {
+	const (
+		localTLD   = "lan"
+		blockedTTL = 10
+		rewriteTTL = 60
+	)
+
+	hosts, err := hostsfile.NewDefaultStorage(
+		testutil.ContextWithTimeout(t, testTimeout),
+		&hostsfile.DefaultStorageConfig{
+			Logger: testLogger,
+			Readers: []io.Reader{strings.NewReader(
+				"192.168.1.20 hosts-dhcp\n" +
+					"192.168.1.30 first.hosts second.hosts\n",
+			)},
+		},
+	)
+	require.NoError(t, err)
+
+	flt, err := filtering.New(&filtering.Config{
+		Logger:             testLogger,
+		BlockingMode:       filtering.BlockingModeDefault,
+		BlockedResponseTTL: blockedTTL,
+		EtcHosts:           hosts,
+		Rewrites: []*filtering.LegacyRewrite{{
+			Domain:  "nas.lan",
+			Answer:  "192.168.1.10",
+			TTL:     rewriteTTL,
+			Enabled: true,
+		}, {
+			Domain:  "nas-alias.lan",
+			Answer:  "192.168.1.10",
+			Enabled: true,
+		}, {
+			Domain:  "*.wildcard.lan",
+			Answer:  "192.168.1.11",
+			Enabled: true,
+		}, {
+			Domain:  "disabled.lan",
+			Answer:  "192.168.1.12",
+			Enabled: false,
+		}, {
+			Domain:  "implicit.lan",
+			Answer:  "192.168.1.13",
+			Enabled: true,
+		}, {
+			Domain:     "13.1.168.192.in-addr.arpa",
+			Answer:     "explicit.lan.",
+			RecordType: "PTR",
+			Enabled:    true,
+		}, {
+			Domain:  "public.example",
+			Answer:  "203.0.113.1",
+			Enabled: true,
+		}},
+		RewritesEnabled: true,
+	}, nil)
+	require.NoError(t, err)
+
+	dhcp := &testDHCP{
+		OnEnabled:  func() (ok bool) { return true },
+		OnIPByHost: func(host string) (_ netip.Addr) { panic(testutil.UnexpectedCall(host)) },
+		OnHostByIP: func(ip netip.Addr) (host string) {
+			switch ip {
+			case netip.MustParseAddr("192.168.1.10"), netip.MustParseAddr("192.168.1.20"):
+				return "dhcp-host"
+			default:
+				return ""
+			}
+		},
+	}
+
+	s := &Server{
+		dnsFilter:         flt,
+		dhcpServer:        dhcp,
+		localDomainSuffix: localTLD,
+		baseLogger:        testLogger,
+		logger:            testLogger,
+	}
+
+	testCases := []struct {
+		name       string
+		arpa       string
+		wantHost   string
+		wantReason filtering.Reason
+		wantTTL    uint32
+		private    bool
+		protection bool
+		filtering  bool
+	}{{
+		name:       "rewrite",
+		arpa:       "10.1.168.192.in-addr.arpa.",
+		wantHost:   "nas.lan.",
+		wantReason: filtering.Rewritten,
+		wantTTL:    rewriteTTL,
+		private:    true,
+		protection: true,
+		filtering:  true,
+	}, {
+		name:       "rewrite_public",
+		arpa:       "1.113.0.203.in-addr.arpa.",
+		wantHost:   "public.example.",
+		wantReason: filtering.Rewritten,
+		wantTTL:    blockedTTL,
+		private:    false,
+		protection: true,
+		filtering:  true,
+	}, {
+		name:       "dhcp_over_hosts",
+		arpa:       "20.1.168.192.in-addr.arpa.",
+		wantHost:   "dhcp-host.lan.",
+		wantReason: filtering.NotFilteredNotFound,
+		wantTTL:    blockedTTL,
+		private:    true,
+		protection: true,
+		filtering:  true,
+	}, {
+		name:       "hosts",
+		arpa:       "30.1.168.192.in-addr.arpa.",
+		wantHost:   "first.hosts.",
+		wantReason: filtering.RewrittenAutoHosts,
+		wantTTL:    blockedTTL,
+		private:    true,
+		protection: true,
+		filtering:  true,
+	}, {
+		name:       "filtering_disabled",
+		arpa:       "10.1.168.192.in-addr.arpa.",
+		wantHost:   "dhcp-host.lan.",
+		wantReason: filtering.NotFilteredNotFound,
+		wantTTL:    blockedTTL,
+		private:    true,
+		protection: true,
+		filtering:  false,
+	}, {
+		name:       "protection_disabled",
+		arpa:       "10.1.168.192.in-addr.arpa.",
+		wantHost:   "dhcp-host.lan.",
+		wantReason: filtering.NotFilteredNotFound,
+		wantTTL:    blockedTTL,
+		private:    true,
+		protection: false,
+		filtering:  true,
+	}, {
+		name:       "protection_disabled_hosts",
+		arpa:       "30.1.168.192.in-addr.arpa.",
+		wantHost:   "",
+		wantReason: filtering.NotFilteredNotFound,
+		private:    true,
+		protection: false,
+		filtering:  true,
+	}, {
+		name:       "wildcard",
+		arpa:       "11.1.168.192.in-addr.arpa.",
+		wantHost:   "",
+		wantReason: filtering.NotFilteredNotFound,
+		private:    true,
+		protection: true,
+		filtering:  true,
+	}, {
+		name:       "disabled",
+		arpa:       "12.1.168.192.in-addr.arpa.",
+		wantHost:   "",
+		wantReason: filtering.NotFilteredNotFound,
+		private:    true,
+		protection: true,
+		filtering:  true,
+	}, {
+		name:       "explicit_ptr",
+		arpa:       "13.1.168.192.in-addr.arpa.",
+		wantHost:   "",
+		wantReason: filtering.NotFilteredNotFound,
+		private:    true,
+		protection: true,
+		filtering:  true,
+	}, {
+		name:       "partial",
+		arpa:       "1.168.192.in-addr.arpa.",
+		wantHost:   "",
+		wantReason: filtering.NotFilteredNotFound,
+		private:    false,
+		protection: true,
+		filtering:  true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Req: (&dns.Msg{}).SetQuestion(tc.arpa, dns.TypePTR),
+			}
+
+			if tc.private {
+				addr, addrErr := netutil.IPFromReversedAddr(tc.arpa)
+				require.NoError(t, addrErr)
+
+				pctx.RequestedPrivateRDNS = netip.PrefixFrom(addr, addr.BitLen())
+			}
+
+			dctx := &dnsContext{
+				proxyCtx:          pctx,
+				result:            &filtering.Result{},
+				setts:             &filtering.Settings{FilteringEnabled: tc.filtering},
+				protectionEnabled: tc.protection,
+			}
+
+			rc := s.processLocalPTR(testutil.ContextWithTimeout(t, testTimeout), dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			assert.Equal(t, tc.wantReason, dctx.result.Reason)
+			if tc.wantHost == "" {
+				assert.Nil(t, pctx.Res)
+
+				return
+			}
+
+			require.NotNil(t, pctx.Res)
+			require.Len(t, pctx.Res.Answer, 1)
+
+			ptr := testutil.RequireTypeAssert[*dns.PTR](t, pctx.Res.Answer[0])
+			assert.Equal(t, tc.wantHost, ptr.Ptr)
+			assert.Equal(t, tc.wantTTL, ptr.Hdr.Ttl)
+		})
+	}
+}
+
 func TestServer_ProcessUpstream_localPTR(t *testing.T) {
 	const locDomain = "some.local."
 	const reqAddr = "1.1.168.192.in-addr.arpa."
@@ -31,7 +31,7 @@ func (s *Server) ServeDNS(ctx context.Context, _ *proxy.Proxy, pctx *proxy.DNSCo
 		s.processInitial,
 		s.processDDRQuery,
 		s.processDHCPHosts,
-		s.processDHCPAddrs,
+		s.processLocalPTR,
 		s.processFilteringBeforeRequest,
 		s.processUpstream,
 		s.processFilteringAfterResponse,
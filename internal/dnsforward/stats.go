@@ -161,6 +161,13 @@ func (s *Server) updateStats(dctx *dnsContext, clientIP string, processingTime t
 		e.Client = clientIP
 	}
 
+	for _, r := range dctx.result.Rules {
+		e.Rules = append(e.Rules, stats.Rule{
+			Text:         r.Text,
+			FilterListID: int64(r.FilterListID),
+		})
+	}
+
 	switch dctx.result.Reason {
 	case filtering.FilteredSafeBrowsing:
 		e.Result = stats.RSafeBrowsing
@@ -18,47 +18,48 @@ import (
 	"github.com/AdguardTeam/urlfilter/rules"
 )
 
-// serviceRules maps a service ID to its filtering rules.
-var serviceRules map[string][]*rules.NetworkRule
-
-// serviceIDs contains service IDs sorted alphabetically.
-var serviceIDs []string
-
 // initBlockedServices initializes package-level blocked service data.  l must
 // not be nil.
 func initBlockedServices(ctx context.Context, l *slog.Logger) {
 	svcLen := len(blockedServices)
-	serviceIDs = make([]string, svcLen)
-	serviceRules = make(map[string][]*rules.NetworkRule, svcLen)
-
-	for i, s := range blockedServices {
-		netRules := make([]*rules.NetworkRule, 0, len(s.Rules))
-		for _, text := range s.Rules {
-			rule, err := rules.NewNetworkRule(text, rulelist.IDBlockedService)
-			if err == nil {
-				netRules = append(netRules, rule)
-
-				continue
-			}
-
-			l.ErrorContext(
-				ctx,
-				"parsing blocked service rule",
-				"svc", s.ID,
-				"rule", text,
-				slogutil.KeyError, err,
-			)
-		}
-
-		serviceIDs[i] = s.ID
-		serviceRules[s.ID] = netRules
+	builtin := make([]*knownService, 0, svcLen)
+	for i := range blockedServices {
+		builtin = append(builtin, newService(ctx, l, &blockedServices[i]))
 	}
 
-	slices.Sort(serviceIDs)
+	services.setBuiltin(ctx, l, builtin)
 
 	l.DebugContext(ctx, "initialized services", "svc_len", svcLen)
 }
 
+// newService parses the rules of svc and returns the resulting service.  The
+// rules that can't be parsed are logged and skipped.  l and svc must not be
+// nil.
+func newService(ctx context.Context, l *slog.Logger, svc *blockedService) (s *knownService) {
+	netRules := make([]*rules.NetworkRule, 0, len(svc.Rules))
+	for _, text := range svc.Rules {
+		rule, err := rules.NewNetworkRule(text, rulelist.IDBlockedService)
+		if err == nil {
+			netRules = append(netRules, rule)
+
+			continue
+		}
+
+		l.ErrorContext(
+			ctx,
+			"parsing blocked service rule",
+			"svc", svc.ID,
+			"rule", text,
+			slogutil.KeyError, err,
+		)
+	}
+
+	return &knownService{
+		info:  svc,
+		rules: netRules,
+	}
+}
+
 // BlockedServices is the configuration of blocked services.
 //
 // TODO(s.chzhen):  Move to a higher-level package to allow importing the client
@@ -84,7 +85,8 @@ func (s *BlockedServices) Clone() (c *BlockedServices) {
 }
 
 // FilterUnknownIDs filters out unknown service IDs within s and logs them at
-// warning level.  It does nothing if s is nil.
+// warning level.  IDs that may be provided by the service catalogs that haven't
+// been loaded yet are kept.  It does nothing if s is nil.
 func (s *BlockedServices) FilterUnknownIDs(ctx context.Context, logger *slog.Logger) {
 	if s == nil {
 		// [BlockedServices.Validate] handles this case.
@@ -92,7 +94,7 @@ func (s *BlockedServices) FilterUnknownIDs(ctx context.Context, logger *slog.Log
 	}
 
 	s.IDs = slices.DeleteFunc(s.IDs, func(id string) (ok bool) {
-		_, isKnown := serviceRules[id]
+		isKnown := services.mayHave(id)
 		if !isKnown {
 			logger.WarnContext(ctx, "filtered unknown service", "id", id)
 		}
@@ -105,6 +107,8 @@ func (s *BlockedServices) FilterUnknownIDs(ctx context.Context, logger *slog.Log
 var _ validate.Interface = (*BlockedServices)(nil)
 
 // Validate implements the [validate.Interface] interface for *BlockedServices.
+// IDs that may be provided by the service catalogs that haven't been loaded yet
+// are considered valid.
 func (s *BlockedServices) Validate() (err error) {
 	if s == nil {
 		return errors.ErrNoValue
@@ -112,8 +116,7 @@ func (s *BlockedServices) Validate() (err error) {
 
 	var errs []error
 	for _, id := range s.IDs {
-		_, ok := serviceRules[id]
-		if !ok {
+		if !services.mayHave(id) {
 			errs = append(errs, fmt.Errorf("unknown blocked-service %q", id))
 		}
 	}
@@ -139,7 +142,7 @@ func (d *DNSFilter) ApplyBlockedServices(setts *Settings) {
 // ApplyBlockedServicesList appends filtering rules to the settings.
 func (d *DNSFilter) ApplyBlockedServicesList(setts *Settings, list []string) {
 	for _, name := range list {
-		rules, ok := serviceRules[name]
+		rules, ok := services.rules(name)
 		if !ok {
 			d.logger.ErrorContext(context.TODO(), "unknown service name", "name", name)
 
@@ -154,16 +157,21 @@ func (d *DNSFilter) ApplyBlockedServicesList(setts *Settings, list []string) {
 }
 
 func (d *DNSFilter) handleBlockedServicesIDs(w http.ResponseWriter, r *http.Request) {
-	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, serviceIDs)
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, services.ids())
 }
 
+// handleBlockedServicesAll is the handler for the GET
+// /control/blocked_services/all HTTP API.  It returns the builtin services
+// along with the custom ones and the ones from the service catalogs.
 func (d *DNSFilter) handleBlockedServicesAll(w http.ResponseWriter, r *http.Request) {
+	svcs, groups := services.all()
+
 	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, struct {
-		BlockedServices []blockedService `json:"blocked_services"`
-		ServiceGroups   []serviceGroup   `json:"groups"`
+		BlockedServices []*blockedService `json:"blocked_services"`
+		ServiceGroups   []serviceGroup    `json:"groups"`
 	}{
-		BlockedServices: blockedServices,
-		ServiceGroups:   serviceGroups,
+		BlockedServices: svcs,
+		ServiceGroups:   groups,
 	})
 }
 
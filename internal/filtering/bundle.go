@@ -0,0 +1,694 @@
+package filtering
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// bundleVersion is the current version of the format of filtering bundles.
+const bundleVersion uint = 1
+
+// bundleFileName is the name of the file suggested to the browser when a
+// filtering bundle is exported.
+const bundleFileName = "filtering_bundle.json"
+
+// bundleMode is the mode of importing a filtering bundle.
+type bundleMode string
+
+// Valid bundle import modes.
+const (
+	// bundleModeMerge means adding the filter lists, groups, rules, rewrites,
+	// and blocked services missing from the current configuration.  The safe
+	// search settings and the blocked services schedule are kept.
+	bundleModeMerge bundleMode = "merge"
+
+	// bundleModeReplace means replacing the current filtering configuration
+	// with the one from the bundle.  The safe search settings and the blocked
+	// services are only replaced if the bundle contains them.
+	bundleModeReplace bundleMode = "replace"
+)
+
+// bundleJSON is a filtering bundle, a portable snapshot of the filtering
+// configuration that can be copied between instances.
+type bundleJSON struct {
+	// BlockedServices are the globally blocked services along with their
+	// schedule.  It's nil if the bundle doesn't contain them.
+	BlockedServices *BlockedServices `json:"blocked_services,omitempty"`
+
+	// SafeSearch are the global safe search settings.  It's nil if the bundle
+	// doesn't contain them.
+	SafeSearch *SafeSearchConfig `json:"safe_search,omitempty"`
+
+	// Filters are the blocking filter lists.
+	Filters []*bundleFilterJSON `json:"filters"`
+
+	// WhitelistFilters are the allowing filter lists.
+	WhitelistFilters []*bundleFilterJSON `json:"whitelist_filters"`
+
+	// FilterGroups are the filter groups the filter lists may refer to.
+	FilterGroups []*filterGroupJSON `json:"filter_groups"`
+
+	// UserRules are the global custom filtering rules.
+	UserRules []string `json:"user_rules"`
+
+	// Rewrites are the legacy DNS rewrites.
+	Rewrites []*rewriteEntryJSON `json:"rewrites"`
+
+	// Version is the version of the bundle format.  It must be equal to
+	// [bundleVersion].
+	Version uint `json:"version"`
+}
+
+// bundleFilterJSON is a filter list within a filtering bundle.  Unlike
+// [filterJSON], it only contains the portable properties of the list.
+type bundleFilterJSON struct {
+	URL     string `json:"url"`
+	Name    string `json:"name"`
+	Group   string `json:"group,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// bundleImportReq is the request body for the POST
+// /control/filtering/bundle/import HTTP API.
+type bundleImportReq struct {
+	Bundle *bundleJSON `json:"bundle"`
+	Mode   bundleMode  `json:"mode"`
+}
+
+// handleBundleExport is the handler for the GET
+// /control/filtering/bundle/export HTTP API.
+func (d *DNSFilter) handleBundleExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(httphdr.ContentDisposition, fmt.Sprintf("attachment; filename=%q", bundleFileName))
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, d.exportBundle())
+}
+
+// exportBundle returns the current filtering configuration as a bundle.
+func (d *DNSFilter) exportBundle() (b *bundleJSON) {
+	b = &bundleJSON{
+		Filters:          []*bundleFilterJSON{},
+		WhitelistFilters: []*bundleFilterJSON{},
+		FilterGroups:     []*filterGroupJSON{},
+		UserRules:        []string{},
+		Rewrites:         []*rewriteEntryJSON{},
+		Version:          bundleVersion,
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		b.BlockedServices = d.conf.BlockedServices.Clone()
+
+		safeSearch := d.conf.SafeSearchConf
+		b.SafeSearch = &safeSearch
+
+		for _, g := range d.conf.FilterGroups {
+			b.FilterGroups = append(b.FilterGroups, &filterGroupJSON{
+				Name: g.Name,
+				Tags: slices.Clone(g.Tags),
+			})
+		}
+
+		for _, rw := range d.conf.Rewrites {
+			b.Rewrites = append(b.Rewrites, newRewriteEntryJSON(rw))
+		}
+	}()
+
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	b.Filters = appendBundleFilters(b.Filters, d.conf.Filters)
+	b.WhitelistFilters = appendBundleFilters(b.WhitelistFilters, d.conf.WhitelistFilters)
+	b.UserRules = append(b.UserRules, d.conf.UserRules...)
+
+	return b
+}
+
+// appendBundleFilters appends the bundle representations of filters to orig
+// and returns it.
+func appendBundleFilters(orig []*bundleFilterJSON, filters []FilterYAML) (res []*bundleFilterJSON) {
+	res = orig
+	for _, f := range filters {
+		res = append(res, &bundleFilterJSON{
+			URL:     f.URL,
+			Name:    f.Name,
+			Group:   f.Group,
+			Enabled: f.Enabled,
+		})
+	}
+
+	return res
+}
+
+// handleBundleImport is the handler for the POST
+// /control/filtering/bundle/import HTTP API.
+func (d *DNSFilter) handleBundleImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	req := &bundleImportReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = d.validateBundle(req.Bundle, req.Mode)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return
+	}
+
+	err = d.importBundle(ctx, req.Bundle, req.Mode)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "importing: %s", err)
+
+		return
+	}
+
+	d.conf.ConfModifier.Apply(ctx)
+	d.EnableFilters(true)
+
+	// Download the new lists in the background, since there may be many of
+	// them.
+	go d.refreshNewFilters(context.WithoutCancel(ctx))
+
+	aghhttp.OK(ctx, l, w)
+}
+
+// ImportConfig is the filtering configuration converted from another DNS
+// server to merge into the current one.
+type ImportConfig struct {
+	// FilterGroups are the filter groups to add.  The groups with the same
+	// names as the existing ones are kept as is.
+	FilterGroups []*FilterGroup
+
+	// Filters are the blocking filter lists to add.  Only the URL, name,
+	// group, and enabled flag of each list are used.
+	Filters []FilterYAML
+
+	// UserRules are the global custom filtering rules to add.
+	UserRules []string
+
+	// Rewrites are the legacy rewrites to add.
+	Rewrites []*rewrite.Item
+}
+
+// Import merges c into the configuration in the same way as a filtering bundle
+// is merged, saves the configuration, and downloads the new filter lists in
+// the background.  The filter lists and rewrites from c that can't be added
+// are skipped and reported in skipped.  c must not be nil.
+func (d *DNSFilter) Import(ctx context.Context, c *ImportConfig) (skipped []error, err error) {
+	b := &bundleJSON{
+		FilterGroups: make([]*filterGroupJSON, 0, len(c.FilterGroups)),
+		UserRules:    c.UserRules,
+		Version:      bundleVersion,
+	}
+
+	for _, g := range c.FilterGroups {
+		b.FilterGroups = append(b.FilterGroups, &filterGroupJSON{
+			Name: g.Name,
+			Tags: g.Tags,
+		})
+	}
+
+	groupNames, err := d.bundleGroupNames(b.FilterGroups, bundleModeMerge)
+	if err != nil {
+		return nil, fmt.Errorf("filter groups: %w", err)
+	}
+
+	urls := container.NewMapSet[string]()
+	for _, f := range c.Filters {
+		bf := &bundleFilterJSON{
+			URL:     f.URL,
+			Name:    f.Name,
+			Group:   f.Group,
+			Enabled: f.Enabled,
+		}
+
+		err = d.validateBundleFilter(bf, urls, groupNames)
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("filter %q: %w", f.URL, err))
+
+			continue
+		}
+
+		b.Filters = append(b.Filters, bf)
+	}
+
+	for _, item := range c.Rewrites {
+		ent := &rewriteEntryJSON{
+			Domain:  item.Domain,
+			Answer:  item.Answer,
+			Type:    item.Type,
+			Comment: item.Comment,
+			TTL:     item.TTL,
+			Enabled: aghalg.BoolToNullBool(item.Enabled),
+		}
+
+		err = validateBundleRewrite(ent)
+		if err == nil {
+			err = ent.toLegacyRewrite(true).normalize(ctx, d.logger)
+		}
+
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("rewrite %q: %w", item.Domain, err))
+
+			continue
+		}
+
+		b.Rewrites = append(b.Rewrites, ent)
+	}
+
+	err = d.importBundle(ctx, b, bundleModeMerge)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return skipped, err
+	}
+
+	d.conf.ConfModifier.Apply(ctx)
+	d.EnableFilters(true)
+
+	// Download the new lists in the background, since there may be many of
+	// them.
+	go d.refreshNewFilters(context.WithoutCancel(ctx))
+
+	return skipped, nil
+}
+
+// validateBundle returns an error if b can't be imported in the given mode.
+func (d *DNSFilter) validateBundle(b *bundleJSON, mode bundleMode) (err error) {
+	switch {
+	case b == nil:
+		return fmt.Errorf("bundle: %w", errors.ErrNoValue)
+	case b.Version != bundleVersion:
+		return fmt.Errorf("version: %w: %d", errors.ErrBadEnumValue, b.Version)
+	case mode != bundleModeMerge && mode != bundleModeReplace:
+		return fmt.Errorf("mode: %w: %q", errors.ErrBadEnumValue, mode)
+	}
+
+	groupNames, err := d.bundleGroupNames(b.FilterGroups, mode)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	var errs []error
+
+	urls := container.NewMapSet[string]()
+	for _, lists := range []struct {
+		name    string
+		filters []*bundleFilterJSON
+	}{{
+		name:    "filters",
+		filters: b.Filters,
+	}, {
+		name:    "whitelist_filters",
+		filters: b.WhitelistFilters,
+	}} {
+		for i, f := range lists.filters {
+			err = d.validateBundleFilter(f, urls, groupNames)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: at index %d: %w", lists.name, i, err))
+			}
+		}
+	}
+
+	for i, rw := range b.Rewrites {
+		err = validateBundleRewrite(rw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rewrites: at index %d: %w", i, err))
+		}
+	}
+
+	if b.BlockedServices != nil {
+		err = b.BlockedServices.Validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("blocked_services: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// bundleGroupNames validates groups and returns the names of the filter groups
+// the filter lists of the bundle may refer to after it's imported in the given
+// mode.
+func (d *DNSFilter) bundleGroupNames(
+	groups []*filterGroupJSON,
+	mode bundleMode,
+) (names *container.MapSet[string], err error) {
+	fltGroups := make([]*FilterGroup, 0, len(groups))
+	for _, g := range groups {
+		if g == nil {
+			fltGroups = append(fltGroups, nil)
+
+			continue
+		}
+
+		fltGroups = append(fltGroups, &FilterGroup{
+			Name: g.Name,
+		})
+	}
+
+	err = validateFilterGroups(fltGroups)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	names = container.NewMapSet[string]()
+	for _, g := range fltGroups {
+		names.Add(g.Name)
+	}
+
+	if mode == bundleModeMerge {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		for _, g := range d.conf.FilterGroups {
+			names.Add(g.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// validateBundleFilter returns an error if f isn't a valid filter list.  urls
+// are the URLs of the lists already validated, f's URL is added to it.
+// groupNames are the names of the groups the list may refer to.
+func (d *DNSFilter) validateBundleFilter(
+	f *bundleFilterJSON,
+	urls *container.MapSet[string],
+	groupNames *container.MapSet[string],
+) (err error) {
+	if f == nil {
+		return errors.ErrNoValue
+	}
+
+	if urls.Has(f.URL) {
+		return fmt.Errorf("url: %w: %q", errors.ErrDuplicated, f.URL)
+	}
+
+	urls.Add(f.URL)
+
+	err = d.validateFilterURL(f.URL)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	if f.Group != "" && !groupNames.Has(f.Group) {
+		return fmt.Errorf("filter group %q: %w", f.Group, errFilterGroupNotExist)
+	}
+
+	return nil
+}
+
+// validateBundleRewrite returns an error if rw isn't a valid legacy rewrite.
+func validateBundleRewrite(rw *rewriteEntryJSON) (err error) {
+	switch {
+	case rw == nil:
+		return errors.ErrNoValue
+	case rw.Domain == "":
+		return fmt.Errorf("domain: %w", errors.ErrEmptyValue)
+	case rw.Answer == "":
+		return fmt.Errorf("answer: %w", errors.ErrEmptyValue)
+	default:
+		return nil
+	}
+}
+
+// importBundle applies the validated bundle b to the configuration in the
+// given mode.  It doesn't rebuild the filtering engines.
+func (d *DNSFilter) importBundle(ctx context.Context, b *bundleJSON, mode bundleMode) (err error) {
+	replace := mode == bundleModeReplace
+
+	// Prepare the lists beforehand to not fail in the middle of the import.
+	blockFilters, err := newBundleFilters(b.Filters, d.idGen, false)
+	if err != nil {
+		return fmt.Errorf("filters: %w", err)
+	}
+
+	allowFilters, err := newBundleFilters(b.WhitelistFilters, d.idGen, true)
+	if err != nil {
+		return fmt.Errorf("whitelist_filters: %w", err)
+	}
+
+	rewrites, err := newBundleRewrites(ctx, d, b.Rewrites)
+	if err != nil {
+		return fmt.Errorf("rewrites: %w", err)
+	}
+
+	// Update the safe search before changing anything else, since it's the
+	// only step that can fail after the preparations.
+	if replace && b.SafeSearch != nil && d.safeSearch != nil {
+		err = d.safeSearch.Update(ctx, *b.SafeSearch)
+		if err != nil {
+			return fmt.Errorf("updating safe search: %w", err)
+		}
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		d.importBundleGroups(b.FilterGroups, replace)
+		d.importBundleRewrites(rewrites, replace)
+		d.importBundleBlockedServices(b.BlockedServices, replace)
+
+		if replace && b.SafeSearch != nil {
+			d.conf.SafeSearchConf = *b.SafeSearch
+		}
+	}()
+
+	d.conf.filtersMu.Lock()
+	defer d.conf.filtersMu.Unlock()
+
+	if replace {
+		d.conf.Filters = d.replaceBundleFilters(ctx, d.conf.Filters, blockFilters)
+		d.conf.WhitelistFilters = d.replaceBundleFilters(ctx, d.conf.WhitelistFilters, allowFilters)
+		d.conf.UserRules = slices.Clone(b.UserRules)
+	} else {
+		d.mergeBundleFilters(&d.conf.Filters, blockFilters)
+		d.mergeBundleFilters(&d.conf.WhitelistFilters, allowFilters)
+		d.conf.UserRules = mergeUnique(d.conf.UserRules, b.UserRules, func(a, b string) (ok bool) {
+			return a == b
+		})
+	}
+
+	d.logger.InfoContext(
+		ctx,
+		"imported filtering bundle",
+		"mode", mode,
+		"filters", len(d.conf.Filters),
+		"whitelist_filters", len(d.conf.WhitelistFilters),
+	)
+
+	return nil
+}
+
+// newBundleFilters returns new filter lists for the bundle lists.  Each list
+// gets a new ID from idGen and a new UID.
+func newBundleFilters(
+	lists []*bundleFilterJSON,
+	idGen *idGenerator,
+	white bool,
+) (filters []FilterYAML, err error) {
+	filters = make([]FilterYAML, 0, len(lists))
+	for i, l := range lists {
+		flt := FilterYAML{
+			Enabled: l.Enabled,
+			URL:     l.URL,
+			Name:    l.Name,
+			white:   white,
+			Filter: Filter{
+				ID:    idGen.next(),
+				Group: l.Group,
+			},
+		}
+
+		err = flt.ensureUID()
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		filters = append(filters, flt)
+	}
+
+	return filters, nil
+}
+
+// newBundleRewrites returns the normalized legacy rewrites for the bundle
+// rewrites.
+func newBundleRewrites(
+	ctx context.Context,
+	d *DNSFilter,
+	entries []*rewriteEntryJSON,
+) (rewrites []*LegacyRewrite, err error) {
+	rewrites = make([]*LegacyRewrite, 0, len(entries))
+	for i, ent := range entries {
+		rw := ent.toLegacyRewrite(ent.Enabled != aghalg.NBFalse)
+		err = rw.normalize(ctx, d.logger)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		rewrites = append(rewrites, rw)
+	}
+
+	return rewrites, nil
+}
+
+// importBundleGroups replaces or merges the filter groups with groups.
+// d.confMu must be locked.
+func (d *DNSFilter) importBundleGroups(groups []*filterGroupJSON, replace bool) {
+	if replace {
+		d.conf.FilterGroups = nil
+	}
+
+	for _, g := range groups {
+		if d.hasFilterGroup(g.Name) {
+			continue
+		}
+
+		d.conf.FilterGroups = append(d.conf.FilterGroups, &FilterGroup{
+			Name: g.Name,
+			Tags: slices.Clone(g.Tags),
+		})
+	}
+}
+
+// importBundleRewrites replaces or merges the legacy rewrites with rewrites.
+// d.confMu must be locked.
+func (d *DNSFilter) importBundleRewrites(rewrites []*LegacyRewrite, replace bool) {
+	if replace {
+		d.setRewrites(rewrites)
+
+		return
+	}
+
+	d.setRewrites(mergeUnique(d.conf.Rewrites, rewrites, (*LegacyRewrite).equal))
+}
+
+// importBundleBlockedServices replaces or merges the blocked services with
+// bsvc, if it's not nil.  The blocked services are also replaced if there are
+// none yet.  d.confMu must be locked.
+func (d *DNSFilter) importBundleBlockedServices(bsvc *BlockedServices, replace bool) {
+	switch {
+	case bsvc == nil:
+		// Keep the current blocked services.
+	case replace, d.conf.BlockedServices == nil:
+		d.conf.BlockedServices = bsvc.Clone()
+		if d.conf.BlockedServices.Schedule == nil {
+			d.conf.BlockedServices.Schedule = schedule.EmptyWeekly()
+		}
+	default:
+		d.conf.BlockedServices.IDs = mergeUnique(
+			d.conf.BlockedServices.IDs,
+			bsvc.IDs,
+			func(a, b string) (ok bool) { return a == b },
+		)
+	}
+}
+
+// replaceBundleFilters returns the filter lists replacing cur.  The lists from
+// cur with the same URLs as the new ones keep their IDs and cached contents.
+// The cached contents of the other lists from cur are removed.
+// d.conf.filtersMu must be locked.
+func (d *DNSFilter) replaceBundleFilters(
+	ctx context.Context,
+	cur []FilterYAML,
+	newFilters []FilterYAML,
+) (res []FilterYAML) {
+	kept := container.NewMapSet[string]()
+	res = make([]FilterYAML, 0, len(newFilters))
+	for _, nf := range newFilters {
+		i := slices.IndexFunc(cur, func(f FilterYAML) (ok bool) { return f.URL == nf.URL })
+		if i == -1 {
+			res = append(res, nf)
+
+			continue
+		}
+
+		f := cur[i]
+		f.Name, f.Enabled, f.Group = nf.Name, nf.Enabled, nf.Group
+		if !f.Enabled {
+			d.lists.Unload(f.UID)
+		}
+
+		res = append(res, f)
+		kept.Add(f.URL)
+	}
+
+	for i := range cur {
+		f := &cur[i]
+		if kept.Has(f.URL) {
+			continue
+		}
+
+		err := d.removeFilterFiles(ctx, f)
+		if err != nil {
+			d.logger.WarnContext(ctx, "removing replaced filter", "id", f.ID, slogutil.KeyError, err)
+		}
+	}
+
+	return res
+}
+
+// mergeBundleFilters appends the lists from newFilters which URLs aren't used
+// by any list yet to filters.  d.conf.filtersMu must be locked.
+func (d *DNSFilter) mergeBundleFilters(filters *[]FilterYAML, newFilters []FilterYAML) {
+	for _, nf := range newFilters {
+		if !d.filterExistsLocked(nf.URL) {
+			*filters = append(*filters, nf)
+		}
+	}
+}
+
+// mergeUnique appends the items of add which aren't equal to any of the items
+// of orig to orig and returns it.
+func mergeUnique[T any](orig, add []T, eq func(a, b T) (ok bool)) (res []T) {
+	res = orig
+	for _, a := range add {
+		if !slices.ContainsFunc(res, func(o T) (ok bool) { return eq(o, a) }) {
+			res = append(res, a)
+		}
+	}
+
+	return res
+}
+
+// refreshNewFilters downloads the enabled filter lists which have never been
+// updated, for example because they have just been imported, and rebuilds the
+// filtering engines if needed.
+func (d *DNSFilter) refreshNewFilters(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, d.logger)
+
+	d.refreshLock.Lock()
+	defer d.refreshLock.Unlock()
+
+	updated, _, err := d.refreshFiltersIntl(true, true, true, func(flt *FilterYAML) (ok bool) {
+		return d.ruleListState(flt).Updated.IsZero()
+	})
+	if err != nil {
+		d.logger.ErrorContext(ctx, "refreshing new filters", slogutil.KeyError, err)
+	}
+
+	d.logger.DebugContext(ctx, "refreshed new filters", "updated", updated)
+}
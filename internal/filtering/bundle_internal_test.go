@@ -0,0 +1,392 @@
+package filtering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBundleTestFilter returns a new filter for the bundle tests with the
+// initial configuration.  confModCh receives a value on each configuration
+// change.
+func newBundleTestFilter(
+	tb testing.TB,
+	keptURL string,
+	removedURL string,
+) (d *DNSFilter, confModCh chan struct{}) {
+	tb.Helper()
+
+	confModCh = make(chan struct{}, 1)
+
+	d, err := New(&Config{
+		Logger:  testLogger,
+		DataDir: tb.TempDir(),
+		HTTPClient: &http.Client{
+			Timeout: testTimeout,
+		},
+		ConfModifier: &aghtest.ConfigModifier{
+			OnApply: func(_ context.Context) {
+				confModCh <- struct{}{}
+			},
+		},
+		HTTPReg: aghhttp.EmptyRegistrar{},
+	}, nil)
+	require.NoError(tb, err)
+	tb.Cleanup(d.Close)
+
+	d.Start()
+
+	d.conf.FilterGroups = []*FilterGroup{{
+		Name: "old",
+		Tags: []string{},
+	}}
+	d.conf.Filters = []FilterYAML{{
+		Enabled: true,
+		URL:     keptURL,
+		Name:    "Kept",
+		Filter:  Filter{ID: d.idGen.next()},
+	}, {
+		Enabled: true,
+		URL:     removedURL,
+		Name:    "Removed",
+		Filter: Filter{
+			ID:    d.idGen.next(),
+			Group: "old",
+		},
+	}}
+	d.conf.UserRules = []string{"||old.example^"}
+	d.conf.Rewrites = []*LegacyRewrite{{
+		Domain:  "old.example",
+		Answer:  "192.0.2.1",
+		Enabled: true,
+	}}
+	d.conf.BlockedServices = &BlockedServices{
+		Schedule: schedule.EmptyWeekly(),
+		IDs:      []string{"youtube"},
+	}
+
+	return d, confModCh
+}
+
+// importBundle sends the import request with b in the given mode to d and
+// returns the response code.
+func importBundle(tb testing.TB, d *DNSFilter, b *bundleJSON, mode bundleMode) (code int) {
+	tb.Helper()
+
+	body, err := json.Marshal(&bundleImportReq{
+		Bundle: b,
+		Mode:   mode,
+	})
+	require.NoError(tb, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(
+		http.MethodPost,
+		"/control/filtering/bundle/import",
+		bytes.NewReader(body),
+	)
+	d.handleBundleImport(w, r)
+
+	return w.Code
+}
+
+func TestDNSFilter_handleBundleExport(t *testing.T) {
+	const fltURL = "https://filters.example/list.txt"
+
+	d, _ := newBundleTestFilter(t, fltURL, "https://filters.example/other.txt")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/control/filtering/bundle/export", nil)
+	d.handleBundleExport(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Contains(t, w.Header().Get(httphdr.ContentDisposition), bundleFileName)
+
+	got := &bundleJSON{}
+	err := json.NewDecoder(w.Body).Decode(got)
+	require.NoError(t, err)
+
+	assert.Equal(t, bundleVersion, got.Version)
+	assert.Equal(t, []string{"||old.example^"}, got.UserRules)
+	assert.Empty(t, got.WhitelistFilters)
+
+	require.Len(t, got.Filters, 2)
+	assert.Equal(t, &bundleFilterJSON{
+		URL:     fltURL,
+		Name:    "Kept",
+		Enabled: true,
+	}, got.Filters[0])
+	assert.Equal(t, "old", got.Filters[1].Group)
+
+	require.Len(t, got.Rewrites, 1)
+	assert.Equal(t, "old.example", got.Rewrites[0].Domain)
+
+	require.NotNil(t, got.BlockedServices)
+	assert.Equal(t, []string{"youtube"}, got.BlockedServices.IDs)
+	assert.NotNil(t, got.SafeSearch)
+}
+
+func TestDNSFilter_handleBundleImport(t *testing.T) {
+	// Initialize the blocked services to validate the ones from the bundle.
+	InitModule(testutil.ContextWithTimeout(t, testTimeout), testLogger)
+
+	keptURL := serveFiltersLocally(t, []byte("||kept.example^\n"))
+	removedURL := serveFiltersLocally(t, []byte("||removed.example^\n"))
+	newURL := serveFiltersLocally(t, []byte("||new.example^\n"))
+
+	newBundle := func() (b *bundleJSON) {
+		return &bundleJSON{
+			BlockedServices: &BlockedServices{
+				IDs: []string{"tiktok"},
+			},
+			Filters: []*bundleFilterJSON{{
+				URL:     keptURL,
+				Name:    "Renamed",
+				Group:   "new",
+				Enabled: true,
+			}},
+			WhitelistFilters: []*bundleFilterJSON{{
+				URL:     newURL,
+				Name:    "New",
+				Enabled: true,
+			}},
+			FilterGroups: []*filterGroupJSON{{
+				Name: "new",
+				Tags: []string{"device_tv"},
+			}},
+			UserRules: []string{"||new.example^"},
+			Rewrites: []*rewriteEntryJSON{{
+				Domain: "new.example",
+				Answer: "192.0.2.2",
+			}},
+			Version: bundleVersion,
+		}
+	}
+
+	t.Run("replace", func(t *testing.T) {
+		d, confModCh := newBundleTestFilter(t, keptURL, removedURL)
+		keptID := d.conf.Filters[0].ID
+
+		code := importBundle(t, d, newBundle(), bundleModeReplace)
+		require.Equal(t, http.StatusOK, code)
+
+		testutil.RequireReceive(t, confModCh, testTimeout)
+
+		d.conf.filtersMu.RLock()
+		require.Len(t, d.conf.Filters, 1)
+		assert.Equal(t, keptID, d.conf.Filters[0].ID)
+		assert.Equal(t, "Renamed", d.conf.Filters[0].Name)
+		assert.Equal(t, "new", d.conf.Filters[0].Group)
+
+		require.Len(t, d.conf.WhitelistFilters, 1)
+		assert.NotEmpty(t, d.conf.WhitelistFilters[0].UID)
+		assert.Equal(t, []string{"||new.example^"}, d.conf.UserRules)
+		d.conf.filtersMu.RUnlock()
+
+		d.confMu.RLock()
+		require.Len(t, d.conf.FilterGroups, 1)
+		assert.Equal(t, "new", d.conf.FilterGroups[0].Name)
+
+		require.Len(t, d.conf.Rewrites, 1)
+		assert.Equal(t, "new.example", d.conf.Rewrites[0].Domain)
+		assert.True(t, d.conf.Rewrites[0].Enabled)
+
+		assert.Equal(t, []string{"tiktok"}, d.conf.BlockedServices.IDs)
+		assert.NotNil(t, d.conf.BlockedServices.Schedule)
+		d.confMu.RUnlock()
+
+		// The new list must be downloaded in the background.
+		require.Eventually(t, func() (ok bool) {
+			d.conf.filtersMu.RLock()
+			defer d.conf.filtersMu.RUnlock()
+
+			return !d.ruleListState(&d.conf.WhitelistFilters[0]).Updated.IsZero()
+		}, testTimeout, testTimeout/10)
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		d, confModCh := newBundleTestFilter(t, keptURL, removedURL)
+
+		code := importBundle(t, d, newBundle(), bundleModeMerge)
+		require.Equal(t, http.StatusOK, code)
+
+		testutil.RequireReceive(t, confModCh, testTimeout)
+
+		d.conf.filtersMu.RLock()
+		require.Len(t, d.conf.Filters, 2)
+		assert.Equal(t, "Kept", d.conf.Filters[0].Name)
+
+		require.Len(t, d.conf.WhitelistFilters, 1)
+		assert.Equal(t, newURL, d.conf.WhitelistFilters[0].URL)
+		assert.Equal(t, []string{"||old.example^", "||new.example^"}, d.conf.UserRules)
+		d.conf.filtersMu.RUnlock()
+
+		d.confMu.RLock()
+		assert.Len(t, d.conf.FilterGroups, 2)
+		assert.Len(t, d.conf.Rewrites, 2)
+		assert.Equal(t, []string{"youtube", "tiktok"}, d.conf.BlockedServices.IDs)
+		d.confMu.RUnlock()
+
+		require.Eventually(t, func() (ok bool) {
+			d.conf.filtersMu.RLock()
+			defer d.conf.filtersMu.RUnlock()
+
+			return !d.ruleListState(&d.conf.WhitelistFilters[0]).Updated.IsZero()
+		}, testTimeout, testTimeout/10)
+	})
+
+	t.Run("merge_no_blocked_services", func(t *testing.T) {
+		d, confModCh := newBundleTestFilter(t, keptURL, removedURL)
+		d.conf.BlockedServices = nil
+
+		code := importBundle(t, d, newBundle(), bundleModeMerge)
+		require.Equal(t, http.StatusOK, code)
+
+		testutil.RequireReceive(t, confModCh, testTimeout)
+
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		require.NotNil(t, d.conf.BlockedServices)
+		assert.Equal(t, []string{"tiktok"}, d.conf.BlockedServices.IDs)
+		assert.NotNil(t, d.conf.BlockedServices.Schedule)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		d, _ := newBundleTestFilter(t, keptURL, removedURL)
+
+		testCases := []struct {
+			modify   func(b *bundleJSON)
+			name     string
+			mode     bundleMode
+			wantCode int
+		}{{
+			modify:   func(b *bundleJSON) { b.Version = bundleVersion + 1 },
+			name:     "bad_version",
+			mode:     bundleModeReplace,
+			wantCode: http.StatusUnprocessableEntity,
+		}, {
+			modify:   func(_ *bundleJSON) {},
+			name:     "bad_mode",
+			mode:     "append",
+			wantCode: http.StatusUnprocessableEntity,
+		}, {
+			modify: func(b *bundleJSON) {
+				b.WhitelistFilters = append(b.WhitelistFilters, b.Filters[0])
+			},
+			name:     "duplicate_url",
+			mode:     bundleModeReplace,
+			wantCode: http.StatusUnprocessableEntity,
+		}, {
+			modify:   func(b *bundleJSON) { b.FilterGroups = nil },
+			name:     "unknown_group",
+			mode:     bundleModeReplace,
+			wantCode: http.StatusUnprocessableEntity,
+		}, {
+			modify:   func(b *bundleJSON) { b.Rewrites[0].Answer = "" },
+			name:     "empty_answer",
+			mode:     bundleModeMerge,
+			wantCode: http.StatusUnprocessableEntity,
+		}}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				b := newBundle()
+				tc.modify(b)
+
+				code := importBundle(t, d, b, tc.mode)
+				assert.Equal(t, tc.wantCode, code)
+
+				d.conf.filtersMu.RLock()
+				defer d.conf.filtersMu.RUnlock()
+
+				assert.Len(t, d.conf.Filters, 2)
+				assert.Equal(t, []string{"||old.example^"}, d.conf.UserRules)
+			})
+		}
+	})
+}
+
+func TestDNSFilter_Import(t *testing.T) {
+	keptURL := serveFiltersLocally(t, []byte("||kept.example^\n"))
+	removedURL := serveFiltersLocally(t, []byte("||removed.example^\n"))
+	newURL := serveFiltersLocally(t, []byte("||new.example^\n"))
+
+	d, confModCh := newBundleTestFilter(t, keptURL, removedURL)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	skipped, err := d.Import(ctx, &ImportConfig{
+		FilterGroups: []*FilterGroup{{
+			Name: "kids",
+		}},
+		Filters: []FilterYAML{{
+			Enabled: true,
+			URL:     keptURL,
+			Name:    "Kept again",
+		}, {
+			Enabled: true,
+			URL:     newURL,
+			Name:    "New",
+			Filter: Filter{
+				Group: "kids",
+			},
+		}, {
+			Enabled: true,
+			URL:     "ftp://lists.example/bad.txt",
+			Name:    "Bad",
+		}},
+		UserRules: []string{"||old.example^", "|new.example^"},
+		Rewrites: []*rewrite.Item{{
+			Domain: "nas.lan",
+			Answer: "192.0.2.10",
+		}, {
+			Domain: "bad.lan",
+			Answer: "",
+		}},
+	})
+	require.NoError(t, err)
+
+	testutil.RequireReceive(t, confModCh, testTimeout)
+
+	require.Len(t, skipped, 2)
+
+	testutil.AssertErrorMsg(
+		t,
+		`filter "ftp://lists.example/bad.txt": checking filter: bad http(s) url `+
+			`"ftp://lists.example/bad.txt": scheme: bad enum value: "ftp"; want "http" or "https"`,
+		skipped[0],
+	)
+	testutil.AssertErrorMsg(t, `rewrite "bad.lan": answer: empty value`, skipped[1])
+
+	d.conf.filtersMu.RLock()
+	require.Len(t, d.conf.Filters, 3)
+	assert.Equal(t, "Kept", d.conf.Filters[0].Name)
+	assert.Equal(t, "kids", d.conf.Filters[2].Group)
+	assert.Equal(t, []string{"||old.example^", "|new.example^"}, d.conf.UserRules)
+	d.conf.filtersMu.RUnlock()
+
+	d.confMu.RLock()
+	assert.Len(t, d.conf.FilterGroups, 2)
+	require.Len(t, d.conf.Rewrites, 2)
+	assert.Equal(t, "nas.lan", d.conf.Rewrites[1].Domain)
+	d.confMu.RUnlock()
+
+	require.Eventually(t, func() (ok bool) {
+		d.conf.filtersMu.RLock()
+		defer d.conf.filtersMu.RUnlock()
+
+		return !d.ruleListState(&d.conf.Filters[2]).Updated.IsZero()
+	}, testTimeout, testTimeout/10)
+}
@@ -0,0 +1,399 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// CheckerType is the type of a named checker.
+type CheckerType string
+
+// CheckerType values.
+const (
+	// CheckerTypeHTTPJSON is a checker that looks up hosts using an HTTP API
+	// responding with JSON.
+	CheckerTypeHTTPJSON CheckerType = "http_json"
+
+	// CheckerTypeDNSBL is a checker that looks up hosts using a DNS-based
+	// blocklist by resolving "<host>.<zone>".
+	CheckerTypeDNSBL CheckerType = "dnsbl"
+
+	// CheckerTypeHashSet is a checker that looks up hosts in a set of SHA256
+	// hashes of hostnames loaded from a file or a URL.
+	CheckerTypeHashSet CheckerType = "hash_set"
+)
+
+// CheckerReason is the reason with which a named checker blocks hosts.
+type CheckerReason string
+
+// CheckerReason values.
+const (
+	// CheckerReasonSafeBrowsing means that the hosts are blocked as malicious
+	// or phishing ones, see [FilteredSafeBrowsing].
+	CheckerReasonSafeBrowsing CheckerReason = "safe_browsing"
+
+	// CheckerReasonParental means that the hosts are blocked by the parental
+	// control, see [FilteredParental].
+	CheckerReasonParental CheckerReason = "parental"
+)
+
+// HostPlaceholder is the placeholder for the checked host within the URL of an
+// HTTP JSON checker.
+const HostPlaceholder = "{host}"
+
+// CheckerConfig is the configuration of a named checker, such as a
+// threat-intelligence lookup service.
+type CheckerConfig struct {
+	// Name is the unique name of the checker.  It must not be empty.
+	Name string `yaml:"name"`
+
+	// Type is the type of the checker.
+	Type CheckerType `yaml:"type"`
+
+	// URL is the URL of the lookup API for [CheckerTypeHTTPJSON] checkers,
+	// which must contain [HostPlaceholder], or the URL or the absolute path of
+	// the hash set for [CheckerTypeHashSet] checkers.
+	URL string `yaml:"url,omitempty"`
+
+	// Upstream is the address of the DNS server used by [CheckerTypeDNSBL]
+	// checkers.
+	Upstream string `yaml:"upstream,omitempty"`
+
+	// Zone is the domain name of the DNS-based blocklist used by
+	// [CheckerTypeDNSBL] checkers.
+	Zone string `yaml:"zone,omitempty"`
+
+	// Reason is the reason with which the hosts are blocked.  If it's empty,
+	// [CheckerReasonSafeBrowsing] is used.
+	Reason CheckerReason `yaml:"reason"`
+
+	// Timeout is the timeout for a single lookup.  It must not be negative.  If
+	// it's zero, the default timeout is used.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// CacheTTL is the time during which the results of lookups are cached.
+	// If it's zero, the default TTL is used.  The failed lookups are cached
+	// for a shorter time.
+	CacheTTL timeutil.Duration `yaml:"cache_ttl"`
+
+	// CacheSize is the size of the results cache in bytes.  If it's zero, the
+	// cache size is unlimited.
+	CacheSize uint `yaml:"cache_size"`
+
+	// Enabled defines if the checker is applied to the clients without their
+	// own settings.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Validate returns an error if c is invalid.
+func (c *CheckerConfig) Validate() (err error) {
+	switch {
+	case c == nil:
+		return errors.ErrNoValue
+	case c.Name == "":
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case c.Timeout < 0:
+		return fmt.Errorf("timeout: %w: %s", errors.ErrNegative, c.Timeout)
+	case c.CacheTTL < 0:
+		return fmt.Errorf("cache_ttl: %w: %s", errors.ErrNegative, c.CacheTTL)
+	}
+
+	switch c.Reason {
+	case "", CheckerReasonSafeBrowsing, CheckerReasonParental:
+		// Go on.
+	default:
+		return fmt.Errorf("reason: %w: %q", errors.ErrBadEnumValue, c.Reason)
+	}
+
+	switch c.Type {
+	case CheckerTypeHTTPJSON:
+		return validateCheckerURL(c.URL)
+	case CheckerTypeDNSBL:
+		if c.Upstream == "" {
+			return fmt.Errorf("upstream: %w", errors.ErrEmptyValue)
+		} else if c.Zone == "" {
+			return fmt.Errorf("zone: %w", errors.ErrEmptyValue)
+		}
+
+		return nil
+	case CheckerTypeHashSet:
+		err = hashprefix.ValidateSource(c.URL)
+		if err != nil {
+			return fmt.Errorf("url: %w", err)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("type: %w: %q", errors.ErrBadEnumValue, c.Type)
+	}
+}
+
+// validateCheckerURL returns an error if the URL of an HTTP JSON checker is
+// invalid.
+func validateCheckerURL(urlStr string) (err error) {
+	if urlStr == "" {
+		return fmt.Errorf("url: %w", errors.ErrEmptyValue)
+	} else if !strings.Contains(urlStr, HostPlaceholder) {
+		return fmt.Errorf("url: no %s placeholder", HostPlaceholder)
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url: scheme: %w: %q", errors.ErrBadEnumValue, u.Scheme)
+	}
+
+	return nil
+}
+
+// ValidateCheckers returns an error if any of the named checker configurations
+// is invalid or if their names aren't unique.
+func ValidateCheckers(confs []*CheckerConfig) (err error) {
+	names := container.NewMapSet[string]()
+	for i, c := range confs {
+		err = c.Validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		if names.Has(c.Name) {
+			return fmt.Errorf("at index %d: name: %w: %q", i, errors.ErrDuplicated, c.Name)
+		}
+
+		names.Add(c.Name)
+	}
+
+	return nil
+}
+
+// NamedChecker is a checker with a name and a blocking reason.
+type NamedChecker struct {
+	// Checker checks the hosts.  It must not be nil.
+	Checker Checker
+
+	// Name is the unique name of the checker.
+	Name string
+
+	// Reason is the reason with which the hosts are blocked.
+	Reason CheckerReason
+
+	// Enabled defines if the checker is applied to the clients without their
+	// own settings.
+	Enabled bool
+}
+
+// enabledCheckers returns the names of the named checkers applied to the
+// clients without their own settings.
+func (d *DNSFilter) enabledCheckers() (names []string) {
+	for _, nc := range d.namedCheckers {
+		if nc.Enabled {
+			names = append(names, nc.Name)
+		}
+	}
+
+	return names
+}
+
+// registeredChecker is a checker within the checker registry of [DNSFilter].
+type registeredChecker struct {
+	// checker checks the hosts.  It must not be nil.
+	checker Checker
+
+	// isEnabled returns true if the checker is applied with setts.  It must
+	// not be nil.
+	isEnabled func(setts *Settings) (ok bool)
+
+	// name is the name of the checker used for logging.
+	name string
+
+	// logMsg is the message with which the lookups are logged.
+	logMsg string
+
+	// ruleText is the text of the result rule.
+	ruleText string
+
+	// listID is the ID of the filtering-rule list of the result rule.
+	listID rulelist.APIID
+
+	// reason is the reason of the result.
+	reason Reason
+
+	// isNamed is true if the checker is one of the named checkers.  The errors
+	// of the named checkers are logged instead of being returned, so that an
+	// unavailable lookup service doesn't break resolving.
+	isNamed bool
+}
+
+// result returns the filtering result for the host blocked by rc.
+func (rc *registeredChecker) result() (res Result) {
+	return Result{
+		Rules: []*ResultRule{{
+			Text:         rc.ruleText,
+			FilterListID: rc.listID,
+		}},
+		Reason:     rc.reason,
+		IsFiltered: true,
+	}
+}
+
+// newCheckerRegistry returns the registry of all checkers in the order of
+// application: safe browsing, parental control, and the named checkers.  sb and
+// pc are skipped if nil.
+func newCheckerRegistry(sb, pc Checker, named []*NamedChecker) (reg []*registeredChecker) {
+	if sb != nil {
+		reg = append(reg, &registeredChecker{
+			checker: sb,
+			isEnabled: func(setts *Settings) (ok bool) {
+				return setts.SafeBrowsingEnabled
+			},
+			name:     "safebrowsing",
+			logMsg:   "safebrowsing lookup",
+			ruleText: "adguard-malware-shavar",
+			listID:   rulelist.APIIDSafeBrowsing,
+			reason:   FilteredSafeBrowsing,
+		})
+	}
+
+	if pc != nil {
+		reg = append(reg, &registeredChecker{
+			checker: pc,
+			isEnabled: func(setts *Settings) (ok bool) {
+				return setts.ParentalEnabled
+			},
+			name:     "parental",
+			logMsg:   "parental lookup",
+			ruleText: "parental CATEGORY_BLACKLISTED",
+			listID:   rulelist.APIIDParentalControl,
+			reason:   FilteredParental,
+		})
+	}
+
+	for _, nc := range named {
+		rc := &registeredChecker{
+			checker: nc.Checker,
+			isEnabled: func(setts *Settings) (ok bool) {
+				return slices.Contains(setts.Checkers, nc.Name)
+			},
+			name:     nc.Name,
+			logMsg:   "named checker lookup",
+			ruleText: nc.Name,
+			listID:   rulelist.APIIDSafeBrowsing,
+			reason:   FilteredSafeBrowsing,
+			isNamed:  true,
+		}
+
+		if nc.Reason == CheckerReasonParental {
+			rc.listID = rulelist.APIIDParentalControl
+			rc.reason = FilteredParental
+		}
+
+		reg = append(reg, rc)
+	}
+
+	return reg
+}
+
+// closeCheckers closes the checkers from the registry that implement
+// [io.Closer].  Errors are logged.
+func (d *DNSFilter) closeCheckers(ctx context.Context) {
+	for _, rc := range d.checkers {
+		closer, ok := rc.checker.(io.Closer)
+		if !ok {
+			continue
+		}
+
+		err := closer.Close()
+		if err != nil {
+			d.logger.ErrorContext(ctx, "closing checker", "checker", rc.name, slogutil.KeyError, err)
+		}
+	}
+}
+
+// checkRegistered checks host with the checkers from the registry enabled
+// within setts.  Matches [hostChecker.check].
+func (d *DNSFilter) checkRegistered(
+	host string,
+	_ uint16,
+	setts *Settings,
+) (res Result, err error) {
+	if !setts.ProtectionEnabled {
+		return Result{}, nil
+	}
+
+	// TODO(s.chzhen):  Pass context.
+	ctx := context.TODO()
+
+	for _, rc := range d.checkers {
+		if !rc.isEnabled(setts) {
+			continue
+		}
+
+		start := time.Now()
+		block, checkErr := rc.checker.Check(host)
+		d.logger.DebugContext(
+			ctx,
+			rc.logMsg,
+			"host", host,
+			"checker", rc.name,
+			"blocked", block,
+			"elapsed", time.Since(start),
+		)
+
+		switch {
+		case checkErr == nil:
+			if block {
+				return rc.result(), nil
+			}
+		case rc.isNamed:
+			d.logger.ErrorContext(
+				ctx,
+				"checking host",
+				"checker", rc.name,
+				"host", host,
+				slogutil.KeyError, checkErr,
+			)
+		default:
+			return Result{}, fmt.Errorf("%s: %w", rc.name, checkErr)
+		}
+	}
+
+	return Result{}, nil
+}
+
+// ValidateCheckerNames returns an error if names contain empty, duplicated, or
+// unknown names of the named checkers from confs.
+func ValidateCheckerNames(confs []*CheckerConfig, names []string) (err error) {
+	known := container.NewMapSet[string]()
+	for _, c := range confs {
+		known.Add(c.Name)
+	}
+
+	set := container.NewMapSet[string]()
+	for i, n := range names {
+		switch {
+		case n == "":
+			return fmt.Errorf("at index %d: %w", i, errors.ErrEmptyValue)
+		case set.Has(n):
+			return fmt.Errorf("at index %d: %w: %q", i, errors.ErrDuplicated, n)
+		case !known.Has(n):
+			return fmt.Errorf("at index %d: unknown checker %q", i, n)
+		}
+
+		set.Add(n)
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package filtering
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/service"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkerFunc is a function that implements the [Checker] interface.
+type checkerFunc func(host string) (block bool, err error)
+
+// type check
+var _ Checker = checkerFunc(nil)
+
+// Check implements the [Checker] interface for checkerFunc.
+func (f checkerFunc) Check(host string) (block bool, err error) {
+	return f(host)
+}
+
+func TestDNSFilter_CheckHost_namedCheckers(t *testing.T) {
+	const (
+		threatHost = "threat.example"
+		adultHost  = "adult.example"
+	)
+
+	newHostChecker := func(blocked string) (c Checker) {
+		return checkerFunc(func(host string) (block bool, err error) {
+			return host == blocked, nil
+		})
+	}
+
+	d, setts := newForTest(t, &Config{
+		NamedCheckers: []*NamedChecker{{
+			Checker: checkerFunc(func(_ string) (block bool, err error) {
+				return false, errors.Error("unavailable")
+			}),
+			Name:    "broken",
+			Reason:  CheckerReasonSafeBrowsing,
+			Enabled: true,
+		}, {
+			Checker: newHostChecker(threatHost),
+			Name:    "threat_intel",
+			Reason:  CheckerReasonSafeBrowsing,
+			Enabled: true,
+		}, {
+			Checker: newHostChecker(adultHost),
+			Name:    "adult",
+			Reason:  CheckerReasonParental,
+			Enabled: false,
+		}},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	assert.Equal(t, []string{"broken", "threat_intel"}, d.Settings().Checkers)
+
+	testCases := []struct {
+		name       string
+		host       string
+		checkers   []string
+		wantRule   string
+		wantListID rulelist.APIID
+		wantReason Reason
+	}{{
+		name:       "safe_browsing",
+		host:       threatHost,
+		checkers:   []string{"broken", "threat_intel"},
+		wantRule:   "threat_intel",
+		wantListID: rulelist.APIIDSafeBrowsing,
+		wantReason: FilteredSafeBrowsing,
+	}, {
+		name:       "parental",
+		host:       adultHost,
+		checkers:   []string{"adult"},
+		wantRule:   "adult",
+		wantListID: rulelist.APIIDParentalControl,
+		wantReason: FilteredParental,
+	}, {
+		name:       "not_selected",
+		host:       adultHost,
+		checkers:   []string{"threat_intel"},
+		wantRule:   "",
+		wantReason: NotFilteredNotFound,
+	}, {
+		name:       "error",
+		host:       "other.example",
+		checkers:   []string{"broken"},
+		wantRule:   "",
+		wantReason: NotFilteredNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := *setts
+			s.Checkers = tc.checkers
+
+			res, err := d.CheckHost(tc.host, dns.TypeA, &s)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantReason, res.Reason)
+			if tc.wantRule == "" {
+				assert.Empty(t, res.Rules)
+
+				return
+			}
+
+			require.Len(t, res.Rules, 1)
+
+			assert.Equal(t, tc.wantRule, res.Rules[0].Text)
+			assert.Equal(t, tc.wantListID, res.Rules[0].FilterListID)
+		})
+	}
+}
+
+func TestValidateCheckers(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		confs      []*CheckerConfig
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		confs: []*CheckerConfig{{
+			Name: "http",
+			Type: CheckerTypeHTTPJSON,
+			URL:  "https://lookup.example/check?host=" + HostPlaceholder,
+		}, {
+			Name:     "dnsbl",
+			Type:     CheckerTypeDNSBL,
+			Upstream: "1.1.1.1",
+			Zone:     "dnsbl.example",
+			Reason:   CheckerReasonParental,
+			Timeout:  timeutil.Duration(testTimeout),
+		}, {
+			Name: "hashes",
+			Type: CheckerTypeHashSet,
+			URL:  "https://hashes.example/list.txt",
+		}},
+	}, {
+		name:       "no_placeholder",
+		wantErrMsg: "at index 0: url: no {host} placeholder",
+		confs: []*CheckerConfig{{
+			Name: "http",
+			Type: CheckerTypeHTTPJSON,
+			URL:  "https://lookup.example/check",
+		}},
+	}, {
+		name:       "no_zone",
+		wantErrMsg: "at index 0: zone: empty value",
+		confs: []*CheckerConfig{{
+			Name:     "dnsbl",
+			Type:     CheckerTypeDNSBL,
+			Upstream: "1.1.1.1",
+		}},
+	}, {
+		name:       "bad_reason",
+		wantErrMsg: `at index 0: reason: bad enum value: "ads"`,
+		confs: []*CheckerConfig{{
+			Name:   "hashes",
+			Type:   CheckerTypeHashSet,
+			URL:    "https://hashes.example/list.txt",
+			Reason: "ads",
+		}},
+	}, {
+		name:       "bad_type",
+		wantErrMsg: `at index 0: type: bad enum value: "ldap"`,
+		confs: []*CheckerConfig{{
+			Name: "ldap",
+			Type: "ldap",
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `at index 1: name: duplicated value: "hashes"`,
+		confs: []*CheckerConfig{{
+			Name: "hashes",
+			Type: CheckerTypeHashSet,
+			URL:  "/var/lib/hashes.txt",
+		}, {
+			Name: "hashes",
+			Type: CheckerTypeHashSet,
+			URL:  "/var/lib/other.txt",
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, ValidateCheckers(tc.confs))
+		})
+	}
+}
+
+func TestValidateCheckerNames(t *testing.T) {
+	confs := []*CheckerConfig{{
+		Name: "hashes",
+	}}
+
+	testutil.AssertErrorMsg(t, "", ValidateCheckerNames(confs, []string{"hashes"}))
+	testutil.AssertErrorMsg(
+		t,
+		`at index 1: duplicated value: "hashes"`,
+		ValidateCheckerNames(confs, []string{"hashes", "hashes"}),
+	)
+	testutil.AssertErrorMsg(
+		t,
+		`at index 0: unknown checker "other"`,
+		ValidateCheckerNames(confs, []string{"other"}),
+	)
+}
+
+// refresherChecker is a [Checker] that counts its refreshes.
+type refresherChecker struct {
+	checkerFunc
+
+	refreshes int
+}
+
+// type check
+var _ service.Refresher = (*refresherChecker)(nil)
+
+// Refresh implements the [service.Refresher] interface for *refresherChecker.
+func (c *refresherChecker) Refresh(_ context.Context) (err error) {
+	c.refreshes++
+
+	return nil
+}
+
+func TestDNSFilter_refreshCheckers(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	c := &refresherChecker{
+		checkerFunc: func(_ string) (block bool, err error) {
+			return false, nil
+		},
+	}
+
+	d, _ := newForTest(t, &Config{
+		NamedCheckers: []*NamedChecker{{
+			Checker: c,
+			Name:    "db",
+			Reason:  CheckerReasonSafeBrowsing,
+			Enabled: true,
+		}},
+		FiltersUpdateIntervalHours: 0,
+	}, nil)
+	t.Cleanup(d.Close)
+
+	d.refreshCheckers(ctx)
+	assert.Equal(t, 1, c.refreshes)
+
+	d.refreshCheckers(ctx)
+	assert.Equal(t, 1, c.refreshes)
+
+	d.conf.FiltersUpdateIntervalHours = 1
+	d.checkersRefreshed = time.Now().Add(-2 * time.Hour)
+
+	d.refreshCheckers(ctx)
+	assert.Equal(t, 2, c.refreshes)
+}
+
+// closerChecker is a [Checker] that counts its closings.
+type closerChecker struct {
+	checkerFunc
+
+	closes int
+}
+
+// type check
+var _ io.Closer = (*closerChecker)(nil)
+
+// Close implements the [io.Closer] interface for *closerChecker.
+func (c *closerChecker) Close() (err error) {
+	c.closes++
+
+	return nil
+}
+
+func TestDNSFilter_Close_checkers(t *testing.T) {
+	c := &closerChecker{
+		checkerFunc: func(_ string) (block bool, err error) {
+			return false, nil
+		},
+	}
+
+	d, _ := newForTest(t, &Config{
+		NamedCheckers: []*NamedChecker{{
+			Checker: c,
+			Name:    "dnsbl",
+			Reason:  CheckerReasonSafeBrowsing,
+			Enabled: true,
+		}},
+	}, nil)
+
+	d.Close()
+	assert.Equal(t, 1, c.closes)
+}
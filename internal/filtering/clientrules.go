@@ -0,0 +1,187 @@
+package filtering
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/urlfilter"
+)
+
+// ClientRules is a compiled list of custom filtering rules of a single client
+// or client tag.  It's safe for concurrent use.
+type ClientRules struct {
+	// engine is the filtering engine built from the rules.
+	engine *urlfilter.DNSEngine
+}
+
+// NewClientRules compiles the custom filtering rules of a client or a client
+// tag.  cr is nil if userRules contain no rules.
+func NewClientRules(userRules []string) (cr *ClientRules, err error) {
+	if !slices.ContainsFunc(userRules, isRuleLine) {
+		return nil, nil
+	}
+
+	// The rule storage of a list created from bytes doesn't hold any
+	// resources, so there is no need to close it.
+	rs, err := newRuleStorage([]Filter{{
+		ID:   rulelist.IDClientCustom,
+		Data: []byte(strings.Join(userRules, "\n")),
+	}})
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	return &ClientRules{
+		engine: urlfilter.NewDNSEngine(rs),
+	}, nil
+}
+
+// isRuleLine returns true if line is neither empty nor a comment.
+func isRuleLine(line string) (ok bool) {
+	line = strings.TrimSpace(line)
+
+	return line != "" && line[0] != '!' && line[0] != '#'
+}
+
+// TagRules are the custom filtering rules applied to all clients with a tag.
+type TagRules struct {
+	// Tag is the client tag.  It must not be empty.
+	Tag string `yaml:"tag"`
+
+	// Rules are the filtering rules.
+	Rules []string `yaml:"rules"`
+}
+
+// compileTagRules validates tagRules and compiles the rules of each tag.
+func compileTagRules(tagRules []*TagRules) (compiled map[string]*ClientRules, err error) {
+	defer func() { err = errors.Annotate(err, "tag_rules: %w") }()
+
+	compiled = make(map[string]*ClientRules, len(tagRules))
+	tags := container.NewMapSet[string]()
+	for i, tr := range tagRules {
+		switch {
+		case tr == nil:
+			return nil, fmt.Errorf("at index %d: %w", i, errors.ErrNoValue)
+		case tr.Tag == "":
+			return nil, fmt.Errorf("at index %d: tag: %w", i, errors.ErrEmptyValue)
+		case tags.Has(tr.Tag):
+			return nil, fmt.Errorf("at index %d: tag: %w: %q", i, errors.ErrDuplicated, tr.Tag)
+		default:
+			tags.Add(tr.Tag)
+		}
+
+		var cr *ClientRules
+		cr, err = NewClientRules(tr.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		if cr != nil {
+			compiled[tr.Tag] = cr
+		}
+	}
+
+	return compiled, nil
+}
+
+// applyTagRules adds the custom filtering rules of the client tags from setts
+// to setts.  setts must not be nil.
+func (d *DNSFilter) applyTagRules(setts *Settings) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	for _, t := range setts.ClientTags {
+		if cr := d.tagRules[t]; cr != nil {
+			setts.ClientRules = append(setts.ClientRules, cr)
+		}
+	}
+}
+
+// tagRulesJSON is the JSON representation of a [TagRules].
+type tagRulesJSON struct {
+	Tag   string   `json:"tag"`
+	Rules []string `json:"rules"`
+}
+
+// tagRulesListJSON is the request and response body for the tag rules HTTP API.
+type tagRulesListJSON struct {
+	Tags []*tagRulesJSON `json:"tags"`
+}
+
+// handleTagRules is the handler for the GET /control/filtering/tag_rules HTTP
+// API.
+func (d *DNSFilter) handleTagRules(w http.ResponseWriter, r *http.Request) {
+	resp := &tagRulesListJSON{
+		Tags: []*tagRulesJSON{},
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		for _, tr := range d.conf.TagRules {
+			resp.Tags = append(resp.Tags, &tagRulesJSON{
+				Tag:   tr.Tag,
+				Rules: slices.Clone(tr.Rules),
+			})
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
+}
+
+// handleTagRulesUpdate is the handler for the PUT
+// /control/filtering/tag_rules/update HTTP API.
+func (d *DNSFilter) handleTagRulesUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	req := &tagRulesListJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	tagRules := make([]*TagRules, 0, len(req.Tags))
+	for _, tr := range req.Tags {
+		if tr == nil {
+			tagRules = append(tagRules, nil)
+
+			continue
+		}
+
+		tagRules = append(tagRules, &TagRules{
+			Tag:   tr.Tag,
+			Rules: tr.Rules,
+		})
+	}
+
+	compiled, err := compileTagRules(tagRules)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		d.conf.TagRules = tagRules
+		d.tagRules = compiled
+	}()
+
+	l.DebugContext(ctx, "updated tag rules", "num", len(tagRules))
+
+	d.conf.ConfModifier.Apply(ctx)
+}
@@ -0,0 +1,250 @@
+package filtering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientRules(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rules   []string
+		wantNil bool
+	}{{
+		name:    "nil",
+		rules:   nil,
+		wantNil: true,
+	}, {
+		name:    "comments",
+		rules:   []string{"! Comment", "", "# Comment"},
+		wantNil: true,
+	}, {
+		name:    "rules",
+		rules:   []string{"! Comment", "||example.org^"},
+		wantNil: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cr, err := NewClientRules(tc.rules)
+			require.NoError(t, err)
+
+			if tc.wantNil {
+				assert.Nil(t, cr)
+			} else {
+				assert.NotNil(t, cr)
+			}
+		})
+	}
+}
+
+func TestDNSFilter_ApplyAdditionalFiltering_clientRules(t *testing.T) {
+	const (
+		globalRules = "||global.example^\n" +
+			"||unblocked.example^\n"
+
+		clientID = "client"
+	)
+
+	clientRules, err := NewClientRules([]string{
+		"@@||unblocked.example^",
+		"||client.example^",
+	})
+	require.NoError(t, err)
+
+	d, _ := newForTest(t, &Config{
+		ApplyClientFiltering: func(id string, _ netip.Addr, setts *Settings) {
+			if id != clientID {
+				return
+			}
+
+			setts.ClientTags = []string{"device_tv"}
+			setts.ClientRules = append(setts.ClientRules, clientRules)
+		},
+		BlockedServices: &BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+		},
+		TagRules: []*TagRules{{
+			Tag:   "device_tv",
+			Rules: []string{"||tv.example^"},
+		}, {
+			Tag:   "device_pc",
+			Rules: []string{"||pc.example^"},
+		}},
+	}, []Filter{{
+		ID:   rulelist.IDCustom,
+		Data: []byte(globalRules),
+	}})
+	t.Cleanup(d.Close)
+
+	testCases := []struct {
+		name       string
+		host       string
+		clientID   string
+		wantReason Reason
+		wantListID rulelist.APIID
+	}{{
+		name:       "global",
+		host:       "global.example",
+		clientID:   clientID,
+		wantReason: FilteredBlockList,
+		wantListID: rulelist.APIIDCustom,
+	}, {
+		name:       "client_rule",
+		host:       "client.example",
+		clientID:   clientID,
+		wantReason: FilteredBlockList,
+		wantListID: rulelist.APIIDClientCustom,
+	}, {
+		name:       "client_exception",
+		host:       "unblocked.example",
+		clientID:   clientID,
+		wantReason: NotFilteredAllowList,
+		wantListID: rulelist.APIIDClientCustom,
+	}, {
+		name:       "tag_rule",
+		host:       "tv.example",
+		clientID:   clientID,
+		wantReason: FilteredBlockList,
+		wantListID: rulelist.APIIDClientCustom,
+	}, {
+		name:       "other_tag_rule",
+		host:       "pc.example",
+		clientID:   clientID,
+		wantReason: NotFilteredNotFound,
+		wantListID: 0,
+	}, {
+		name:       "other_client",
+		host:       "client.example",
+		clientID:   "other",
+		wantReason: NotFilteredNotFound,
+		wantListID: 0,
+	}, {
+		name:       "other_client_global",
+		host:       "unblocked.example",
+		clientID:   "other",
+		wantReason: FilteredBlockList,
+		wantListID: rulelist.APIIDCustom,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setts := &Settings{
+				ProtectionEnabled: true,
+				FilteringEnabled:  true,
+			}
+
+			d.ApplyAdditionalFiltering(netip.Addr{}, tc.clientID, setts)
+
+			res, cErr := d.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, cErr)
+
+			assert.Equal(t, tc.wantReason, res.Reason)
+			if tc.wantReason == NotFilteredNotFound {
+				return
+			}
+
+			require.Len(t, res.Rules, 1)
+
+			assert.Equal(t, tc.wantListID, res.Rules[0].FilterListID)
+		})
+	}
+}
+
+func TestDNSFilter_handleTagRulesUpdate(t *testing.T) {
+	confModCh := make(chan struct{}, 1)
+	d := newDNSFilter(t)
+	d.conf.ConfModifier = &aghtest.ConfigModifier{
+		OnApply: func(_ context.Context) {
+			confModCh <- struct{}{}
+		},
+	}
+
+	testCases := []struct {
+		name         string
+		body         string
+		wantTagRules []*TagRules
+		wantCode     int
+	}{{
+		name: "success",
+		body: `{"tags":[{"tag":"device_tv","rules":["||tv.example^"]},` +
+			`{"tag":"device_pc","rules":["! Comment"]}]}`,
+		wantTagRules: []*TagRules{{
+			Tag:   "device_tv",
+			Rules: []string{"||tv.example^"},
+		}, {
+			Tag:   "device_pc",
+			Rules: []string{"! Comment"},
+		}},
+		wantCode: http.StatusOK,
+	}, {
+		name:         "empty_tag",
+		body:         `{"tags":[{"tag":"","rules":["||tv.example^"]}]}`,
+		wantTagRules: nil,
+		wantCode:     http.StatusBadRequest,
+	}, {
+		name:         "duplicate",
+		body:         `{"tags":[{"tag":"device_tv"},{"tag":"device_tv"}]}`,
+		wantTagRules: nil,
+		wantCode:     http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d.conf.TagRules = nil
+			d.tagRules = nil
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(
+				http.MethodPut,
+				"/control/filtering/tag_rules/update",
+				bytes.NewBufferString(tc.body),
+			)
+
+			d.handleTagRulesUpdate(w, r)
+			require.Equal(t, tc.wantCode, w.Code)
+
+			if tc.wantCode != http.StatusOK {
+				assert.Nil(t, d.conf.TagRules)
+				assert.Nil(t, d.tagRules)
+
+				return
+			}
+
+			testutil.RequireReceive(t, confModCh, testTimeout)
+			assert.Equal(t, tc.wantTagRules, d.conf.TagRules)
+
+			// Tags without rules aren't compiled.
+			assert.Len(t, d.tagRules, 1)
+			assert.Contains(t, d.tagRules, "device_tv")
+
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/control/filtering/tag_rules", nil)
+			d.handleTagRules(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			resp := &tagRulesListJSON{}
+			err := json.NewDecoder(w.Body).Decode(resp)
+			require.NoError(t, err)
+
+			require.Len(t, resp.Tags, len(tc.wantTagRules))
+			for i, tr := range resp.Tags {
+				assert.Equal(t, tc.wantTagRules[i].Tag, tr.Tag)
+				assert.Equal(t, tc.wantTagRules[i].Rules, tr.Rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package filtering
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// CustomRule is a global custom filtering rule with metadata.  Unlike the
+// plain [Config.UserRules], it may expire, after which it's removed.
+type CustomRule struct {
+	// Created is the time when the rule has been added.
+	Created time.Time `yaml:"created"`
+
+	// ExpiresAt is the time after which the rule is no longer applied and is
+	// removed.  If it's zero, the rule never expires.
+	ExpiresAt time.Time `yaml:"expires_at,omitempty"`
+
+	// Text is the text of the rule.  It must be a single valid filtering rule.
+	Text string `yaml:"text"`
+
+	// Author is the name of the user that has added the rule, if known.
+	Author string `yaml:"author,omitempty"`
+
+	// Comment is the optional explanation of the rule.
+	Comment string `yaml:"comment,omitempty"`
+
+	// ID is the unique identifier of the rule.  It must not be zero.  The IDs
+	// of the removed rules aren't reused; see [Config.CustomRulesLastID].
+	ID uint64 `yaml:"id"`
+}
+
+// isExpired returns true if the rule has expired by now.
+func (cr *CustomRule) isExpired(now time.Time) (ok bool) {
+	return !cr.ExpiresAt.IsZero() && !now.Before(cr.ExpiresAt)
+}
+
+// validateRuleText returns an error if text isn't a single valid filtering
+// rule.
+func validateRuleText(text string) (err error) {
+	if strings.ContainsAny(text, "\r\n") {
+		return errors.Error("text: must be a single line")
+	}
+
+	r, err := rules.NewRule(text, rulelist.IDCustom)
+	if err != nil {
+		return fmt.Errorf("text: %w", err)
+	} else if r == nil {
+		return fmt.Errorf("text: %w", errors.ErrEmptyValue)
+	}
+
+	return nil
+}
+
+// validateCustomRules returns an error if the custom rules are invalid.
+func validateCustomRules(crs []*CustomRule) (err error) {
+	defer func() { err = errors.Annotate(err, "custom_rules: %w") }()
+
+	ids := container.NewMapSet[uint64]()
+	for i, cr := range crs {
+		switch {
+		case cr == nil:
+			return fmt.Errorf("at index %d: %w", i, errors.ErrNoValue)
+		case cr.ID == 0:
+			return fmt.Errorf("at index %d: id: %w", i, errors.ErrEmptyValue)
+		case ids.Has(cr.ID):
+			return fmt.Errorf("at index %d: id: %w: %d", i, errors.ErrDuplicated, cr.ID)
+		default:
+			ids.Add(cr.ID)
+		}
+
+		err = validateRuleText(cr.Text)
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// withCustomRules returns a new slice with userRules and the texts of the
+// custom rules that haven't expired by now.  d.conf.filtersMu is expected to be
+// locked.
+func (d *DNSFilter) withCustomRules(userRules []string, now time.Time) (res []string) {
+	res = make([]string, 0, len(userRules)+len(d.conf.CustomRules))
+	res = append(res, userRules...)
+	for _, cr := range d.conf.CustomRules {
+		if !cr.isExpired(now) {
+			res = append(res, cr.Text)
+		}
+	}
+
+	return res
+}
+
+// removeExpiredCustomRules removes the expired custom rules and rebuilds the
+// filtering engines if there were any.
+func (d *DNSFilter) removeExpiredCustomRules(ctx context.Context) {
+	now := time.Now()
+
+	var removed []*CustomRule
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		d.conf.CustomRules = slices.DeleteFunc(d.conf.CustomRules, func(cr *CustomRule) (ok bool) {
+			if cr.isExpired(now) {
+				removed = append(removed, cr)
+
+				return true
+			}
+
+			return false
+		})
+	}()
+
+	if len(removed) == 0 {
+		return
+	}
+
+	for _, cr := range removed {
+		d.logger.InfoContext(ctx, "removed expired custom rule", "id", cr.ID, "text", cr.Text)
+	}
+
+	d.conf.ConfModifier.Apply(ctx)
+	d.EnableFilters(true)
+}
+
+// customRuleJSON is the JSON representation of a [CustomRule].
+type customRuleJSON struct {
+	// Created is the time when the rule has been added.
+	Created time.Time `json:"created"`
+
+	// ExpiresAt is the time when the rule expires.  It's nil if the rule
+	// never expires.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// ExpiresIn is the remaining lifetime of the rule in milliseconds.  It's
+	// nil if the rule never expires.
+	ExpiresIn *int64 `json:"expires_in,omitempty"`
+
+	// Hits is the number of matches of the rule within the statistics
+	// retention interval.  It's nil if the numbers of matches aren't
+	// available.
+	Hits *uint64 `json:"hits,omitempty"`
+
+	Text    string `json:"text"`
+	Author  string `json:"author"`
+	Comment string `json:"comment"`
+	ID      uint64 `json:"id"`
+}
+
+// newCustomRuleJSON returns the JSON representation of cr.  hits may be nil.
+func newCustomRuleJSON(
+	cr *CustomRule,
+	hits map[RuleKey]uint64,
+	now time.Time,
+) (j *customRuleJSON) {
+	j = &customRuleJSON{
+		Created: cr.Created,
+		Text:    cr.Text,
+		Author:  cr.Author,
+		Comment: cr.Comment,
+		ID:      cr.ID,
+	}
+
+	if !cr.ExpiresAt.IsZero() {
+		j.ExpiresAt = &cr.ExpiresAt
+		expiresIn := max(0, cr.ExpiresAt.Sub(now).Milliseconds())
+		j.ExpiresIn = &expiresIn
+	}
+
+	if hits != nil {
+		n := hits[RuleKey{Text: cr.Text, FilterListID: rulelist.APIIDCustom}]
+		j.Hits = &n
+	}
+
+	return j
+}
+
+// customRulesJSON is the response body for the GET
+// /control/filtering/custom_rules HTTP API.
+type customRulesJSON struct {
+	Rules []*customRuleJSON `json:"rules"`
+}
+
+// handleCustomRules is the handler for the GET /control/filtering/custom_rules
+// HTTP API.
+func (d *DNSFilter) handleCustomRules(w http.ResponseWriter, r *http.Request) {
+	hits, _ := d.ruleHits()
+	now := time.Now()
+
+	resp := &customRulesJSON{
+		Rules: []*customRuleJSON{},
+	}
+
+	func() {
+		d.conf.filtersMu.RLock()
+		defer d.conf.filtersMu.RUnlock()
+
+		for _, cr := range d.conf.CustomRules {
+			if !cr.isExpired(now) {
+				resp.Rules = append(resp.Rules, newCustomRuleJSON(cr, hits, now))
+			}
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
+}
+
+// customRuleAddJSON is the request body for the POST
+// /control/filtering/custom_rules/add HTTP API.
+type customRuleAddJSON struct {
+	Text    string `json:"text"`
+	Author  string `json:"author"`
+	Comment string `json:"comment"`
+
+	// Duration is the lifetime of the rule in milliseconds.  If it's zero,
+	// the rule never expires.
+	Duration int64 `json:"duration"`
+}
+
+// handleCustomRuleAdd is the handler for the POST
+// /control/filtering/custom_rules/add HTTP API.
+func (d *DNSFilter) handleCustomRuleAdd(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	req := &customRuleAddJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	cr := &CustomRule{
+		Created: time.Now(),
+		Text:    strings.TrimSpace(req.Text),
+		Author:  req.Author,
+		Comment: req.Comment,
+	}
+
+	if cr.Author == "" && d.conf.WebUserLogin != nil {
+		cr.Author = d.conf.WebUserLogin(ctx)
+	}
+
+	var dur time.Duration
+	err = validateRuleText(cr.Text)
+	if err == nil {
+		dur, err = durationFromMs(req.Duration)
+	}
+
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	if dur > 0 {
+		cr.ExpiresAt = cr.Created.Add(dur)
+	}
+
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		d.conf.CustomRulesLastID++
+		cr.ID = d.conf.CustomRulesLastID
+		d.conf.CustomRules = append(d.conf.CustomRules, cr)
+	}()
+
+	l.InfoContext(ctx, "added custom rule", "id", cr.ID, "text", cr.Text, "expires", cr.ExpiresAt)
+
+	d.conf.ConfModifier.Apply(ctx)
+	d.EnableFilters(true)
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, newCustomRuleJSON(cr, nil, cr.Created))
+}
+
+// customRuleDeleteJSON is the request body for the POST
+// /control/filtering/custom_rules/delete HTTP API.
+type customRuleDeleteJSON struct {
+	ID uint64 `json:"id"`
+}
+
+// handleCustomRuleDelete is the handler for the POST
+// /control/filtering/custom_rules/delete HTTP API.
+func (d *DNSFilter) handleCustomRuleDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	req := &customRuleDeleteJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	var found bool
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		n := len(d.conf.CustomRules)
+		d.conf.CustomRules = slices.DeleteFunc(d.conf.CustomRules, func(cr *CustomRule) (ok bool) {
+			return cr.ID == req.ID
+		})
+
+		found = len(d.conf.CustomRules) < n
+	}()
+
+	if !found {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusNotFound, "custom rule %d not found", req.ID)
+
+		return
+	}
+
+	l.DebugContext(ctx, "deleted custom rule", "id", req.ID)
+
+	d.conf.ConfModifier.Apply(ctx)
+	d.EnableFilters(true)
+
+	aghhttp.OK(ctx, l, w)
+}
@@ -0,0 +1,225 @@
+package filtering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isBlocked returns true if host is blocked by d with the default settings.
+func isBlocked(tb testing.TB, d *DNSFilter, host string) (ok bool) {
+	tb.Helper()
+
+	res, err := d.CheckHost(host, dns.TypeA, &Settings{
+		ProtectionEnabled: true,
+		FilteringEnabled:  true,
+	})
+	require.NoError(tb, err)
+
+	return res.IsFiltered
+}
+
+func TestDNSFilter_customRules(t *testing.T) {
+	d, err := New(&Config{
+		Logger:           testLogger,
+		DataDir:          t.TempDir(),
+		FilteringEnabled: true,
+		ConfModifier: &aghtest.ConfigModifier{
+			OnApply: func(_ context.Context) {},
+		},
+		HTTPReg: aghhttp.EmptyRegistrar{},
+		WebUserLogin: func(_ context.Context) (login string) {
+			return "admin"
+		},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	d.Start()
+
+	add := func(t *testing.T, req *customRuleAddJSON) (w *httptest.ResponseRecorder) {
+		t.Helper()
+
+		b, mErr := json.Marshal(req)
+		require.NoError(t, mErr)
+
+		w = httptest.NewRecorder()
+		d.handleCustomRuleAdd(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+
+		return w
+	}
+
+	w := add(t, &customRuleAddJSON{
+		Text:     "||temporary.example^",
+		Comment:  "for the afternoon",
+		Duration: time.Hour.Milliseconds(),
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = add(t, &customRuleAddJSON{
+		Text:   "||permanent.example^",
+		Author: "operator",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Eventually(t, func() (ok bool) {
+		return isBlocked(t, d, "temporary.example") && isBlocked(t, d, "permanent.example")
+	}, testTimeout, testTimeout/10)
+
+	t.Run("list", func(t *testing.T) {
+		w = httptest.NewRecorder()
+		d.handleCustomRules(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp := &customRulesJSON{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+		require.Len(t, resp.Rules, 2)
+
+		temp := resp.Rules[0]
+		assert.Equal(t, uint64(1), temp.ID)
+		assert.Equal(t, "admin", temp.Author)
+		assert.Equal(t, "for the afternoon", temp.Comment)
+		require.NotNil(t, temp.ExpiresIn)
+
+		assert.InDelta(t, time.Hour.Milliseconds(), *temp.ExpiresIn, float64(time.Minute.Milliseconds()))
+
+		perm := resp.Rules[1]
+		assert.Equal(t, "operator", perm.Author)
+		assert.Nil(t, perm.ExpiresAt)
+		assert.Nil(t, perm.ExpiresIn)
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		w = add(t, &customRuleAddJSON{Text: "||a.example^\n||b.example^"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = add(t, &customRuleAddJSON{Text: "! comment"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = add(t, &customRuleAddJSON{Text: "||c.example^", Duration: -1})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = add(t, &customRuleAddJSON{Text: "||c.example^", Duration: maxDurationMs + 1})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = add(t, &customRuleAddJSON{Text: "||c.example^", Duration: math.MaxInt64})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(
+			t,
+			"duration: out of range: 9223372036854775807, max 315360000000\n",
+			w.Body.String(),
+		)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		func() {
+			d.conf.filtersMu.Lock()
+			defer d.conf.filtersMu.Unlock()
+
+			d.conf.CustomRules[0].ExpiresAt = time.Now().Add(-time.Second)
+		}()
+
+		d.removeExpiredCustomRules(testutil.ContextWithTimeout(t, testTimeout))
+
+		require.Eventually(t, func() (ok bool) {
+			return !isBlocked(t, d, "temporary.example")
+		}, testTimeout, testTimeout/10)
+
+		assert.True(t, isBlocked(t, d, "permanent.example"))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		b, mErr := json.Marshal(&customRuleDeleteJSON{ID: 2})
+		require.NoError(t, mErr)
+
+		w = httptest.NewRecorder()
+		d.handleCustomRuleDelete(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		require.Eventually(t, func() (ok bool) {
+			return !isBlocked(t, d, "permanent.example")
+		}, testTimeout, testTimeout/10)
+
+		w = httptest.NewRecorder()
+		d.handleCustomRuleDelete(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("id_not_reused", func(t *testing.T) {
+		w = add(t, &customRuleAddJSON{Text: "||next.example^"})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp := &customRuleJSON{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+
+		assert.Equal(t, uint64(3), resp.ID)
+
+		c := &Config{}
+		d.WriteDiskConfig(c)
+
+		assert.Equal(t, uint64(3), c.CustomRulesLastID)
+	})
+}
+
+func TestValidateCustomRules(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		rules      []*CustomRule
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		rules: []*CustomRule{{
+			Text: "||a.example^",
+			ID:   1,
+		}, {
+			Text: "@@||b.example^",
+			ID:   2,
+		}},
+	}, {
+		name:       "duplicate_id",
+		wantErrMsg: "custom_rules: at index 1: id: duplicated value: 1",
+		rules: []*CustomRule{{
+			Text: "||a.example^",
+			ID:   1,
+		}, {
+			Text: "||b.example^",
+			ID:   1,
+		}},
+	}, {
+		name:       "no_id",
+		wantErrMsg: "custom_rules: at index 0: id: empty value",
+		rules: []*CustomRule{{
+			Text: "||a.example^",
+		}},
+	}, {
+		name:       "comment",
+		wantErrMsg: "custom_rules: at index 0: text: empty value",
+		rules: []*CustomRule{{
+			Text: "# comment",
+			ID:   1,
+		}},
+	}, {
+		name:       "nil",
+		wantErrMsg: "custom_rules: at index 0: no value",
+		rules:      []*CustomRule{nil},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateCustomRules(tc.rules))
+		})
+	}
+}
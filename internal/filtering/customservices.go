@@ -0,0 +1,352 @@
+package filtering
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+const (
+	// serviceCatalogDir is the name of the directory within the data directory
+	// containing the cached service catalogs.
+	serviceCatalogDir = "service_catalogs"
+
+	// maxServiceCatalogSize is the maximum size of a service catalog.
+	maxServiceCatalogSize = uint64(rulelist.DefaultMaxRuleListSize)
+)
+
+// CustomService is a blocked service defined by the administrator.
+type CustomService struct {
+	// ID is the unique identifier of the service.  It must not be empty and
+	// must not be the same as the one of a builtin service.
+	ID string `yaml:"id"`
+
+	// Name is the human-readable name of the service.  It must not be empty.
+	Name string `yaml:"name"`
+
+	// IconSVG is the SVG icon of the service.  It may be empty.
+	IconSVG string `yaml:"icon_svg"`
+
+	// GroupID is the ID of the service group.  It must not be empty.
+	GroupID string `yaml:"group_id"`
+
+	// Rules are the filtering rules blocking the service.  It must not be
+	// empty.
+	Rules []string `yaml:"rules"`
+}
+
+// validate returns an error if cs is invalid.
+func (cs *CustomService) validate() (err error) {
+	switch {
+	case cs == nil:
+		return errors.ErrNoValue
+	case cs.ID == "":
+		return fmt.Errorf("id: %w", errors.ErrEmptyValue)
+	case services.isBuiltin(cs.ID):
+		return fmt.Errorf("id: %w: %q is a builtin service", errors.ErrDuplicated, cs.ID)
+	case cs.Name == "":
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case cs.GroupID == "":
+		return fmt.Errorf("group_id: %w", errors.ErrEmptyValue)
+	case len(cs.Rules) == 0:
+		return fmt.Errorf("rules: %w", errors.ErrEmptyValue)
+	}
+
+	for i, text := range cs.Rules {
+		_, err = rules.NewNetworkRule(text, rulelist.IDBlockedService)
+		if err != nil {
+			return fmt.Errorf("rules: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// ServiceCatalog is a remote list of blocked services in the format of the
+// upstream services index.
+type ServiceCatalog struct {
+	// URL is the HTTP(S) URL of the catalog.  It must not be empty.
+	URL string `yaml:"url"`
+
+	// Enabled defines if the services of the catalog are used.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if sc is invalid.
+func (sc *ServiceCatalog) validate() (err error) {
+	if sc == nil {
+		return errors.ErrNoValue
+	} else if sc.URL == "" {
+		return fmt.Errorf("url: %w", errors.ErrEmptyValue)
+	}
+
+	u, err := url.Parse(sc.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url: scheme: %w: %q", errors.ErrBadEnumValue, u.Scheme)
+	}
+
+	return nil
+}
+
+// validateServices returns an error if the custom services or the service
+// catalogs within c are invalid.  The builtin services must be initialized.
+func validateServices(c *Config) (err error) {
+	ids := container.NewMapSet[string]()
+	for i, cs := range c.CustomServices {
+		err = cs.validate()
+		if err != nil {
+			return fmt.Errorf("custom_services: at index %d: %w", i, err)
+		}
+
+		if ids.Has(cs.ID) {
+			return fmt.Errorf("custom_services: at index %d: id: %w: %q", i, errors.ErrDuplicated, cs.ID)
+		}
+
+		ids.Add(cs.ID)
+	}
+
+	urls := container.NewMapSet[string]()
+	for i, sc := range c.ServiceCatalogs {
+		err = sc.validate()
+		if err != nil {
+			return fmt.Errorf("service_catalogs: at index %d: %w", i, err)
+		}
+
+		if urls.Has(sc.URL) {
+			return fmt.Errorf("service_catalogs: at index %d: url: %w: %q", i, errors.ErrDuplicated, sc.URL)
+		}
+
+		urls.Add(sc.URL)
+	}
+
+	return nil
+}
+
+// InitServices validates and registers the custom blocked services from c and
+// the services from the cached catalogs within dataDir, so that the clients
+// are able to use them.  It must be called after [InitModule].  l and c must
+// not be nil.
+func InitServices(ctx context.Context, l *slog.Logger, c *Config, dataDir string) (err error) {
+	err = validateServices(c)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	custom := make([]*knownService, 0, len(c.CustomServices))
+	for _, cs := range c.CustomServices {
+		custom = append(custom, newService(ctx, l, &blockedService{
+			ID:      cs.ID,
+			Name:    cs.Name,
+			IconSVG: []byte(cs.IconSVG),
+			Rules:   cs.Rules,
+			GroupID: cs.GroupID,
+		}))
+	}
+
+	var urls []string
+	for _, sc := range c.ServiceCatalogs {
+		if sc.Enabled {
+			urls = append(urls, sc.URL)
+		}
+	}
+
+	services.setCustom(ctx, l, custom, urls)
+
+	for _, u := range urls {
+		loadServiceCatalog(ctx, l, dataDir, u)
+	}
+
+	l.DebugContext(ctx, "initialized custom services", "num", len(custom), "catalogs", len(urls))
+
+	return nil
+}
+
+// serviceCatalogPath returns the path to the cached service catalog with the
+// given URL within dataDir.
+func serviceCatalogPath(dataDir, catalogURL string) (p string) {
+	sum := sha256.Sum256([]byte(catalogURL))
+
+	return filepath.Join(dataDir, serviceCatalogDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadServiceCatalog registers the services from the cached service catalog
+// with the given URL within dataDir, if there is one.  Errors are logged.
+func loadServiceCatalog(ctx context.Context, l *slog.Logger, dataDir, catalogURL string) {
+	// #nosec G304 -- The path is always within dataDir.
+	data, err := os.ReadFile(serviceCatalogPath(dataDir, catalogURL))
+	if errors.Is(err, os.ErrNotExist) {
+		// Do nothing, the catalog hasn't been downloaded yet.
+		return
+	} else if err != nil {
+		l.ErrorContext(ctx, "reading service catalog", "url", catalogURL, slogutil.KeyError, err)
+
+		return
+	}
+
+	svcs, err := parseServiceCatalog(ctx, l, data)
+	if err != nil {
+		l.ErrorContext(ctx, "parsing service catalog", "url", catalogURL, slogutil.KeyError, err)
+
+		return
+	}
+
+	services.setCatalog(ctx, l, catalogURL, svcs)
+}
+
+// serviceCatalogJSON is the JSON structure of the upstream services index.
+type serviceCatalogJSON struct {
+	BlockedServices []*serviceCatalogItemJSON `json:"blocked_services"`
+}
+
+// serviceCatalogItemJSON is the JSON structure of a single service of the
+// upstream services index.
+type serviceCatalogItemJSON struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	IconSVG string   `json:"icon_svg"`
+	Group   string   `json:"group"`
+	Rules   []string `json:"rules"`
+}
+
+// parseServiceCatalog parses the services from the service catalog data.
+// Invalid services are logged and skipped.
+func parseServiceCatalog(
+	ctx context.Context,
+	l *slog.Logger,
+	data []byte,
+) (svcs []*knownService, err error) {
+	catalog := &serviceCatalogJSON{}
+	err = json.Unmarshal(data, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("decoding: %w", err)
+	}
+
+	for i, item := range catalog.BlockedServices {
+		if item == nil || item.ID == "" || item.Name == "" || len(item.Rules) == 0 {
+			l.WarnContext(ctx, "skipping invalid service", "idx", i)
+
+			continue
+		}
+
+		svcs = append(svcs, newService(ctx, l, &blockedService{
+			ID:      item.ID,
+			Name:    item.Name,
+			IconSVG: []byte(item.IconSVG),
+			Rules:   item.Rules,
+			GroupID: item.Group,
+		}))
+	}
+
+	return svcs, nil
+}
+
+// refreshServiceCatalogs downloads the enabled service catalogs that aren't
+// cached yet or are older than the filters update interval and registers their
+// services.  If the interval is zero, only the catalogs that aren't cached yet
+// are downloaded.  Errors are logged.
+func (d *DNSFilter) refreshServiceCatalogs(ctx context.Context) {
+	ivl := time.Duration(d.conf.FiltersUpdateIntervalHours) * time.Hour
+	for _, sc := range d.conf.ServiceCatalogs {
+		if !sc.Enabled {
+			continue
+		}
+
+		fi, err := os.Stat(serviceCatalogPath(d.conf.DataDir, sc.URL))
+		if err == nil && (ivl == 0 || time.Since(fi.ModTime()) < ivl) {
+			continue
+		}
+
+		err = d.refreshServiceCatalog(ctx, sc.URL)
+		if err != nil {
+			d.logger.ErrorContext(
+				ctx,
+				"refreshing service catalog",
+				"url", sc.URL,
+				slogutil.KeyError, err,
+			)
+		}
+	}
+}
+
+// refreshServiceCatalog downloads the service catalog from catalogURL, caches
+// it within the data directory, and registers its services.
+func (d *DNSFilter) refreshServiceCatalog(ctx context.Context, catalogURL string) (err error) {
+	d.logger.DebugContext(ctx, "downloading service catalog", "url", catalogURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, catalogURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := d.conf.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	data, err := io.ReadAll(ioutil.LimitReader(resp.Body, maxServiceCatalogSize))
+	if err != nil {
+		return fmt.Errorf("reading: %w", err)
+	}
+
+	svcs, err := parseServiceCatalog(ctx, d.logger, data)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	err = writeServiceCatalog(serviceCatalogPath(d.conf.DataDir, catalogURL), data)
+	if err != nil {
+		return fmt.Errorf("caching: %w", err)
+	}
+
+	services.setCatalog(ctx, d.logger, catalogURL, svcs)
+
+	d.logger.InfoContext(ctx, "updated service catalog", "url", catalogURL, "num", len(svcs))
+
+	return nil
+}
+
+// writeServiceCatalog atomically writes the service catalog data to the file
+// at p, creating the directory if necessary.
+func writeServiceCatalog(p string, data []byte) (err error) {
+	err = os.MkdirAll(filepath.Dir(p), aghos.DefaultPermDir)
+	if err != nil {
+		return fmt.Errorf("creating dir: %w", err)
+	}
+
+	file, err := aghrenameio.NewPendingFile(p, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer func() { err = aghrenameio.WithDeferredCleanup(err, file) }()
+
+	_, err = file.Write(data)
+
+	return err
+}
@@ -0,0 +1,216 @@
+package filtering
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServiceCatalog is the common service catalog data for tests.  It
+// contains a service clashing with a builtin one.
+const testServiceCatalog = `{
+  "blocked_services": [
+    {
+      "id": "saas_app",
+      "name": "SaaS App",
+      "icon_svg": "<svg/>",
+      "rules": ["||saas.example^"],
+      "group": "work"
+    },
+    {
+      "id": "youtube",
+      "name": "Not YouTube",
+      "icon_svg": "",
+      "rules": ["||not-youtube.example^"],
+      "group": "video"
+    }
+  ],
+  "groups": [{"id": "work"}]
+}`
+
+func TestInitServices(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	InitModule(ctx, testLogger)
+
+	catalogURL := serveFiltersLocally(t, []byte(testServiceCatalog))
+	dataDir := t.TempDir()
+
+	conf := &Config{
+		HTTPClient: &http.Client{
+			Timeout: testTimeout,
+		},
+		DataDir:                    dataDir,
+		FiltersUpdateIntervalHours: 24,
+		CustomServices: []*CustomService{{
+			ID:      "intranet",
+			Name:    "Intranet",
+			GroupID: "work",
+			Rules:   []string{"||intranet.example^"},
+		}},
+		ServiceCatalogs: []*ServiceCatalog{{
+			URL:     catalogURL,
+			Enabled: true,
+		}},
+	}
+
+	err := InitServices(ctx, testLogger, conf, dataDir)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		InitModule(ctx, testLogger)
+		services.setCustom(ctx, testLogger, nil, nil)
+	})
+
+	assert.True(t, services.has("intranet"))
+	assert.True(t, services.has("youtube"))
+	assert.False(t, services.has("saas_app"))
+
+	bs := &BlockedServices{
+		Schedule: schedule.EmptyWeekly(),
+		IDs:      []string{"saas_app", "unknown_app"},
+	}
+	bs.FilterUnknownIDs(ctx, testLogger)
+	assert.Equal(t, []string{"saas_app", "unknown_app"}, bs.IDs)
+	require.NoError(t, bs.Validate())
+
+	d, _ := newForTest(t, conf, nil)
+	t.Cleanup(d.Close)
+
+	d.refreshServiceCatalogs(ctx)
+
+	assert.True(t, services.has("saas_app"))
+	assert.FileExists(t, serviceCatalogPath(dataDir, catalogURL))
+
+	bs.FilterUnknownIDs(ctx, testLogger)
+	assert.Equal(t, []string{"saas_app"}, bs.IDs)
+
+	rules, ok := services.rules("youtube")
+	require.True(t, ok)
+	require.NotEmpty(t, rules)
+
+	assert.NotContains(t, rules[0].String(), "not-youtube")
+
+	svcs, groups := services.all()
+	assert.Contains(t, groups, serviceGroup{ID: "work"})
+
+	var gotIDs []string
+	for _, s := range svcs {
+		gotIDs = append(gotIDs, s.ID)
+	}
+
+	assert.Equal(t, services.ids(), gotIDs)
+	assert.Contains(t, gotIDs, "intranet")
+
+	t.Run("cached", func(t *testing.T) {
+		services.setCustom(ctx, testLogger, nil, nil)
+		require.False(t, services.has("saas_app"))
+
+		err = InitServices(ctx, testLogger, conf, dataDir)
+		require.NoError(t, err)
+
+		assert.True(t, services.has("saas_app"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		err = os.Remove(serviceCatalogPath(dataDir, catalogURL))
+		require.NoError(t, err)
+
+		conf.ServiceCatalogs[0].Enabled = false
+		err = InitServices(ctx, testLogger, conf, dataDir)
+		require.NoError(t, err)
+
+		d.refreshServiceCatalogs(ctx)
+
+		assert.False(t, services.has("saas_app"))
+		assert.NoFileExists(t, serviceCatalogPath(dataDir, catalogURL))
+	})
+
+	t.Run("no_update_ivl", func(t *testing.T) {
+		conf.FiltersUpdateIntervalHours = 0
+		conf.ServiceCatalogs[0].Enabled = true
+		err = InitServices(ctx, testLogger, conf, dataDir)
+		require.NoError(t, err)
+
+		require.False(t, services.has("saas_app"))
+
+		d.refreshServiceCatalogs(ctx)
+
+		assert.True(t, services.has("saas_app"))
+		assert.FileExists(t, serviceCatalogPath(dataDir, catalogURL))
+	})
+}
+
+func TestValidateServices(t *testing.T) {
+	InitModule(testutil.ContextWithTimeout(t, testTimeout), testLogger)
+
+	testCases := []struct {
+		conf       *Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &Config{
+			CustomServices: []*CustomService{{
+				ID:      "intranet",
+				Name:    "Intranet",
+				GroupID: "work",
+				Rules:   []string{"||intranet.example^"},
+			}},
+			ServiceCatalogs: []*ServiceCatalog{{
+				URL: "https://catalog.example/services.json",
+			}},
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &Config{
+			CustomServices: []*CustomService{{
+				ID:      "youtube",
+				Name:    "YouTube",
+				GroupID: "video",
+				Rules:   []string{"||youtube.example^"},
+			}},
+		},
+		name: "builtin",
+		wantErrMsg: `custom_services: at index 0: id: duplicated value: ` +
+			`"youtube" is a builtin service`,
+	}, {
+		conf: &Config{
+			CustomServices: []*CustomService{{
+				ID:      "intranet",
+				Name:    "Intranet",
+				GroupID: "work",
+			}},
+		},
+		name:       "no_rules",
+		wantErrMsg: "custom_services: at index 0: rules: empty value",
+	}, {
+		conf: &Config{
+			ServiceCatalogs: []*ServiceCatalog{{
+				URL: "ftp://catalog.example/services.json",
+			}},
+		},
+		name:       "bad_scheme",
+		wantErrMsg: `service_catalogs: at index 0: url: scheme: bad enum value: "ftp"`,
+	}, {
+		conf: &Config{
+			ServiceCatalogs: []*ServiceCatalog{{
+				URL: "https://catalog.example/services.json",
+			}, {
+				URL: "https://catalog.example/services.json",
+			}},
+		},
+		name: "duplicate_url",
+		wantErrMsg: `service_catalogs: at index 1: url: duplicated value: ` +
+			`"https://catalog.example/services.json"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateServices(tc.conf))
+		})
+	}
+}
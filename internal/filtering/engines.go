@@ -0,0 +1,335 @@
+package filtering
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+)
+
+// engines is a set of filtering engines built from the same filter lists.  It
+// isn't modified after it has been built, so that a new set can be built while
+// the current one is used for filtering and then swapped with it atomically.
+type engines struct {
+	// mu prevents closing the engines while they are used for filtering.  It's
+	// locked for reading while matching and for writing while closing.
+	mu *sync.RWMutex
+
+	storage *filterlist.RuleStorage
+	engine  *urlfilter.DNSEngine
+
+	storageAllow *filterlist.RuleStorage
+	engineAllow  *urlfilter.DNSEngine
+
+	// indexes are the indexes of the blocking filter lists without a group.
+	indexes []*rulelist.Index
+
+	// indexesAllow are the indexes of the allowing filter lists without a
+	// group.
+	indexesAllow []*rulelist.Index
+
+	// groups are the blocking engines of the filter groups by the group name.
+	groups map[string]*groupEngine
+
+	// groupsAllow are the allowing engines of the filter groups by the group
+	// name.
+	groupsAllow map[string]*groupEngine
+
+	// closed is true if the engines have been closed.  It's protected by mu.
+	closed bool
+}
+
+// acquireEngines returns the current filtering engines locked for reading, or
+// nil if there are none.  If e isn't nil, e.release must be called after the
+// results of matching are no longer used.
+func (d *DNSFilter) acquireEngines() (e *engines) {
+	for {
+		e = d.engines.Load()
+		if e == nil {
+			return nil
+		}
+
+		e.mu.RLock()
+		if !e.closed {
+			return e
+		}
+
+		// The engines have been swapped and closed after being loaded, so try
+		// the new ones.
+		e.mu.RUnlock()
+	}
+}
+
+// release releases the engines acquired with [DNSFilter.acquireEngines].
+func (e *engines) release() {
+	e.mu.RUnlock()
+}
+
+// close waits until e is no longer used for filtering and closes it.  Errors
+// are logged.  l must not be nil.
+func (e *engines) close(ctx context.Context, l *slog.Logger) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+
+	if e.storage != nil {
+		if err := e.storage.Close(); err != nil {
+			l.ErrorContext(ctx, "closing rules storage", slogutil.KeyError, err)
+		}
+	}
+
+	if e.storageAllow != nil {
+		if err := e.storageAllow.Close(); err != nil {
+			l.ErrorContext(ctx, "closing allow rules storage", slogutil.KeyError, err)
+		}
+	}
+
+	if err := closeIndexes(e.indexes); err != nil {
+		l.ErrorContext(ctx, "closing rule indexes", slogutil.KeyError, err)
+	}
+
+	if err := closeIndexes(e.indexesAllow); err != nil {
+		l.ErrorContext(ctx, "closing allow rule indexes", slogutil.KeyError, err)
+	}
+
+	if err := closeGroupEngines(e.groups); err != nil {
+		l.ErrorContext(ctx, "closing group rules storages", slogutil.KeyError, err)
+	}
+
+	if err := closeGroupEngines(e.groupsAllow); err != nil {
+		l.ErrorContext(ctx, "closing group allow rules storages", slogutil.KeyError, err)
+	}
+}
+
+// swapEngines sets e as the current filtering engines and closes the previous
+// ones, if any.  e may be nil.  The filtering isn't blocked while the previous
+// engines are being closed.
+func (d *DNSFilter) swapEngines(ctx context.Context, e *engines) {
+	prev := d.engines.Swap(e)
+	if prev != nil {
+		prev.close(ctx, d.logger)
+	}
+}
+
+// buildEngines builds new filtering engines from the filter lists.  It
+// reports the progress to d.rebuild.
+func (d *DNSFilter) buildEngines(
+	ctx context.Context,
+	allowFilters []Filter,
+	blockFilters []Filter,
+) (e *engines, err error) {
+	_, blockGroups := partitionFilters(blockFilters)
+	_, allowGroups := partitionFilters(allowFilters)
+
+	// The steps are the indexing of the lists, if enabled, and the building of
+	// the global and the group engines.
+	total := 2 + len(blockGroups) + len(allowGroups)
+	if d.conf.RuleIndexEnabled {
+		total += len(blockFilters) + len(allowFilters)
+	}
+
+	d.rebuild.start(total)
+
+	e = &engines{
+		mu: &sync.RWMutex{},
+	}
+
+	blockFilters, blockIdxs := d.indexFilters(ctx, blockFilters)
+	allowFilters, allowIdxs := d.indexFilters(ctx, allowFilters)
+	e.indexes, e.indexesAllow = blockIdxs[""], allowIdxs[""]
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		e.close(ctx, d.logger)
+
+		// Close the indexes of the groups, which engines haven't been built.
+		// Closing an index twice is safe.
+		for _, idxs := range []map[string][]*rulelist.Index{blockIdxs, allowIdxs} {
+			for _, groupIdxs := range idxs {
+				_ = closeIndexes(groupIdxs)
+			}
+		}
+	}()
+
+	blockFilters, blockGroups = partitionFilters(blockFilters)
+	allowFilters, allowGroups = partitionFilters(allowFilters)
+
+	e.storage, e.engine, err = newEngine(blockFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	d.rebuild.step()
+
+	e.storageAllow, e.engineAllow, err = newEngine(allowFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	d.rebuild.step()
+
+	e.groups, err = newGroupEngines(blockGroups, blockIdxs, d.rebuild.step)
+	if err != nil {
+		return nil, err
+	}
+
+	e.groupsAllow, err = newGroupEngines(allowGroups, allowIdxs, d.rebuild.step)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// newEngine returns a new rule storage and a filtering engine for filters.
+func newEngine(
+	filters []Filter,
+) (rs *filterlist.RuleStorage, eng *urlfilter.DNSEngine, err error) {
+	rs, err = newRuleStorage(filters)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, nil, err
+	}
+
+	return rs, urlfilter.NewDNSEngine(rs), nil
+}
+
+// initFiltering builds new filtering engines from the filter lists without
+// blocking the filtering and then swaps them with the current ones.
+func (d *DNSFilter) initFiltering(ctx context.Context, allowFilters, blockFilters []Filter) (err error) {
+	d.rebuildMu.Lock()
+	defer d.rebuildMu.Unlock()
+
+	start := time.Now()
+	e, err := d.buildEngines(ctx, allowFilters, blockFilters)
+	d.rebuild.finish(start, err)
+	if err != nil {
+		return err
+	}
+
+	d.swapEngines(ctx, e)
+
+	// Make sure that the OS reclaims memory as soon as possible.
+	debug.FreeOSMemory()
+
+	d.logger.DebugContext(ctx, "initialized filtering engine", "elapsed", time.Since(start))
+
+	return nil
+}
+
+// rebuildStatus is the status of the rebuilding of the filtering engines.  It's
+// safe for concurrent use.
+type rebuildStatus struct {
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// lastTime is the time when the last rebuild has finished.
+	lastTime time.Time
+
+	// lastErr is the error of the last rebuild, if any.
+	lastErr error
+
+	// lastDuration is the duration of the last rebuild.
+	lastDuration time.Duration
+
+	// done is the number of the finished steps of the current rebuild.
+	done int
+
+	// total is the total number of the steps of the current rebuild.
+	total int
+
+	// inProgress is true if a rebuild is in progress.
+	inProgress bool
+}
+
+// newRebuildStatus returns a new properly initialized *rebuildStatus.
+func newRebuildStatus() (s *rebuildStatus) {
+	return &rebuildStatus{
+		mu: &sync.Mutex{},
+	}
+}
+
+// start marks the beginning of a rebuild with the given number of steps.
+func (s *rebuildStatus) start(total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inProgress = true
+	s.done, s.total = 0, total
+}
+
+// step marks a step of the current rebuild as finished.
+func (s *rebuildStatus) step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.done = min(s.done+1, s.total)
+}
+
+// finish marks the end of the rebuild started at start.
+func (s *rebuildStatus) finish(start time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inProgress = false
+	s.done = s.total
+	s.lastTime = time.Now()
+	s.lastDuration = s.lastTime.Sub(start)
+	s.lastErr = err
+}
+
+// engineStatusJSON is the JSON representation of the status of the filtering
+// engines.
+type engineStatusJSON struct {
+	// LastRebuildTime is the time when the last rebuild has finished, in the
+	// RFC 3339 format.  It's empty if there have been no rebuilds yet.
+	LastRebuildTime string `json:"last_rebuild_time,omitempty"`
+
+	// LastRebuildError is the error of the last rebuild, if any.
+	LastRebuildError string `json:"last_rebuild_error,omitempty"`
+
+	// LastRebuildDuration is the duration of the last rebuild in milliseconds.
+	LastRebuildDuration int64 `json:"last_rebuild_duration_ms"`
+
+	// Progress is the progress of the current rebuild in percent.
+	Progress int `json:"progress"`
+
+	// Rebuilding is true if a rebuild is in progress.
+	Rebuilding bool `json:"rebuilding"`
+}
+
+// toJSON returns the JSON representation of the status.
+func (s *rebuildStatus) toJSON() (j *engineStatusJSON) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j = &engineStatusJSON{
+		LastRebuildDuration: s.lastDuration.Milliseconds(),
+		Progress:            100,
+		Rebuilding:          s.inProgress,
+	}
+
+	if s.inProgress && s.total > 0 {
+		j.Progress = s.done * 100 / s.total
+	}
+
+	if !s.lastTime.IsZero() {
+		j.LastRebuildTime = s.lastTime.Format(time.RFC3339)
+	}
+
+	if s.lastErr != nil {
+		j.LastRebuildError = s.lastErr.Error()
+	}
+
+	return j
+}
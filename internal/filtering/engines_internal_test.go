@@ -0,0 +1,88 @@
+package filtering
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_initFiltering_concurrent(t *testing.T) {
+	filters := []Filter{{
+		ID:   0,
+		Data: []byte("||blocked.example^\n"),
+	}}
+
+	d, setts := newForTest(t, &Config{}, filters)
+	t.Cleanup(d.Close)
+
+	const (
+		rebuildsNum = 10
+		readersNum  = 4
+	)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for range readersNum {
+		wg.Go(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				res, err := d.CheckHost("blocked.example", dns.TypeA, setts)
+				if !assert.NoError(t, err) || !assert.True(t, res.IsFiltered) {
+					return
+				}
+			}
+		})
+	}
+
+	for range rebuildsNum {
+		err := d.initFiltering(ctx, nil, filters)
+		require.NoError(t, err)
+	}
+
+	close(stop)
+	wg.Wait()
+
+	status := d.rebuild.toJSON()
+	assert.False(t, status.Rebuilding)
+	assert.Equal(t, 100, status.Progress)
+	assert.NotEmpty(t, status.LastRebuildTime)
+	assert.Empty(t, status.LastRebuildError)
+}
+
+func TestRebuildStatus_toJSON(t *testing.T) {
+	s := newRebuildStatus()
+
+	got := s.toJSON()
+	assert.Equal(t, &engineStatusJSON{Progress: 100}, got)
+
+	s.start(4)
+	s.step()
+
+	got = s.toJSON()
+	assert.True(t, got.Rebuilding)
+	assert.Equal(t, 25, got.Progress)
+
+	const testError errors.Error = "test error"
+
+	s.finish(time.Now().Add(-time.Second), testError)
+
+	got = s.toJSON()
+	assert.False(t, got.Rebuilding)
+	assert.Equal(t, 100, got.Progress)
+	assert.Equal(t, testError.Error(), got.LastRebuildError)
+	assert.GreaterOrEqual(t, got.LastRebuildDuration, int64(1000))
+	assert.NotEmpty(t, got.LastRebuildTime)
+}
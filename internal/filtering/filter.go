@@ -1,12 +1,12 @@
 package filtering
 
 import (
+	"cmp"
 	"context"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
 	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
@@ -14,41 +14,55 @@ import (
 	"strings"
 	"time"
 
-	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
-	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil/urlutil"
 )
 
 // filterDir is the subdirectory of a data directory to store downloaded
 // filters.
 const filterDir = "filters"
 
-// FilterYAML represents a filter list in the configuration file.
+// FilterYAML represents a filter list in the configuration file.  The contents
+// of the list and the data about them, such as the number of rules and the
+// time of the last update, are kept by the [rulelist.Filter] with the same UID
+// within [DNSFilter.lists].
 //
 // TODO(e.burkov):  Investigate if the field ordering is important.
 type FilterYAML struct {
-	Enabled     bool
-	URL         string    // URL or a file path
-	Name        string    `yaml:"name"`
-	RulesCount  int       `yaml:"-"`
-	LastUpdated time.Time `yaml:"-"`
-	checksum    uint32    // checksum of the file data
-	white       bool
+	Enabled bool
+	URL     string // URL or a file path
+	Name    string `yaml:"name"`
+
+	// UID is the unique ID of the filter list.  Unlike the ID, it isn't reused
+	// by other lists and doesn't change when the list is reloaded.  It's
+	// assigned when the list is added or first loaded.
+	UID rulelist.UID `yaml:"uid"`
+
+	white bool
 
 	Filter `yaml:",inline"`
 }
 
-// Clear filter rules
-func (filter *FilterYAML) unload() {
-	filter.RulesCount = 0
-	filter.checksum = 0
+// ensureUID sets a new UID for the filter list if it doesn't have one.
+func (filter *FilterYAML) ensureUID() (err error) {
+	if filter.UID != (rulelist.UID{}) {
+		return nil
+	}
+
+	filter.UID, err = rulelist.NewUID()
+	if err != nil {
+		return fmt.Errorf("generating uid: %w", err)
+	}
+
+	return nil
 }
 
-// Path to the filter contents
-func (filter *FilterYAML) Path(dataDir string) string {
+// legacyPath returns the path to the cached contents of the filter list within
+// dataDir, which has been used before the contents were cached by the UIDs.
+func (filter *FilterYAML) legacyPath(dataDir string) (p string) {
 	return filepath.Join(
 		dataDir,
 		filterDir,
@@ -56,6 +70,19 @@ func (filter *FilterYAML) Path(dataDir string) string {
 	)
 }
 
+// ruleListURL returns the URL of the filter list for [rulelist.Filter].  The
+// file paths are converted into URLs with the file scheme.
+func (filter *FilterYAML) ruleListURL() (u *url.URL, err error) {
+	if filepath.IsAbs(filter.URL) {
+		return &url.URL{
+			Scheme: urlutil.SchemeFile,
+			Path:   filepath.Clean(filter.URL),
+		}, nil
+	}
+
+	return url.Parse(filter.URL)
+}
+
 // ensureName sets provided title or default name for the filter if it doesn't
 // have name already.
 func (filter *FilterYAML) ensureName(title string) {
@@ -117,18 +144,30 @@ func (d *DNSFilter) filterSetProperties(
 		"filter_url", flt.URL,
 	)
 
-	defer func(oldURL, oldName string, oldEnabled bool, oldUpdated time.Time, oldRulesCount int) {
-		if err != nil {
-			flt.URL = oldURL
-			flt.Name = oldName
-			flt.Enabled = oldEnabled
-			flt.LastUpdated = oldUpdated
-			flt.RulesCount = oldRulesCount
+	ctx := context.TODO()
+	oldList, hasOldList := d.lists.Filter(flt.UID)
+	defer func(oldURL string, oldName string, oldGroup string, oldEnabled bool) {
+		if err == nil {
+			return
 		}
-	}(flt.URL, flt.Name, flt.Enabled, flt.LastUpdated, flt.RulesCount)
+
+		flt.URL = oldURL
+		flt.Name = oldName
+		flt.Group = oldGroup
+		flt.Enabled = oldEnabled
+		if hasOldList {
+			oldList.SetEnabled(oldEnabled)
+			d.lists.Set(ctx, oldList)
+		}
+	}(flt.URL, flt.Name, flt.Group, flt.Enabled)
 
 	flt.Name = newList.Name
 
+	// Changing the group only requires rebuilding the engines, not updating
+	// the list.
+	regroup := flt.Group != newList.Group
+	flt.Group = newList.Group
+
 	if flt.URL != newList.URL {
 		if d.filterExistsLocked(newList.URL) {
 			return false, errFilterExists
@@ -136,9 +175,14 @@ func (d *DNSFilter) filterSetProperties(
 
 		shouldRestart = true
 
+		// Replace the rule list, which also removes the unprocessed copy of the
+		// contents of the previous one, since its patches don't apply to the
+		// new one.
 		flt.URL = newList.URL
-		flt.LastUpdated = time.Time{}
-		flt.unload()
+		_, err = d.ruleList(ctx, flt)
+		if err != nil {
+			return false, err
+		}
 	}
 
 	if flt.Enabled != newList.Enabled {
@@ -152,16 +196,18 @@ func (d *DNSFilter) filterSetProperties(
 		// possible to set a bad rules source, but the validation should still
 		// kick in when the filter is enabled.  Consider changing this behavior
 		// to be stricter.
-		flt.unload()
+		d.lists.Unload(flt.UID)
 
 		return shouldRestart, err
 	}
 
 	if !shouldRestart {
-		return false, nil
+		return regroup, nil
 	}
 
-	return d.update(flt)
+	shouldRestart, err = d.update(flt)
+
+	return shouldRestart || regroup, err
 }
 
 // filterExists returns true if a filter with the same url exists in d.  It's
@@ -175,6 +221,23 @@ func (d *DNSFilter) filterExists(url string) (ok bool) {
 	return r
 }
 
+// FilterListName returns the name of the filter list with the given ID or, if
+// the list has no name, its URL.  name is empty if there is no such list.
+func (d *DNSFilter) FilterListName(id rulelist.APIID) (name string) {
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	for _, filters := range [][]FilterYAML{d.conf.Filters, d.conf.WhitelistFilters} {
+		for _, f := range filters {
+			if rulelist.APIID(f.ID) == id {
+				return cmp.Or(f.Name, f.URL)
+			}
+		}
+	}
+
+	return ""
+}
+
 // filterExistsLocked returns true if d contains the filter with the same url.
 // d.filtersMu is expected to be locked.
 func (d *DNSFilter) filterExistsLocked(url string) (ok bool) {
@@ -217,8 +280,14 @@ func (d *DNSFilter) filterAdd(flt FilterYAML) (err error) {
 }
 
 // Load filters from the disk
-// And if any filter has zero ID, assign a new one
-func (d *DNSFilter) loadFilters(ctx context.Context, array []FilterYAML) {
+// And if any filter has zero ID, assign a new one.  uids are the UIDs of the
+// filters that have already been loaded, and a new UID is also assigned if the
+// filter has none or it's duplicated.  uids must not be nil.
+func (d *DNSFilter) loadFilters(
+	ctx context.Context,
+	array []FilterYAML,
+	uids *container.MapSet[rulelist.UID],
+) (err error) {
 	for i := range array {
 		filter := &array[i] // otherwise we're operating on a copy
 		if filter.ID == 0 {
@@ -228,16 +297,33 @@ func (d *DNSFilter) loadFilters(ctx context.Context, array []FilterYAML) {
 			filter.ID = newID
 		}
 
+		if uids.Has(filter.UID) {
+			d.logger.WarnContext(ctx, "filter has duplicate uid", "idx", i, "uid", filter.UID)
+
+			filter.UID = rulelist.UID{}
+		}
+
+		err = filter.ensureUID()
+		if err != nil {
+			return fmt.Errorf("filter at index %d: %w", i, err)
+		}
+
+		uids.Add(filter.UID)
+
+		d.migrateCache(ctx, filter)
+
 		if !filter.Enabled {
 			// No need to load a filter that is not enabled
 			continue
 		}
 
-		err := d.load(ctx, filter)
+		err = d.load(ctx, filter)
 		if err != nil {
 			d.logger.ErrorContext(ctx, "loading filter", "id", filter.ID, slogutil.KeyError, err)
 		}
 	}
+
+	return nil
 }
 
 func deduplicateFilters(filters []FilterYAML) (deduplicated []FilterYAML) {
@@ -260,19 +346,29 @@ func deduplicateFilters(filters []FilterYAML) (deduplicated []FilterYAML) {
 //
 // TODO(e.burkov):  Get rid of the concurrency pattern which requires the
 // [sync.Mutex.TryLock].
-func (d *DNSFilter) tryRefreshFilters(block, allow, force bool) (updated int, isNetworkErr, ok bool) {
+func (d *DNSFilter) tryRefreshFilters(
+	block bool,
+	allow bool,
+	force bool,
+) (updated int, isNetworkErr, ok bool, err error) {
 	if ok = d.refreshLock.TryLock(); !ok {
-		return 0, false, false
+		return 0, false, false, nil
 	}
 	defer d.refreshLock.Unlock()
 
-	updated, isNetworkErr = d.refreshFiltersIntl(block, allow, force)
+	updated, isNetworkErr, err = d.refreshFiltersIntl(block, allow, force, nil)
 
-	return updated, isNetworkErr, ok
+	return updated, isNetworkErr, ok, err
 }
 
-// listsToUpdate returns the slice of filter lists that could be updated.
-func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []FilterYAML) {
+// listsToUpdate returns the slice of filter lists that could be updated.  If
+// include isn't nil, only the filter lists for which it returns true are
+// returned.
+func (d *DNSFilter) listsToUpdate(
+	filters *[]FilterYAML,
+	force bool,
+	include func(flt *FilterYAML) (ok bool),
+) (toUpd []FilterYAML) {
 	now := time.Now()
 
 	d.conf.filtersMu.RLock()
@@ -281,12 +377,13 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 	for i := range *filters {
 		flt := &(*filters)[i] // otherwise we will be operating on a copy
 
-		if !flt.Enabled {
+		if !flt.Enabled || (include != nil && !include(flt)) {
 			continue
 		}
 
 		if !force {
-			exp := flt.LastUpdated.Add(time.Duration(d.conf.FiltersUpdateIntervalHours) * time.Hour)
+			updated := d.ruleListState(flt).Updated
+			exp := updated.Add(time.Duration(d.conf.FiltersUpdateIntervalHours) * time.Hour)
 			if now.Before(exp) {
 				continue
 			}
@@ -296,9 +393,10 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 			Filter: Filter{
 				ID: flt.ID,
 			},
-			URL:      flt.URL,
-			Name:     flt.Name,
-			checksum: flt.checksum,
+			Enabled: flt.Enabled,
+			URL:     flt.URL,
+			Name:    flt.Name,
+			UID:     flt.UID,
 		})
 	}
 
@@ -307,20 +405,24 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 
 // refreshFiltersArray updates the filters array and returns the number of
 // filters that have been refreshed.  updateFlags is true if filter data has
-// changed.
+// changed.  err contains the *rulelist.FilterError of each list that has failed
+// to update, which is also stored as the error of that list in d.lists.
 func (d *DNSFilter) refreshFiltersArray(
 	ctx context.Context,
 	filters *[]FilterYAML,
 	force bool,
-) (updateCount int, updateFilters []FilterYAML, updateFlags []bool, isNetErr bool) {
-	updateFilters = d.listsToUpdate(filters, force)
+	include func(flt *FilterYAML) (ok bool),
+) (updateCount int, updateFilters []FilterYAML, updateFlags []bool, isNetErr bool, err error) {
+	updateFilters = d.listsToUpdate(filters, force, include)
 	if len(updateFilters) == 0 {
-		return 0, nil, nil, false
+		return 0, nil, nil, false, nil
 	}
 
-	failNum, updateFlags := d.updateFilterList(ctx, updateFilters)
-	if failNum == len(updateFilters) {
-		return 0, nil, nil, true
+	errs, updateFlags := d.updateFilterList(ctx, updateFilters)
+	err = errors.Join(errs...)
+
+	if len(errs) == len(updateFilters) {
+		return 0, nil, nil, true, err
 	}
 
 	d.conf.filtersMu.Lock()
@@ -328,32 +430,36 @@ func (d *DNSFilter) refreshFiltersArray(
 
 	updateCount = d.syncUpdatedFilters(ctx, filters, updateFilters, updateFlags)
 
-	return updateCount, updateFilters, updateFlags, false
+	return updateCount, updateFilters, updateFlags, false, err
 }
 
-// updateFilterList updates each filter in updateFilters and returns the number
-// of failures and the updateFlags slice aligned with updateFilters indicating
-// whether each filter's data changed.
+// updateFilterList updates each filter in updateFilters and returns the errors
+// of the failed updates and the updateFlags slice aligned with updateFilters
+// indicating whether each filter's data changed.  Each of errs is a
+// *rulelist.FilterError.
 func (d *DNSFilter) updateFilterList(
 	ctx context.Context,
 	updateFilters []FilterYAML,
-) (failNum int, updateFlags []bool) {
+) (errs []error, updateFlags []bool) {
 	for i := range updateFilters {
 		uf := &updateFilters[i]
 		updated, err := d.update(uf)
 		updateFlags = append(updateFlags, updated)
 		if err != nil {
-			failNum++
-			d.logger.ErrorContext(ctx, "updating filter", "url", uf.URL, slogutil.KeyError, err)
+			errs = append(errs, &rulelist.FilterError{
+				Err: err,
+				UID: uf.UID,
+			})
+			d.logger.DebugContext(ctx, "updating filter", "url", uf.URL, slogutil.KeyError, err)
 		}
 	}
 
-	return failNum, updateFlags
+	return errs, updateFlags
 }
 
-// syncUpdatedFilters syncs updated filters back to the original filters slice
-// and returns the updateCount.  filters must not be nil.  updateFlags must
-// align with updateFilters.  d.conf.filtersMu must be locked.
+// syncUpdatedFilters syncs the names of the updated filters back to the
+// original filters slice and returns the updateCount.  filters must not be nil.
+// updateFlags must align with updateFilters.  d.conf.filtersMu must be locked.
 func (d *DNSFilter) syncUpdatedFilters(
 	ctx context.Context,
 	filters *[]FilterYAML,
@@ -364,14 +470,13 @@ func (d *DNSFilter) syncUpdatedFilters(
 		uf := &updateFilters[i]
 		updated := updateFlags[i]
 
+		if !updated {
+			continue
+		}
+
 		for k := range *filters {
 			f := &(*filters)[k]
-			if f.ID != uf.ID || f.URL != uf.URL {
-				continue
-			}
-
-			f.LastUpdated = uf.LastUpdated
-			if !updated {
+			if f.UID != uf.UID || f.URL != uf.URL {
 				continue
 			}
 
@@ -379,13 +484,10 @@ func (d *DNSFilter) syncUpdatedFilters(
 				ctx,
 				"updated filter",
 				"id", f.ID,
-				"rules_count", uf.RulesCount,
-				"prev_rules_count", f.RulesCount,
+				"rules_count", d.ruleListState(f).RulesCount,
 			)
 
 			f.Name = uf.Name
-			f.RulesCount = uf.RulesCount
-			f.checksum = uf.checksum
 			updateCount++
 		}
 	}
@@ -394,24 +496,32 @@ func (d *DNSFilter) syncUpdatedFilters(
 }
 
 // refreshFiltersIntl checks filters and updates them if necessary.  If force is
-// true, it ignores the filter.LastUpdated field value.
+// true, it ignores the time of the last update of the filters.  If include
+// isn't nil, only the filter lists for which it returns true are checked.
 //
 // Algorithm:
 //
 //  1. Get the list of filters to be updated.  For each filter, run the download
-//     and checksum check operation.  Store downloaded data in a temporary file
-//     inside data/filters directory
+//     and checksum check operation using d.lists.  Store downloaded data in a
+//     temporary file inside data/filters directory
 //
 //  2. For each filter, if filter data hasn't changed, just set new update time
-//     on file.  Otherwise, rename the temporary file (<temp> -> 1.txt).  Note
-//     that this method works only on Unix systems.  On Windows, don't pass
-//     files to filtering, pass the whole data.
+//     on file.  Otherwise, rename the temporary file (<temp> -> <uid>.txt).
+//     Note that this method works only on Unix systems.  On Windows, don't
+//     pass files to filtering, pass the whole data.
 //
 // refreshFiltersIntl returns the number of updated filters.  It also returns
-// true if there was a network error and nothing could be updated.
+// true if there was a network error and nothing could be updated.  err contains
+// the *rulelist.FilterError of each list that has failed to update, which is
+// also stored as the error of that list.
 //
 // TODO(a.garipov, e.burkov): What the hell?
-func (d *DNSFilter) refreshFiltersIntl(block, allow, force bool) (int, bool) {
+func (d *DNSFilter) refreshFiltersIntl(
+	block bool,
+	allow bool,
+	force bool,
+	include func(flt *FilterYAML) (ok bool),
+) (updated int, isNetErr bool, err error) {
 	ctx := context.TODO()
 
 	updNum := 0
@@ -422,40 +532,61 @@ func (d *DNSFilter) refreshFiltersIntl(block, allow, force bool) (int, bool) {
 
 	var lists []FilterYAML
 	var toUpd []bool
-	isNetErr := false
 
 	if block {
-		updNum, lists, toUpd, isNetErr = d.refreshFiltersArray(ctx, &d.conf.Filters, force)
+		updNum, lists, toUpd, isNetErr, err = d.refreshFiltersArray(
+			ctx,
+			&d.conf.Filters,
+			force,
+			include,
+		)
 	}
 	if allow {
-		updNumAl, listsAl, toUpdAl, isNetErrAl := d.refreshFiltersArray(
+		updNumAl, listsAl, toUpdAl, isNetErrAl, errAl := d.refreshFiltersArray(
 			ctx,
 			&d.conf.WhitelistFilters,
 			force,
+			include,
 		)
 
 		updNum += updNumAl
 		lists = append(lists, listsAl...)
 		toUpd = append(toUpd, toUpdAl...)
 		isNetErr = isNetErr || isNetErrAl
+		err = errors.Join(err, errAl)
 	}
 	if isNetErr {
-		return 0, true
+		return 0, true, err
 	}
 
 	if updNum == 0 {
-		return 0, false
+		return 0, false, err
 	}
 
 	d.EnableFilters(false)
 
 	for i := range lists {
 		if toUpd[i] {
-			removeOldFilterFile(ctx, d.logger, lists[i].Path(d.conf.DataDir))
+			removeOldFilterFile(ctx, d.logger, d.lists.CachePath(lists[i].UID))
 		}
 	}
 
-	return updNum, false
+	return updNum, false, err
+}
+
+// removeFilterFiles removes the removed filter list from d.lists, which moves
+// its cached contents aside and removes its raw copy, and removes its index, if
+// any.
+func (d *DNSFilter) removeFilterFiles(ctx context.Context, flt *FilterYAML) (err error) {
+	err = d.lists.Remove(ctx, flt.UID)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	d.removeIndex(ctx, d.lists.CachePath(flt.UID))
+
+	return nil
 }
 
 // removeOldFilterFile deletes the old filter file and logs any error at the
@@ -474,175 +605,133 @@ func removeOldFilterFile(ctx context.Context, l *slog.Logger, fltPath string) {
 	l.Log(ctx, lvl, "removing old filter", "path", fltPath, slogutil.KeyError, err)
 }
 
-// update refreshes filter's content and a/mtimes of it's file.
-func (d *DNSFilter) update(filter *FilterYAML) (b bool, err error) {
-	ctx := context.TODO()
-
-	b, err = d.updateIntl(ctx, filter)
-	filter.LastUpdated = time.Now()
-	if !b {
-		chErr := os.Chtimes(
-			filter.Path(d.conf.DataDir),
-			filter.LastUpdated,
-			filter.LastUpdated,
-		)
-		if chErr != nil {
-			d.logger.ErrorContext(ctx, "changing last modified time", slogutil.KeyError, chErr)
-		}
+// ruleList returns the rule list of flt from d.lists.  A new rule list is set if
+// there is none or if the URL of flt has changed.
+func (d *DNSFilter) ruleList(ctx context.Context, flt *FilterYAML) (rl *rulelist.Filter, err error) {
+	u, err := flt.ruleListURL()
+	if err != nil {
+		return nil, fmt.Errorf("parsing url: %w", err)
 	}
 
-	return b, err
-}
-
-// updateIntl updates the flt rewriting it's actual file.  It returns true if
-// the actual update has been performed.
-func (d *DNSFilter) updateIntl(ctx context.Context, flt *FilterYAML) (ok bool, err error) {
-	d.logger.DebugContext(ctx, "downloading update for filter", "id", flt.ID, "url", flt.URL)
+	rl, ok := d.lists.Filter(flt.UID)
+	if ok && rl.URL().String() == u.String() {
+		rl.SetEnabled(flt.Enabled)
 
-	var res *rulelist.ParseResult
-
-	tmpFile, err := aghrenameio.NewPendingFile(flt.Path(d.conf.DataDir), aghos.DefaultPermFile)
-	if err != nil {
-		return false, err
+		return rl, nil
 	}
-	defer func() { err = d.finalizeUpdate(ctx, tmpFile, flt, res, err, ok) }()
 
-	r, err := d.reader(flt.URL)
+	rl, err = rulelist.NewFilter(&rulelist.FilterConfig{
+		URL:         u,
+		UID:         flt.UID,
+		URLFilterID: flt.ID,
+		Enabled:     flt.Enabled,
+	})
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
-		return false, err
+		return nil, err
 	}
-	defer func() { err = errors.WithDeferred(err, r.Close()) }()
-
-	bufPtr := d.bufPool.Get()
-	defer d.bufPool.Put(bufPtr)
 
-	p := rulelist.NewParser()
-	res, err = p.Parse(tmpFile, r, *bufPtr)
+	d.lists.Set(ctx, rl)
 
-	return res.Checksum != flt.checksum && err == nil, err
+	return rl, nil
 }
 
-// finalizeUpdate closes and gets rid of temporary file f with filter's content
-// according to updated.  It also saves new values of flt's name, rules number
-// and checksum if succeeded.
-func (d *DNSFilter) finalizeUpdate(
-	ctx context.Context,
-	file aghrenameio.PendingFile,
-	flt *FilterYAML,
-	res *rulelist.ParseResult,
-	returned error,
-	updated bool,
-) (err error) {
-	id := flt.ID
-	if !updated {
-		if returned == nil {
-			d.logger.DebugContext(ctx, "skipping filter with no changes", "id", id, "url", flt.URL)
-		}
-
-		return errors.WithDeferred(returned, file.Cleanup())
-	}
-
-	d.logger.InfoContext(ctx, "saving contents", "id", id, "path", flt.Path(d.conf.DataDir))
-
-	err = file.CloseReplace()
-	if err != nil {
-		return fmt.Errorf("finalizing update: %w", err)
+// ruleListState returns the state of the rule list of flt after its last
+// loading or update.  st is empty if the list has never been loaded or updated.
+func (d *DNSFilter) ruleListState(flt *FilterYAML) (st rulelist.FilterState) {
+	rl, ok := d.lists.Filter(flt.UID)
+	if !ok {
+		return st
 	}
 
-	rulesCount := res.RulesCount
-	d.logger.InfoContext(
-		ctx,
-		"filter updated",
-		"id", id,
-		"bytes_written", res.BytesWritten,
-		"rules_count", rulesCount,
-	)
-
-	flt.ensureName(res.Title)
-	flt.checksum = res.Checksum
-	flt.RulesCount = rulesCount
-
-	return nil
+	return rl.State()
 }
 
-// reader returns an io.ReadCloser reading filtering-rule list data form either
-// a file on the filesystem or the filter's HTTP URL.
-func (d *DNSFilter) reader(fltURL string) (r io.ReadCloser, err error) {
-	if !filepath.IsAbs(fltURL) {
-		r, err = d.readerFromURL(fltURL)
-		if err != nil {
-			return nil, fmt.Errorf("reading from url: %w", err)
-		}
+// update refreshes the contents of filter using d.lists.  It returns true if
+// the rules have changed.  The error of the update is also kept as the error of
+// the rule list of filter.
+func (d *DNSFilter) update(filter *FilterYAML) (b bool, err error) {
+	ctx := context.TODO()
 
-		return r, nil
+	_, err = d.ruleList(ctx, filter)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return false, err
 	}
 
-	fltURL = filepath.Clean(fltURL)
-	if !pathMatchesAny(d.safeFSPatterns, fltURL) {
-		return nil, fmt.Errorf("path %q does not match safe patterns", fltURL)
+	b, err = d.lists.RefreshFilter(ctx, filter.UID)
+	if err != nil {
+		// Return the underlying error of the *rulelist.FilterError, since it's
+		// shown to the user as is.
+		return false, errors.Unwrap(err)
 	}
 
-	r, err = os.Open(fltURL)
-	if err != nil {
-		return nil, fmt.Errorf("opening file: %w", err)
+	if b {
+		filter.ensureName(d.ruleListState(filter).Title)
 	}
 
-	return r, nil
+	return b, nil
 }
 
-// readerFromURL returns an io.ReadCloser reading filtering-rule list data form
-// the filter's URL.
-func (d *DNSFilter) readerFromURL(fltURL string) (r io.ReadCloser, err error) {
-	resp, err := d.conf.HTTPClient.Get(fltURL)
+// load loads the data of flt from its cached contents using d.lists.
+func (d *DNSFilter) load(ctx context.Context, flt *FilterYAML) (err error) {
+	_, err = d.ruleList(ctx, flt)
 	if err != nil {
-		// Don't wrap the error since it's informative enough as is.
-		return nil, err
+		return fmt.Errorf("loading filter: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	err = d.lists.Load(ctx, flt.UID)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
 	}
 
-	return resp.Body, nil
+	flt.ensureName(d.ruleListState(flt).Title)
+
+	return nil
 }
 
-// loads filter contents from the file in dataDir
-func (d *DNSFilter) load(ctx context.Context, flt *FilterYAML) (err error) {
-	fileName := flt.Path(d.conf.DataDir)
+// migrateCache renames the cached contents of flt and their unprocessed copy
+// named after the ID of flt, which have been used before the contents were
+// cached by the UIDs, if there are any.  It also removes the index of the
+// previous contents, which is rebuilt for the renamed ones.
+func (d *DNSFilter) migrateCache(ctx context.Context, flt *FilterYAML) {
+	legacyPath := flt.legacyPath(d.conf.DataDir)
+	legacyRawPath := strings.TrimSuffix(legacyPath, ".txt") + ".raw.txt"
+
+	renames := []struct {
+		from string
+		to   string
+	}{{
+		from: legacyPath,
+		to:   d.lists.CachePath(flt.UID),
+	}, {
+		from: legacyRawPath,
+		to:   d.lists.RawPath(flt.UID),
+	}}
+
+	migrated := false
+	for _, r := range renames {
+		if _, err := os.Stat(r.from); err != nil {
+			continue
+		} else if _, err = os.Stat(r.to); err == nil {
+			continue
+		}
 
-	d.logger.DebugContext(ctx, "loading filter", "id", flt.ID, "path", fileName)
+		err := os.Rename(r.from, r.to)
+		if err != nil {
+			d.logger.WarnContext(ctx, "migrating filter cache", "path", r.from, slogutil.KeyError, err)
 
-	// #nosec G304 -- Assume that fileName is always within DataDir.
-	file, err := os.Open(fileName)
-	if errors.Is(err, os.ErrNotExist) {
-		// Do nothing, file doesn't exist.
-		return nil
-	} else if err != nil {
-		return fmt.Errorf("opening filter file: %w", err)
-	}
-	defer func() { err = errors.WithDeferred(err, file.Close()) }()
+			continue
+		}
 
-	st, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("getting filter file stat: %w", err)
+		migrated = true
 	}
 
-	d.logger.DebugContext(ctx, "filter file", "id", flt.ID, "path", fileName, "len", st.Size())
-
-	bufPtr := d.bufPool.Get()
-	defer d.bufPool.Put(bufPtr)
-
-	p := rulelist.NewParser()
-	res, err := p.Parse(io.Discard, file, *bufPtr)
-	if err != nil {
-		return fmt.Errorf("parsing filter file: %w", err)
+	if migrated {
+		d.logger.InfoContext(ctx, "migrated filter cache", "id", flt.ID, "uid", flt.UID)
+		d.removeIndex(ctx, legacyPath)
 	}
-
-	flt.ensureName(res.Title)
-	flt.RulesCount, flt.checksum, flt.LastUpdated = res.RulesCount, res.Checksum, st.ModTime()
-
-	return nil
 }
 
 // EnableFilters enables filters.
@@ -658,7 +747,7 @@ func (d *DNSFilter) enableFiltersLocked(ctx context.Context, async bool) {
 	filters := make([]Filter, 1, len(d.conf.Filters)+len(d.conf.WhitelistFilters)+1)
 	filters[0] = Filter{
 		ID:   rulelist.IDCustom,
-		Data: []byte(strings.Join(d.conf.UserRules, "\n")),
+		Data: []byte(strings.Join(d.withCustomRules(d.conf.UserRules, time.Now()), "\n")),
 	}
 
 	for _, filter := range d.conf.Filters {
@@ -668,7 +757,8 @@ func (d *DNSFilter) enableFiltersLocked(ctx context.Context, async bool) {
 
 		filters = append(filters, Filter{
 			ID:       filter.ID,
-			FilePath: filter.Path(d.conf.DataDir),
+			FilePath: d.lists.CachePath(filter.UID),
+			Group:    filter.Group,
 		})
 	}
 
@@ -680,7 +770,8 @@ func (d *DNSFilter) enableFiltersLocked(ctx context.Context, async bool) {
 
 		allowFilters = append(allowFilters, Filter{
 			ID:       filter.ID,
-			FilePath: filter.Path(d.conf.DataDir),
+			FilePath: d.lists.CachePath(filter.UID),
+			Group:    filter.Group,
 		})
 	}
 
@@ -689,6 +780,8 @@ func (d *DNSFilter) enableFiltersLocked(ctx context.Context, async bool) {
 		d.logger.ErrorContext(ctx, "enabling filters", slogutil.KeyError, err)
 	}
 
+	d.syncWatchedFiles(ctx)
+
 	d.SetEnabled(d.conf.FilteringEnabled)
 }
 
@@ -699,6 +792,9 @@ func (d *DNSFilter) ApplyAdditionalFiltering(cliAddr netip.Addr, clientID string
 
 	d.ApplyBlockedServices(setts)
 	d.applyClientFiltering(clientID, cliAddr, setts)
+	d.applyTagRules(setts)
+	d.applySchedules(setts, time.Now())
+	d.applyUnblockGrants(setts)
 	if setts.BlockedServices != nil {
 		// TODO(e.burkov):  Get rid of this crutch.
 		setts.ServicesRules = nil
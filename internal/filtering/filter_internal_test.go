@@ -7,8 +7,10 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/netutil/urlutil"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
@@ -64,11 +66,11 @@ func updateAndAssert(
 	require.NoError(tb, err)
 	wantUpd(tb, ok)
 
-	assert.Equal(tb, wantRulesCount, f.RulesCount)
+	assert.Equal(tb, wantRulesCount, dnsFilter.ruleListState(f).RulesCount)
 
 	dir, err := os.ReadDir(filepath.Join(dnsFilter.conf.DataDir, filterDir))
 	require.NoError(tb, err)
-	require.FileExists(tb, f.Path(dnsFilter.conf.DataDir))
+	require.FileExists(tb, dnsFilter.lists.CachePath(f.UID))
 
 	assert.Len(tb, dir, 1)
 
@@ -132,7 +134,11 @@ func TestDNSFilter_Update(t *testing.T) {
 		err := dnsFilter.load(ctx, f)
 		require.NoError(t, err)
 
-		f.unload()
+		dnsFilter.lists.Unload(f.UID)
+
+		st := dnsFilter.ruleListState(f)
+		assert.Zero(t, st.RulesCount)
+		assert.False(t, st.Updated.IsZero())
 	})
 }
 
@@ -175,3 +181,112 @@ func TestFilterYAML_EnsureName(t *testing.T) {
 		assert.Equal(t, "List 0", f.Name)
 	})
 }
+
+func TestDNSFilter_refreshFiltersIntl_lastError(t *testing.T) {
+	failing := &atomic.Bool{}
+	failing.Store(true)
+
+	addr := serveHTTPLocally(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("||example.org^\n"))
+	}))
+
+	d, err := New(&Config{
+		Logger:  testLogger,
+		DataDir: t.TempDir(),
+		HTTPClient: &http.Client{
+			Timeout: testTimeout,
+		},
+		Filters: []FilterYAML{{
+			Enabled: true,
+			URL:     addr,
+			Filter:  Filter{ID: 1},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	require.Len(t, d.conf.Filters, 1)
+
+	uid := d.conf.Filters[0].UID
+	require.NotEqual(t, rulelist.UID{}, uid)
+
+	_, isNetErr, err := d.refreshFiltersIntl(true, false, true, nil)
+	require.True(t, isNetErr)
+
+	refreshErr := &rulelist.FilterError{}
+	require.ErrorAs(t, err, &refreshErr)
+
+	assert.Equal(t, uid, refreshErr.UID)
+
+	fj := filterToJSON(d.conf.Filters[0], d.ruleListState(&d.conf.Filters[0]))
+	assert.Equal(t, uid, fj.UID)
+	assert.NotEmpty(t, fj.LastError)
+
+	fltErr := &rulelist.FilterError{}
+	require.ErrorAs(t, d.ruleListState(&d.conf.Filters[0]).Err, &fltErr)
+
+	assert.Equal(t, uid, fltErr.UID)
+
+	failing.Store(false)
+
+	updated, isNetErr, err := d.refreshFiltersIntl(true, false, true, nil)
+	require.NoError(t, err)
+	require.False(t, isNetErr)
+
+	assert.Equal(t, 1, updated)
+
+	fj = filterToJSON(d.conf.Filters[0], d.ruleListState(&d.conf.Filters[0]))
+	assert.Equal(t, uid, fj.UID)
+	assert.Empty(t, fj.LastError)
+}
+
+func TestDNSFilter_migrateCache(t *testing.T) {
+	dataDir := t.TempDir()
+	fltDir := filepath.Join(dataDir, filterDir)
+
+	err := os.MkdirAll(fltDir, 0o700)
+	require.NoError(t, err)
+
+	const (
+		content = "! Title: Legacy\n||one.example^\n||two.example^\n"
+		raw     = "! Diff-Path: patches/v1.patch\n" + content
+	)
+
+	err = os.WriteFile(filepath.Join(fltDir, "1.txt"), []byte(content), 0o600)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(fltDir, "1.raw.txt"), []byte(raw), 0o600)
+	require.NoError(t, err)
+
+	uid := rulelist.MustNewUID()
+	d, err := New(&Config{
+		Logger:  testLogger,
+		DataDir: dataDir,
+		HTTPClient: &http.Client{
+			Timeout: testTimeout,
+		},
+		Filters: []FilterYAML{{
+			Enabled: true,
+			URL:     "https://filters.example/list.txt",
+			UID:     uid,
+			Filter:  Filter{ID: 1},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	assert.NoFileExists(t, filepath.Join(fltDir, "1.txt"))
+	assert.NoFileExists(t, filepath.Join(fltDir, "1.raw.txt"))
+	assert.FileExists(t, d.lists.CachePath(uid))
+	assert.FileExists(t, d.lists.RawPath(uid))
+
+	flt := &d.conf.Filters[0]
+	assert.Equal(t, 2, d.ruleListState(flt).RulesCount)
+	assert.Equal(t, "Legacy", flt.Name)
+}
@@ -0,0 +1,370 @@
+package filtering
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// FilterGroup is a named group of filter lists.  Unlike the lists without a
+// group, which are applied to all clients, the lists of a group are only
+// applied to the clients that either select the group explicitly or have at
+// least one of its tags.
+type FilterGroup struct {
+	// Name is the unique name of the group.  It must not be empty.
+	Name string `yaml:"name"`
+
+	// Tags are the client tags for which the group is applied.
+	Tags []string `yaml:"tags"`
+}
+
+// validateFilterGroups returns an error if groups contain invalid or duplicated
+// groups.
+func validateFilterGroups(groups []*FilterGroup) (err error) {
+	names := container.NewMapSet[string]()
+	for i, g := range groups {
+		switch {
+		case g == nil:
+			return fmt.Errorf("filter_groups: at index %d: %w", i, errors.ErrNoValue)
+		case g.Name == "":
+			return fmt.Errorf("filter_groups: at index %d: name: %w", i, errors.ErrEmptyValue)
+		case names.Has(g.Name):
+			return fmt.Errorf(
+				"filter_groups: at index %d: name: %w: %q",
+				i,
+				errors.ErrDuplicated,
+				g.Name,
+			)
+		default:
+			names.Add(g.Name)
+		}
+	}
+
+	return nil
+}
+
+// hasFilterGroup returns true if the filter group with the given name is
+// configured.  d.confMu is expected to be locked.
+func (d *DNSFilter) hasFilterGroup(name string) (ok bool) {
+	return slices.ContainsFunc(d.conf.FilterGroups, func(g *FilterGroup) (found bool) {
+		return g.Name == name
+	})
+}
+
+// clientFilterGroups returns the names of the filter groups applied to the
+// client with the given settings.  setts must not be nil.
+func (d *DNSFilter) clientFilterGroups(setts *Settings) (groups []string) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	for _, g := range d.conf.FilterGroups {
+		if slices.Contains(setts.FilterGroups, g.Name) ||
+			slices.ContainsFunc(g.Tags, func(t string) (ok bool) {
+				return slices.Contains(setts.ClientTags, t)
+			}) {
+			groups = append(groups, g.Name)
+		}
+	}
+
+	return groups
+}
+
+// groupEngine is the filtering engine built from the filter lists of a single
+// filter group.
+type groupEngine struct {
+	// storage is the storage of the rules of the group.
+	storage *filterlist.RuleStorage
+
+	// engine is the filtering engine built from storage.
+	engine *urlfilter.DNSEngine
+
+	// indexes are the indexes of the filter lists of the group, if any.
+	indexes []*rulelist.Index
+}
+
+// partitionFilters splits filters into the ones without a group and the ones
+// belonging to each filter group.
+func partitionFilters(filters []Filter) (global []Filter, groups map[string][]Filter) {
+	for _, f := range filters {
+		if f.Group == "" {
+			global = append(global, f)
+
+			continue
+		}
+
+		if groups == nil {
+			groups = map[string][]Filter{}
+		}
+
+		groups[f.Group] = append(groups[f.Group], f)
+	}
+
+	return global, groups
+}
+
+// newGroupEngines returns the filtering engines for each of the groups of
+// filters.  idxs are the indexes of the filter lists by the group name, see
+// [DNSFilter.indexFilters].  onBuilt is called after each engine is built.
+func newGroupEngines(
+	groups map[string][]Filter,
+	idxs map[string][]*rulelist.Index,
+	onBuilt func(),
+) (engs map[string]*groupEngine, err error) {
+	engs = make(map[string]*groupEngine, len(groups))
+	for name, filters := range groups {
+		var rs *filterlist.RuleStorage
+		rs, err = newRuleStorage(filters)
+		if err != nil {
+			err = fmt.Errorf("filter group %q: %w", name, err)
+
+			return nil, errors.WithDeferred(err, closeGroupEngines(engs))
+		}
+
+		engs[name] = &groupEngine{
+			storage: rs,
+			engine:  urlfilter.NewDNSEngine(rs),
+			indexes: idxs[name],
+		}
+
+		onBuilt()
+	}
+
+	return engs, nil
+}
+
+// closeGroupEngines closes the rule storages of engs and returns the joined
+// error, if any.
+func closeGroupEngines(engs map[string]*groupEngine) (err error) {
+	var errs []error
+	for name, e := range engs {
+		closeErr := errors.Join(e.storage.Close(), closeIndexes(e.indexes))
+		if closeErr != nil {
+			errs = append(errs, fmt.Errorf("filter group %q: %w", name, closeErr))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// appendGroupEngines appends the engines of the given filter groups from
+// groupEngs to engs and returns the result.  The engines of groupEngs are
+// expected to be acquired, see [DNSFilter.acquireEngines].
+func appendGroupEngines(
+	engs []dnsMatcher,
+	groupEngs map[string]*groupEngine,
+	groups []string,
+) (res []dnsMatcher) {
+	res = engs
+	for _, name := range groups {
+		if e := groupEngs[name]; e != nil {
+			res = append(res, e.engine)
+			res = appendIndexes(res, e.indexes)
+		}
+	}
+
+	return res
+}
+
+// dnsMatcher is the common interface of the filtering engines and the rule
+// indexes.
+type dnsMatcher interface {
+	// MatchRequestInto matches req and appends the matched rules to res.  See
+	// [urlfilter.DNSEngine.MatchRequestInto].
+	MatchRequestInto(req *urlfilter.DNSRequest, res *urlfilter.DNSResult) (matched bool)
+}
+
+// type check
+var (
+	_ dnsMatcher = (*urlfilter.DNSEngine)(nil)
+	_ dnsMatcher = (*rulelist.Index)(nil)
+)
+
+// matchEngines matches req against the global engine and the additional
+// engines, such as the ones of filter groups and rule indexes.  The results of
+// all engines are combined so that exception and $important rules work across
+// them.  The engines are expected to be acquired, see
+// [DNSFilter.acquireEngines].
+func matchEngines(
+	global *urlfilter.DNSEngine,
+	extra []dnsMatcher,
+	req *urlfilter.DNSRequest,
+) (res *urlfilter.DNSResult, matched bool) {
+	res = &urlfilter.DNSResult{}
+	matched = global.MatchRequestInto(req, res)
+	if len(extra) == 0 {
+		return res, matched
+	}
+
+	for _, e := range extra {
+		e.MatchRequestInto(req, res)
+	}
+
+	res.NetworkRule = rules.GetDNSBasicRule(res.NetworkRules)
+	if res.NetworkRule != nil {
+		// Network rules take precedence over the hosts-file style ones, see
+		// [urlfilter.DNSEngine.MatchRequestInto].
+		res.HostRulesV4, res.HostRulesV6 = nil, nil
+
+		return res, true
+	}
+
+	return res, len(res.HostRulesV4) > 0 || len(res.HostRulesV6) > 0
+}
+
+// filterGroupJSON is the JSON representation of a [FilterGroup].
+type filterGroupJSON struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// filterGroupsJSON is the request and response body for the filter groups HTTP
+// API.
+type filterGroupsJSON struct {
+	Groups []*filterGroupJSON `json:"groups"`
+}
+
+// handleFilterGroups is the handler for the GET /control/filtering/groups HTTP
+// API.
+func (d *DNSFilter) handleFilterGroups(w http.ResponseWriter, r *http.Request) {
+	resp := &filterGroupsJSON{
+		Groups: []*filterGroupJSON{},
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		for _, g := range d.conf.FilterGroups {
+			resp.Groups = append(resp.Groups, &filterGroupJSON{
+				Name: g.Name,
+				Tags: slices.Clone(g.Tags),
+			})
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
+}
+
+// handleFilterGroupsUpdate is the handler for the PUT
+// /control/filtering/groups/update HTTP API.
+func (d *DNSFilter) handleFilterGroupsUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	req := &filterGroupsJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	groups := make([]*FilterGroup, 0, len(req.Groups))
+	for _, g := range req.Groups {
+		if g == nil {
+			groups = append(groups, nil)
+
+			continue
+		}
+
+		groups = append(groups, &FilterGroup{
+			Name: g.Name,
+			Tags: g.Tags,
+		})
+	}
+
+	err = validateFilterGroups(groups)
+	if err == nil {
+		err = d.validateGroupsInUse(groups)
+	}
+
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		d.conf.FilterGroups = groups
+	}()
+
+	l.DebugContext(ctx, "updated filter groups", "num", len(groups))
+
+	d.conf.ConfModifier.Apply(ctx)
+}
+
+// validateGroupsInUse returns an error if any of the filter lists belongs to a
+// group missing from groups.
+func (d *DNSFilter) validateGroupsInUse(groups []*FilterGroup) (err error) {
+	names := container.NewMapSet[string]()
+	for _, g := range groups {
+		names.Add(g.Name)
+	}
+
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	for _, flts := range [][]FilterYAML{d.conf.Filters, d.conf.WhitelistFilters} {
+		for _, f := range flts {
+			if f.Group != "" && !names.Has(f.Group) {
+				return fmt.Errorf("filter group %q is used by filter list %d", f.Group, f.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateFilterGroup returns an error if the filter group with the given name
+// doesn't exist.  An empty name is valid and means no group.
+func (d *DNSFilter) validateFilterGroup(name string) (err error) {
+	if name == "" {
+		return nil
+	}
+
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	if !d.hasFilterGroup(name) {
+		return fmt.Errorf("filter group %q: %w", name, errFilterGroupNotExist)
+	}
+
+	return nil
+}
+
+// errFilterGroupNotExist is returned when a filter list refers to an unknown
+// filter group.
+const errFilterGroupNotExist errors.Error = "group doesn't exist"
+
+// logUnusedGroupLists logs the filter lists that refer to unknown filter
+// groups, since such lists are never applied.
+func (d *DNSFilter) logUnusedGroupLists(ctx context.Context, filters []FilterYAML) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	for _, f := range filters {
+		if f.Group != "" && !d.hasFilterGroup(f.Group) {
+			d.logger.WarnContext(
+				ctx,
+				"filter list refers to unknown group",
+				"id", f.ID,
+				"group", f.Group,
+				slogutil.KeyError, errFilterGroupNotExist,
+			)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package filtering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_CheckHost_filterGroups(t *testing.T) {
+	const (
+		globalRules = "||global.example^\n" +
+			"||shared.example^\n" +
+			"||important.example^$important\n"
+		kidsRules = "@@||shared.example^\n" +
+			"@@||important.example^\n" +
+			"||kids.example^\n"
+		kidsAllowRules = "||global.example^\n"
+		iotRules       = "||iot.example^\n"
+	)
+
+	d, _ := newForTest(t, &Config{
+		FilterGroups: []*FilterGroup{{
+			Name: "kids",
+		}, {
+			Name: "iot",
+			Tags: []string{"device_camera"},
+		}},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	blockFilters := []Filter{{
+		ID:   0,
+		Data: []byte(globalRules),
+	}, {
+		ID:    1,
+		Data:  []byte(kidsRules),
+		Group: "kids",
+	}, {
+		ID:    2,
+		Data:  []byte(iotRules),
+		Group: "iot",
+	}}
+
+	allowFilters := []Filter{{
+		ID:    3,
+		Data:  []byte(kidsAllowRules),
+		Group: "kids",
+	}}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	err := d.setFilters(ctx, blockFilters, allowFilters, false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		host       string
+		groups     []string
+		tags       []string
+		wantReason Reason
+	}{{
+		name:       "global",
+		host:       "global.example",
+		groups:     nil,
+		tags:       nil,
+		wantReason: FilteredBlockList,
+	}, {
+		name:       "group_not_selected",
+		host:       "kids.example",
+		groups:     nil,
+		tags:       nil,
+		wantReason: NotFilteredNotFound,
+	}, {
+		name:       "group_selected",
+		host:       "kids.example",
+		groups:     []string{"kids"},
+		tags:       nil,
+		wantReason: FilteredBlockList,
+	}, {
+		name:       "group_exception",
+		host:       "shared.example",
+		groups:     []string{"kids"},
+		tags:       nil,
+		wantReason: NotFilteredAllowList,
+	}, {
+		name:       "global_important",
+		host:       "important.example",
+		groups:     []string{"kids"},
+		tags:       nil,
+		wantReason: FilteredBlockList,
+	}, {
+		name:       "group_allowlist",
+		host:       "global.example",
+		groups:     []string{"kids"},
+		tags:       nil,
+		wantReason: NotFilteredAllowList,
+	}, {
+		name:       "group_by_tag",
+		host:       "iot.example",
+		groups:     nil,
+		tags:       []string{"device_camera"},
+		wantReason: FilteredBlockList,
+	}, {
+		name:       "group_other_tag",
+		host:       "iot.example",
+		groups:     nil,
+		tags:       []string{"device_pc"},
+		wantReason: NotFilteredNotFound,
+	}, {
+		name:       "group_unknown",
+		host:       "iot.example",
+		groups:     []string{"unknown"},
+		tags:       nil,
+		wantReason: NotFilteredNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setts := &Settings{
+				ClientTags:        tc.tags,
+				FilterGroups:      tc.groups,
+				ProtectionEnabled: true,
+				FilteringEnabled:  true,
+			}
+
+			res, cErr := d.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, cErr)
+
+			assert.Equal(t, tc.wantReason, res.Reason)
+		})
+	}
+}
+
+func TestDNSFilter_handleFilterGroupsUpdate(t *testing.T) {
+	confModCh := make(chan struct{}, 1)
+	d := newDNSFilter(t)
+	d.conf.ConfModifier = &aghtest.ConfigModifier{
+		OnApply: func(_ context.Context) {
+			confModCh <- struct{}{}
+		},
+	}
+
+	d.conf.Filters = []FilterYAML{{
+		Enabled: true,
+		Filter: Filter{
+			ID:    1,
+			Group: "kids",
+		},
+	}}
+
+	testCases := []struct {
+		name       string
+		body       string
+		wantGroups []*FilterGroup
+		wantCode   int
+	}{{
+		name: "success",
+		body: `{"groups":[{"name":"kids","tags":[]},` +
+			`{"name":"iot","tags":["device_camera"]}]}`,
+		wantGroups: []*FilterGroup{{
+			Name: "kids",
+			Tags: []string{},
+		}, {
+			Name: "iot",
+			Tags: []string{"device_camera"},
+		}},
+		wantCode: http.StatusOK,
+	}, {
+		name:       "empty_name",
+		body:       `{"groups":[{"name":"kids"},{"name":""}]}`,
+		wantGroups: nil,
+		wantCode:   http.StatusBadRequest,
+	}, {
+		name:       "duplicate",
+		body:       `{"groups":[{"name":"kids"},{"name":"kids"}]}`,
+		wantGroups: nil,
+		wantCode:   http.StatusBadRequest,
+	}, {
+		name:       "in_use",
+		body:       `{"groups":[{"name":"iot"}]}`,
+		wantGroups: nil,
+		wantCode:   http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d.conf.FilterGroups = nil
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(
+				http.MethodPut,
+				"/control/filtering/groups/update",
+				bytes.NewBufferString(tc.body),
+			)
+
+			d.handleFilterGroupsUpdate(w, r)
+			require.Equal(t, tc.wantCode, w.Code)
+
+			if tc.wantCode != http.StatusOK {
+				assert.Nil(t, d.conf.FilterGroups)
+
+				return
+			}
+
+			testutil.RequireReceive(t, confModCh, testTimeout)
+			assert.Equal(t, tc.wantGroups, d.conf.FilterGroups)
+
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/control/filtering/groups", nil)
+			d.handleFilterGroups(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			resp := &filterGroupsJSON{}
+			err := json.NewDecoder(w.Body).Decode(resp)
+			require.NoError(t, err)
+
+			require.Len(t, resp.Groups, len(tc.wantGroups))
+			for i, g := range resp.Groups {
+				assert.Equal(t, tc.wantGroups[i].Name, g.Name)
+				assert.Equal(t, tc.wantGroups[i].Tags, g.Tags)
+			}
+		})
+	}
+}
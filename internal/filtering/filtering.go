@@ -12,7 +12,6 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"runtime/debug"
 	"slices"
 	"strings"
 	"sync"
@@ -22,13 +21,16 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/agh"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/hostsfile"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/mathutil"
+	"github.com/AdguardTeam/golibs/service"
 	"github.com/AdguardTeam/golibs/syncutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/AdguardTeam/urlfilter"
 	"github.com/AdguardTeam/urlfilter/filterlist"
 	"github.com/AdguardTeam/urlfilter/rules"
@@ -49,6 +51,18 @@ type Settings struct {
 	ClientIP   netip.Addr
 	ClientTags []string
 
+	// FilterGroups are the names of the filter groups explicitly selected for
+	// the client.  The groups selected by the client tags are applied as well.
+	FilterGroups []string
+
+	// ClientRules are the custom filtering rules of the client and of its
+	// tags.  Items must not be nil.
+	ClientRules []*ClientRules
+
+	// ClientSchedules are the scheduled settings of the client.  Items must
+	// not be nil.
+	ClientSchedules []*ScheduledSettings
+
 	ServicesRules []ServiceEntry
 
 	// BlockedServices is the configuration of blocked services of a client.  It
@@ -63,6 +77,9 @@ type Settings struct {
 
 	// ClientSafeSearch is a client configured safe search.
 	ClientSafeSearch SafeSearch
+
+	// Checkers are the names of the named checkers applied to the client.
+	Checkers []string
 }
 
 // Resolver is the interface for net.Resolver to simplify testing.
@@ -88,6 +105,10 @@ type Config struct {
 	// ParentControl is the parental control hash-prefix checker.
 	ParentalControlChecker Checker `yaml:"-"`
 
+	// NamedCheckers are the additional checkers, such as threat-intelligence
+	// lookup services, created from Checkers.  Items must not be nil.
+	NamedCheckers []*NamedChecker `yaml:"-"`
+
 	SafeSearch SafeSearch `yaml:"-"`
 
 	// ApplyClientFiltering retrieves persistent client information using the
@@ -95,6 +116,12 @@ type Config struct {
 	// It must not be nil.
 	ApplyClientFiltering func(clientID string, cliAddr netip.Addr, setts *Settings) `yaml:"-"`
 
+	// RuleHits returns the number of matches of each filtering rule within the
+	// statistics retention interval.  If it's nil or returns nil, the numbers
+	// of matches aren't reported.  complete is false if some of the matched
+	// rules may be missing from hits.
+	RuleHits func() (hits map[RuleKey]uint64, complete bool) `yaml:"-"`
+
 	// BlockedServices is the configuration of blocked services.
 	// Per-client settings can override this configuration.
 	BlockedServices *BlockedServices `yaml:"blocked_services"`
@@ -112,9 +139,24 @@ type Config struct {
 	// HTTPReg registers HTTP handlers.  It must not be nil.
 	HTTPReg aghhttp.Registrar `yaml:"-"`
 
+	// WebUserLogin returns the login of the web user making the HTTP API
+	// request with ctx, if any.  It's used as the default author of the custom
+	// rules.  If it's nil, the author is only set explicitly.
+	WebUserLogin func(ctx context.Context) (login string) `yaml:"-"`
+
+	// ClientTags is the sorted list of the available client tags.  The tag
+	// schedules for other tags are rejected.
+	ClientTags []string `yaml:"-"`
+
 	// HTTPClient is the client to use for updating the remote filters.
 	HTTPClient *http.Client `yaml:"-"`
 
+	// Watcher is used to track the changes of the files of the local filter
+	// lists, so that they're applied without a refresh.  If it's nil, the
+	// files are only read on refreshes.  The watcher is started in
+	// [DNSFilter.Start] and shut down in [DNSFilter.Close].
+	Watcher aghos.FSWatcher `yaml:"-"`
+
 	// filtersMu protects filter lists.
 	filtersMu *sync.RWMutex
 
@@ -124,6 +166,10 @@ type Config struct {
 
 	SafeSearchConf SafeSearchConfig `yaml:"safe_search"`
 
+	// SafeSearchProviders are the custom safe search providers, which can be
+	// enabled both globally and per client using [SafeSearchConfig.Providers].
+	SafeSearchProviders []*SafeSearchProvider `yaml:"safe_search_providers"`
+
 	// DataDir is used to store filters' contents.
 	DataDir string `yaml:"-"`
 
@@ -141,19 +187,79 @@ type Config struct {
 	// Rewrites is a list of legacy DNS rewrite records.
 	Rewrites []*LegacyRewrite `yaml:"rewrites"`
 
+	// RewriteGroups are the groups of DNS rewrites applied only to some of the
+	// clients.  The rewrites of the first group matching a client take
+	// precedence over the ones of the following groups and the global ones.
+	RewriteGroups []*rewrite.Group `yaml:"rewrite_groups"`
+
 	// Filters are the blocking filter lists.
 	Filters []FilterYAML `yaml:"-"`
 
 	// WhitelistFilters are the allowing filter lists.
 	WhitelistFilters []FilterYAML `yaml:"-"`
 
+	// FilterGroups are the named groups of filter lists applied only to some
+	// of the clients.
+	FilterGroups []*FilterGroup `yaml:"filter_groups"`
+
+	// TagRules are the custom filtering rules applied to the clients with the
+	// corresponding tags.
+	TagRules []*TagRules `yaml:"tag_rules"`
+
+	// TagSchedules are the scheduled settings applied to the clients with the
+	// corresponding tags.
+	TagSchedules []*TagSchedules `yaml:"tag_schedules"`
+
+	// CustomServices are the blocked services defined by the administrator in
+	// addition to the builtin ones.  See [InitServices].
+	CustomServices []*CustomService `yaml:"custom_services"`
+
+	// ServiceCatalogs are the remote lists of additional blocked services.
+	// Their services are refreshed along with the filters.
+	ServiceCatalogs []*ServiceCatalog `yaml:"service_catalogs"`
+
 	// UserRules is the global list of custom rules.
 	UserRules []string `yaml:"-"`
 
+	// CustomRules are the global custom rules with metadata, which are applied
+	// along with UserRules until they expire.
+	CustomRules []*CustomRule `yaml:"custom_rules"`
+
+	// CustomRulesLastID is the last ID assigned to a custom rule.  It's kept
+	// so that the IDs of the removed rules aren't reused.
+	CustomRulesLastID uint64 `yaml:"custom_rules_last_id"`
+
+	// UnblockRequests are the requests of the clients to unblock domains,
+	// including the approved ones that haven't expired yet.
+	UnblockRequests []*UnblockRequest `yaml:"unblock_requests"`
+
+	// UnblockRequestsLastID is the last ID assigned to an unblock request.
+	// It's kept so that the IDs of the removed requests aren't reused.
+	UnblockRequestsLastID uint64 `yaml:"unblock_requests_last_id"`
+
+	// UnblockGrantDuration is the default duration of the allow rule created
+	// when an unblock request is approved.  If it's zero,
+	// [DefaultUnblockGrantDuration] is used.
+	UnblockGrantDuration timeutil.Duration `yaml:"unblock_grant_duration"`
+
 	// SafeFSPatterns are the patterns for matching which local filtering-rule
 	// files can be added.
 	SafeFSPatterns []string `yaml:"safe_fs_patterns"`
 
+	// SafeBrowsingDatabase is the URL or the absolute path of the offline
+	// database of hashed hostnames used for safe browsing.  If it's empty, the
+	// hosts are checked using the remote upstream.
+	SafeBrowsingDatabase string `yaml:"safebrowsing_database"`
+
+	// ParentalDatabase is the URL or the absolute path of the offline database
+	// of hashed hostnames used for parental control.  If it's empty, the hosts
+	// are checked using the remote upstream.
+	ParentalDatabase string `yaml:"parental_database"`
+
+	// Checkers are the configurations of the named checkers, such as
+	// threat-intelligence lookup services.  See [NamedChecker].
+	Checkers []*CheckerConfig `yaml:"checkers"`
+
 	SafeBrowsingCacheSize uint `yaml:"safebrowsing_cache_size"` // (in bytes)
 	SafeSearchCacheSize   uint `yaml:"safesearch_cache_size"`   // (in bytes)
 	ParentalCacheSize     uint `yaml:"parental_cache_size"`     // (in bytes)
@@ -181,6 +287,11 @@ type Config struct {
 	// RewritesEnabled indicates whether legacy rewrites are applied.
 	RewritesEnabled bool `yaml:"rewrites_enabled"`
 
+	// RuleIndexEnabled indicates whether the simple rules of the downloaded
+	// filter lists are compiled into memory-mapped indexes instead of being
+	// loaded into the filtering engine.  See [rulelist.CompileIndex].
+	RuleIndexEnabled bool `yaml:"rule_index_enabled"`
+
 	ParentalEnabled     bool `yaml:"parental_enabled"`
 	SafeBrowsingEnabled bool `yaml:"safebrowsing_enabled"`
 
@@ -255,19 +366,33 @@ type DNSFilter struct {
 	// bufPool is a pool of buffers used for filtering-rule list parsing.
 	bufPool *syncutil.Pool[[]byte]
 
-	rulesStorage    *filterlist.RuleStorage
-	filteringEngine *urlfilter.DNSEngine
+	// lists contains the filtering-rule lists of the filters from conf by their
+	// UIDs along with their cached contents.  It's never nil after New.
+	lists *rulelist.Storage
+
+	// engines are the current filtering engines.  Use
+	// [DNSFilter.acquireEngines] to use them for filtering.
+	engines atomic.Pointer[engines]
+
+	// rebuild is the status of the rebuilding of the filtering engines.
+	rebuild *rebuildStatus
 
-	rulesStorageAllow    *filterlist.RuleStorage
-	filteringEngineAllow *urlfilter.DNSEngine
+	// rebuildMu makes sure that only one rebuild of the filtering engines
+	// takes place at a time.
+	rebuildMu *sync.Mutex
+
+	// tagRules are the compiled custom filtering rules of the client tags by
+	// the tag.  It's protected by confMu.
+	tagRules map[string]*ClientRules
 
 	safeSearch SafeSearch
 
-	// safeBrowsingChecker is the safe browsing hash-prefix checker.
-	safeBrowsingChecker Checker
+	// checkers is the registry of the safe browsing, parental control, and
+	// named checkers in the order of application.
+	checkers []*registeredChecker
 
-	// parentalControl is the parental control hash-prefix checker.
-	parentalControlChecker Checker
+	// namedCheckers are the additional named checkers.
+	namedCheckers []*NamedChecker
 
 	// applyClientFiltering retrieves persistent client information using the
 	// ClientID or client IP address, and applies it to the filtering settings.
@@ -276,7 +401,13 @@ type DNSFilter struct {
 	// import cycle into account.
 	applyClientFiltering func(clientID string, cliAddr netip.Addr, setts *Settings)
 
-	engineLock sync.RWMutex
+	// rewriteIdx is the reverse index of the legacy rewrites.  It's protected
+	// by confMu.
+	rewriteIdx *rewriteIndex
+
+	// rewriteGroups are the rewrite groups from conf with their rewrites
+	// converted.  It's protected by confMu.
+	rewriteGroups []*rewriteGroup
 
 	// confMu protects conf.
 	confMu *sync.RWMutex
@@ -293,6 +424,20 @@ type DNSFilter struct {
 
 	refreshLock *sync.Mutex
 
+	// checkersRefreshed is the time of the last refresh of the checkers.  It's
+	// only accessed within updatesLoop.
+	checkersRefreshed time.Time
+
+	// watcher tracks the changes of the files of the local filter lists.  It's
+	// never nil.
+	watcher aghos.FSWatcher
+
+	// watchedMu protects watched.
+	watchedMu *sync.Mutex
+
+	// watched are the paths of the files tracked by watcher.
+	watched *container.MapSet[string]
+
 	hostCheckers []hostChecker
 
 	safeFSPatterns []string
@@ -308,6 +453,10 @@ type Filter struct {
 
 	// ID is automatically assigned when filter is added.
 	ID rules.ListID `yaml:"id"`
+
+	// Group is the name of the filter group of the list.  If it's empty, the
+	// list is applied to all clients.
+	Group string `yaml:"group,omitempty"`
 }
 
 // SetEnabled sets the status of the *DNSFilter.
@@ -325,6 +474,7 @@ func (d *DNSFilter) Settings() (s *Settings) {
 		SafeSearchEnabled:   d.conf.SafeSearchConf.Enabled,
 		SafeBrowsingEnabled: d.conf.SafeBrowsingEnabled,
 		ParentalEnabled:     d.conf.ParentalEnabled,
+		Checkers:            d.enabledCheckers(),
 	}
 }
 
@@ -336,6 +486,7 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 
 		*c = *d.conf
 		c.Rewrites = cloneRewrites(c.Rewrites)
+		c.UnblockRequests = slices.Clone(c.UnblockRequests)
 	}()
 
 	d.conf.filtersMu.RLock()
@@ -344,6 +495,8 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 	c.Filters = slices.Clone(d.conf.Filters)
 	c.WhitelistFilters = slices.Clone(d.conf.WhitelistFilters)
 	c.UserRules = slices.Clone(d.conf.UserRules)
+	c.CustomRules = slices.Clone(d.conf.CustomRules)
+	c.CustomRulesLastID = d.conf.CustomRulesLastID
 }
 
 // setFilters sets new filters, synchronously or asynchronously.  When filters
@@ -387,28 +540,19 @@ func (d *DNSFilter) setFilters(
 
 // Close - close the object
 func (d *DNSFilter) Close() {
-	d.engineLock.Lock()
-	defer d.engineLock.Unlock()
+	ctx := context.TODO()
 
 	if d.done != nil {
 		d.done <- struct{}{}
 	}
 
-	d.reset(context.TODO())
-}
-
-func (d *DNSFilter) reset(ctx context.Context) {
-	if d.rulesStorage != nil {
-		if err := d.rulesStorage.Close(); err != nil {
-			d.logger.ErrorContext(ctx, "closing rules storage", slogutil.KeyError, err)
-		}
+	err := d.watcher.Shutdown(ctx)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "shutting down filter files watcher", slogutil.KeyError, err)
 	}
 
-	if d.rulesStorageAllow != nil {
-		if err := d.rulesStorageAllow.Close(); err != nil {
-			d.logger.ErrorContext(ctx, "closing allow rules storage", slogutil.KeyError, err)
-		}
-	}
+	d.swapEngines(ctx, nil)
+	d.closeCheckers(ctx)
 }
 
 // ProtectionStatus returns the status of protection and time until it's
@@ -511,7 +655,7 @@ func (d *DNSFilter) CheckHost(
 	host = strings.ToLower(host)
 
 	if setts.FilteringEnabled {
-		res = d.processRewrites(host, qtype)
+		res = d.processRewrites(host, qtype, setts)
 		if res.Reason == Rewritten {
 			return res, nil
 		}
@@ -540,7 +684,10 @@ func (d *DNSFilter) CheckHost(
 // Secondly, it finds A or AAAA rewrites for host and, if found, sets res.IPList
 // accordingly.  If the found rewrite has a special value of "A" or "AAAA", the
 // result is an exception.
-func (d *DNSFilter) processRewrites(host string, qtype uint16) (res Result) {
+//
+// The rewrites of the groups matching the client take precedence over the
+// global ones, see [DNSFilter.clientRewrites].  setts must not be nil.
+func (d *DNSFilter) processRewrites(host string, qtype uint16, setts *Settings) (res Result) {
 	d.confMu.RLock()
 	defer d.confMu.RUnlock()
 
@@ -550,22 +697,25 @@ func (d *DNSFilter) processRewrites(host string, qtype uint16) (res Result) {
 		return Result{}
 	}
 
-	rewrites, matched := findRewrites(d.conf.Rewrites, host, qtype)
+	sets := d.clientRewrites(setts)
+	rewrites, matched := findRewritesIn(sets, host, qtype)
 	if !matched {
 		return Result{}
 	}
 
 	res.Reason = Rewritten
 
-	return d.handleRewriteLoop(ctx, host, qtype, rewrites, matched, &res)
+	return d.handleRewriteLoop(ctx, host, qtype, sets, rewrites, matched, &res)
 }
 
 // handleRewriteLoop performs filtering rewrite processing based on the legacy
-// rewrite records.  res must not be nil.
+// rewrite records.  sets are the sets of rewrites in the order of precedence,
+// see [DNSFilter.clientRewrites].  res must not be nil.
 func (d *DNSFilter) handleRewriteLoop(
 	ctx context.Context,
 	host string,
 	qtype uint16,
+	sets [][]*LegacyRewrite,
 	rewrites []*LegacyRewrite,
 	matched bool,
 	res *Result,
@@ -604,7 +754,8 @@ func (d *DNSFilter) handleRewriteLoop(
 
 		cnames.Add(host)
 		res.CanonName = host
-		rewrites, matched = findRewrites(d.conf.Rewrites, host, qtype)
+		setRewriteTTL(res, rw.TTL)
+		rewrites, matched = findRewritesIn(sets, host, qtype)
 	}
 
 	d.setRewriteResult(ctx, res, host, rewrites, qtype)
@@ -737,40 +888,6 @@ func ruleListFromFilter(f Filter) (rl filterlist.Interface, skip bool, err error
 	return rl, false, nil
 }
 
-// Initialize urlfilter objects.
-func (d *DNSFilter) initFiltering(ctx context.Context, allowFilters, blockFilters []Filter) (err error) {
-	rulesStorage, err := newRuleStorage(blockFilters)
-	if err != nil {
-		return err
-	}
-
-	rulesStorageAllow, err := newRuleStorage(allowFilters)
-	if err != nil {
-		return err
-	}
-
-	filteringEngine := urlfilter.NewDNSEngine(rulesStorage)
-	filteringEngineAllow := urlfilter.NewDNSEngine(rulesStorageAllow)
-
-	func() {
-		d.engineLock.Lock()
-		defer d.engineLock.Unlock()
-
-		d.reset(ctx)
-		d.rulesStorage = rulesStorage
-		d.filteringEngine = filteringEngine
-		d.rulesStorageAllow = rulesStorageAllow
-		d.filteringEngineAllow = filteringEngineAllow
-	}()
-
-	// Make sure that the OS reclaims memory as soon as possible.
-	debug.FreeOSMemory()
-
-	d.logger.DebugContext(ctx, "initialized filtering engine")
-
-	return nil
-}
-
 // hostRules is a helper that converts a slice of host rules into a slice of the
 // rules.Rule interface values.
 func hostRulesToRules(netRules []*rules.HostRule) (res []rules.Rule) {
@@ -887,6 +1004,8 @@ func (d *DNSFilter) matchHost(
 
 	ctx := context.TODO()
 
+	groups := d.clientFilterGroups(setts)
+
 	// TODO(f.setrakov): Reuse client tags and identifiers.
 	ufReq := &urlfilter.DNSRequest{
 		Hostname:          host,
@@ -896,25 +1015,37 @@ func (d *DNSFilter) matchHost(
 		DNSType:           rrtype,
 	}
 
-	d.engineLock.RLock()
-	// Keep in mind that this lock must be held no just when calling Match() but
-	// also while using the rules returned by it.
+	e := d.acquireEngines()
+	if e == nil {
+		return Result{}, nil
+	}
+
+	// Keep in mind that the engines must be acquired not just when calling
+	// Match() but also while using the rules returned by it.
 	//
 	// TODO(e.burkov):  Inspect if the above is true.
-	defer d.engineLock.RUnlock()
+	defer e.release()
 
-	if setts.ProtectionEnabled && d.filteringEngineAllow != nil {
-		dnsres, ok := d.filteringEngineAllow.MatchRequest(ufReq)
+	if setts.ProtectionEnabled && e.engineAllow != nil {
+		allowEngs := appendIndexes(nil, e.indexesAllow)
+		allowEngs = appendGroupEngines(allowEngs, e.groupsAllow, groups)
+		dnsres, ok := matchEngines(e.engineAllow, allowEngs, ufReq)
 		if ok {
 			return d.matchHostProcessAllowList(ctx, host, dnsres)
 		}
 	}
 
-	if d.filteringEngine == nil {
+	if e.engine == nil {
 		return Result{}, nil
 	}
 
-	dnsres, matchedEngine := d.filteringEngine.MatchRequest(ufReq)
+	engs := appendIndexes(nil, e.indexes)
+	engs = appendGroupEngines(engs, e.groups, groups)
+	for _, cr := range setts.ClientRules {
+		engs = append(engs, cr.engine)
+	}
+
+	dnsres, matchedEngine := matchEngines(e.engine, engs, ufReq)
 
 	// Check DNS rewrites first, because the API there is a bit awkward.
 	dnsRWRes := d.processDNSResultRewrites(dnsres, host)
@@ -970,14 +1101,27 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 	d = &DNSFilter{
 		logger: c.Logger,
 		// #nosec G115 -- The Unix epoch time is highly unlikely to be negative.
-		idGen:                  newIDGenerator(uint64(time.Now().Unix()), c.Logger),
-		bufPool:                syncutil.NewSlicePool[byte](rulelist.DefaultRuleBufSize),
-		safeSearch:             c.SafeSearch,
-		refreshLock:            &sync.Mutex{},
-		safeBrowsingChecker:    c.SafeBrowsingChecker,
-		parentalControlChecker: c.ParentalControlChecker,
-		applyClientFiltering:   c.ApplyClientFiltering,
-		confMu:                 &sync.RWMutex{},
+		idGen:       newIDGenerator(uint64(time.Now().Unix()), c.Logger),
+		bufPool:     syncutil.NewSlicePool[byte](rulelist.DefaultRuleBufSize),
+		safeSearch:  c.SafeSearch,
+		refreshLock: &sync.Mutex{},
+		rebuild:     newRebuildStatus(),
+		rebuildMu:   &sync.Mutex{},
+		checkers: newCheckerRegistry(
+			c.SafeBrowsingChecker,
+			c.ParentalControlChecker,
+			c.NamedCheckers,
+		),
+		namedCheckers:        c.NamedCheckers,
+		applyClientFiltering: c.ApplyClientFiltering,
+		confMu:               &sync.RWMutex{},
+		watcher:              c.Watcher,
+		watchedMu:            &sync.Mutex{},
+		watched:              container.NewMapSet[string](),
+	}
+
+	if d.watcher == nil {
+		d.watcher = aghos.EmptyFSWatcher{}
 	}
 
 	err = d.validateSafeFSPatterns(c.SafeFSPatterns)
@@ -986,6 +1130,14 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		return nil, err
 	}
 
+	d.lists = rulelist.NewStorage(&rulelist.StorageConfig{
+		Logger:              c.Logger,
+		HTTPClient:          c.HTTPClient,
+		CheckFilePath:       d.checkFilePath,
+		CacheDir:            filepath.Join(c.DataDir, filterDir),
+		MaxRuleListTextSize: rulelist.DefaultMaxRuleListSize,
+	})
+
 	d.hostCheckers = []hostChecker{{
 		check: d.matchSysHosts,
 		name:  "hosts container",
@@ -996,11 +1148,8 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		check: d.matchBlockedServicesRules,
 		name:  "blocked services",
 	}, {
-		check: d.checkSafeBrowsing,
-		name:  "safe browsing",
-	}, {
-		check: d.checkParental,
-		name:  "parental",
+		check: d.checkRegistered,
+		name:  "checkers",
 	}, {
 		check: d.checkSafeSearch,
 		name:  "safe search",
@@ -1016,6 +1165,45 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		return nil, fmt.Errorf("rewrites: preparing: %w", err)
 	}
 
+	err = d.prepareRewriteGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite_groups: %w", err)
+	}
+
+	err = validateFilterGroups(d.conf.FilterGroups)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	d.tagRules, err = compileTagRules(d.conf.TagRules)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	err = validateTagSchedules(d.conf.TagSchedules)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	err = d.prepareUnblockRequests()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	err = validateCustomRules(d.conf.CustomRules)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	for _, cr := range d.conf.CustomRules {
+		d.conf.CustomRulesLastID = max(d.conf.CustomRulesLastID, cr.ID)
+	}
+
 	if d.conf.BlockedServices != nil {
 		d.conf.BlockedServices.FilterUnknownIDs(ctx, d.logger)
 		err = d.conf.BlockedServices.Validate()
@@ -1040,15 +1228,27 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		return nil, fmt.Errorf("making filtering directory: %w", err)
 	}
 
-	d.loadFilters(ctx, d.conf.Filters)
-	d.loadFilters(ctx, d.conf.WhitelistFilters)
-
 	d.conf.Filters = deduplicateFilters(d.conf.Filters)
 	d.conf.WhitelistFilters = deduplicateFilters(d.conf.WhitelistFilters)
 
+	uids := container.NewMapSet[rulelist.UID]()
+	err = d.loadFilters(ctx, d.conf.Filters, uids)
+	if err == nil {
+		err = d.loadFilters(ctx, d.conf.WhitelistFilters, uids)
+	}
+
+	if err != nil {
+		d.Close()
+
+		return nil, fmt.Errorf("loading filters: %w", err)
+	}
+
 	d.idGen.fix(d.conf.Filters)
 	d.idGen.fix(d.conf.WhitelistFilters)
 
+	d.logUnusedGroupLists(ctx, d.conf.Filters)
+	d.logUnusedGroupLists(ctx, d.conf.WhitelistFilters)
+
 	return d, nil
 }
 
@@ -1068,6 +1268,16 @@ func (d *DNSFilter) validateSafeFSPatterns(patterns []string) (err error) {
 	return nil
 }
 
+// checkFilePath returns an error if the local filtering-rule list file at
+// filePath doesn't match the safe patterns.  filePath must be absolute.
+func (d *DNSFilter) checkFilePath(filePath string) (err error) {
+	if !pathMatchesAny(d.safeFSPatterns, filePath) {
+		return fmt.Errorf("path %q does not match safe patterns", filePath)
+	}
+
+	return nil
+}
+
 // Start registers web handlers and starts filters updates loop.
 func (d *DNSFilter) Start() {
 	d.filtersInitializerChan = make(chan filtersInitializerParams, 1)
@@ -1075,16 +1285,28 @@ func (d *DNSFilter) Start() {
 
 	d.RegisterFilteringHandlers()
 
-	go d.updatesLoop(context.TODO())
+	ctx := context.TODO()
+	err := d.watcher.Start(ctx)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "starting filter files watcher", slogutil.KeyError, err)
+	}
+
+	go d.handleWatcherEvents(ctx)
+	go d.updatesLoop(ctx)
 }
 
-// updatesLoop initializes new filters and checks for filters updates in a loop.
+// updatesLoop initializes new filters, checks for filters, service catalogs,
+// and hash-prefix databases updates, and removes the outdated unblock requests
+// and the expired custom rules in a loop.
 func (d *DNSFilter) updatesLoop(ctx context.Context) {
 	defer slogutil.RecoverAndLog(ctx, d.logger)
 
 	ivl := time.Second * 5
 	t := time.NewTimer(ivl)
 
+	cleanupTicker := time.NewTicker(unblockCleanupIvl)
+	defer cleanupTicker.Stop()
+
 	for {
 		select {
 		case params := <-d.filtersInitializerChan:
@@ -1095,8 +1317,13 @@ func (d *DNSFilter) updatesLoop(ctx context.Context) {
 				continue
 			}
 		case <-t.C:
-			ivl = d.periodicallyRefreshFilters(ivl)
+			ivl = d.periodicallyRefreshFilters(ctx, ivl)
+			d.refreshServiceCatalogs(ctx)
+			d.refreshCheckers(ctx)
 			t.Reset(ivl)
+		case <-cleanupTicker.C:
+			d.cleanupUnblockRequests(ctx)
+			d.removeExpiredCustomRules(ctx)
 		case <-d.done:
 			t.Stop()
 
@@ -1106,16 +1333,21 @@ func (d *DNSFilter) updatesLoop(ctx context.Context) {
 }
 
 // periodicallyRefreshFilters checks for filters updates and returns time
-// interval for the next update.
-func (d *DNSFilter) periodicallyRefreshFilters(ivl time.Duration) (nextIvl time.Duration) {
+// interval for the next update.  Errors are logged.
+func (d *DNSFilter) periodicallyRefreshFilters(
+	ctx context.Context,
+	ivl time.Duration,
+) (nextIvl time.Duration) {
 	const maxInterval = time.Hour
 
 	if d.conf.FiltersUpdateIntervalHours == 0 {
 		return ivl
 	}
 
-	isNetErr, ok := false, false
-	_, isNetErr, ok = d.tryRefreshFilters(true, true, false)
+	_, isNetErr, ok, err := d.tryRefreshFilters(true, true, false)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "refreshing filters", slogutil.KeyError, err)
+	}
 
 	if ok && !isNetErr {
 		ivl = maxInterval
@@ -1127,76 +1359,28 @@ func (d *DNSFilter) periodicallyRefreshFilters(ivl time.Duration) (nextIvl time.
 	return ivl
 }
 
-// Safe browsing and parental control methods.
-
-// TODO(a.garipov): Unify with checkParental.
-func (d *DNSFilter) checkSafeBrowsing(
-	host string,
-	_ uint16,
-	setts *Settings,
-) (res Result, err error) {
-	if !setts.ProtectionEnabled || !setts.SafeBrowsingEnabled {
-		return Result{}, nil
-	}
-
-	ctx := context.TODO()
-	if d.logger.Enabled(ctx, slogutil.LevelDebug) {
-		startTime := time.Now()
-		defer func() {
-			elapsed := time.Since(startTime)
-			d.logger.DebugContext(ctx, "safebrowsing lookup", "host", host, "elapsed", elapsed)
-		}()
-	}
-
-	res = Result{
-		Rules: []*ResultRule{{
-			Text:         "adguard-malware-shavar",
-			FilterListID: rulelist.APIIDSafeBrowsing,
-		}},
-		Reason:     FilteredSafeBrowsing,
-		IsFiltered: true,
-	}
-
-	block, err := d.safeBrowsingChecker.Check(host)
-	if !block || err != nil {
-		return Result{}, err
-	}
-
-	return res, nil
-}
-
-// TODO(a.garipov): Unify with checkSafeBrowsing.
-func (d *DNSFilter) checkParental(
-	host string,
-	_ uint16,
-	setts *Settings,
-) (res Result, err error) {
-	if !setts.ProtectionEnabled || !setts.ParentalEnabled {
-		return Result{}, nil
+// refreshCheckers refreshes the safe browsing, parental control, and named
+// checkers that implement [service.Refresher], such as the ones using offline
+// databases, on the first call and then once in the filters update interval.
+// If the interval is zero, the checkers are only refreshed on the first call.
+// Errors are logged.
+func (d *DNSFilter) refreshCheckers(ctx context.Context) {
+	ivl := time.Duration(d.conf.FiltersUpdateIntervalHours) * time.Hour
+	if !d.checkersRefreshed.IsZero() && (ivl == 0 || time.Since(d.checkersRefreshed) < ivl) {
+		return
 	}
 
-	ctx := context.TODO()
-	if d.logger.Enabled(ctx, slogutil.LevelDebug) {
-		startTime := time.Now()
-		defer func() {
-			elapsed := time.Since(startTime)
-			d.logger.DebugContext(ctx, "parental lookup", "host", host, "elapsed", elapsed)
-		}()
-	}
+	d.checkersRefreshed = time.Now()
 
-	res = Result{
-		Rules: []*ResultRule{{
-			Text:         "parental CATEGORY_BLACKLISTED",
-			FilterListID: rulelist.APIIDParentalControl,
-		}},
-		Reason:     FilteredParental,
-		IsFiltered: true,
-	}
+	for _, rc := range d.checkers {
+		refr, ok := rc.checker.(service.Refresher)
+		if !ok {
+			continue
+		}
 
-	block, err := d.parentalControlChecker.Check(host)
-	if !block || err != nil {
-		return Result{}, err
+		err := refr.Refresh(ctx)
+		if err != nil {
+			d.logger.ErrorContext(ctx, "refreshing checker", slogutil.KeyError, err)
+		}
 	}
-
-	return res, nil
 }
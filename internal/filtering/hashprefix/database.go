@@ -0,0 +1,272 @@
+package hashprefix
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/service"
+)
+
+// DatabaseConfig is the configuration structure for [Database].
+type DatabaseConfig struct {
+	// Logger is used for logging the operation of the database.  It must not
+	// be nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used to download the database.  It must not be nil if
+	// Source is a URL.
+	HTTPClient *http.Client
+
+	// Source is either the HTTP(S) URL or the absolute path of the database
+	// file.  It must not be empty.
+	Source string
+
+	// CachePath is the path to the cached copy of the database downloaded from
+	// a URL.  It's not used if Source is a path.
+	CachePath string
+
+	// MaxSize is the maximum size of the database file.
+	MaxSize uint64
+}
+
+// Database is an offline database of hashed hostnames.  The database file
+// contains a hexadecimal SHA256 hash of a hostname on each line.  Empty lines
+// and lines starting with a "#" are ignored.
+type Database struct {
+	// logger is used for logging the operation of the database.
+	logger *slog.Logger
+
+	// httpClient is used to download the database.
+	httpClient *http.Client
+
+	// mu protects hashes.
+	mu *sync.RWMutex
+
+	// hashes is the set of the hashed hostnames.
+	hashes *container.MapSet[hostnameHash]
+
+	// source is the URL or the path of the database file.
+	source string
+
+	// cachePath is the path to the cached copy of the database.
+	cachePath string
+
+	// maxSize is the maximum size of the database file.
+	maxSize uint64
+}
+
+// NewDatabase returns a new properly initialized database loaded from either
+// the file or the cached copy, if there is one.  A database downloaded from a
+// URL is empty until the first refresh.  conf must not be nil.
+func NewDatabase(ctx context.Context, conf *DatabaseConfig) (db *Database, err error) {
+	err = ValidateSource(conf.Source)
+	if err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+
+	db = &Database{
+		logger:     conf.Logger,
+		httpClient: conf.HTTPClient,
+		mu:         &sync.RWMutex{},
+		hashes:     container.NewMapSet[hostnameHash](),
+		source:     conf.Source,
+		cachePath:  conf.CachePath,
+		maxSize:    conf.MaxSize,
+	}
+
+	path := db.source
+	if db.isRemote() {
+		path = db.cachePath
+	}
+
+	err = db.loadFile(ctx, path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading %q: %w", path, err)
+	}
+
+	return db, nil
+}
+
+// ValidateSource returns an error if src is neither an absolute path nor an
+// HTTP(S) URL.
+func ValidateSource(src string) (err error) {
+	if src == "" {
+		return errors.ErrEmptyValue
+	} else if filepath.IsAbs(src) {
+		return nil
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme: %w: %q", errors.ErrBadEnumValue, u.Scheme)
+	} else if u.Host == "" {
+		return fmt.Errorf("url: host: %w", errors.ErrEmptyValue)
+	}
+
+	return nil
+}
+
+// isRemote returns true if the database is downloaded from a URL.  db.source is
+// expected to be valid, see [ValidateSource].
+func (db *Database) isRemote() (ok bool) {
+	return !filepath.IsAbs(db.source)
+}
+
+// type check
+var _ service.Refresher = (*Database)(nil)
+
+// Refresh implements the [service.Refresher] interface for *Database.  It
+// either downloads the database from the URL and caches it or reloads the
+// database file.
+func (db *Database) Refresh(ctx context.Context) (err error) {
+	if !db.isRemote() {
+		return db.loadFile(ctx, db.source)
+	}
+
+	data, err := db.download(ctx)
+	if err != nil {
+		return fmt.Errorf("downloading: %w", err)
+	}
+
+	hashes, err := parseDatabase(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("parsing: %w", err)
+	}
+
+	err = writeCache(db.cachePath, data)
+	if err != nil {
+		return fmt.Errorf("caching: %w", err)
+	}
+
+	db.setHashes(ctx, hashes)
+
+	return nil
+}
+
+// download returns the data of the database downloaded from its URL.
+func (db *Database) download(ctx context.Context) (data []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, db.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := db.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	return io.ReadAll(ioutil.LimitReader(resp.Body, db.maxSize))
+}
+
+// loadFile loads the database from the file at path.
+func (db *Database) loadFile(ctx context.Context, path string) (err error) {
+	// #nosec G304 -- The path is set by the administrator.
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	hashes, err := parseDatabase(ioutil.LimitReader(f, db.maxSize))
+	if err != nil {
+		return fmt.Errorf("parsing: %w", err)
+	}
+
+	db.setHashes(ctx, hashes)
+
+	return nil
+}
+
+// setHashes replaces the hashed hostnames of db.
+func (db *Database) setHashes(ctx context.Context, hashes *container.MapSet[hostnameHash]) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.hashes = hashes
+
+	db.logger.InfoContext(ctx, "loaded database", "source", db.source, "len", hashes.Len())
+}
+
+// containsAny returns true if any of the hashes is within db.
+func (db *Database) containsAny(hashes []hostnameHash) (ok bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, h := range hashes {
+		if db.hashes.Has(h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseDatabase parses the hashed hostnames from r.
+func parseDatabase(r io.Reader) (hashes *container.MapSet[hostnameHash], err error) {
+	hashes = container.NewMapSet[hostnameHash]()
+
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		if len(line) != hexSize {
+			return nil, fmt.Errorf("line %d: bad hash length %d, want %d", lineNum, len(line), hexSize)
+		}
+
+		var hash hostnameHash
+		_, err = hex.Decode(hash[:], line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		hashes.Add(hash)
+	}
+
+	return hashes, s.Err()
+}
+
+// writeCache atomically writes data to the file at path, creating the
+// directory if necessary.
+func writeCache(path string, data []byte) (err error) {
+	err = os.MkdirAll(filepath.Dir(path), aghos.DefaultPermDir)
+	if err != nil {
+		return fmt.Errorf("creating dir: %w", err)
+	}
+
+	file, err := aghrenameio.NewPendingFile(path, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer func() { err = aghrenameio.WithDeferredCleanup(err, file) }()
+
+	_, err = file.Write(data)
+
+	return err
+}
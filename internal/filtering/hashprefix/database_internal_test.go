@@ -0,0 +1,188 @@
+package hashprefix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// testMaxSize is the maximum database size for tests.
+	testMaxSize = 1024 * 1024
+
+	// testTimeout is the common timeout for tests and contexts.
+	testTimeout = 1 * time.Second
+)
+
+// newTestDatabaseData returns the database data containing the hashes of
+// hosts.
+func newTestDatabaseData(hosts ...string) (data []byte) {
+	data = []byte("# Test database.\n\n")
+	for _, h := range hosts {
+		sum := sha256.Sum256([]byte(h))
+		data = append(data, hex.EncodeToString(sum[:])+"\n"...)
+	}
+
+	return data
+}
+
+func TestChecker_Check_database(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	dbPath := filepath.Join(t.TempDir(), "db.txt")
+	err := os.WriteFile(dbPath, newTestDatabaseData("blocked.example"), 0o600)
+	require.NoError(t, err)
+
+	db, err := NewDatabase(ctx, &DatabaseConfig{
+		Logger:  testLogger,
+		Source:  dbPath,
+		MaxSize: testMaxSize,
+	})
+	require.NoError(t, err)
+
+	c := New(&Config{
+		Logger:    testLogger,
+		CacheTime: cacheTime,
+		CacheSize: cacheSize,
+		Database:  db,
+	})
+
+	blocked, err := c.Check("sub.blocked.example")
+	require.NoError(t, err)
+
+	assert.True(t, blocked)
+
+	blocked, err = c.Check("allowed.example")
+	require.NoError(t, err)
+
+	assert.False(t, blocked)
+
+	err = os.WriteFile(dbPath, newTestDatabaseData("allowed.example"), 0o600)
+	require.NoError(t, err)
+
+	err = c.Refresh(ctx)
+	require.NoError(t, err)
+
+	blocked, err = c.Check("allowed.example")
+	require.NoError(t, err)
+
+	assert.True(t, blocked)
+}
+
+func TestDatabase_Refresh_url(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	data := newTestDatabaseData("blocked.example")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	cachePath := filepath.Join(t.TempDir(), "hashprefix", "db.txt")
+	conf := &DatabaseConfig{
+		Logger:     testLogger,
+		HTTPClient: srv.Client(),
+		Source:     srv.URL,
+		CachePath:  cachePath,
+		MaxSize:    testMaxSize,
+	}
+
+	db, err := NewDatabase(ctx, conf)
+	require.NoError(t, err)
+
+	hashes := hostnameToHashes("blocked.example")
+	assert.False(t, db.containsAny(hashes))
+
+	err = db.Refresh(ctx)
+	require.NoError(t, err)
+
+	assert.True(t, db.containsAny(hashes))
+	assert.FileExists(t, cachePath)
+
+	db, err = NewDatabase(ctx, conf)
+	require.NoError(t, err)
+
+	assert.True(t, db.containsAny(hashes))
+}
+
+func TestParseDatabase(t *testing.T) {
+	testCases := []struct {
+		name       string
+		data       string
+		wantErrMsg string
+		wantLen    int
+	}{{
+		name:       "valid",
+		data:       string(newTestDatabaseData("a.example", "b.example")),
+		wantErrMsg: "",
+		wantLen:    2,
+	}, {
+		name:       "bad_length",
+		data:       "# Comment.\nabcd\n",
+		wantErrMsg: "line 2: bad hash length 4, want 64",
+		wantLen:    0,
+	}, {
+		name:       "bad_hex",
+		data:       "zz" + string(newTestDatabaseData("a.example")[20:82]) + "\n",
+		wantErrMsg: "line 1: encoding/hex: invalid byte: U+007A 'z'",
+		wantLen:    0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hashes, err := parseDatabase(strings.NewReader(tc.data))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg == "" {
+				assert.Equal(t, tc.wantLen, hashes.Len())
+			}
+		})
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	testCases := []struct {
+		name       string
+		src        string
+		wantErrMsg string
+	}{{
+		name:       "path",
+		src:        filepath.Join(t.TempDir(), "db.txt"),
+		wantErrMsg: "",
+	}, {
+		name:       "url",
+		src:        "https://example.com/db.txt",
+		wantErrMsg: "",
+	}, {
+		name:       "empty",
+		src:        "",
+		wantErrMsg: "empty value",
+	}, {
+		name:       "relative_path",
+		src:        "db.txt",
+		wantErrMsg: `scheme: bad enum value: ""`,
+	}, {
+		name:       "bad_scheme",
+		src:        "ftp://example.com/db.txt",
+		wantErrMsg: `scheme: bad enum value: "ftp"`,
+	}, {
+		name:       "no_host",
+		src:        "https:///db.txt",
+		wantErrMsg: "url: host: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, ValidateSource(tc.src))
+		})
+	}
+}
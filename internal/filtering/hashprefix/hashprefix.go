@@ -15,6 +15,7 @@ import (
 	"github.com/AdguardTeam/golibs/cache"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/service"
 	"github.com/AdguardTeam/golibs/stringutil"
 	"github.com/miekg/dns"
 	"golang.org/x/net/publicsuffix"
@@ -69,6 +70,10 @@ type Config struct {
 	// CacheSize is the maximum size of the cache.  If it's zero, cache size is
 	// unlimited.
 	CacheSize uint
+
+	// Database is the offline database of hashed hostnames.  If it's not nil,
+	// the hosts are checked against it instead of Upstream.
+	Database *Database
 }
 
 type Checker struct {
@@ -86,6 +91,9 @@ type Checker struct {
 
 	// cacheTime is the time period to store hash.
 	cacheTime time.Duration
+
+	// database is the offline database of hashed hostnames, if any.
+	database *Database
 }
 
 // New returns Checker.
@@ -99,9 +107,23 @@ func New(conf *Config) (c *Checker) {
 		}),
 		txtSuffix: conf.TXTSuffix,
 		cacheTime: conf.CacheTime,
+		database:  conf.Database,
 	}
 }
 
+// type check
+var _ service.Refresher = (*Checker)(nil)
+
+// Refresh implements the [service.Refresher] interface for *Checker.  It
+// refreshes the offline database, if there is one.
+func (c *Checker) Refresh(ctx context.Context) (err error) {
+	if c.database == nil {
+		return nil
+	}
+
+	return c.database.Refresh(ctx)
+}
+
 // Check returns true if request for the host should be blocked.
 func (c *Checker) Check(host string) (ok bool, err error) {
 	ctx := context.TODO()
@@ -110,6 +132,13 @@ func (c *Checker) Check(host string) (ok bool, err error) {
 
 	l := c.logger.With("host", host)
 
+	if c.database != nil {
+		blocked := c.database.containsAny(hashes)
+		l.DebugContext(ctx, "checked in database", "blocked", blocked)
+
+		return blocked, nil
+	}
+
 	found, blocked, hashesToRequest := c.findInCache(hashes)
 	if found {
 		l.DebugContext(ctx, "found in cache", "blocked", blocked)
@@ -103,3 +103,19 @@ func (d *DNSFilter) hostsRewrites(
 
 	return vals, rls, len(addrs) > 0
 }
+
+// EtcHostsByAddr returns the first host name for addr from the operating
+// system's hosts database, if any.  The first name is the canonical one,
+// according to hosts(5).
+func (d *DNSFilter) EtcHostsByAddr(addr netip.Addr) (host string) {
+	if d.conf.EtcHosts == nil {
+		return ""
+	}
+
+	names := d.conf.EtcHosts.ByAddr(addr)
+	if len(names) == 0 {
+		return ""
+	}
+
+	return names[0]
+}
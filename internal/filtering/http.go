@@ -19,6 +19,7 @@ import (
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil/urlutil"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/miekg/dns"
 )
 
@@ -34,11 +35,8 @@ func (d *DNSFilter) validateFilterURL(urlStr string) (err error) {
 			return err
 		}
 
-		if !pathMatchesAny(d.safeFSPatterns, urlStr) {
-			return fmt.Errorf("path %q does not match safe patterns", urlStr)
-		}
-
-		return nil
+		// Don't wrap the error since it's informative enough as is.
+		return d.checkFilePath(urlStr)
 	}
 
 	u, err := url.ParseRequestURI(urlStr)
@@ -57,9 +55,14 @@ func (d *DNSFilter) validateFilterURL(urlStr string) (err error) {
 }
 
 type filterAddJSON struct {
-	Name      string `json:"name"`
-	URL       string `json:"url"`
-	Whitelist bool   `json:"whitelist"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// Group is the name of the filter group of the list.  It's empty for the
+	// lists applied to all clients.
+	Group string `json:"group"`
+
+	Whitelist bool `json:"whitelist"`
 }
 
 func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request) {
@@ -83,6 +86,10 @@ func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request
 	}
 
 	err = d.validateFilterURL(fj.URL)
+	if err == nil {
+		err = d.validateFilterGroup(fj.Group)
+	}
+
 	if err != nil {
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
 
@@ -113,10 +120,31 @@ func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request
 		Name:    fj.Name,
 		white:   fj.Whitelist,
 		Filter: Filter{
-			ID: d.idGen.next(),
+			ID:    d.idGen.next(),
+			Group: fj.Group,
 		},
 	}
 
+	err = filt.ensureUID()
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	added := false
+	defer func() {
+		if added {
+			return
+		}
+
+		// Don't keep the rule list of the filter that hasn't been added.
+		rmErr := d.removeFilterFiles(ctx, &filt)
+		if rmErr != nil {
+			l.WarnContext(ctx, "removing filter files", "url", filt.URL, slogutil.KeyError, rmErr)
+		}
+	}()
+
 	// Download the filter contents
 	ok, err := d.update(&filt)
 	if err != nil {
@@ -166,10 +194,12 @@ func (d *DNSFilter) handleFilteringAddURL(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	added = true
+
 	d.conf.ConfModifier.Apply(ctx)
 	d.EnableFilters(true)
 
-	_, err = fmt.Fprintf(w, "OK %d rules\n", filt.RulesCount)
+	_, err = fmt.Fprintf(w, "OK %d rules\n", d.ruleListState(&filt).RulesCount)
 	if err != nil {
 		aghhttp.ErrorAndLog(
 			ctx,
@@ -208,6 +238,7 @@ func (d *DNSFilter) handleFilteringRemoveURL(w http.ResponseWriter, r *http.Requ
 	}
 
 	var deleted FilterYAML
+	var deletedRulesCount int
 	func() {
 		d.conf.filtersMu.Lock()
 		defer d.conf.filtersMu.Unlock()
@@ -232,16 +263,10 @@ func (d *DNSFilter) handleFilteringRemoveURL(w http.ResponseWriter, r *http.Requ
 		}
 
 		deleted = (*filters)[delIdx]
-		p := deleted.Path(d.conf.DataDir)
-		err = os.Rename(p, p+".old")
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			d.logger.ErrorContext(
-				ctx,
-				"renaming filter file",
-				"id", deleted.ID,
-				"path", p,
-				slogutil.KeyError, err,
-			)
+		deletedRulesCount = d.ruleListState(&deleted).RulesCount
+		err = d.removeFilterFiles(ctx, &deleted)
+		if err != nil {
+			d.logger.ErrorContext(ctx, "deleting filter", "id", deleted.ID, slogutil.KeyError, err)
 
 			return
 		}
@@ -260,7 +285,7 @@ func (d *DNSFilter) handleFilteringRemoveURL(w http.ResponseWriter, r *http.Requ
 	//
 	// TODO(a.garipov): Make sure the above comment is true.
 
-	_, err = fmt.Fprintf(w, "OK %d rules\n", deleted.RulesCount)
+	_, err = fmt.Fprintf(w, "OK %d rules\n", deletedRulesCount)
 	if err != nil {
 		aghhttp.ErrorAndLog(
 			ctx,
@@ -275,9 +300,14 @@ func (d *DNSFilter) handleFilteringRemoveURL(w http.ResponseWriter, r *http.Requ
 }
 
 type filterURLReqData struct {
-	Name    string `json:"name"`
-	URL     string `json:"url"`
-	Enabled bool   `json:"enabled"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// Group is the name of the filter group of the list.  It's empty for the
+	// lists applied to all clients.
+	Group string `json:"group"`
+
+	Enabled bool `json:"enabled"`
 }
 
 type filterURLReq struct {
@@ -319,10 +349,20 @@ func (d *DNSFilter) handleFilteringSetURL(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	err = d.validateFilterGroup(fj.Data.Group)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
 	filt := FilterYAML{
 		Enabled: fj.Data.Enabled,
 		Name:    fj.Data.Name,
 		URL:     fj.Data.URL,
+		Filter: Filter{
+			Group: fj.Data.Group,
+		},
 	}
 
 	restart, err := d.filterSetProperties(fj.URL, filt, fj.Whitelist)
@@ -384,7 +424,11 @@ func (d *DNSFilter) handleFilteringRefresh(w http.ResponseWriter, r *http.Reques
 	resp := struct {
 		Updated int `json:"updated"`
 	}{}
-	resp.Updated, _, ok = d.tryRefreshFilters(!req.White, req.White, true)
+	resp.Updated, _, ok, err = d.tryRefreshFilters(!req.White, req.White, true)
+	if err != nil {
+		l.ErrorContext(ctx, "refreshing filters", slogutil.KeyError, err)
+	}
+
 	if !ok {
 		aghhttp.ErrorAndLog(
 			ctx,
@@ -406,8 +450,24 @@ type filterJSON struct {
 	Name        string `json:"name"`
 	LastUpdated string `json:"last_updated,omitempty"`
 
+	// Group is the name of the filter group of the list.  It's empty for the
+	// lists applied to all clients.
+	Group string `json:"group,omitempty"`
+
 	ID rulelist.APIID `json:"id"`
 
+	// UID is the unique ID of the filter list.
+	UID rulelist.UID `json:"uid"`
+
+	// LastError is the error of the last loading or update of the filter
+	// list.  It's empty if the last loading or update has succeeded.
+	LastError string `json:"last_error,omitempty"`
+
+	// Hits is the total number of matches of the rules of the filter list
+	// within the statistics retention interval.  It's nil if the numbers of
+	// matches aren't available.
+	Hits *uint64 `json:"hits,omitempty"`
+
 	RulesCount uint64 `json:"rules_count"`
 	Enabled    bool   `json:"enabled"`
 }
@@ -416,23 +476,58 @@ type filteringConfig struct {
 	Filters          []filterJSON `json:"filters"`
 	WhitelistFilters []filterJSON `json:"whitelist_filters"`
 	UserRules        []string     `json:"user_rules"`
-	Interval         uint32       `json:"interval"` // in hours
-	Enabled          bool         `json:"enabled"`
+
+	// UserRulesHits are the numbers of matches of each of the user rules
+	// within the statistics retention interval.  It's nil if the numbers of
+	// matches aren't available.
+	UserRulesHits []*ruleHitsJSON `json:"user_rules_hits,omitempty"`
+
+	// Engine is the status of the filtering engines.  It's only set in
+	// responses.
+	Engine *engineStatusJSON `json:"engine,omitempty"`
+
+	Interval uint32 `json:"interval"` // in hours
+	Enabled  bool   `json:"enabled"`
 }
 
-func filterToJSON(f FilterYAML) filterJSON {
+// filterToJSON returns the HTTP API representation of the filter list f with
+// the state of its rule list st.
+func filterToJSON(f FilterYAML, st rulelist.FilterState) filterJSON {
 	fj := filterJSON{
 		// #nosec G115 -- The overflow is required for backwards compatibility.
 		ID:      rulelist.APIID(f.ID),
 		Enabled: f.Enabled,
 		URL:     f.URL,
 		Name:    f.Name,
+		Group:   f.Group,
+		UID:     f.UID,
 		// #nosec G115 -- The number of rules must not be negative.
-		RulesCount: uint64(f.RulesCount),
+		RulesCount: uint64(st.RulesCount),
 	}
 
-	if !f.LastUpdated.IsZero() {
-		fj.LastUpdated = f.LastUpdated.Format(time.RFC3339)
+	if !st.Updated.IsZero() {
+		fj.LastUpdated = st.Updated.Format(time.RFC3339)
+	}
+
+	fltErr := &rulelist.FilterError{}
+	if errors.As(st.Err, &fltErr) {
+		fj.LastError = fltErr.Err.Error()
+	}
+
+	return fj
+}
+
+// filterToJSONWithHits is like [filterToJSON] but also sets the number of
+// matches of the rules of the filter list from listHits, if it's not nil.
+func filterToJSONWithHits(
+	f FilterYAML,
+	st rulelist.FilterState,
+	listHits map[rulelist.APIID]uint64,
+) (fj filterJSON) {
+	fj = filterToJSON(f, st)
+	if listHits != nil {
+		hits := listHits[fj.ID]
+		fj.Hits = &hits
 	}
 
 	return fj
@@ -440,19 +535,31 @@ func filterToJSON(f FilterYAML) filterJSON {
 
 // Get filtering configuration
 func (d *DNSFilter) handleFilteringStatus(w http.ResponseWriter, r *http.Request) {
-	resp := filteringConfig{}
+	hits, _ := d.ruleHits()
+
+	var listHits map[rulelist.APIID]uint64
+	if hits != nil {
+		listHits = listsHits(hits)
+	}
+
+	resp := filteringConfig{
+		Engine: d.rebuild.toJSON(),
+	}
 	d.conf.filtersMu.RLock()
 	resp.Enabled = d.conf.FilteringEnabled
 	resp.Interval = d.conf.FiltersUpdateIntervalHours
 	for _, f := range d.conf.Filters {
-		fj := filterToJSON(f)
+		fj := filterToJSONWithHits(f, d.ruleListState(&f), listHits)
 		resp.Filters = append(resp.Filters, fj)
 	}
 	for _, f := range d.conf.WhitelistFilters {
-		fj := filterToJSON(f)
+		fj := filterToJSONWithHits(f, d.ruleListState(&f), listHits)
 		resp.WhitelistFilters = append(resp.WhitelistFilters, fj)
 	}
 	resp.UserRules = d.conf.UserRules
+	if hits != nil {
+		resp.UserRulesHits = userRulesHits(d.conf.UserRules, hits)
+	}
 	d.conf.filtersMu.RUnlock()
 
 	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
@@ -637,6 +744,24 @@ func stringToDNSType(str string) (qtype uint16, err error) {
 	return uint16(val), nil
 }
 
+// maxDurationMs is the maximum duration in milliseconds accepted by the HTTP
+// APIs, which is ten years.
+const maxDurationMs = int64(10 * 365 * timeutil.Day / time.Millisecond)
+
+// durationFromMs returns the duration of ms milliseconds from an HTTP API
+// request.  It returns an error if ms is negative or greater than
+// [maxDurationMs], since the large values overflow [time.Duration].
+func durationFromMs(ms int64) (d time.Duration, err error) {
+	switch {
+	case ms < 0:
+		return 0, fmt.Errorf("duration: negative value %d", ms)
+	case ms > maxDurationMs:
+		return 0, fmt.Errorf("duration: %w: %d, max %d", errors.ErrOutOfRange, ms, maxDurationMs)
+	default:
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+}
+
 // setProtectedBool sets the value of a boolean pointer under a lock.  l must
 // protect the value under ptr.
 //
@@ -727,11 +852,16 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodPost, "/control/safesearch/disable", d.handleSafeSearchDisable)
 	registerHTTP(http.MethodGet, "/control/safesearch/status", d.handleSafeSearchStatus)
 	registerHTTP(http.MethodPut, "/control/safesearch/settings", d.handleSafeSearchSettings)
+	registerHTTP(http.MethodGet, "/control/safesearch/providers", d.handleSafeSearchProviders)
 
 	registerHTTP(http.MethodGet, "/control/rewrite/list", d.handleRewriteList)
 	registerHTTP(http.MethodGet, "/control/rewrite/settings", d.handleRewriteSettings)
 	registerHTTP(http.MethodPost, "/control/rewrite/add", d.handleRewriteAdd)
 	registerHTTP(http.MethodPost, "/control/rewrite/delete", d.handleRewriteDelete)
+	registerHTTP(http.MethodGet, "/control/rewrite/groups", d.handleRewriteGroups)
+	registerHTTP(http.MethodPut, "/control/rewrite/groups/update", d.handleRewriteGroupsUpdate)
+	registerHTTP(http.MethodPost, "/control/rewrite/import", d.handleRewriteImport)
+	registerHTTP(http.MethodPost, "/control/rewrite/import/preview", d.handleRewriteImportPreview)
 	registerHTTP(http.MethodPut, "/control/rewrite/settings/update", d.handleRewriteSettingsUpdate)
 	registerHTTP(http.MethodPut, "/control/rewrite/update", d.handleRewriteUpdate)
 
@@ -753,6 +883,22 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodPost, "/control/filtering/refresh", d.handleFilteringRefresh)
 	registerHTTP(http.MethodPost, "/control/filtering/set_rules", d.handleFilteringSetRules)
 	registerHTTP(http.MethodGet, "/control/filtering/check_host", d.handleCheckHost)
+	registerHTTP(http.MethodGet, "/control/filtering/overlap", d.handleFilteringOverlap)
+	registerHTTP(http.MethodGet, "/control/filtering/groups", d.handleFilterGroups)
+	registerHTTP(http.MethodPut, "/control/filtering/groups/update", d.handleFilterGroupsUpdate)
+	registerHTTP(http.MethodGet, "/control/filtering/tag_rules", d.handleTagRules)
+	registerHTTP(http.MethodPut, "/control/filtering/tag_rules/update", d.handleTagRulesUpdate)
+	registerHTTP(http.MethodGet, "/control/filtering/tag_schedules", d.handleTagSchedules)
+	registerHTTP(http.MethodPut, "/control/filtering/tag_schedules/update", d.handleTagSchedulesUpdate)
+	registerHTTP(http.MethodGet, "/control/filtering/custom_rules", d.handleCustomRules)
+	registerHTTP(http.MethodPost, "/control/filtering/custom_rules/add", d.handleCustomRuleAdd)
+	registerHTTP(http.MethodPost, "/control/filtering/custom_rules/delete", d.handleCustomRuleDelete)
+	registerHTTP(http.MethodGet, "/control/filtering/bundle/export", d.handleBundleExport)
+	registerHTTP(http.MethodPost, "/control/filtering/bundle/import", d.handleBundleImport)
+
+	registerHTTP(http.MethodGet, "/control/unblock_requests", d.handleUnblockRequests)
+	registerHTTP(http.MethodPost, "/control/unblock_requests/approve", d.handleUnblockRequestApprove)
+	registerHTTP(http.MethodPost, "/control/unblock_requests/deny", d.handleUnblockRequestDeny)
 }
 
 // ValidateUpdateIvl returns false if i is not a valid filters update interval.
@@ -494,3 +494,74 @@ func TestDNSFilter_HandleCheckHost(t *testing.T) {
 		})
 	}
 }
+
+func TestDNSFilter_handleFilteringStatus_hits(t *testing.T) {
+	d := newDNSFilter(t)
+
+	d.conf.Filters = []FilterYAML{{
+		Enabled: true,
+		Name:    "used",
+		Filter:  Filter{ID: 1},
+	}, {
+		Enabled: true,
+		Name:    "unused",
+		Filter:  Filter{ID: 2},
+	}}
+	d.conf.UserRules = []string{
+		"! Comment",
+		"||used.example^",
+		"",
+		"||unused.example^",
+	}
+
+	getStatus := func(t *testing.T) (resp *filteringConfig) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/control/filtering/status", nil)
+		d.handleFilteringStatus(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp = &filteringConfig{}
+		err := json.NewDecoder(w.Body).Decode(resp)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	t.Run("no_stats", func(t *testing.T) {
+		resp := getStatus(t)
+		require.Len(t, resp.Filters, 2)
+
+		assert.Nil(t, resp.Filters[0].Hits)
+		assert.Nil(t, resp.Filters[1].Hits)
+		assert.Empty(t, resp.UserRulesHits)
+	})
+
+	d.conf.RuleHits = func() (hits map[RuleKey]uint64, complete bool) {
+		return map[RuleKey]uint64{
+			{Text: "||a.example^", FilterListID: 1}:    2,
+			{Text: "||b.example^", FilterListID: 1}:    3,
+			{Text: "||used.example^", FilterListID: 0}: 4,
+		}, true
+	}
+
+	t.Run("stats", func(t *testing.T) {
+		resp := getStatus(t)
+		require.Len(t, resp.Filters, 2)
+		require.NotNil(t, resp.Filters[0].Hits)
+		require.NotNil(t, resp.Filters[1].Hits)
+
+		assert.Equal(t, uint64(5), *resp.Filters[0].Hits)
+		assert.Zero(t, *resp.Filters[1].Hits)
+
+		wantRules := []*ruleHitsJSON{{
+			Text: "||used.example^",
+			Hits: 4,
+		}, {
+			Text: "||unused.example^",
+			Hits: 0,
+		}}
+		assert.Equal(t, wantRules, resp.UserRulesHits)
+	})
+}
@@ -0,0 +1,94 @@
+package filtering
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// isLocalFilter returns true if the filter list is read from a local file.
+func isLocalFilter(flt *FilterYAML) (ok bool) {
+	return filepath.IsAbs(flt.URL)
+}
+
+// syncWatchedFiles makes d.watcher track the files of the enabled local filter
+// lists and only them.  d.conf.filtersMu must be locked.
+func (d *DNSFilter) syncWatchedFiles(ctx context.Context) {
+	paths := container.NewMapSet[string]()
+	for _, filters := range [][]FilterYAML{d.conf.Filters, d.conf.WhitelistFilters} {
+		for i := range filters {
+			flt := &filters[i]
+			if flt.Enabled && isLocalFilter(flt) {
+				paths.Add(filepath.Clean(flt.URL))
+			}
+		}
+	}
+
+	d.watchedMu.Lock()
+	defer d.watchedMu.Unlock()
+
+	for p := range d.watched.Range {
+		if paths.Has(p) {
+			continue
+		}
+
+		err := d.watcher.Remove(p)
+		if err != nil {
+			d.logger.WarnContext(ctx, "unwatching filter file", "path", p, slogutil.KeyError, err)
+		}
+
+		d.watched.Delete(p)
+	}
+
+	for p := range paths.Range {
+		if d.watched.Has(p) {
+			continue
+		}
+
+		err := d.watcher.Add(p)
+		if err != nil {
+			// Try again on the next synchronization, since the file may appear
+			// later.
+			d.logger.DebugContext(ctx, "watching filter file", "path", p, slogutil.KeyError, err)
+
+			continue
+		}
+
+		d.watched.Add(p)
+	}
+}
+
+// handleWatcherEvents refreshes the local filter lists on each event from
+// d.watcher.  It is intended to be used as a goroutine.
+func (d *DNSFilter) handleWatcherEvents(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, d.logger)
+
+	eventsCh := d.watcher.Events()
+	if eventsCh == nil {
+		return
+	}
+
+	for range eventsCh {
+		d.refreshLocalFilters(ctx)
+	}
+
+	d.logger.DebugContext(ctx, "watcher closed the events channel")
+}
+
+// refreshLocalFilters updates the enabled local filter lists and rebuilds the
+// filtering engines if any of them has changed.  Unlike periodic updates, it
+// waits for an ongoing update to finish, since the files may have changed after
+// it has read them.
+func (d *DNSFilter) refreshLocalFilters(ctx context.Context) {
+	d.refreshLock.Lock()
+	defer d.refreshLock.Unlock()
+
+	updated, _, err := d.refreshFiltersIntl(true, true, true, isLocalFilter)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "refreshing local filters", slogutil.KeyError, err)
+	}
+
+	d.logger.DebugContext(ctx, "refreshed local filters", "updated", updated)
+}
@@ -0,0 +1,102 @@
+package filtering
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_handleWatcherEvents(t *testing.T) {
+	fltDir := t.TempDir()
+	fltPath := filepath.Join(fltDir, "local.txt")
+
+	err := os.WriteFile(fltPath, []byte("||first.example^\n"), 0o600)
+	require.NoError(t, err)
+
+	events := make(chan aghos.Event)
+	addedCh := make(chan string, 1)
+	removedCh := make(chan string, 1)
+
+	watcher := aghtest.NewFSWatcher()
+	watcher.OnShutdown = func(_ context.Context) (err error) { return nil }
+	watcher.OnEvents = func() (e <-chan aghos.Event) { return events }
+	watcher.OnAdd = func(name string) (err error) {
+		addedCh <- name
+
+		return nil
+	}
+	watcher.OnRemove = func(name string) (err error) {
+		removedCh <- name
+
+		return nil
+	}
+
+	d, err := New(&Config{
+		Logger:  testLogger,
+		DataDir: t.TempDir(),
+		HTTPClient: &http.Client{
+			Timeout: testTimeout,
+		},
+		Watcher:        watcher,
+		SafeFSPatterns: []string{filepath.Join(fltDir, "*")},
+		Filters: []FilterYAML{{
+			Enabled: true,
+			URL:     fltPath,
+			Filter:  Filter{ID: 1},
+		}, {
+			Enabled: true,
+			URL:     "https://filters.example/list.txt",
+			Filter:  Filter{ID: 2},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	go d.handleWatcherEvents(ctx)
+	t.Cleanup(func() { close(events) })
+
+	// Only the local list must be watched.
+	d.EnableFilters(false)
+
+	added, _ := testutil.RequireReceive(t, addedCh, testTimeout)
+	assert.Equal(t, fltPath, added)
+
+	setts := &Settings{
+		ProtectionEnabled: true,
+		FilteringEnabled:  true,
+	}
+
+	err = os.WriteFile(fltPath, []byte("||second.example^\n"), 0o600)
+	require.NoError(t, err)
+
+	testutil.RequireSend(t, events, aghos.Event{}, testTimeout)
+
+	// Only the local list is updated, and the engines are rebuilt in the
+	// background, so wait for the new rules to be applied.
+	require.Eventually(t, func() (ok bool) {
+		res, checkErr := d.CheckHost("second.example", dns.TypeA, setts)
+
+		return checkErr == nil && res.IsFiltered
+	}, testTimeout, testTimeout/10)
+
+	d.checkMatchEmpty(t, "first.example", setts)
+
+	d.conf.filtersMu.Lock()
+	d.conf.Filters[0].Enabled = false
+	d.conf.filtersMu.Unlock()
+
+	d.EnableFilters(false)
+
+	removed, _ := testutil.RequireReceive(t, removedCh, testTimeout)
+	assert.Equal(t, fltPath, removed)
+}
@@ -0,0 +1,140 @@
+package lookup
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/cache"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// maxFailureTTL is the maximum time during which the failed lookups are cached.
+const maxFailureTTL = 1 * time.Minute
+
+// cachedHeaderSize is the size of the header of a cached lookup result: the
+// expiration time in Unix nanoseconds followed by the status.  The header of a
+// failed lookup is followed by the error message.
+const cachedHeaderSize = 8 + 1
+
+// cachedStatus is the status of a cached lookup result.
+type cachedStatus = byte
+
+// cachedStatus values.
+const (
+	cachedStatusPass cachedStatus = iota
+	cachedStatusBlock
+	cachedStatusFail
+)
+
+// cached is a checker that caches the results of another checker.
+type cached struct {
+	// checker is the underlying checker.
+	checker filtering.Checker
+
+	// cache stores the lookup results.
+	cache cache.Cache
+
+	// ttl is the time during which the results are cached.
+	ttl time.Duration
+
+	// failureTTL is the time during which the failed lookups are cached.
+	failureTTL time.Duration
+}
+
+// newCached returns a new caching checker wrapping c.  ttl must be positive.
+// If size is zero, the size of the cache is unlimited.
+func newCached(c filtering.Checker, ttl time.Duration, size uint) (cc *cached) {
+	return &cached{
+		checker: c,
+		cache: cache.New(cache.Config{
+			EnableLRU: true,
+			MaxSize:   size,
+		}),
+		ttl:        ttl,
+		failureTTL: min(ttl, maxFailureTTL),
+	}
+}
+
+// type check
+var _ filtering.Checker = (*cached)(nil)
+
+// Check implements the [filtering.Checker] interface for *cached.  Errors are
+// cached for a shorter time, so that an unavailable lookup service isn't
+// queried for each request.
+func (c *cached) Check(host string) (block bool, err error) {
+	key := []byte(host)
+	if block, ok, err := c.get(key); ok {
+		return block, err
+	}
+
+	block, err = c.checker.Check(host)
+
+	ttl, status := c.ttl, cachedStatusPass
+	if err != nil {
+		ttl, status = c.failureTTL, cachedStatusFail
+	} else if block {
+		status = cachedStatusBlock
+	}
+
+	val := make([]byte, cachedHeaderSize, cachedHeaderSize+len(errMsg(err)))
+	// #nosec G115 -- The Unix epoch time is highly unlikely to be negative.
+	binary.BigEndian.PutUint64(val, uint64(time.Now().Add(ttl).UnixNano()))
+	val[cachedHeaderSize-1] = status
+	val = append(val, errMsg(err)...)
+
+	_ = c.cache.Set(key, val)
+
+	// Don't wrap the error, since it's informative enough as is.
+	return block, err
+}
+
+// type check
+var _ io.Closer = (*cached)(nil)
+
+// Close implements the [io.Closer] interface for *cached.  It closes the
+// underlying checker if it implements [io.Closer].
+func (c *cached) Close() (err error) {
+	closer, ok := c.checker.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	// Don't wrap the error, since it's informative enough as is.
+	return closer.Close()
+}
+
+// errMsg returns the message of err or an empty string if err is nil.
+func errMsg(err error) (msg string) {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+// get returns the cached result for key.  err is the cached error of a failed
+// lookup.  ok is false if there is no result or it has expired.
+func (c *cached) get(key []byte) (block, ok bool, err error) {
+	val := c.cache.Get(key)
+	if len(val) < cachedHeaderSize {
+		return false, false, nil
+	}
+
+	// #nosec G115 -- The Unix epoch time is highly unlikely to be negative.
+	if binary.BigEndian.Uint64(val) <= uint64(time.Now().UnixNano()) {
+		c.cache.Del(key)
+
+		return false, false, nil
+	}
+
+	switch val[cachedHeaderSize-1] {
+	case cachedStatusBlock:
+		return true, true, nil
+	case cachedStatusFail:
+		return false, true, errors.Error(val[cachedHeaderSize:])
+	default:
+		return false, true, nil
+	}
+}
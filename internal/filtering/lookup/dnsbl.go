@@ -0,0 +1,87 @@
+package lookup
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+)
+
+// dnsbl is a checker that looks up hosts using a DNS-based blocklist.  A host
+// is blocked if "<host>.<zone>" resolves to any IPv4 address.
+type dnsbl struct {
+	// upstream is the DNS server used for the lookups.
+	upstream upstream.Upstream
+
+	// zone is the FQDN of the blocklist.
+	zone string
+}
+
+// newDNSBL returns a new DNS-based blocklist checker.
+func newDNSBL(
+	l *slog.Logger,
+	addr string,
+	zone string,
+	timeout time.Duration,
+) (c *dnsbl, err error) {
+	ups, err := upstream.AddressToUpstream(addr, &upstream.Options{
+		Logger:  l,
+		Timeout: timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upstream: %w", err)
+	}
+
+	return &dnsbl{
+		upstream: ups,
+		zone:     dns.Fqdn(zone),
+	}, nil
+}
+
+// type check
+var _ filtering.Checker = (*dnsbl)(nil)
+
+// Check implements the [filtering.Checker] interface for *dnsbl.
+func (c *dnsbl) Check(host string) (block bool, err error) {
+	req := &dns.Msg{}
+	req.SetQuestion(host+"."+c.zone, dns.TypeA)
+
+	resp, err := c.upstream.Exchange(req)
+	if err != nil {
+		return false, fmt.Errorf("looking up: %w", err)
+	}
+
+	switch resp.Rcode {
+	case dns.RcodeSuccess:
+		// Go on.
+	case dns.RcodeNameError:
+		return false, nil
+	default:
+		return false, fmt.Errorf("got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	for _, rr := range resp.Answer {
+		if _, ok := rr.(*dns.A); ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// type check
+var _ io.Closer = (*dnsbl)(nil)
+
+// Close implements the [io.Closer] interface for *dnsbl.
+func (c *dnsbl) Close() (err error) {
+	err = c.upstream.Close()
+	if err != nil {
+		return fmt.Errorf("closing upstream: %w", err)
+	}
+
+	return nil
+}
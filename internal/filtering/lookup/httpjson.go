@@ -0,0 +1,82 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+)
+
+// maxResponseSize is the maximum size of the response of an HTTP lookup
+// service.
+const maxResponseSize = 64 * 1024
+
+// httpJSON is a checker that looks up hosts using an HTTP API.  The API is
+// expected to respond with a JSON object like:
+//
+//	{"blocked": true}
+type httpJSON struct {
+	// client is used to send the requests.
+	client *http.Client
+
+	// urlTmpl is the URL of the API containing [filtering.HostPlaceholder].
+	urlTmpl string
+
+	// timeout is the timeout for a single lookup.
+	timeout time.Duration
+}
+
+// newHTTPJSON returns a new HTTP JSON checker.
+func newHTTPJSON(client *http.Client, urlTmpl string, timeout time.Duration) (c *httpJSON) {
+	return &httpJSON{
+		client:  client,
+		urlTmpl: urlTmpl,
+		timeout: timeout,
+	}
+}
+
+// httpJSONResponse is the response of an HTTP lookup service.
+type httpJSONResponse struct {
+	Blocked bool `json:"blocked"`
+}
+
+// type check
+var _ filtering.Checker = (*httpJSON)(nil)
+
+// Check implements the [filtering.Checker] interface for *httpJSON.
+func (c *httpJSON) Check(host string) (block bool, err error) {
+	// TODO(s.chzhen):  Pass context.
+	ctx, cancel := context.WithTimeout(context.TODO(), c.timeout)
+	defer cancel()
+
+	u := strings.ReplaceAll(c.urlTmpl, filtering.HostPlaceholder, url.QueryEscape(host))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	r := &httpJSONResponse{}
+	err = json.NewDecoder(ioutil.LimitReader(resp.Body, maxResponseSize)).Decode(r)
+	if err != nil {
+		return false, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return r.Blocked, nil
+}
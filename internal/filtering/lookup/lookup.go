@@ -0,0 +1,112 @@
+// Package lookup contains the implementations of the named checkers, such as
+// threat-intelligence lookup services, for the filtering package.
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// DefaultTimeout is the timeout for a single lookup used when the checker
+// configuration has none.
+const DefaultTimeout = 3 * time.Second
+
+// DefaultCacheTTL is the time during which the results of lookups are cached
+// used when the checker configuration has none.
+const DefaultCacheTTL = 10 * time.Minute
+
+// Config is the configuration structure for [New].
+type Config struct {
+	// Logger is used for logging the operation of the checker.  It must not be
+	// nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used for the HTTP lookups and for downloading the hash
+	// sets.  It must not be nil.
+	HTTPClient *http.Client
+
+	// Checker is the configuration of the checker.  It must not be nil and
+	// must be valid.
+	Checker *filtering.CheckerConfig
+
+	// CachePath is the path to the cached copy of the hash set downloaded from
+	// a URL.  It's only used by [filtering.CheckerTypeHashSet] checkers.
+	CachePath string
+
+	// MaxSize is the maximum size of the hash set file.
+	MaxSize uint64
+}
+
+// New returns a new properly initialized named checker.  conf must not be nil.
+func New(ctx context.Context, conf *Config) (nc *filtering.NamedChecker, err error) {
+	c := conf.Checker
+
+	timeout := time.Duration(c.Timeout)
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	var checker filtering.Checker
+	switch c.Type {
+	case filtering.CheckerTypeHTTPJSON:
+		checker = newHTTPJSON(conf.HTTPClient, c.URL, timeout)
+	case filtering.CheckerTypeDNSBL:
+		checker, err = newDNSBL(conf.Logger, c.Upstream, c.Zone, timeout)
+	case filtering.CheckerTypeHashSet:
+		checker, err = newHashSet(ctx, conf)
+	default:
+		return nil, fmt.Errorf("type: %w: %q", errors.ErrBadEnumValue, c.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("checker %q: %w", c.Name, err)
+	}
+
+	if c.Type != filtering.CheckerTypeHashSet {
+		ttl := time.Duration(c.CacheTTL)
+		if ttl == 0 {
+			ttl = DefaultCacheTTL
+		}
+
+		checker = newCached(checker, ttl, c.CacheSize)
+	}
+
+	reason := c.Reason
+	if reason == "" {
+		reason = filtering.CheckerReasonSafeBrowsing
+	}
+
+	return &filtering.NamedChecker{
+		Checker: checker,
+		Name:    c.Name,
+		Reason:  reason,
+		Enabled: c.Enabled,
+	}, nil
+}
+
+// newHashSet returns a hash-prefix checker using the offline database from the
+// hash set of the checker.
+func newHashSet(ctx context.Context, conf *Config) (c *hashprefix.Checker, err error) {
+	db, err := hashprefix.NewDatabase(ctx, &hashprefix.DatabaseConfig{
+		Logger:     conf.Logger,
+		HTTPClient: conf.HTTPClient,
+		Source:     conf.Checker.URL,
+		CachePath:  conf.CachePath,
+		MaxSize:    conf.MaxSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("initializing hash set: %w", err)
+	}
+
+	return hashprefix.New(&hashprefix.Config{
+		Logger:   conf.Logger,
+		Database: db,
+	}), nil
+}
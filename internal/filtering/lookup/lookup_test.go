@@ -0,0 +1,194 @@
+package lookup_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/lookup"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests and contexts.
+const testTimeout = 1 * time.Second
+
+// testMaxSize is the maximum hash set size for tests.
+const testMaxSize = 1024 * 1024
+
+// testLogger is the common logger for tests.
+var testLogger = slogutil.NewDiscardLogger()
+
+// blockedHost is the host blocked by the test services.
+const blockedHost = "blocked.example"
+
+func TestNew_httpJSON(t *testing.T) {
+	var reqNum atomic.Uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqNum.Add(1)
+
+		if r.URL.Query().Get("host") == blockedHost {
+			_, _ = w.Write([]byte(`{"blocked":true}`))
+		} else {
+			_, _ = w.Write([]byte(`{"blocked":false}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	nc, err := lookup.New(testutil.ContextWithTimeout(t, testTimeout), &lookup.Config{
+		Logger:     testLogger,
+		HTTPClient: srv.Client(),
+		Checker: &filtering.CheckerConfig{
+			Name:     "threat_intel",
+			Type:     filtering.CheckerTypeHTTPJSON,
+			URL:      srv.URL + "/check?host=" + filtering.HostPlaceholder,
+			Timeout:  timeutil.Duration(testTimeout),
+			CacheTTL: timeutil.Duration(time.Hour),
+			Enabled:  true,
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "threat_intel", nc.Name)
+	assert.Equal(t, filtering.CheckerReasonSafeBrowsing, nc.Reason)
+	assert.True(t, nc.Enabled)
+
+	for range 2 {
+		blocked, checkErr := nc.Checker.Check(blockedHost)
+		require.NoError(t, checkErr)
+
+		assert.True(t, blocked)
+	}
+
+	assert.Equal(t, uint32(1), reqNum.Load())
+
+	blocked, err := nc.Checker.Check("allowed.example")
+	require.NoError(t, err)
+
+	assert.False(t, blocked)
+	assert.Equal(t, uint32(2), reqNum.Load())
+}
+
+func TestNew_httpJSONFailure(t *testing.T) {
+	var reqNum atomic.Uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		reqNum.Add(1)
+
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	nc, err := lookup.New(testutil.ContextWithTimeout(t, testTimeout), &lookup.Config{
+		Logger:     testLogger,
+		HTTPClient: srv.Client(),
+		Checker: &filtering.CheckerConfig{
+			Name:    "threat_intel",
+			Type:    filtering.CheckerTypeHTTPJSON,
+			URL:     srv.URL + "/check?host=" + filtering.HostPlaceholder,
+			Timeout: timeutil.Duration(testTimeout),
+		},
+	})
+	require.NoError(t, err)
+
+	_, firstErr := nc.Checker.Check(blockedHost)
+	require.Error(t, firstErr)
+
+	_, err = nc.Checker.Check(blockedHost)
+	testutil.AssertErrorMsg(t, firstErr.Error(), err)
+
+	assert.Equal(t, uint32(1), reqNum.Load())
+}
+
+func TestNew_dnsbl(t *testing.T) {
+	const zone = "dnsbl.example"
+
+	addr := aghtest.StartLocalhostUpstream(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := (&dns.Msg{}).SetReply(req)
+		if req.Question[0].Name == dns.Fqdn(blockedHost+"."+zone) {
+			resp.Answer = append(resp.Answer, &dns.A{
+				Hdr: dns.RR_Header{
+					Name:   req.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    60,
+				},
+				A: []byte{127, 0, 0, 2},
+			})
+		} else {
+			resp.Rcode = dns.RcodeNameError
+		}
+
+		_ = w.WriteMsg(resp)
+	}))
+
+	nc, err := lookup.New(testutil.ContextWithTimeout(t, testTimeout), &lookup.Config{
+		Logger: testLogger,
+		Checker: &filtering.CheckerConfig{
+			Name:     "dnsbl",
+			Type:     filtering.CheckerTypeDNSBL,
+			Upstream: addr.String(),
+			Zone:     zone,
+			Reason:   filtering.CheckerReasonParental,
+			Timeout:  timeutil.Duration(testTimeout),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, filtering.CheckerReasonParental, nc.Reason)
+
+	blocked, err := nc.Checker.Check(blockedHost)
+	require.NoError(t, err)
+
+	assert.True(t, blocked)
+
+	blocked, err = nc.Checker.Check("allowed.example")
+	require.NoError(t, err)
+
+	assert.False(t, blocked)
+
+	closer, ok := nc.Checker.(io.Closer)
+	require.True(t, ok)
+
+	assert.NoError(t, closer.Close())
+}
+
+func TestNew_hashSet(t *testing.T) {
+	sum := sha256.Sum256([]byte(blockedHost))
+	path := filepath.Join(t.TempDir(), "hashes.txt")
+	err := os.WriteFile(path, []byte(hex.EncodeToString(sum[:])+"\n"), 0o600)
+	require.NoError(t, err)
+
+	nc, err := lookup.New(testutil.ContextWithTimeout(t, testTimeout), &lookup.Config{
+		Logger: testLogger,
+		Checker: &filtering.CheckerConfig{
+			Name: "hashes",
+			Type: filtering.CheckerTypeHashSet,
+			URL:  path,
+		},
+		MaxSize: testMaxSize,
+	})
+	require.NoError(t, err)
+
+	blocked, err := nc.Checker.Check("sub." + blockedHost)
+	require.NoError(t, err)
+
+	assert.True(t, blocked)
+
+	blocked, err = nc.Checker.Check("allowed.example")
+	require.NoError(t, err)
+
+	assert.False(t, blocked)
+}
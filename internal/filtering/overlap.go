@@ -0,0 +1,353 @@
+package filtering
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// overlapFilter is the information about a single enabled filter list that is
+// used for the overlap analysis.
+type overlapFilter struct {
+	// path is the path to the cached rule-list file.
+	path string
+
+	// name is the human-readable name of the filter list.
+	name string
+
+	// url is the URL or the file path of the filter list.
+	url string
+
+	// id is the ID of the filter list.
+	id rulelist.APIID
+}
+
+// overlapJSON is the number of rules shared between two filter lists.
+type overlapJSON struct {
+	// ID is the ID of the other filter list.
+	ID rulelist.APIID `json:"id"`
+
+	// RulesCount is the number of rules shared with the other filter list.
+	RulesCount uint64 `json:"rules_count"`
+}
+
+// overlapFilterJSON is the result of the overlap analysis of a single filter
+// list.
+type overlapFilterJSON struct {
+	// Name is the human-readable name of the filter list.
+	Name string `json:"name"`
+
+	// URL is the URL or the file path of the filter list.
+	URL string `json:"url"`
+
+	// Overlaps are the numbers of rules shared with each of the other filter
+	// lists of the same kind.  It's sorted by the number of rules in the
+	// descending order.
+	Overlaps []*overlapJSON `json:"overlaps"`
+
+	// ID is the ID of the filter list.
+	ID rulelist.APIID `json:"id"`
+
+	// RulesCount is the number of distinct rules in the filter list.
+	RulesCount uint64 `json:"rules_count"`
+
+	// UniqueRulesCount is the number of rules which aren't contained in any
+	// other filter list of the same kind.
+	UniqueRulesCount uint64 `json:"unique_rules_count"`
+
+	// DuplicateRulesCount is the number of rules which are also contained in
+	// at least one other filter list of the same kind.
+	DuplicateRulesCount uint64 `json:"duplicate_rules_count"`
+
+	// UnusedRulesCount is the number of rules which haven't matched any
+	// request within the statistics retention interval.  It's nil if the
+	// numbers of matches aren't available.
+	UnusedRulesCount *uint64 `json:"unused_rules_count,omitempty"`
+
+	// UnusedRules are the first [maxUnusedRules] rules which haven't matched
+	// any request within the statistics retention interval.
+	UnusedRules []string `json:"unused_rules,omitempty"`
+}
+
+// maxUnusedRules is the maximum number of unused rules reported for a single
+// filter list.
+const maxUnusedRules = 100
+
+// overlapResp is the response for the GET /control/filtering/overlap HTTP API.
+type overlapResp struct {
+	Filters          []*overlapFilterJSON `json:"filters"`
+	WhitelistFilters []*overlapFilterJSON `json:"whitelist_filters"`
+
+	// RuleHitsIncomplete is true if some of the matched rules are missing
+	// from the statistics.  The unused rules aren't reported in that case,
+	// since the rules that have matched could be reported as unused.
+	RuleHitsIncomplete bool `json:"rule_hits_incomplete"`
+}
+
+// overlapAnalyzer collects the information about rules shared between filter
+// lists.  Rules are compared by their hashes to reduce the memory footprint.
+type overlapAnalyzer struct {
+	// owners maps the hash of each rule to the indexes of the filter lists
+	// containing it.
+	owners map[uint64][]int
+
+	// hits are the numbers of matches of rules.  If it's nil, the unused rules
+	// aren't collected.
+	hits map[RuleKey]uint64
+
+	// unused are the information about unused rules for each filter list.
+	// It's nil if hits is nil.
+	unused []*unusedRules
+
+	// seed is the seed for hashing the rules.
+	seed maphash.Seed
+
+	// buf is the buffer used to scan rule-list files.
+	buf []byte
+}
+
+// unusedRules is the information about the rules of a single filter list that
+// haven't matched any request.
+type unusedRules struct {
+	// rules are the first [maxUnusedRules] unused rules.
+	rules []string
+
+	// count is the total number of unused rules.
+	count uint64
+}
+
+// newOverlapAnalyzer returns a new properly initialized *overlapAnalyzer for n
+// filter lists.  buf is used to scan rule-list files.  hits may be nil.
+func newOverlapAnalyzer(buf []byte, n int, hits map[RuleKey]uint64) (a *overlapAnalyzer) {
+	a = &overlapAnalyzer{
+		owners: map[uint64][]int{},
+		hits:   hits,
+		seed:   maphash.MakeSeed(),
+		buf:    buf,
+	}
+
+	if hits != nil {
+		a.unused = make([]*unusedRules, n)
+		for i := range a.unused {
+			a.unused[i] = &unusedRules{}
+		}
+	}
+
+	return a
+}
+
+// addList adds the rules from r as belonging to the filter list with index idx
+// and ID id.  Lists must be added in the ascending order of their indexes.
+func (a *overlapAnalyzer) addList(idx int, id rulelist.APIID, r io.Reader) (err error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(a.buf, bufio.MaxScanTokenSize)
+
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] == '!' || line[0] == '#' {
+			continue
+		}
+
+		h := maphash.Bytes(a.seed, line)
+		owners := a.owners[h]
+		if len(owners) > 0 && owners[len(owners)-1] == idx {
+			// Don't count the duplicates within a single list.
+			continue
+		}
+
+		a.owners[h] = append(owners, idx)
+
+		if a.hits != nil {
+			a.collectUnused(idx, id, line)
+		}
+	}
+
+	return errors.Annotate(s.Err(), "scanning rules: %w")
+}
+
+// collectUnused remembers rule as unused if it hasn't matched any request.
+// a.hits must not be nil.
+func (a *overlapAnalyzer) collectUnused(idx int, id rulelist.APIID, rule []byte) {
+	text := string(rule)
+	if a.hits[RuleKey{Text: text, FilterListID: id}] > 0 {
+		return
+	}
+
+	u := a.unused[idx]
+	u.count++
+	if len(u.rules) < maxUnusedRules {
+		u.rules = append(u.rules, text)
+	}
+}
+
+// result returns the overlap information for flts, which must be the filter
+// lists added to a in the same order.
+func (a *overlapAnalyzer) result(flts []*overlapFilter) (res []*overlapFilterJSON) {
+	res = make([]*overlapFilterJSON, len(flts))
+	shared := make([]map[int]uint64, len(flts))
+	for i, f := range flts {
+		res[i] = &overlapFilterJSON{
+			Name:     f.name,
+			URL:      f.url,
+			Overlaps: []*overlapJSON{},
+			ID:       f.id,
+		}
+		shared[i] = map[int]uint64{}
+
+		if a.unused != nil {
+			res[i].UnusedRulesCount = &a.unused[i].count
+			res[i].UnusedRules = a.unused[i].rules
+		}
+	}
+
+	for _, owners := range a.owners {
+		for _, i := range owners {
+			res[i].RulesCount++
+			if len(owners) == 1 {
+				res[i].UniqueRulesCount++
+
+				continue
+			}
+
+			res[i].DuplicateRulesCount++
+			for _, j := range owners {
+				if j != i {
+					shared[i][j]++
+				}
+			}
+		}
+	}
+
+	for i, s := range shared {
+		for j, n := range s {
+			res[i].Overlaps = append(res[i].Overlaps, &overlapJSON{
+				ID:         flts[j].id,
+				RulesCount: n,
+			})
+		}
+
+		slices.SortFunc(res[i].Overlaps, func(a, b *overlapJSON) (c int) {
+			return cmp.Or(cmp.Compare(b.RulesCount, a.RulesCount), cmp.Compare(a.ID, b.ID))
+		})
+	}
+
+	return res
+}
+
+// enabledOverlapFilters returns the enabled filter lists of the kind specified
+// by white.
+func (d *DNSFilter) enabledOverlapFilters(white bool) (flts []*overlapFilter) {
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	filters := d.conf.Filters
+	if white {
+		filters = d.conf.WhitelistFilters
+	}
+
+	for _, f := range filters {
+		if !f.Enabled {
+			continue
+		}
+
+		flts = append(flts, &overlapFilter{
+			path: d.lists.CachePath(f.UID),
+			name: f.Name,
+			url:  f.URL,
+			// #nosec G115 -- The overflow is required for backwards
+			// compatibility.
+			id: rulelist.APIID(f.ID),
+		})
+	}
+
+	return flts
+}
+
+// analyzeOverlap returns the overlap information for all enabled filter lists
+// of the kind specified by white.  hits may be nil, in which case the unused
+// rules aren't reported.
+func (d *DNSFilter) analyzeOverlap(
+	ctx context.Context,
+	white bool,
+	hits map[RuleKey]uint64,
+) (res []*overlapFilterJSON, err error) {
+	flts := d.enabledOverlapFilters(white)
+
+	bufPtr := d.bufPool.Get()
+	defer d.bufPool.Put(bufPtr)
+
+	a := newOverlapAnalyzer(*bufPtr, len(flts), hits)
+	for i, f := range flts {
+		err = addOverlapFile(a, i, f.id, f.path)
+		if err != nil {
+			return nil, fmt.Errorf("filter list %d: %w", f.id, err)
+		}
+	}
+
+	d.logger.DebugContext(ctx, "analyzed overlap", "lists", len(flts), "rules", len(a.owners))
+
+	return a.result(flts), nil
+}
+
+// addOverlapFile adds the rules from the file at path to a as belonging to the
+// filter list with index idx and ID id.  A missing file is considered empty.
+func addOverlapFile(a *overlapAnalyzer, idx int, id rulelist.APIID, path string) (err error) {
+	// #nosec G304 -- Assume that path is always within DataDir.
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("opening filter file: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	return a.addList(idx, id, f)
+}
+
+// handleFilteringOverlap is the handler for the GET /control/filtering/overlap
+// HTTP API.
+func (d *DNSFilter) handleFilteringOverlap(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	resp := &overlapResp{}
+
+	hits, complete := d.ruleHits()
+	if hits != nil && !complete {
+		resp.RuleHitsIncomplete = true
+		hits = nil
+	}
+
+	var err error
+	resp.Filters, err = d.analyzeOverlap(ctx, false, hits)
+	if err == nil {
+		resp.WhitelistFilters, err = d.analyzeOverlap(ctx, true, hits)
+	}
+
+	if err != nil {
+		aghhttp.ErrorAndLog(
+			ctx,
+			l,
+			r,
+			w,
+			http.StatusInternalServerError,
+			"analyzing overlap: %s",
+			err,
+		)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, resp)
+}
@@ -0,0 +1,192 @@
+package filtering
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_handleFilteringOverlap(t *testing.T) {
+	d := newDNSFilter(t)
+
+	d.conf.Filters = []FilterYAML{{
+		Enabled: true,
+		Name:    "first",
+		URL:     "https://example.com/1.txt",
+		UID:     rulelist.MustNewUID(),
+		Filter:  Filter{ID: 1},
+	}, {
+		Enabled: true,
+		Name:    "second",
+		URL:     "https://example.com/2.txt",
+		UID:     rulelist.MustNewUID(),
+		Filter:  Filter{ID: 2},
+	}, {
+		Enabled: true,
+		Name:    "third",
+		URL:     "https://example.com/3.txt",
+		UID:     rulelist.MustNewUID(),
+		Filter:  Filter{ID: 3},
+	}, {
+		Enabled: false,
+		Name:    "disabled",
+		URL:     "https://example.com/4.txt",
+		UID:     rulelist.MustNewUID(),
+		Filter:  Filter{ID: 4},
+	}}
+
+	contents := []string{
+		"||unique-1.example^\n||shared.example^\n||all.example^\n||all.example^\n",
+		"! Comment\n||shared.example^\n||all.example^\n",
+		"||all.example^\n||unique-3.example^\n",
+		"||all.example^\n",
+	}
+
+	for i, c := range contents {
+		p := d.lists.CachePath(d.conf.Filters[i].UID)
+		err := os.WriteFile(p, []byte(c), aghos.DefaultPermFile)
+		require.NoError(t, err)
+	}
+
+	// Add a list without a cached file.
+	d.conf.WhitelistFilters = []FilterYAML{{
+		Enabled: true,
+		Name:    "missing",
+		URL:     filepath.Join(t.TempDir(), "missing.txt"),
+		UID:     rulelist.MustNewUID(),
+		Filter:  Filter{ID: 5},
+	}}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/control/filtering/overlap", nil)
+	d.handleFilteringOverlap(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	resp := &overlapResp{}
+	err := json.NewDecoder(w.Body).Decode(resp)
+	require.NoError(t, err)
+
+	want := []*overlapFilterJSON{{
+		Name: "first",
+		URL:  "https://example.com/1.txt",
+		Overlaps: []*overlapJSON{{
+			ID:         2,
+			RulesCount: 2,
+		}, {
+			ID:         3,
+			RulesCount: 1,
+		}},
+		ID:                  1,
+		RulesCount:          3,
+		UniqueRulesCount:    1,
+		DuplicateRulesCount: 2,
+	}, {
+		Name: "second",
+		URL:  "https://example.com/2.txt",
+		Overlaps: []*overlapJSON{{
+			ID:         1,
+			RulesCount: 2,
+		}, {
+			ID:         3,
+			RulesCount: 1,
+		}},
+		ID:                  2,
+		RulesCount:          2,
+		UniqueRulesCount:    0,
+		DuplicateRulesCount: 2,
+	}, {
+		Name: "third",
+		URL:  "https://example.com/3.txt",
+		Overlaps: []*overlapJSON{{
+			ID:         1,
+			RulesCount: 1,
+		}, {
+			ID:         2,
+			RulesCount: 1,
+		}},
+		ID:                  3,
+		RulesCount:          2,
+		UniqueRulesCount:    1,
+		DuplicateRulesCount: 1,
+	}}
+	assert.Equal(t, want, resp.Filters)
+
+	require.Len(t, resp.WhitelistFilters, 1)
+
+	wl := resp.WhitelistFilters[0]
+	assert.Equal(t, rulelist.APIID(5), wl.ID)
+	assert.Zero(t, wl.RulesCount)
+	assert.Empty(t, wl.Overlaps)
+	assert.Nil(t, wl.UnusedRulesCount)
+
+	t.Run("unused", func(t *testing.T) {
+		d.conf.RuleHits = func() (hits map[RuleKey]uint64, complete bool) {
+			return map[RuleKey]uint64{
+				{Text: "||all.example^", FilterListID: 1}:    2,
+				{Text: "||shared.example^", FilterListID: 2}: 1,
+				{Text: "||all.example^", FilterListID: 2}:    0,
+			}, true
+		}
+
+		w = httptest.NewRecorder()
+		d.handleFilteringOverlap(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp = &overlapResp{}
+		err = json.NewDecoder(w.Body).Decode(resp)
+		require.NoError(t, err)
+		require.Len(t, resp.Filters, 3)
+
+		wantUnused := [][]string{
+			{"||unique-1.example^", "||shared.example^"},
+			{"||all.example^"},
+			{"||all.example^", "||unique-3.example^"},
+		}
+
+		for i, f := range resp.Filters {
+			require.NotNil(t, f.UnusedRulesCount)
+
+			assert.Equal(t, uint64(len(wantUnused[i])), *f.UnusedRulesCount)
+			assert.Equal(t, wantUnused[i], f.UnusedRules)
+		}
+
+		require.Len(t, resp.WhitelistFilters, 1)
+
+		wl = resp.WhitelistFilters[0]
+		require.NotNil(t, wl.UnusedRulesCount)
+
+		assert.Zero(t, *wl.UnusedRulesCount)
+		assert.False(t, resp.RuleHitsIncomplete)
+	})
+
+	t.Run("incomplete", func(t *testing.T) {
+		d.conf.RuleHits = func() (hits map[RuleKey]uint64, complete bool) {
+			return map[RuleKey]uint64{
+				{Text: "||all.example^", FilterListID: 1}: 2,
+			}, false
+		}
+
+		w = httptest.NewRecorder()
+		d.handleFilteringOverlap(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp = &overlapResp{}
+		err = json.NewDecoder(w.Body).Decode(resp)
+		require.NoError(t, err)
+		require.Len(t, resp.Filters, 3)
+
+		assert.True(t, resp.RuleHitsIncomplete)
+		for _, f := range resp.Filters {
+			assert.Nil(t, f.UnusedRulesCount)
+			assert.Empty(t, f.UnusedRules)
+		}
+	})
+}
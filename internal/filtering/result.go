@@ -36,6 +36,11 @@ type Result struct {
 	// Reason is the reason for blocking or unblocking the request.
 	Reason Reason `json:",omitempty"`
 
+	// TTL is the TTL of the records of the legacy rewrite result in seconds.
+	// If it's zero, the default TTL is used.  It is zero unless Reason is set
+	// to Rewritten.
+	TTL uint32 `json:"-"`
+
 	// IsFiltered is true if the request is filtered.
 	//
 	// TODO(d.kolyshev): Get rid of this flag.
@@ -55,6 +60,15 @@ type ResultRule struct {
 	FilterListID rulelist.APIID `json:",omitempty"`
 }
 
+// RuleKey identifies a filtering rule by its text and its filter list.
+type RuleKey struct {
+	// Text is the text of the rule.
+	Text string
+
+	// FilterListID is the ID of the rule's filter list.
+	FilterListID rulelist.APIID
+}
+
 // NewResultRule converts an URLFilter rule into a *ResultRule.  nr must not be
 // nil.
 func NewResultRule(r rules.Rule) (rr *ResultRule) {
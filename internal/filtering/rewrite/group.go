@@ -0,0 +1,106 @@
+package rewrite
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/urlfilter"
+)
+
+// Group is a set of rewrites applied only to the requests from the clients
+// within its scope.  The rewrites of a group take precedence over the global
+// ones, which makes split-horizon answers possible.
+type Group struct {
+	// Name is the unique name of the group.  It must not be empty.
+	Name string `yaml:"name"`
+
+	// Clients are the names or ClientIDs of the persistent clients within the
+	// scope of the group.
+	Clients []string `yaml:"clients"`
+
+	// Tags are the tags of the clients within the scope of the group.  A client
+	// is within the scope if it has at least one of these tags.
+	Tags []string `yaml:"tags"`
+
+	// Subnets are the subnets of the clients within the scope of the group.
+	Subnets []netip.Prefix `yaml:"subnets"`
+
+	// Rewrites are the rewrites of the group.
+	Rewrites []*Item `yaml:"rewrites"`
+}
+
+// validate returns an error if g is invalid.  g must not be nil.
+func (g *Group) validate() (err error) {
+	var errs []error
+	if g.Name == "" {
+		errs = append(errs, fmt.Errorf("name: %w", errors.ErrEmptyValue))
+	}
+
+	if len(g.Clients) == 0 && len(g.Tags) == 0 && len(g.Subnets) == 0 {
+		errs = append(errs, fmt.Errorf("clients, tags, or subnets: %w", errors.ErrNoValue))
+	}
+
+	for i, pref := range g.Subnets {
+		if !pref.IsValid() {
+			errs = append(errs, fmt.Errorf("subnets: at index %d: bad prefix", i))
+		}
+	}
+
+	err = validateItems(g.Rewrites)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("rewrites: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Matches returns true if the client of dReq is within the scope of g.  g and
+// dReq must not be nil.
+func (g *Group) Matches(dReq *urlfilter.DNSRequest) (ok bool) {
+	if slices.ContainsFunc(g.Clients, dReq.ClientIdentifiers.Has) {
+		return true
+	}
+
+	if dReq.ClientIP.IsValid() && slices.ContainsFunc(g.Subnets, func(p netip.Prefix) (c bool) {
+		return p.Contains(dReq.ClientIP)
+	}) {
+		return true
+	}
+
+	return slices.ContainsFunc(g.Tags, dReq.ClientTags.Has)
+}
+
+// ValidateGroups returns an error if any of groups is invalid or their names
+// aren't unique.
+func ValidateGroups(groups []*Group) (err error) {
+	names := container.NewMapSet[string]()
+
+	var errs []error
+	for i, g := range groups {
+		if g == nil {
+			errs = append(errs, fmt.Errorf("at index %d: %w", i, errors.ErrNoValue))
+
+			continue
+		}
+
+		err = g.validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("at index %d: %w", i, err))
+
+			continue
+		}
+
+		if names.Has(g.Name) {
+			errs = append(errs, fmt.Errorf("at index %d: name: %w: %q", i, errors.ErrDuplicated, g.Name))
+
+			continue
+		}
+
+		names.Add(g.Name)
+	}
+
+	return errors.Join(errs...)
+}
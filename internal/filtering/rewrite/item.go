@@ -5,19 +5,69 @@ import (
 	"net/netip"
 	"strings"
 
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/miekg/dns"
 )
 
+// recordTypes are the explicit types of the records supported by rewrites.
+// These are the types supported by the $dnsrewrite rules.
+var recordTypes = container.NewMapSet(
+	dns.TypeA,
+	dns.TypeAAAA,
+	dns.TypeCNAME,
+	dns.TypeHTTPS,
+	dns.TypeMX,
+	dns.TypePTR,
+	dns.TypeSRV,
+	dns.TypeTXT,
+)
+
 // Item is a single DNS rewrite record.
-//
-// TODO(s.chzhen):  Add "Enabled" property.
 type Item struct {
 	// Domain is the domain pattern for which this rewrite should work.
 	Domain string `yaml:"domain"`
 
 	// Answer is the IP address, canonical name, or one of the special
-	// values: "A" or "AAAA".
+	// values: "A" or "AAAA".  For the other record types, it's the value of the
+	// record in the format of the $dnsrewrite rules.
 	Answer string `yaml:"answer"`
+
+	// Type is the explicit type of the record, for example "MX".  If it's
+	// empty, the type is inferred from Answer.
+	Type string `yaml:"type,omitempty"`
+
+	// Comment is an arbitrary comment of the administrator.
+	Comment string `yaml:"comment,omitempty"`
+
+	// TTL is the TTL of the records in seconds.  If it's zero, the TTL of the
+	// blocked responses is used.  The $dnsrewrite rules don't support TTLs, so
+	// it's only used when the item is converted into a legacy rewrite.
+	TTL uint32 `yaml:"ttl,omitempty"`
+
+	// Enabled indicates whether this rewrite is active.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Validate returns an error if rw is invalid.
+func (rw *Item) Validate() (err error) {
+	switch {
+	case rw == nil:
+		return errors.ErrNoValue
+	case rw.Domain == "":
+		return fmt.Errorf("domain: %w", errors.ErrEmptyValue)
+	case rw.Answer == "":
+		return fmt.Errorf("answer: %w", errors.ErrEmptyValue)
+	case rw.Type == "":
+		return nil
+	}
+
+	rr, ok := dns.StringToType[strings.ToUpper(rw.Type)]
+	if !ok || !recordTypes.Has(rr) {
+		return fmt.Errorf("type: %w: %q", errors.ErrBadEnumValue, rw.Type)
+	}
+
+	return nil
 }
 
 // equal returns true if rw is equal to other.
@@ -45,11 +95,18 @@ func (rw *Item) toRule() (res string) {
 		return fmt.Sprintf("@@||%s^$dnstype=%s,dnsrewrite", domain, dTypeKey)
 	}
 
-	return fmt.Sprintf("|%s^$dnsrewrite=NOERROR;%s;%s", domain, dTypeKey, rw.Answer)
+	ans := strings.ReplaceAll(rw.Answer, ",", `\,`)
+
+	return fmt.Sprintf("|%s^$dnsrewrite=NOERROR;%s;%s", domain, dTypeKey, ans)
 }
 
-// rewriteParams returns dns request type and exception flag for rw.
+// rewriteParams returns dns request type and exception flag for rw.  rw must
+// be valid.
 func (rw *Item) rewriteParams() (dType uint16, exception bool) {
+	if t := strings.ToUpper(rw.Type); t != "" {
+		return dns.StringToType[t], rw.Answer == t
+	}
+
 	switch rw.Answer {
 	case "AAAA":
 		return dns.TypeAAAA, true
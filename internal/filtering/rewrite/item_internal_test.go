@@ -99,6 +99,22 @@ func TestItem_toRule(t *testing.T) {
 			Answer: "other.org",
 		},
 		want: "|*.example.org^$dnsrewrite=NOERROR;CNAME;other.org",
+	}, {
+		name: "mx_rule",
+		item: &Item{
+			Domain: testDomain,
+			Answer: "10 mail.example.org",
+			Type:   "mx",
+		},
+		want: "|example.org^$dnsrewrite=NOERROR;MX;10 mail.example.org",
+	}, {
+		name: "https_rule",
+		item: &Item{
+			Domain: testDomain,
+			Answer: "1 . alpn=h2,h3",
+			Type:   "HTTPS",
+		},
+		want: `|example.org^$dnsrewrite=NOERROR;HTTPS;1 . alpn=h2\,h3`,
 	}, {
 		name: "aaaa_exception",
 		item: &Item{
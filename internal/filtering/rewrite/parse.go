@@ -0,0 +1,358 @@
+package rewrite
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// Format is the format of the records of another DNS server to parse into
+// rewrites.
+type Format string
+
+// Valid formats.
+const (
+	// FormatDnsmasq is the format of the dnsmasq configuration files.  The
+	// "address", "host-record", and "cname" options are parsed, the other
+	// options are ignored.
+	FormatDnsmasq Format = "dnsmasq"
+
+	// FormatPihole is the format of the Pi-hole local DNS records, that is the
+	// hosts-like "custom.list" file and the "cname" options of the
+	// "05-pihole-custom-cname.conf" file.
+	FormatPihole Format = "pihole"
+
+	// FormatUnbound is the format of the Unbound configuration files.  The
+	// "local-data" and "local-data-ptr" statements are parsed, the other
+	// statements are ignored.
+	FormatUnbound Format = "unbound"
+)
+
+// Parse parses the records of format from r into enabled rewrite items.  The
+// lines that can't be converted into rewrites are skipped and reported in
+// skipped.
+// err is only returned if r can't be read or format is unknown.
+func Parse(format Format, r io.Reader) (items []*Item, skipped []error, err error) {
+	var parseLine func(line string) (lineItems []*Item, err error)
+	switch format {
+	case FormatDnsmasq:
+		parseLine = parseDnsmasqLine
+	case FormatPihole:
+		parseLine = parsePiholeLine
+	case FormatUnbound:
+		parseLine = parseUnboundLine
+	default:
+		return nil, nil, fmt.Errorf("format: %w: %q", errors.ErrBadEnumValue, format)
+	}
+
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		lineItems, lineErr := parseLine(line)
+		if lineErr != nil {
+			skipped = append(skipped, fmt.Errorf("line %d: %w", lineNum, lineErr))
+
+			continue
+		}
+
+		for _, item := range lineItems {
+			item.Enabled = true
+		}
+
+		items = append(items, lineItems...)
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading: %w", err)
+	}
+
+	return items, skipped, nil
+}
+
+// parseDnsmasqLine parses a single line of a dnsmasq configuration file.
+func parseDnsmasqLine(line string) (items []*Item, err error) {
+	opt, val, _ := strings.Cut(line, "=")
+	switch strings.TrimSpace(opt) {
+	case "address":
+		return parseDnsmasqAddress(strings.TrimSpace(val))
+	case "host-record":
+		return parseDnsmasqHostRecord(strings.TrimSpace(val))
+	case "cname":
+		return parseDnsmasqCNAME(strings.TrimSpace(val))
+	default:
+		return nil, nil
+	}
+}
+
+// parseDnsmasqAddress parses the value of the dnsmasq "address" option, for
+// example "/example.com/example.net/192.0.2.1".  Since dnsmasq also applies it
+// to the subdomains, a wildcard rewrite is added for each domain.  The "#"
+// domain, which matches all domains in dnsmasq, isn't supported.
+func parseDnsmasqAddress(val string) (items []*Item, err error) {
+	parts := strings.Split(strings.TrimPrefix(val, "/"), "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("address: %w", errors.ErrNoValue)
+	}
+
+	ip := parts[len(parts)-1]
+	switch ip {
+	case "", "#":
+		return nil, fmt.Errorf("address: blocking entries aren't supported")
+	default:
+		if _, err = netip.ParseAddr(ip); err != nil {
+			return nil, fmt.Errorf("address: %w", err)
+		}
+	}
+
+	for _, domain := range parts[:len(parts)-1] {
+		domain = normalizeDomain(domain)
+		switch domain {
+		case "":
+			return nil, fmt.Errorf("address: domain: %w", errors.ErrEmptyValue)
+		case "#":
+			return nil, fmt.Errorf("address: domain: matching all domains isn't supported")
+		default:
+			err = netutil.ValidateDomainName(domain)
+			if err != nil {
+				return nil, fmt.Errorf("address: domain: %w", err)
+			}
+		}
+
+		items = append(items, &Item{
+			Domain: domain,
+			Answer: ip,
+		}, &Item{
+			Domain: "*." + domain,
+			Answer: ip,
+		})
+	}
+
+	return items, nil
+}
+
+// parseDnsmasqHostRecord parses the value of the dnsmasq "host-record" option,
+// for example "host.lan,alias.lan,192.0.2.1,2001:db8::1,3600".  The TTL is
+// ignored.
+func parseDnsmasqHostRecord(val string) (items []*Item, err error) {
+	var names, addrs []string
+	for i, field := range strings.Split(val, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if _, err = netip.ParseAddr(field); err == nil {
+			addrs = append(addrs, field)
+
+			continue
+		}
+
+		if _, err = strconv.ParseUint(field, 10, 32); err == nil && i > 0 {
+			// The TTL, which rewrites don't support.
+			continue
+		}
+
+		names = append(names, normalizeDomain(field))
+	}
+
+	if len(names) == 0 || len(addrs) == 0 {
+		return nil, fmt.Errorf("host-record: want names and addresses")
+	}
+
+	for _, name := range names {
+		for _, addr := range addrs {
+			items = append(items, &Item{
+				Domain: name,
+				Answer: addr,
+			})
+		}
+	}
+
+	return items, nil
+}
+
+// parseDnsmasqCNAME parses the value of the dnsmasq "cname" option, for example
+// "alias.lan,other.lan,target.lan,3600".  The TTL is ignored.
+func parseDnsmasqCNAME(val string) (items []*Item, err error) {
+	fields := strings.Split(val, ",")
+	if _, err = strconv.ParseUint(strings.TrimSpace(fields[len(fields)-1]), 10, 32); err == nil {
+		// The TTL, which rewrites don't support.
+		fields = fields[:len(fields)-1]
+	}
+
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("cname: want aliases and target")
+	}
+
+	target := normalizeDomain(fields[len(fields)-1])
+	for _, alias := range fields[:len(fields)-1] {
+		items = append(items, &Item{
+			Domain: normalizeDomain(alias),
+			Answer: target,
+		})
+	}
+
+	return items, nil
+}
+
+// parsePiholeLine parses a single line of a Pi-hole "custom.list" or
+// "05-pihole-custom-cname.conf" file.
+func parsePiholeLine(line string) (items []*Item, err error) {
+	if strings.HasPrefix(line, "cname=") {
+		return parseDnsmasqCNAME(strings.TrimPrefix(line, "cname="))
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("want address and hostnames")
+	}
+
+	addr, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	for _, name := range fields[1:] {
+		if name[0] == '#' {
+			break
+		}
+
+		items = append(items, &Item{
+			Domain: normalizeDomain(name),
+			Answer: addr.String(),
+		})
+	}
+
+	return items, nil
+}
+
+// parseUnboundLine parses a single line of an Unbound configuration file.
+func parseUnboundLine(line string) (items []*Item, err error) {
+	stmt, val, _ := strings.Cut(line, ":")
+	val = unquote(strings.TrimSpace(val))
+
+	switch strings.TrimSpace(stmt) {
+	case "local-data":
+		var item *Item
+		item, err = parseUnboundLocalData(val)
+		if err != nil {
+			return nil, fmt.Errorf("local-data: %w", err)
+		}
+
+		return []*Item{item}, nil
+	case "local-data-ptr":
+		var item *Item
+		item, err = parseUnboundLocalDataPTR(val)
+		if err != nil {
+			return nil, fmt.Errorf("local-data-ptr: %w", err)
+		}
+
+		return []*Item{item}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// parseUnboundLocalData parses the value of the Unbound "local-data"
+// statement, which is a resource record in the zone file format.
+func parseUnboundLocalData(val string) (item *Item, err error) {
+	rr, err := dns.NewRR(val)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	} else if rr == nil {
+		return nil, errors.ErrNoValue
+	}
+
+	item = &Item{
+		Domain: normalizeDomain(rr.Header().Name),
+	}
+
+	switch rr := rr.(type) {
+	case *dns.A:
+		item.Answer = rr.A.String()
+	case *dns.AAAA:
+		item.Answer = rr.AAAA.String()
+	case *dns.CNAME:
+		item.Answer = normalizeDomain(rr.Target)
+	case *dns.MX:
+		item.Type = "MX"
+		item.Answer = fmt.Sprintf("%d %s", rr.Preference, normalizeDomain(rr.Mx))
+	case *dns.PTR:
+		item.Type = "PTR"
+		item.Answer = normalizeDomain(rr.Ptr)
+	case *dns.SRV:
+		item.Type = "SRV"
+		item.Answer = fmt.Sprintf(
+			"%d %d %d %s",
+			rr.Priority,
+			rr.Weight,
+			rr.Port,
+			normalizeDomain(rr.Target),
+		)
+	case *dns.TXT:
+		item.Type = "TXT"
+		item.Answer = strings.Join(rr.Txt, "")
+	default:
+		return nil, fmt.Errorf("unsupported type %s", dns.TypeToString[rr.Header().Rrtype])
+	}
+
+	return item, nil
+}
+
+// parseUnboundLocalDataPTR parses the value of the Unbound "local-data-ptr"
+// statement, for example "192.0.2.1 host.lan".
+func parseUnboundLocalDataPTR(val string) (item *Item, err error) {
+	fields := strings.Fields(val)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("want address and hostname")
+	}
+
+	addr, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	arpa, err := netutil.IPToReversedAddr(addr.AsSlice())
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	return &Item{
+		Domain: arpa,
+		Answer: normalizeDomain(fields[len(fields)-1]),
+		Type:   "PTR",
+	}, nil
+}
+
+// normalizeDomain returns the lowercased domain name without the trailing dot.
+func normalizeDomain(domain string) (norm string) {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+// unquote returns the contents of the double- or single-quoted string at the
+// beginning of s, if any, dropping the rest, such as comments.
+func unquote(s string) (unquoted string) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return s
+	}
+
+	unquoted, _, _ = strings.Cut(s[1:], s[:1])
+
+	return unquoted
+}
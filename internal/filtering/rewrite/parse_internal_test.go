@@ -0,0 +1,102 @@
+package rewrite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name        string
+		format      Format
+		in          string
+		want        []*Item
+		wantSkipped []string
+	}{{
+		name:   "dnsmasq",
+		format: FormatDnsmasq,
+		in: `# Local records.
+domain-needed
+address=/nas.lan/192.168.1.10
+host-record=Router.lan,gw.lan,192.168.1.1,fd00::1,3600
+cname=www.lan,web.lan,nas.lan,600
+address=/ads.example/#
+address=/#/192.168.1.2
+address=/bad domain/192.168.1.3
+`,
+		want: []*Item{
+			{Domain: "nas.lan", Answer: "192.168.1.10", Enabled: true},
+			{Domain: "*.nas.lan", Answer: "192.168.1.10", Enabled: true},
+			{Domain: "router.lan", Answer: "192.168.1.1", Enabled: true},
+			{Domain: "router.lan", Answer: "fd00::1", Enabled: true},
+			{Domain: "gw.lan", Answer: "192.168.1.1", Enabled: true},
+			{Domain: "gw.lan", Answer: "fd00::1", Enabled: true},
+			{Domain: "www.lan", Answer: "nas.lan", Enabled: true},
+			{Domain: "web.lan", Answer: "nas.lan", Enabled: true},
+		},
+		wantSkipped: []string{
+			"line 6: address: blocking entries aren't supported",
+			"line 7: address: domain: matching all domains isn't supported",
+			`line 8: address: domain: bad domain name "bad domain": ` +
+				`bad top-level domain name label "bad domain": ` +
+				`bad top-level domain name label rune ' '`,
+		},
+	}, {
+		name:   "pihole",
+		format: FormatPihole,
+		in: `192.168.1.10 nas.lan nas # NAS
+bad.lan
+cname=alias.lan,nas.lan
+`,
+		want: []*Item{
+			{Domain: "nas.lan", Answer: "192.168.1.10", Enabled: true},
+			{Domain: "nas", Answer: "192.168.1.10", Enabled: true},
+			{Domain: "alias.lan", Answer: "nas.lan", Enabled: true},
+		},
+		wantSkipped: []string{"line 2: want address and hostnames"},
+	}, {
+		name:   "unbound",
+		format: FormatUnbound,
+		in: `server:
+    local-zone: "lan." static
+    local-data: "nas.lan. 3600 IN A 192.168.1.10" # NAS
+    local-data: 'www.lan. CNAME nas.lan.'
+    local-data: "lan. MX 10 mail.lan."
+    local-data: 'lan. TXT "v=spf1 -all"'
+    local-data: "lan. NS ns.lan."
+    local-data-ptr: "192.168.1.10 nas.lan"
+`,
+		want: []*Item{
+			{Domain: "nas.lan", Answer: "192.168.1.10", Enabled: true},
+			{Domain: "www.lan", Answer: "nas.lan", Enabled: true},
+			{Domain: "lan", Answer: "10 mail.lan", Type: "MX", Enabled: true},
+			{Domain: "lan", Answer: "v=spf1 -all", Type: "TXT", Enabled: true},
+			{Domain: "10.1.168.192.in-addr.arpa", Answer: "nas.lan", Type: "PTR", Enabled: true},
+		},
+		wantSkipped: []string{"line 7: local-data: unsupported type NS"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			items, skipped, err := Parse(tc.format, strings.NewReader(tc.in))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, items)
+
+			require.Len(t, skipped, len(tc.wantSkipped))
+
+			for i, skipErr := range skipped {
+				testutil.AssertErrorMsg(t, tc.wantSkipped[i], skipErr)
+			}
+		})
+	}
+
+	t.Run("bad_format", func(t *testing.T) {
+		_, _, err := Parse("bind", strings.NewReader(""))
+		testutil.AssertErrorMsg(t, `format: bad enum value: "bind"`, err)
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/urlfilter"
 	"github.com/AdguardTeam/urlfilter/filterlist"
 	"github.com/AdguardTeam/urlfilter/rules"
@@ -39,6 +40,11 @@ type Config struct {
 	// Rewrites stores the rewrite entries.  It must not be nil.
 	Rewrites []*Item
 
+	// Groups are the rewrite groups scoped to clients.  The rewrites of the
+	// first group matching a request take precedence over the rewrites of the
+	// following groups and the global ones.  See [Group].
+	Groups []*Group
+
 	// ListID is used as an identifier of the underlying rules list.
 	ListID rules.ListID
 }
@@ -60,12 +66,35 @@ type DefaultStorage struct {
 	// rewrites stores the rewrite entries from configuration.
 	rewrites []*Item
 
+	// groups are the rewrite groups with their engines, in the order of
+	// precedence.
+	groups []*groupEngine
+
 	// urlFilterID is the synthetic integer identifier for the urlfilter engine.
 	urlFilterID rules.ListID
 }
 
+// groupEngine is a rewrite group with its DNS filtering engine.
+type groupEngine struct {
+	// group is the configuration of the group.  It must not be nil.
+	group *Group
+
+	// engine is the DNS filtering engine for the rewrites of the group.
+	engine *urlfilter.DNSEngine
+}
+
 // NewDefaultStorage returns new rewrites storage.  conf must not be nil.
 func NewDefaultStorage(conf *Config) (s *DefaultStorage, err error) {
+	err = validateItems(conf.Rewrites)
+	if err != nil {
+		return nil, fmt.Errorf("rewrites: %w", err)
+	}
+
+	err = ValidateGroups(conf.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("groups: %w", err)
+	}
+
 	s = &DefaultStorage{
 		logger:      conf.Logger,
 		mu:          &sync.RWMutex{},
@@ -73,6 +102,19 @@ func NewDefaultStorage(conf *Config) (s *DefaultStorage, err error) {
 		rewrites:    conf.Rewrites,
 	}
 
+	for _, g := range conf.Groups {
+		var engine *urlfilter.DNSEngine
+		engine, _, err = s.newEngine(g.Rewrites)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", g.Name, err)
+		}
+
+		s.groups = append(s.groups, &groupEngine{
+			group:  g,
+			engine: engine,
+		})
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -94,12 +136,13 @@ func (s *DefaultStorage) MatchRequest(dReq *urlfilter.DNSRequest) (rws []*rules.
 
 	ctx := context.TODO()
 
-	rewriteRules := s.rewriteRulesForReq(dReq)
+	engines := s.enginesForReq(dReq)
+	rewriteRules := rewriteRulesForReq(engines, dReq)
 	if len(rewriteRules) == 0 {
 		return nil
 	}
 
-	resolvedRules, wildcardRewrite := s.resolveCNAMEChain(ctx, dReq, rewriteRules)
+	resolvedRules, wildcardRewrite := s.resolveCNAMEChain(ctx, engines, dReq, rewriteRules)
 	if wildcardRewrite != nil {
 		return []*rules.DNSRewrite{wildcardRewrite}
 	}
@@ -112,10 +155,11 @@ func (s *DefaultStorage) MatchRequest(dReq *urlfilter.DNSRequest) (rws []*rules.
 }
 
 // resolveCNAMEChain follows the CNAME chain for a DNS request, handling loops
-// and special cases.  dReq must not be nil, and rewriteRules must not contain
-// nil elements.
+// and special cases.  dReq must not be nil, and neither engines nor
+// rewriteRules must contain nil elements.
 func (s *DefaultStorage) resolveCNAMEChain(
 	ctx context.Context,
+	engines []*urlfilter.DNSEngine,
 	dReq *urlfilter.DNSRequest,
 	rewriteRules []*rules.NetworkRule,
 ) (resolvedRules []*rules.NetworkRule, wildcardRewrite *rules.DNSRewrite) {
@@ -149,7 +193,7 @@ func (s *DefaultStorage) resolveCNAMEChain(
 
 		cnames.Add(rwAns)
 
-		rewriteRulesForReq := s.rewriteRulesForReq(&urlfilter.DNSRequest{
+		rewriteRulesForReq := rewriteRulesForReq(engines, &urlfilter.DNSRequest{
 			Hostname: rwAns,
 			DNSType:  dReq.DNSType,
 		})
@@ -188,15 +232,42 @@ func (s *DefaultStorage) collectDNSRewrites(
 	return rws
 }
 
-// rewriteRulesForReq returns matching dnsrewrite rules.
-func (s *DefaultStorage) rewriteRulesForReq(dReq *urlfilter.DNSRequest) (rules []*rules.NetworkRule) {
-	res, _ := s.engine.MatchRequest(dReq)
+// enginesForReq returns the engines of the groups matching dReq in the order of
+// precedence followed by the engine of the global rewrites.  dReq must not be
+// nil.
+func (s *DefaultStorage) enginesForReq(dReq *urlfilter.DNSRequest) (engines []*urlfilter.DNSEngine) {
+	for _, ge := range s.groups {
+		if ge.group.Matches(dReq) {
+			engines = append(engines, ge.engine)
+		}
+	}
+
+	return append(engines, s.engine)
+}
+
+// rewriteRulesForReq returns matching dnsrewrite rules from the first of
+// engines having any.
+func rewriteRulesForReq(
+	engines []*urlfilter.DNSEngine,
+	dReq *urlfilter.DNSRequest,
+) (rules []*rules.NetworkRule) {
+	for _, engine := range engines {
+		res, _ := engine.MatchRequest(dReq)
+		if rules = res.DNSRewrites(); len(rules) > 0 {
+			return rules
+		}
+	}
 
-	return res.DNSRewrites()
+	return nil
 }
 
 // Add implements the [Storage] interface for *DefaultStorage.
 func (s *DefaultStorage) Add(item *Item) (err error) {
+	err = item.Validate()
+	if err != nil {
+		return fmt.Errorf("validating: %w", err)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -240,13 +311,39 @@ func (s *DefaultStorage) List() (items []*Item) {
 
 // resetRules resets the filtering rules.
 func (s *DefaultStorage) resetRules() (err error) {
+	engine, strList, err := s.newEngine(s.rewrites)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	s.ruleList = strList
+	s.engine = engine
+
+	s.logger.InfoContext(
+		context.TODO(),
+		"reset rules",
+		"filter", s.urlFilterID,
+		"count", s.engine.RulesCount,
+	)
+
+	return nil
+}
+
+// newEngine returns a new DNS filtering engine for the enabled items as well as
+// its rule list.
+func (s *DefaultStorage) newEngine(
+	items []*Item,
+) (engine *urlfilter.DNSEngine, strList filterlist.Interface, err error) {
 	// TODO(a.garipov): Use strings.Builder.
 	var rulesText []string
-	for _, rewrite := range s.rewrites {
-		rulesText = append(rulesText, rewrite.toRule())
+	for _, rewrite := range items {
+		if rewrite.Enabled {
+			rulesText = append(rulesText, rewrite.toRule())
+		}
 	}
 
-	strList := filterlist.NewString(&filterlist.StringConfig{
+	strList = filterlist.NewString(&filterlist.StringConfig{
 		ID:             s.urlFilterID,
 		RulesText:      strings.Join(rulesText, "\n"),
 		IgnoreCosmetic: true,
@@ -254,20 +351,23 @@ func (s *DefaultStorage) resetRules() (err error) {
 
 	rs, err := filterlist.NewRuleStorage([]filterlist.Interface{strList})
 	if err != nil {
-		return fmt.Errorf("creating list storage: %w", err)
+		return nil, nil, fmt.Errorf("creating list storage: %w", err)
 	}
 
-	s.ruleList = strList
-	s.engine = urlfilter.NewDNSEngine(rs)
+	return urlfilter.NewDNSEngine(rs), strList, nil
+}
 
-	s.logger.InfoContext(
-		context.TODO(),
-		"reset rules",
-		"filter", s.urlFilterID,
-		"count", s.engine.RulesCount,
-	)
+// validateItems returns an error if any of items is invalid.
+func validateItems(items []*Item) (err error) {
+	var errs []error
+	for i, item := range items {
+		err = item.Validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("at index %d: %w", i, err))
+		}
+	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // matchesQType returns true if dnsrewrite matches the question type qt.
@@ -277,11 +377,6 @@ func matchesQType(dnsrr *rules.DNSRewrite, qt uint16) (ok bool) {
 		return true
 	}
 
-	// Reject types other than A and AAAA.
-	if qt != dns.TypeA && qt != dns.TypeAAAA {
-		return false
-	}
-
 	return dnsrr.RRType == qt
 }
 
@@ -4,8 +4,10 @@ import (
 	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/AdguardTeam/urlfilter"
 	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/miekg/dns"
@@ -21,8 +23,9 @@ var testLogger = slogutil.NewDiscardLogger()
 
 func TestNewDefaultStorage(t *testing.T) {
 	items := []*Item{{
-		Domain: "example.com",
-		Answer: "answer.com",
+		Domain:  "example.com",
+		Answer:  "answer.com",
+		Enabled: true,
 	}}
 
 	s, err := NewDefaultStorage(&Config{
@@ -46,7 +49,7 @@ func TestDefaultStorage_CRUD(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, s.List(), 0)
 
-	item := &Item{Domain: "example.com", Answer: "answer.com"}
+	item := &Item{Domain: "example.com", Answer: "answer.com", Enabled: true}
 
 	err = s.Add(item)
 	require.NoError(t, err)
@@ -73,58 +76,74 @@ func TestDefaultStorage_MatchRequest(t *testing.T) {
 
 	items := []*Item{{
 		// This one and below are about CNAME, A and AAAA.
-		Domain: "somecname",
-		Answer: "somehost.com",
+		Domain:  "somecname",
+		Answer:  "somehost.com",
+		Enabled: true,
 	}, {
-		Domain: "somehost.com",
-		Answer: netip.IPv4Unspecified().String(),
+		Domain:  "somehost.com",
+		Answer:  netip.IPv4Unspecified().String(),
+		Enabled: true,
 	}, {
-		Domain: "host.com",
-		Answer: addr1v4.String(),
+		Domain:  "host.com",
+		Answer:  addr1v4.String(),
+		Enabled: true,
 	}, {
-		Domain: "host.com",
-		Answer: addr2v4.String(),
+		Domain:  "host.com",
+		Answer:  addr2v4.String(),
+		Enabled: true,
 	}, {
-		Domain: "host.com",
-		Answer: addr1v6.String(),
+		Domain:  "host.com",
+		Answer:  addr1v6.String(),
+		Enabled: true,
 	}, {
-		Domain: "www.host.com",
-		Answer: "host.com",
+		Domain:  "www.host.com",
+		Answer:  "host.com",
+		Enabled: true,
 	}, {
 		// This one is a wildcard.
-		Domain: "*.host.com",
-		Answer: addr2v4.String(),
+		Domain:  "*.host.com",
+		Answer:  addr2v4.String(),
+		Enabled: true,
 	}, {
 		// This one and below are about wildcard overriding.
-		Domain: "a.host.com",
-		Answer: addr1v4.String(),
+		Domain:  "a.host.com",
+		Answer:  addr1v4.String(),
+		Enabled: true,
 	}, {
 		// This one is about CNAME and wildcard interacting.
-		Domain: "*.host2.com",
-		Answer: "host.com",
+		Domain:  "*.host2.com",
+		Answer:  "host.com",
+		Enabled: true,
 	}, {
 		// This one and below are about 2 level CNAME.
-		Domain: "b.host.com",
-		Answer: "somecname",
+		Domain:  "b.host.com",
+		Answer:  "somecname",
+		Enabled: true,
 	}, {
 		// This one and below are about 2 level CNAME and wildcard.
-		Domain: "b.host3.com",
-		Answer: "a.host3.com",
+		Domain:  "b.host3.com",
+		Answer:  "a.host3.com",
+		Enabled: true,
 	}, {
-		Domain: "a.host3.com",
-		Answer: "x.host.com",
+		Domain:  "a.host3.com",
+		Answer:  "x.host.com",
+		Enabled: true,
 	}, {
-		Domain: "*.hostboth.com",
-		Answer: addr3v4.String(),
+		Domain:  "*.hostboth.com",
+		Answer:  addr3v4.String(),
+		Enabled: true,
 	}, {
-		Domain: "*.hostboth.com",
-		Answer: addr2v6.String(),
+		Domain:  "*.hostboth.com",
+		Answer:  addr2v6.String(),
+		Enabled: true,
 	}, {
-		Domain: "BIGHOST.COM",
-		Answer: addr4v4.String(),
+		Domain:  "BIGHOST.COM",
+		Answer:  addr4v4.String(),
+		Enabled: true,
 	}, {
-		Domain: "*.issue4016.com",
-		Answer: "sub.issue4016.com",
+		Domain:  "*.issue4016.com",
+		Answer:  "sub.issue4016.com",
+		Enabled: true,
 	}}
 
 	s, err := NewDefaultStorage(&Config{
@@ -293,14 +312,17 @@ func TestDefaultStorage_MatchRequest_Levels(t *testing.T) {
 
 	// Exact host, wildcard L2, wildcard L3.
 	items := []*Item{{
-		Domain: "host.com",
-		Answer: addr1.String(),
+		Domain:  "host.com",
+		Answer:  addr1.String(),
+		Enabled: true,
 	}, {
-		Domain: "*.host.com",
-		Answer: addr2.String(),
+		Domain:  "*.host.com",
+		Answer:  addr2.String(),
+		Enabled: true,
 	}, {
-		Domain: "*.sub.host.com",
-		Answer: addr3.String(),
+		Domain:  "*.sub.host.com",
+		Answer:  addr3.String(),
+		Enabled: true,
 	}}
 
 	s, err := NewDefaultStorage(&Config{
@@ -365,14 +387,17 @@ func TestDefaultStorage_MatchRequest_ExceptionCNAME(t *testing.T) {
 
 	// Wildcard and exception for a sub-domain.
 	items := []*Item{{
-		Domain: "*.host.com",
-		Answer: addr.String(),
+		Domain:  "*.host.com",
+		Answer:  addr.String(),
+		Enabled: true,
 	}, {
-		Domain: "sub.host.com",
-		Answer: "sub.host.com",
+		Domain:  "sub.host.com",
+		Answer:  "sub.host.com",
+		Enabled: true,
 	}, {
-		Domain: "*.sub.host.com",
-		Answer: "*.sub.host.com",
+		Domain:  "*.sub.host.com",
+		Answer:  "*.sub.host.com",
+		Enabled: true,
 	}}
 
 	s, err := NewDefaultStorage(&Config{
@@ -427,20 +452,25 @@ func TestDefaultStorage_MatchRequest_ExceptionIP(t *testing.T) {
 
 	// Exception for AAAA record.
 	items := []*Item{{
-		Domain: "host.com",
-		Answer: addr.String(),
+		Domain:  "host.com",
+		Answer:  addr.String(),
+		Enabled: true,
 	}, {
-		Domain: "host.com",
-		Answer: "AAAA",
+		Domain:  "host.com",
+		Answer:  "AAAA",
+		Enabled: true,
 	}, {
-		Domain: "host2.com",
-		Answer: netutil.IPv6Localhost().String(),
+		Domain:  "host2.com",
+		Answer:  netutil.IPv6Localhost().String(),
+		Enabled: true,
 	}, {
-		Domain: "host2.com",
-		Answer: "A",
+		Domain:  "host2.com",
+		Answer:  "A",
+		Enabled: true,
 	}, {
-		Domain: "host3.com",
-		Answer: "A",
+		Domain:  "host3.com",
+		Answer:  "A",
+		Enabled: true,
 	}}
 
 	s, err := NewDefaultStorage(&Config{
@@ -508,3 +538,225 @@ func TestDefaultStorage_MatchRequest_ExceptionIP(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultStorage_MatchRequest_groups(t *testing.T) {
+	const host = "app.example.com"
+
+	var (
+		publicAddr   = netip.MustParseAddr("203.0.113.1")
+		internalAddr = netip.MustParseAddr("10.0.0.1")
+		taggedAddr   = netip.MustParseAddr("10.0.0.2")
+		vpnAddr      = netip.MustParseAddr("10.8.0.5")
+		guestAddr    = netip.MustParseAddr("192.168.2.5")
+	)
+
+	s, err := NewDefaultStorage(&Config{
+		Logger: testLogger,
+		Rewrites: []*Item{{
+			Domain:  host,
+			Answer:  publicAddr.String(),
+			Enabled: true,
+		}, {
+			Domain:  "alias.example.com",
+			Answer:  host,
+			Enabled: true,
+		}},
+		Groups: []*Group{{
+			Name:    "vpn",
+			Clients: []string{"laptop"},
+			Subnets: []netip.Prefix{netip.MustParsePrefix("10.8.0.0/24")},
+			Rewrites: []*Item{{
+				Domain:  host,
+				Answer:  internalAddr.String(),
+				Enabled: true,
+			}},
+		}, {
+			Name: "tagged",
+			Tags: []string{"device_phone"},
+			Rewrites: []*Item{{
+				Domain:  host,
+				Answer:  taggedAddr.String(),
+				Enabled: true,
+			}},
+		}},
+		ListID: testListID,
+	})
+	require.NoError(t, err)
+
+	newWant := func(addr netip.Addr) (rws []*rules.DNSRewrite) {
+		return []*rules.DNSRewrite{{
+			Value:  addr,
+			RCode:  dns.RcodeSuccess,
+			RRType: dns.TypeA,
+		}}
+	}
+
+	testCases := []struct {
+		name     string
+		host     string
+		ids      []string
+		tags     []string
+		clientIP netip.Addr
+		want     []*rules.DNSRewrite
+	}{{
+		name:     "guest",
+		host:     host,
+		clientIP: guestAddr,
+		want:     newWant(publicAddr),
+	}, {
+		name:     "vpn_subnet",
+		host:     host,
+		clientIP: vpnAddr,
+		want:     newWant(internalAddr),
+	}, {
+		name:     "vpn_client",
+		host:     host,
+		ids:      []string{"laptop"},
+		clientIP: guestAddr,
+		want:     newWant(internalAddr),
+	}, {
+		name:     "tag",
+		host:     host,
+		tags:     []string{"device_pc", "device_phone"},
+		clientIP: guestAddr,
+		want:     newWant(taggedAddr),
+	}, {
+		name:     "first_group",
+		host:     host,
+		tags:     []string{"device_phone"},
+		clientIP: vpnAddr,
+		want:     newWant(internalAddr),
+	}, {
+		name:     "cname_global",
+		host:     "alias.example.com",
+		clientIP: vpnAddr,
+		want:     newWant(internalAddr),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dnsRewrites := s.MatchRequest(&urlfilter.DNSRequest{
+				ClientTags:        container.NewSortedSliceSet(tc.tags...),
+				ClientIdentifiers: container.NewSortedSliceSet(tc.ids...),
+				ClientIP:          tc.clientIP,
+				Hostname:          tc.host,
+				DNSType:           dns.TypeA,
+			})
+
+			assert.Equal(t, tc.want, dnsRewrites)
+		})
+	}
+}
+
+func TestNewDefaultStorage_badGroups(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		groups     []*Group
+	}{{
+		name:       "no_name",
+		wantErrMsg: "groups: at index 0: name: empty value",
+		groups: []*Group{{
+			Tags: []string{"device_phone"},
+		}},
+	}, {
+		name:       "no_scope",
+		wantErrMsg: "groups: at index 0: clients, tags, or subnets: no value",
+		groups: []*Group{{
+			Name: "vpn",
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `groups: at index 1: name: duplicated value: "vpn"`,
+		groups: []*Group{{
+			Name: "vpn",
+			Tags: []string{"device_phone"},
+		}, {
+			Name:    "vpn",
+			Clients: []string{"laptop"},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDefaultStorage(&Config{
+				Logger: testLogger,
+				Groups: tc.groups,
+				ListID: testListID,
+			})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestNewDefaultStorage_badRewrites(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		rewrites   []*Item
+		groups     []*Group
+	}{{
+		name:       "unknown_type",
+		wantErrMsg: `rewrites: at index 0: type: bad enum value: "NS"`,
+		rewrites: []*Item{{
+			Domain: "example.com",
+			Answer: "ns.example.com",
+			Type:   "NS",
+		}},
+	}, {
+		name:       "no_domain",
+		wantErrMsg: "rewrites: at index 1: domain: empty value",
+		rewrites: []*Item{{
+			Domain: "example.com",
+			Answer: "10 mail.example.com",
+			Type:   "mx",
+		}, {
+			Answer: "1.2.3.4",
+		}},
+	}, {
+		name:       "group",
+		wantErrMsg: `groups: at index 0: rewrites: at index 0: type: bad enum value: "BAD"`,
+		groups: []*Group{{
+			Name: "vpn",
+			Tags: []string{"device_phone"},
+			Rewrites: []*Item{{
+				Domain: "example.com",
+				Answer: "1.2.3.4",
+				Type:   "BAD",
+			}},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDefaultStorage(&Config{
+				Logger:   testLogger,
+				Rewrites: tc.rewrites,
+				Groups:   tc.groups,
+				ListID:   testListID,
+			})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestDefaultStorage_Add_disabled(t *testing.T) {
+	s, err := NewDefaultStorage(&Config{
+		Logger: testLogger,
+		ListID: testListID,
+	})
+	require.NoError(t, err)
+
+	err = s.Add(&Item{Domain: "example.com", Answer: "1.2.3.4", Type: "NS", Enabled: true})
+	testutil.AssertErrorMsg(t, `validating: type: bad enum value: "NS"`, err)
+
+	err = s.Add(&Item{Domain: "example.com", Answer: "1.2.3.4", Enabled: false})
+	require.NoError(t, err)
+
+	dnsRewrites := s.MatchRequest(&urlfilter.DNSRequest{
+		Hostname: "example.com",
+		DNSType:  dns.TypeA,
+	})
+	assert.Empty(t, dnsRewrites)
+	assert.Len(t, s.List(), 1)
+}
@@ -0,0 +1,256 @@
+package filtering
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/urlfilter"
+)
+
+// rewriteGroup is a rewrite group with its rewrites converted into the legacy
+// ones.
+type rewriteGroup struct {
+	// group is the configuration of the group.  It must not be nil.
+	group *rewrite.Group
+
+	// rewrites are the normalized rewrites of the group.
+	rewrites []*LegacyRewrite
+}
+
+// newRewriteGroups validates groups and returns them with their rewrites
+// converted into the normalized legacy ones.
+func newRewriteGroups(
+	ctx context.Context,
+	l *slog.Logger,
+	groups []*rewrite.Group,
+) (rgs []*rewriteGroup, err error) {
+	err = rewrite.ValidateGroups(groups)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	rgs = make([]*rewriteGroup, 0, len(groups))
+	for _, g := range groups {
+		rg := &rewriteGroup{
+			group:    g,
+			rewrites: make([]*LegacyRewrite, 0, len(g.Rewrites)),
+		}
+
+		for i, item := range g.Rewrites {
+			rw := &LegacyRewrite{
+				Domain:     item.Domain,
+				Answer:     item.Answer,
+				RecordType: item.Type,
+				Comment:    item.Comment,
+				TTL:        item.TTL,
+				Enabled:    item.Enabled,
+			}
+
+			err = rw.normalize(ctx, l)
+			if err != nil {
+				return nil, fmt.Errorf("group %q: rewrites: at index %d: %w", g.Name, i, err)
+			}
+
+			rg.rewrites = append(rg.rewrites, rw)
+		}
+
+		rgs = append(rgs, rg)
+	}
+
+	return rgs, nil
+}
+
+// prepareRewriteGroups validates the rewrite groups from the configuration and
+// converts their rewrites.
+func (d *DNSFilter) prepareRewriteGroups(ctx context.Context) (err error) {
+	d.rewriteGroups, err = newRewriteGroups(ctx, d.logger, d.conf.RewriteGroups)
+
+	// Don't wrap the error since it's informative enough as is.
+	return err
+}
+
+// clientRewrites returns the rewrites of the groups matching the client with
+// the given settings in the order of precedence followed by the global
+// rewrites.  setts must not be nil.  d.confMu is expected to be locked.
+func (d *DNSFilter) clientRewrites(setts *Settings) (sets [][]*LegacyRewrite) {
+	if len(d.rewriteGroups) == 0 {
+		return [][]*LegacyRewrite{d.conf.Rewrites}
+	}
+
+	// TODO(f.setrakov): Reuse client tags and identifiers.
+	ufReq := &urlfilter.DNSRequest{
+		ClientTags:        container.NewSortedSliceSet(setts.ClientTags...),
+		ClientIP:          setts.ClientIP,
+		ClientIdentifiers: container.NewSortedSliceSet(setts.ClientName),
+	}
+
+	for _, rg := range d.rewriteGroups {
+		if rg.group.Matches(ufReq) {
+			sets = append(sets, rg.rewrites)
+		}
+	}
+
+	return append(sets, d.conf.Rewrites)
+}
+
+// findRewritesIn returns the matched rewrite entries from the first of sets in
+// which host is matched.  See [findRewrites].
+func findRewritesIn(
+	sets [][]*LegacyRewrite,
+	host string,
+	qtype uint16,
+) (rewrites []*LegacyRewrite, matched bool) {
+	for _, entries := range sets {
+		rewrites, matched = findRewrites(entries, host, qtype)
+		if matched {
+			return rewrites, true
+		}
+	}
+
+	return nil, false
+}
+
+// rewriteGroupJSON is the JSON representation of a [rewrite.Group].
+type rewriteGroupJSON struct {
+	Name     string              `json:"name"`
+	Clients  []string            `json:"clients"`
+	Tags     []string            `json:"tags"`
+	Subnets  []netip.Prefix      `json:"subnets"`
+	Rewrites []*rewriteEntryJSON `json:"rewrites"`
+}
+
+// rewriteGroupsJSON is the request and response body for the rewrite groups
+// HTTP API.
+type rewriteGroupsJSON struct {
+	Groups []*rewriteGroupJSON `json:"groups"`
+}
+
+// newRewriteGroupJSON returns the JSON representation of g.  g must not be
+// nil.
+func newRewriteGroupJSON(g *rewrite.Group) (gj *rewriteGroupJSON) {
+	gj = &rewriteGroupJSON{
+		Name:     g.Name,
+		Clients:  slices.Clone(g.Clients),
+		Tags:     slices.Clone(g.Tags),
+		Subnets:  slices.Clone(g.Subnets),
+		Rewrites: make([]*rewriteEntryJSON, 0, len(g.Rewrites)),
+	}
+
+	for _, item := range g.Rewrites {
+		gj.Rewrites = append(gj.Rewrites, &rewriteEntryJSON{
+			Domain:  item.Domain,
+			Answer:  item.Answer,
+			Type:    item.Type,
+			Comment: item.Comment,
+			TTL:     item.TTL,
+			Enabled: aghalg.BoolToNullBool(item.Enabled),
+		})
+	}
+
+	return gj
+}
+
+// toGroup returns the rewrite group with the data from gj.  The rewrites
+// without the enabled property are enabled.  gj must not be nil.
+func (gj *rewriteGroupJSON) toGroup() (g *rewrite.Group) {
+	g = &rewrite.Group{
+		Name:     gj.Name,
+		Clients:  gj.Clients,
+		Tags:     gj.Tags,
+		Subnets:  gj.Subnets,
+		Rewrites: make([]*rewrite.Item, 0, len(gj.Rewrites)),
+	}
+
+	for _, ent := range gj.Rewrites {
+		if ent == nil {
+			g.Rewrites = append(g.Rewrites, nil)
+
+			continue
+		}
+
+		g.Rewrites = append(g.Rewrites, &rewrite.Item{
+			Domain:  ent.Domain,
+			Answer:  ent.Answer,
+			Type:    ent.Type,
+			Comment: ent.Comment,
+			TTL:     ent.TTL,
+			Enabled: ent.Enabled != aghalg.NBFalse,
+		})
+	}
+
+	return g
+}
+
+// handleRewriteGroups is the handler for the GET /control/rewrite/groups HTTP
+// API.
+func (d *DNSFilter) handleRewriteGroups(w http.ResponseWriter, r *http.Request) {
+	resp := &rewriteGroupsJSON{
+		Groups: []*rewriteGroupJSON{},
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		for _, g := range d.conf.RewriteGroups {
+			resp.Groups = append(resp.Groups, newRewriteGroupJSON(g))
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
+}
+
+// handleRewriteGroupsUpdate is the handler for the PUT
+// /control/rewrite/groups/update HTTP API.
+func (d *DNSFilter) handleRewriteGroupsUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	req := &rewriteGroupsJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	groups := make([]*rewrite.Group, 0, len(req.Groups))
+	for _, gj := range req.Groups {
+		if gj == nil {
+			groups = append(groups, nil)
+
+			continue
+		}
+
+		groups = append(groups, gj.toGroup())
+	}
+
+	rgs, err := newRewriteGroups(ctx, l, groups)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		d.conf.RewriteGroups = groups
+		d.rewriteGroups = rgs
+	}()
+
+	l.DebugContext(ctx, "updated rewrite groups", "num", len(groups))
+
+	d.conf.ConfModifier.Apply(ctx)
+}
@@ -0,0 +1,205 @@
+package filtering
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/agh"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_CheckHost_rewriteGroups(t *testing.T) {
+	var (
+		globalIP  = netip.MustParseAddr("203.0.113.1")
+		vpnIP     = netip.MustParseAddr("10.0.0.1")
+		officeIP  = netip.MustParseAddr("10.0.0.2")
+		printerIP = netip.MustParseAddr("192.168.1.2")
+
+		vpnClientIP = netip.MustParseAddr("10.8.0.5")
+	)
+
+	d, _ := newForTest(t, &Config{
+		RewritesEnabled: true,
+		Rewrites: []*LegacyRewrite{{
+			Domain:  "app.example.com",
+			Answer:  globalIP.String(),
+			Enabled: true,
+		}, {
+			Domain:  "www.example.com",
+			Answer:  "app.example.com",
+			Enabled: true,
+		}},
+		RewriteGroups: []*rewrite.Group{{
+			Name:    "vpn",
+			Subnets: []netip.Prefix{netip.MustParsePrefix("10.8.0.0/24")},
+			Rewrites: []*rewrite.Item{{
+				Domain:  "app.example.com",
+				Answer:  vpnIP.String(),
+				TTL:     60,
+				Enabled: true,
+			}},
+		}, {
+			Name:    "office",
+			Clients: []string{"laptop"},
+			Tags:    []string{"device_pc"},
+			Rewrites: []*rewrite.Item{{
+				Domain:  "app.example.com",
+				Answer:  officeIP.String(),
+				Enabled: true,
+			}, {
+				Domain:  "printer.lan",
+				Answer:  printerIP.String(),
+				Enabled: true,
+			}, {
+				Domain:  "disabled.lan",
+				Answer:  printerIP.String(),
+				Enabled: false,
+			}},
+		}},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	testCases := []struct {
+		name       string
+		host       string
+		clientName string
+		tags       []string
+		clientIP   netip.Addr
+		wantIPs    []netip.Addr
+		wantReason Reason
+		wantTTL    uint32
+	}{{
+		name:       "global",
+		host:       "app.example.com",
+		wantIPs:    []netip.Addr{globalIP},
+		wantReason: Rewritten,
+	}, {
+		name:       "subnet",
+		host:       "app.example.com",
+		clientIP:   vpnClientIP,
+		wantIPs:    []netip.Addr{vpnIP},
+		wantReason: Rewritten,
+		wantTTL:    60,
+	}, {
+		name:       "client",
+		host:       "app.example.com",
+		clientName: "laptop",
+		wantIPs:    []netip.Addr{officeIP},
+		wantReason: Rewritten,
+	}, {
+		name:       "tag",
+		host:       "printer.lan",
+		tags:       []string{"device_pc"},
+		wantIPs:    []netip.Addr{printerIP},
+		wantReason: Rewritten,
+	}, {
+		name:       "precedence",
+		host:       "app.example.com",
+		clientName: "laptop",
+		clientIP:   vpnClientIP,
+		wantIPs:    []netip.Addr{vpnIP},
+		wantReason: Rewritten,
+		wantTTL:    60,
+	}, {
+		name:       "cname_global",
+		host:       "www.example.com",
+		clientIP:   vpnClientIP,
+		wantIPs:    []netip.Addr{vpnIP},
+		wantReason: Rewritten,
+		wantTTL:    60,
+	}, {
+		name:       "other_client",
+		host:       "printer.lan",
+		clientName: "phone",
+		wantIPs:    nil,
+		wantReason: NotFilteredNotFound,
+	}, {
+		name:       "disabled",
+		host:       "disabled.lan",
+		clientName: "laptop",
+		wantIPs:    nil,
+		wantReason: NotFilteredNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setts := &Settings{
+				ClientName:        tc.clientName,
+				ClientIP:          tc.clientIP,
+				ClientTags:        tc.tags,
+				ProtectionEnabled: true,
+				FilteringEnabled:  true,
+			}
+
+			res, err := d.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantReason, res.Reason)
+			assert.Equal(t, tc.wantIPs, res.IPList)
+			assert.Equal(t, tc.wantTTL, res.TTL)
+		})
+	}
+}
+
+func TestDNSFilter_handleRewriteGroupsUpdate(t *testing.T) {
+	d, _ := newForTest(t, &Config{
+		ConfModifier:    agh.EmptyConfigModifier{},
+		RewritesEnabled: true,
+	}, nil)
+	t.Cleanup(d.Close)
+
+	const (
+		validBody = `{"groups":[{"name":"vpn","subnets":["10.8.0.0/24"],` +
+			`"rewrites":[{"domain":"app.example.com","answer":"10.0.0.1"}]}]}`
+		noScopeBody = `{"groups":[{"name":"vpn",` +
+			`"rewrites":[{"domain":"app.example.com","answer":"10.0.0.1"}]}]}`
+		badAnswerBody = `{"groups":[{"name":"vpn","tags":["device_pc"],` +
+			`"rewrites":[{"domain":"app.example.com","answer":"mail","type":"MX"}]}]}`
+	)
+
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{{
+		name:       "valid",
+		body:       validBody,
+		wantStatus: http.StatusOK,
+	}, {
+		name:       "no_scope",
+		body:       noScopeBody,
+		wantStatus: http.StatusBadRequest,
+	}, {
+		name:       "bad_answer",
+		body:       badAnswerBody,
+		wantStatus: http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader([]byte(tc.body)))
+			w := httptest.NewRecorder()
+			d.handleRewriteGroupsUpdate(w, r)
+
+			assert.Equal(t, tc.wantStatus, w.Code)
+		})
+	}
+
+	setts := &Settings{
+		ClientIP:          netip.MustParseAddr("10.8.0.5"),
+		ProtectionEnabled: true,
+		FilteringEnabled:  true,
+	}
+
+	res, err := d.CheckHost("app.example.com", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.Equal(t, Rewritten, res.Reason)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.1")}, res.IPList)
+}
@@ -15,9 +15,38 @@ import (
 type rewriteEntryJSON struct {
 	Domain  string          `json:"domain"`
 	Answer  string          `json:"answer"`
+	Type    string          `json:"type,omitempty"`
+	Comment string          `json:"comment,omitempty"`
+	TTL     uint32          `json:"ttl,omitempty"`
 	Enabled aghalg.NullBool `json:"enabled"`
 }
 
+// newRewriteEntryJSON returns the JSON representation of rw.  rw must not be
+// nil.
+func newRewriteEntryJSON(rw *LegacyRewrite) (ent *rewriteEntryJSON) {
+	return &rewriteEntryJSON{
+		Domain:  rw.Domain,
+		Answer:  rw.Answer,
+		Type:    rw.RecordType,
+		Comment: rw.Comment,
+		TTL:     rw.TTL,
+		Enabled: aghalg.BoolToNullBool(rw.Enabled),
+	}
+}
+
+// toLegacyRewrite returns a legacy rewrite with the data from ent and the given
+// enabled flag.  The result isn't normalized.
+func (ent *rewriteEntryJSON) toLegacyRewrite(enabled bool) (rw *LegacyRewrite) {
+	return &LegacyRewrite{
+		Domain:     ent.Domain,
+		Answer:     ent.Answer,
+		RecordType: ent.Type,
+		Comment:    ent.Comment,
+		TTL:        ent.TTL,
+		Enabled:    enabled,
+	}
+}
+
 // rewriteSettings contains DNS rewrite settings.
 type rewriteSettings struct {
 	// Enabled indicates whether legacy rewrites are applied.
@@ -36,12 +65,7 @@ func (d *DNSFilter) handleRewriteList(w http.ResponseWriter, r *http.Request) {
 		defer d.confMu.RUnlock()
 
 		for _, ent := range d.conf.Rewrites {
-			jsonEnt := rewriteEntryJSON{
-				Domain:  ent.Domain,
-				Answer:  ent.Answer,
-				Enabled: aghalg.BoolToNullBool(ent.Enabled),
-			}
-			arr = append(arr, &jsonEnt)
+			arr = append(arr, newRewriteEntryJSON(ent))
 		}
 	}()
 
@@ -66,16 +90,9 @@ func (d *DNSFilter) handleRewriteAdd(w http.ResponseWriter, r *http.Request) {
 		enabled = rwJSON.Enabled == aghalg.NBTrue
 	}
 
-	rw := &LegacyRewrite{
-		Domain:  rwJSON.Domain,
-		Answer:  rwJSON.Answer,
-		Enabled: enabled,
-	}
-
+	rw := rwJSON.toLegacyRewrite(enabled)
 	err = rw.normalize(ctx, l)
 	if err != nil {
-		// Shouldn't happen currently, since normalize only returns a non-nil
-		// error when a rewrite is nil, but be change-proof.
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "normalizing: %s", err)
 
 		return
@@ -85,12 +102,13 @@ func (d *DNSFilter) handleRewriteAdd(w http.ResponseWriter, r *http.Request) {
 		d.confMu.Lock()
 		defer d.confMu.Unlock()
 
-		d.conf.Rewrites = append(d.conf.Rewrites, rw)
+		d.setRewrites(append(d.conf.Rewrites, rw))
 		l.DebugContext(
 			ctx,
 			"added rewrite element",
 			"domain", rw.Domain,
 			"answer", rw.Answer,
+			"type", rw.RecordType,
 			"rewrites_len", len(d.conf.Rewrites),
 		)
 	}()
@@ -112,10 +130,7 @@ func (d *DNSFilter) handleRewriteDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	entDel := &LegacyRewrite{
-		Domain: jsent.Domain,
-		Answer: jsent.Answer,
-	}
+	entDel := jsent.toLegacyRewrite(false)
 	arr := []*LegacyRewrite{}
 
 	defer d.conf.ConfModifier.Apply(ctx)
@@ -138,7 +153,7 @@ func (d *DNSFilter) handleRewriteDelete(w http.ResponseWriter, r *http.Request)
 		)
 	}
 
-	d.conf.Rewrites = arr
+	d.setRewrites(arr)
 }
 
 // rewriteUpdateJSON is a struct for JSON object with rewrite rule update info.
@@ -161,20 +176,10 @@ func (d *DNSFilter) handleRewriteUpdate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	rwDel := &LegacyRewrite{
-		Domain: updateJSON.Target.Domain,
-		Answer: updateJSON.Target.Answer,
-	}
-
-	rwAdd := &LegacyRewrite{
-		Domain: updateJSON.Update.Domain,
-		Answer: updateJSON.Update.Answer,
-	}
-
+	rwDel := updateJSON.Target.toLegacyRewrite(false)
+	rwAdd := updateJSON.Update.toLegacyRewrite(false)
 	err = rwAdd.normalize(ctx, l)
 	if err != nil {
-		// Shouldn't happen currently, since normalize only returns a non-nil
-		// error when a rewrite is nil, but be change-proof.
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "normalizing: %s", err)
 
 		return
@@ -204,7 +209,7 @@ func (d *DNSFilter) handleRewriteUpdate(w http.ResponseWriter, r *http.Request)
 		rwAdd.Enabled = updateJSON.Update.Enabled == aghalg.NBTrue
 	}
 
-	d.conf.Rewrites = slices.Replace(d.conf.Rewrites, index, index+1, rwAdd)
+	d.setRewrites(slices.Replace(d.conf.Rewrites, index, index+1, rwAdd))
 
 	l.DebugContext(
 		ctx,
@@ -8,8 +8,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/agh"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
@@ -404,3 +406,155 @@ func TestDNSFilter_HandleRewriteSettings(t *testing.T) {
 		assert.JSONEq(t, wantEnabled, w.Body.String())
 	}))
 }
+
+func TestDNSFilter_ReverseRewrite_update(t *testing.T) {
+	const (
+		domain = "nas.lan"
+		answer = "192.168.1.10"
+	)
+
+	addr := netip.MustParseAddr(answer)
+	handlers := make(map[string]http.Handler)
+
+	d, err := filtering.New(&filtering.Config{
+		Logger:       testLogger,
+		ConfModifier: agh.EmptyConfigModifier{},
+		HTTPReg: &aghtest.Registrar{
+			OnRegister: func(_, url string, handler http.HandlerFunc) {
+				handlers[url] = handler
+			},
+		},
+		RewritesEnabled: true,
+	}, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(d.Close)
+
+	d.RegisterFilteringHandlers()
+	require.Contains(t, handlers, addURL)
+	require.Contains(t, handlers, deleteURL)
+
+	_, _, ok := d.ReverseRewrite(addr)
+	require.False(t, ok)
+
+	b, err := json.Marshal(newRewriteJSON(domain, answer, aghalg.NBTrue))
+	require.NoError(t, err)
+
+	require.True(t, t.Run("add", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, addURL, bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		handlers[addURL].ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		host, _, found := d.ReverseRewrite(addr)
+		require.True(t, found)
+
+		assert.Equal(t, domain, host)
+	}))
+
+	require.True(t, t.Run("delete", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, deleteURL, bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		handlers[deleteURL].ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		_, _, found := d.ReverseRewrite(addr)
+		assert.False(t, found)
+	}))
+}
+
+func TestDNSFilter_HandleRewriteImport(t *testing.T) {
+	const (
+		path        = "/control/rewrite/import"
+		pathPreview = path + "/preview"
+	)
+
+	existing := []*rewriteJSON{
+		newRewriteJSON("nas.lan", "192.168.1.10", aghalg.NBTrue),
+		newRewriteJSON("www.lan", "nas.lan", aghalg.NBTrue),
+	}
+
+	confUpdated := false
+	handlers := make(map[string]http.Handler)
+
+	d, err := filtering.New(&filtering.Config{
+		Logger: testLogger,
+		ConfModifier: &aghtest.ConfigModifier{
+			OnApply: func(_ context.Context) {
+				confUpdated = true
+			},
+		},
+		HTTPReg: &aghtest.Registrar{
+			OnRegister: func(_, url string, handler http.HandlerFunc) {
+				handlers[url] = handler
+			},
+		},
+		Rewrites: rewriteEntriesToLegacyRewrites(existing),
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	d.RegisterFilteringHandlers()
+	require.Contains(t, handlers, path)
+	require.Contains(t, handlers, pathPreview)
+
+	reqData, err := json.Marshal(map[string]string{
+		"format": "pihole",
+		"data": "192.168.1.10 nas.lan\n192.168.1.20 www.lan\n192.168.1.30 new.lan\n" +
+			"192.168.1.31 new.lan\nbad\n",
+	})
+	require.NoError(t, err)
+
+	const wantResp = `{
+		"rewrites": [{"domain": "new.lan", "answer": "192.168.1.30", "enabled": true}],
+		"conflicts": [{
+			"existing": {"domain": "www.lan", "answer": "nas.lan", "enabled": true},
+			"imported": {"domain": "www.lan", "answer": "192.168.1.20", "enabled": true}
+		}, {
+			"existing": {"domain": "new.lan", "answer": "192.168.1.30", "enabled": true},
+			"imported": {"domain": "new.lan", "answer": "192.168.1.31", "enabled": true}
+		}],
+		"skipped": ["line 5: want address and hostnames"],
+		"duplicates": 1
+	}`
+
+	require.True(t, t.Run("preview", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, pathPreview, bytes.NewReader(reqData))
+		w := httptest.NewRecorder()
+		handlers[pathPreview].ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.JSONEq(t, wantResp, w.Body.String())
+		assert.False(t, confUpdated)
+
+		assertRewritesList(t, handlers[listURL], existing)
+	}))
+
+	require.True(t, t.Run("import", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(reqData))
+		w := httptest.NewRecorder()
+		handlers[path].ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.JSONEq(t, wantResp, w.Body.String())
+		assert.True(t, confUpdated)
+
+		assertRewritesList(t, handlers[listURL], append(
+			existing,
+			newRewriteJSON("new.lan", "192.168.1.30", aghalg.NBTrue),
+		))
+	}))
+
+	t.Run("bad_format", func(t *testing.T) {
+		r := httptest.NewRequest(
+			http.MethodPost,
+			path,
+			bytes.NewReader([]byte(`{"format":"bind","data":""}`)),
+		)
+		w := httptest.NewRecorder()
+		handlers[path].ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "parsing: format: bad enum value: \"bind\"\n", w.Body.String())
+	})
+}
@@ -0,0 +1,240 @@
+package filtering
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
+	"github.com/miekg/dns"
+)
+
+// rewriteImportJSON is the request to import rewrites from the records of
+// another DNS server.
+type rewriteImportJSON struct {
+	// Format is the format of Data.
+	Format rewrite.Format `json:"format"`
+
+	// Data are the contents of the files to import.
+	Data string `json:"data"`
+}
+
+// rewriteConflictJSON is an imported rewrite conflicting with an existing one.
+type rewriteConflictJSON struct {
+	Existing *rewriteEntryJSON `json:"existing"`
+	Imported *rewriteEntryJSON `json:"imported"`
+}
+
+// rewriteImportResultJSON is the result of importing rewrites.
+type rewriteImportResultJSON struct {
+	// Rewrites are the rewrites that are, or would be, added.
+	Rewrites []*rewriteEntryJSON `json:"rewrites"`
+
+	// Conflicts are the imported rewrites for the same domain and record type
+	// as the existing or previously imported ones but with a different answer.
+	// They aren't added.
+	Conflicts []*rewriteConflictJSON `json:"conflicts"`
+
+	// Skipped are the descriptions of the records that couldn't be converted
+	// into rewrites.
+	Skipped []string `json:"skipped"`
+
+	// Duplicates is the number of imported rewrites that already exist.
+	Duplicates uint `json:"duplicates"`
+}
+
+// parseRewriteImport parses and normalizes the rewrites from req.  The records
+// which can't be converted are described in skipped.
+func (d *DNSFilter) parseRewriteImport(
+	ctx context.Context,
+	req *rewriteImportJSON,
+) (rws []*LegacyRewrite, skipped []string, err error) {
+	items, skippedErrs, err := rewrite.Parse(req.Format, strings.NewReader(req.Data))
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	skipped = make([]string, 0, len(skippedErrs))
+	for _, skipErr := range skippedErrs {
+		skipped = append(skipped, skipErr.Error())
+	}
+
+	for _, item := range items {
+		rw := &LegacyRewrite{
+			Domain:     item.Domain,
+			Answer:     item.Answer,
+			RecordType: item.Type,
+			Comment:    item.Comment,
+			Enabled:    true,
+		}
+
+		err = rw.normalize(ctx, d.logger)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s %s: %s", item.Domain, item.Answer, err))
+
+			continue
+		}
+
+		rws = append(rws, rw)
+	}
+
+	return rws, skipped, nil
+}
+
+// mergeImportedRewrites returns the rewrites from imported which should be
+// added to existing as well as the description of the result.  The imported
+// rewrites conflicting either with the existing ones or with the ones added
+// earlier aren't added.  res.Skipped isn't set.
+func mergeImportedRewrites(
+	existing []*LegacyRewrite,
+	imported []*LegacyRewrite,
+) (added []*LegacyRewrite, res *rewriteImportResultJSON) {
+	res = &rewriteImportResultJSON{
+		Rewrites:  []*rewriteEntryJSON{},
+		Conflicts: []*rewriteConflictJSON{},
+	}
+
+	for _, rw := range imported {
+		if containsRewrite(existing, rw) || containsRewrite(added, rw) {
+			res.Duplicates++
+
+			continue
+		}
+
+		c := findConflict(existing, rw)
+		if c == nil {
+			c = findConflict(added, rw)
+		}
+
+		if c != nil {
+			res.Conflicts = append(res.Conflicts, &rewriteConflictJSON{
+				Existing: newRewriteEntryJSON(c),
+				Imported: newRewriteEntryJSON(rw),
+			})
+
+			continue
+		}
+
+		added = append(added, rw)
+		res.Rewrites = append(res.Rewrites, newRewriteEntryJSON(rw))
+	}
+
+	return added, res
+}
+
+// containsRewrite returns true if rws contain a rewrite with the same domain,
+// record type, and answer as rw.
+func containsRewrite(rws []*LegacyRewrite, rw *LegacyRewrite) (ok bool) {
+	for _, other := range rws {
+		if other.Domain == rw.Domain && other.Type == rw.Type && other.Answer == rw.Answer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findConflict returns the first rewrite from rws for the same domain as rw
+// which answers differently to the same queries.  CNAME rewrites conflict with
+// the rewrites of any type.
+func findConflict(rws []*LegacyRewrite, rw *LegacyRewrite) (c *LegacyRewrite) {
+	for _, other := range rws {
+		if other.Domain != rw.Domain || other.Answer == rw.Answer {
+			continue
+		}
+
+		if other.Type == rw.Type || other.Type == dns.TypeCNAME || rw.Type == dns.TypeCNAME {
+			return other
+		}
+	}
+
+	return nil
+}
+
+// decodeRewriteImport decodes and parses the rewrite import request.  If err is
+// not nil, the error response has already been written.
+func (d *DNSFilter) decodeRewriteImport(
+	w http.ResponseWriter,
+	r *http.Request,
+) (rws []*LegacyRewrite, skipped []string, err error) {
+	ctx := r.Context()
+
+	req := &rewriteImportJSON{}
+	err = json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, d.logger, r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return nil, nil, err
+	}
+
+	rws, skipped, err = d.parseRewriteImport(ctx, req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, d.logger, r, w, http.StatusBadRequest, "parsing: %s", err)
+
+		return nil, nil, err
+	}
+
+	return rws, skipped, nil
+}
+
+// handleRewriteImportPreview is the handler for the POST
+// /control/rewrite/import/preview HTTP API.
+func (d *DNSFilter) handleRewriteImportPreview(w http.ResponseWriter, r *http.Request) {
+	rws, skipped, err := d.decodeRewriteImport(w, r)
+	if err != nil {
+		return
+	}
+
+	var res *rewriteImportResultJSON
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		_, res = mergeImportedRewrites(d.conf.Rewrites, rws)
+	}()
+
+	res.Skipped = skipped
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, res)
+}
+
+// handleRewriteImport is the handler for the POST /control/rewrite/import HTTP
+// API.  The conflicting and duplicate rewrites aren't added.
+func (d *DNSFilter) handleRewriteImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	rws, skipped, err := d.decodeRewriteImport(w, r)
+	if err != nil {
+		return
+	}
+
+	var res *rewriteImportResultJSON
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		var added []*LegacyRewrite
+		added, res = mergeImportedRewrites(d.conf.Rewrites, rws)
+		d.setRewrites(append(d.conf.Rewrites, added...))
+
+		d.logger.DebugContext(
+			ctx,
+			"imported rewrites",
+			"added", len(added),
+			"conflicts", len(res.Conflicts),
+			"rewrites_len", len(d.conf.Rewrites),
+		)
+	}()
+
+	res.Skipped = skipped
+
+	if len(res.Rewrites) > 0 {
+		d.conf.ConfModifier.Apply(ctx)
+	}
+
+	aghhttp.WriteJSONResponseOK(ctx, d.logger, w, r, res)
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/miekg/dns"
 )
 
@@ -21,48 +23,74 @@ import (
 //
 // NOTE:  Keep fields in sync with [cloneRewrites].
 type LegacyRewrite struct {
+	// Value is the parsed value of the record if Type is neither dns.TypeA,
+	// dns.TypeAAAA, nor dns.TypeCNAME.  See [rules.RRValue] and [DNSCAA].
+	Value rules.RRValue `yaml:"-"`
+
 	// Domain is the pattern to which this rewrite applies.
 	Domain string `yaml:"domain"`
 
 	// Answer is the IP address, canonical name, or one of the special
-	// values: "A" or "AAAA".
+	// values: "A" or "AAAA".  For the other record types, it's the value of the
+	// record in the format of the $dnsrewrite rules, for example "10
+	// mail.example.com" for MX records.
 	Answer string `yaml:"answer"`
 
+	// RecordType is the explicit type of the record, for example "MX".  If
+	// it's empty, the type is inferred from Answer, which then must be an IP
+	// address, a canonical name, "A", or "AAAA".
+	RecordType string `yaml:"type,omitempty"`
+
+	// Comment is an arbitrary comment of the administrator.
+	Comment string `yaml:"comment,omitempty"`
+
 	// IP is the IP address that should be used in the response if Type is
 	// dns.TypeA or dns.TypeAAAA.
 	IP netip.Addr `yaml:"-"`
 
-	// Type is the DNS record type: A, AAAA, or CNAME.
+	// TTL is the TTL of the records in seconds.  If it's zero, the TTL of the
+	// blocked responses is used.
+	TTL uint32 `yaml:"ttl,omitempty"`
+
+	// Type is the DNS record type: A, AAAA, CNAME, or one of the
+	// [rewriteRecordTypes].
 	Type uint16 `yaml:"-"`
 
 	// Enabled indicates whether this rewrite is active.
 	Enabled bool `yaml:"enabled"`
 }
 
-// equal returns true if the rw is equal to the other.
+// equal returns true if the rw is equal to the other.  An empty record type of
+// other matches any record type.
 func (rw *LegacyRewrite) equal(other *LegacyRewrite) (ok bool) {
-	return rw.Domain == other.Domain && rw.Answer == other.Answer
+	return rw.Domain == other.Domain &&
+		rw.Answer == other.Answer &&
+		(other.RecordType == "" || strings.EqualFold(rw.RecordType, other.RecordType))
 }
 
 // matchesQType returns true if the entry matches the question type qt.
 func (rw *LegacyRewrite) matchesQType(qt uint16) (ok bool) {
-	// Add CNAMEs, since they match for all types requests.
-	if rw.Type == dns.TypeCNAME {
+	switch rw.Type {
+	case dns.TypeCNAME:
+		// Add CNAMEs, since they match for all types requests.
 		return true
-	}
+	case dns.TypeA, dns.TypeAAAA:
+		// Reject types other than A and AAAA.
+		if qt != dns.TypeA && qt != dns.TypeAAAA {
+			return false
+		}
 
-	// Reject types other than A and AAAA.
-	if qt != dns.TypeA && qt != dns.TypeAAAA {
-		return false
+		// If the types match or the entry is set to allow only the other type,
+		// include them.
+		return rw.Type == qt || rw.IP == netip.Addr{}
+	default:
+		return rw.Type == qt
 	}
-
-	// If the types match or the entry is set to allow only the other type,
-	// include them.
-	return rw.Type == qt || rw.IP == netip.Addr{}
 }
 
 // normalize makes sure that the new or decoded entry is normalized with regards
-// to domain name case, IP length, and so on.
+// to domain name case, IP length, and so on.  It also validates the entries
+// with an explicit record type.
 //
 // If rw is nil, it returns an errors.
 func (rw *LegacyRewrite) normalize(ctx context.Context, l *slog.Logger) (err error) {
@@ -74,15 +102,20 @@ func (rw *LegacyRewrite) normalize(ctx context.Context, l *slog.Logger) (err err
 	// use it in matchDomainWildcard instead of using strings.ToLower
 	// everywhere.
 	rw.Domain = strings.ToLower(rw.Domain)
+	rw.RecordType = strings.ToUpper(rw.RecordType)
+	rw.IP = netip.Addr{}
+	rw.Value = nil
+
+	if rw.RecordType != "" {
+		return rw.normalizeTyped()
+	}
 
 	switch rw.Answer {
 	case "AAAA":
-		rw.IP = netip.Addr{}
 		rw.Type = dns.TypeAAAA
 
 		return nil
 	case "A":
-		rw.IP = netip.Addr{}
 		rw.Type = dns.TypeA
 
 		return nil
@@ -108,6 +141,53 @@ func (rw *LegacyRewrite) normalize(ctx context.Context, l *slog.Logger) (err err
 	return nil
 }
 
+// normalizeTyped normalizes and validates the entry with an explicit record
+// type.  rw.RecordType must be in upper case.
+func (rw *LegacyRewrite) normalizeTyped() (err error) {
+	rr, ok := dns.StringToType[rw.RecordType]
+	if !ok || (rr != dns.TypeA &&
+		rr != dns.TypeAAAA &&
+		rr != dns.TypeCNAME &&
+		!rewriteRecordTypes.Has(rr)) {
+		return fmt.Errorf("type: %w: %q", errors.ErrBadEnumValue, rw.RecordType)
+	} else if rw.Answer == "" {
+		return fmt.Errorf("answer: %w", errors.ErrEmptyValue)
+	}
+
+	rw.Type = rr
+
+	switch rr {
+	case dns.TypeA, dns.TypeAAAA:
+		if rw.Answer == rw.RecordType {
+			// An exception for the type.
+			return nil
+		}
+
+		rw.IP, err = netip.ParseAddr(rw.Answer)
+		if err != nil {
+			return fmt.Errorf("answer: %w", err)
+		} else if rw.IP.Is4() != (rr == dns.TypeA) {
+			return fmt.Errorf("answer: %s is not a valid %s address", rw.IP, rw.RecordType)
+		}
+
+		return nil
+	case dns.TypeCNAME:
+		err = netutil.ValidateHostname(rw.Answer)
+		if err != nil {
+			return fmt.Errorf("answer: %w", err)
+		}
+
+		return nil
+	default:
+		rw.Value, err = parseRewriteValue(rr, rw.Answer)
+		if err != nil {
+			return fmt.Errorf("answer: %w", err)
+		}
+
+		return nil
+	}
+}
+
 // isWildcard returns true if pat is a wildcard domain pattern.
 func isWildcard(pat string) bool {
 	return len(pat) > 1 && pat[0] == '*' && pat[1] == '.'
@@ -142,7 +222,8 @@ func (rw *LegacyRewrite) Compare(b *LegacyRewrite) (res int) {
 	}
 }
 
-// prepareRewrites normalizes and validates all legacy DNS rewrites.
+// prepareRewrites normalizes and validates all legacy DNS rewrites and builds
+// their reverse index.
 func (d *DNSFilter) prepareRewrites(ctx context.Context) (err error) {
 	for i, r := range d.conf.Rewrites {
 		err = r.normalize(ctx, d.logger)
@@ -151,6 +232,8 @@ func (d *DNSFilter) prepareRewrites(ctx context.Context) (err error) {
 		}
 	}
 
+	d.setRewrites(d.conf.Rewrites)
+
 	return nil
 }
 
@@ -205,8 +288,8 @@ func finalizeRewrites(rewrites []*LegacyRewrite) (resRewrites []*LegacyRewrite)
 	return rewrites
 }
 
-// setRewriteResult sets the Reason or IPList of res if necessary.  res must not
-// be nil.
+// setRewriteResult sets the Reason, IPList, DNSRewriteResult, or TTL of res if
+// necessary.  res must not be nil.
 func (d *DNSFilter) setRewriteResult(
 	ctx context.Context,
 	res *Result,
@@ -215,7 +298,11 @@ func (d *DNSFilter) setRewriteResult(
 	qtype uint16,
 ) {
 	for _, rw := range rewrites {
-		if rw.Type == qtype && (qtype == dns.TypeA || qtype == dns.TypeAAAA) {
+		if rw.Type != qtype || qtype == dns.TypeCNAME {
+			continue
+		}
+
+		if qtype == dns.TypeA || qtype == dns.TypeAAAA {
 			if rw.IP == (netip.Addr{}) {
 				// "A"/"AAAA" exception: allow getting from upstream.
 				res.Reason = NotFilteredNotFound
@@ -226,7 +313,29 @@ func (d *DNSFilter) setRewriteResult(
 			res.IPList = append(res.IPList, rw.IP)
 
 			d.logger.DebugContext(ctx, "set a/aaaa rewrite", "host", host, "ans", rw.IP)
+		} else {
+			if res.DNSRewriteResult == nil {
+				res.DNSRewriteResult = &DNSRewriteResult{
+					Response: DNSRewriteResultResponse{},
+					RCode:    dns.RcodeSuccess,
+				}
+			}
+
+			resp := res.DNSRewriteResult.Response
+			resp[qtype] = append(resp[qtype], rw.Value)
+
+			d.logger.DebugContext(ctx, "set rewrite", "host", host, "type", rw.RecordType)
 		}
+
+		setRewriteTTL(res, rw.TTL)
+	}
+}
+
+// setRewriteTTL sets the TTL of res to ttl if it's the lowest explicit TTL of
+// the applied rewrites.  res must not be nil.
+func setRewriteTTL(res *Result, ttl uint32) {
+	if ttl != 0 && (res.TTL == 0 || ttl < res.TTL) {
+		res.TTL = ttl
 	}
 }
 
@@ -235,13 +344,95 @@ func cloneRewrites(entries []*LegacyRewrite) (clone []*LegacyRewrite) {
 	clone = make([]*LegacyRewrite, len(entries))
 	for i, rw := range entries {
 		clone[i] = &LegacyRewrite{
-			Domain:  rw.Domain,
-			Answer:  rw.Answer,
-			IP:      rw.IP,
-			Type:    rw.Type,
-			Enabled: rw.Enabled,
+			Value:      rw.Value,
+			Domain:     rw.Domain,
+			Answer:     rw.Answer,
+			RecordType: rw.RecordType,
+			Comment:    rw.Comment,
+			IP:         rw.IP,
+			TTL:        rw.TTL,
+			Type:       rw.Type,
+			Enabled:    rw.Enabled,
 		}
 	}
 
 	return clone
 }
+
+// rewriteIndex is the reverse index of the legacy rewrites.
+type rewriteIndex struct {
+	// byAddr maps an IP address to the first enabled non-wildcard A or AAAA
+	// rewrite with it as the answer.
+	byAddr map[netip.Addr]*LegacyRewrite
+
+	// hasPTR is true if there are enabled PTR rewrites.
+	hasPTR bool
+}
+
+// newRewriteIndex returns the reverse index of the normalized rewrites.
+func newRewriteIndex(rewrites []*LegacyRewrite) (idx *rewriteIndex) {
+	idx = &rewriteIndex{
+		byAddr: map[netip.Addr]*LegacyRewrite{},
+	}
+
+	for _, rw := range rewrites {
+		if !rw.Enabled {
+			continue
+		}
+
+		idx.hasPTR = idx.hasPTR || rw.Type == dns.TypePTR
+
+		// Only A and AAAA rewrites have the IP address set.
+		if !rw.IP.IsValid() || isWildcard(rw.Domain) {
+			continue
+		}
+
+		if _, ok := idx.byAddr[rw.IP]; !ok {
+			idx.byAddr[rw.IP] = rw
+		}
+	}
+
+	return idx
+}
+
+// setRewrites sets the legacy rewrites and rebuilds their reverse index.
+// rewrites must be normalized.  d.confMu is expected to be locked.
+func (d *DNSFilter) setRewrites(rewrites []*LegacyRewrite) {
+	d.conf.Rewrites = rewrites
+	d.rewriteIdx = newRewriteIndex(rewrites)
+}
+
+// ReverseRewrite returns the host name of the first enabled non-wildcard A or
+// AAAA rewrite with the answer addr as well as its TTL.  ok is false if there
+// is no such rewrite, the rewrites are disabled, or there is an explicit PTR
+// rewrite for addr, which is then applied by [DNSFilter.CheckHost].
+func (d *DNSFilter) ReverseRewrite(addr netip.Addr) (host string, ttl uint32, ok bool) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	if !d.conf.RewritesEnabled {
+		return "", 0, false
+	}
+
+	rw, ok := d.rewriteIdx.byAddr[addr]
+	if !ok {
+		return "", 0, false
+	}
+
+	if d.rewriteIdx.hasPTR {
+		arpa, err := netutil.IPToReversedAddr(addr.AsSlice())
+		if err != nil {
+			// Shouldn't happen, since addr is a valid IP address.
+			return "", 0, false
+		}
+
+		rws, _ := findRewrites(d.conf.Rewrites, arpa, dns.TypePTR)
+		if slices.ContainsFunc(rws, func(r *LegacyRewrite) (found bool) {
+			return r.Type == dns.TypePTR
+		}) {
+			return "", 0, false
+		}
+	}
+
+	return rw.Domain, rw.TTL, true
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/urlfilter/rules"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -237,7 +238,7 @@ func TestRewrites(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			r := d.processRewrites(tc.host, tc.dtyp)
+			r := d.processRewrites(tc.host, tc.dtyp, &Settings{})
 			require.Equalf(t, tc.wantReason, r.Reason, "got %s", r.Reason)
 
 			if tc.wantCName != "" {
@@ -293,7 +294,7 @@ func TestRewritesLevels(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			r := d.processRewrites(tc.host, dns.TypeA)
+			r := d.processRewrites(tc.host, dns.TypeA, &Settings{})
 			assert.Equal(t, Rewritten, r.Reason)
 			require.Len(t, r.IPList, 1)
 		})
@@ -341,7 +342,7 @@ func TestRewritesExceptionCNAME(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			r := d.processRewrites(tc.host, dns.TypeA)
+			r := d.processRewrites(tc.host, dns.TypeA, &Settings{})
 			if tc.want == (netip.Addr{}) {
 				assert.Equal(t, NotFilteredNotFound, r.Reason, "got %s", r.Reason)
 
@@ -439,9 +440,207 @@ func TestRewritesExceptionIP(t *testing.T) {
 				t.SkipNow()
 			}
 
-			r := d.processRewrites(tc.host, tc.dtyp)
+			r := d.processRewrites(tc.host, tc.dtyp, &Settings{})
 			assert.Equal(t, tc.want, r.IPList)
 			assert.Equal(t, tc.wantReason, r.Reason)
 		})
 	}
 }
+
+func TestRewritesTyped(t *testing.T) {
+	d, _ := newForTest(t, nil, nil)
+	t.Cleanup(d.Close)
+
+	d.conf.Rewrites = []*LegacyRewrite{{
+		Domain:     "example.com",
+		Answer:     "10 mail.example.com",
+		RecordType: "mx",
+		TTL:        300,
+		Enabled:    true,
+	}, {
+		Domain:     "example.com",
+		Answer:     "v=spf1 a, mx -all",
+		RecordType: "TXT",
+		Comment:    "SPF",
+		Enabled:    true,
+	}, {
+		Domain:     "example.com",
+		Answer:     `0 issue "letsencrypt.org"`,
+		RecordType: "CAA",
+		Enabled:    true,
+	}, {
+		Domain:     "example.com",
+		Answer:     "1.2.3.4",
+		RecordType: "A",
+		TTL:        60,
+		Enabled:    true,
+	}, {
+		Domain:     "www.example.com",
+		Answer:     "example.com",
+		RecordType: "CNAME",
+		TTL:        30,
+		Enabled:    true,
+	}}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	require.NoError(t, d.prepareRewrites(ctx))
+
+	testCases := []struct {
+		want      any
+		name      string
+		host      string
+		wantCNAME string
+		dtyp      uint16
+		wantTTL   uint32
+	}{{
+		want:      nil,
+		name:      "a",
+		host:      "example.com",
+		wantCNAME: "",
+		dtyp:      dns.TypeA,
+		wantTTL:   60,
+	}, {
+		want:      "v=spf1 a, mx -all",
+		name:      "txt",
+		host:      "example.com",
+		wantCNAME: "",
+		dtyp:      dns.TypeTXT,
+		wantTTL:   0,
+	}, {
+		want: &DNSCAA{
+			Tag:   "issue",
+			Value: "letsencrypt.org",
+			Flag:  0,
+		},
+		name:      "caa",
+		host:      "example.com",
+		wantCNAME: "",
+		dtyp:      dns.TypeCAA,
+		wantTTL:   0,
+	}, {
+		want:      nil,
+		name:      "mx_cname",
+		host:      "www.example.com",
+		wantCNAME: "example.com",
+		dtyp:      dns.TypeMX,
+		wantTTL:   30,
+	}, {
+		want:      nil,
+		name:      "no_srv",
+		host:      "example.com",
+		wantCNAME: "",
+		dtyp:      dns.TypeSRV,
+		wantTTL:   0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := d.processRewrites(tc.host, tc.dtyp, &Settings{})
+			require.Equal(t, Rewritten, r.Reason)
+
+			assert.Equal(t, tc.wantCNAME, r.CanonName)
+			assert.Equal(t, tc.wantTTL, r.TTL)
+
+			if tc.want == nil {
+				return
+			}
+
+			require.NotNil(t, r.DNSRewriteResult)
+
+			assert.Equal(t, []any{tc.want}, r.DNSRewriteResult.Response[tc.dtyp])
+		})
+	}
+
+	t.Run("mx", func(t *testing.T) {
+		r := d.processRewrites("example.com", dns.TypeMX, &Settings{})
+		require.NotNil(t, r.DNSRewriteResult)
+
+		vals := r.DNSRewriteResult.Response[dns.TypeMX]
+		require.Len(t, vals, 1)
+
+		mx := testutil.RequireTypeAssert[*rules.DNSMX](t, vals[0])
+
+		assert.Equal(t, "mail.example.com", mx.Exchange)
+		assert.Equal(t, uint16(10), mx.Preference)
+		assert.Equal(t, uint32(300), r.TTL)
+	})
+}
+
+func TestLegacyRewrite_normalize_typed(t *testing.T) {
+	testCases := []struct {
+		rw         *LegacyRewrite
+		name       string
+		wantErrMsg string
+	}{{
+		rw: &LegacyRewrite{
+			Domain:     "example.com",
+			Answer:     "10 60 5060 sip.example.com",
+			RecordType: "SRV",
+		},
+		name:       "srv",
+		wantErrMsg: "",
+	}, {
+		rw: &LegacyRewrite{
+			Domain:     "example.com",
+			Answer:     "1 . alpn=h2,h3",
+			RecordType: "HTTPS",
+		},
+		name:       "https",
+		wantErrMsg: "",
+	}, {
+		rw: &LegacyRewrite{
+			Domain:     "4.3.2.1.in-addr.arpa",
+			Answer:     "host.example.com",
+			RecordType: "PTR",
+		},
+		name:       "ptr",
+		wantErrMsg: "",
+	}, {
+		rw: &LegacyRewrite{
+			Domain:     "example.com",
+			Answer:     "::1",
+			RecordType: "A",
+		},
+		name:       "bad_a",
+		wantErrMsg: "answer: ::1 is not a valid A address",
+	}, {
+		rw: &LegacyRewrite{
+			Domain:     "example.com",
+			Answer:     "mail.example.com",
+			RecordType: "MX",
+		},
+		name:       "bad_mx",
+		wantErrMsg: `answer: invalid mx: "mail.example.com"`,
+	}, {
+		rw: &LegacyRewrite{
+			Domain:     "example.com",
+			Answer:     "issue letsencrypt.org",
+			RecordType: "CAA",
+		},
+		name:       "bad_caa",
+		wantErrMsg: "answer: caa: want 3 space-separated fields, got 2",
+	}, {
+		rw: &LegacyRewrite{
+			Domain:     "example.com",
+			Answer:     "ns.example.com",
+			RecordType: "NS",
+		},
+		name:       "bad_type",
+		wantErrMsg: `type: bad enum value: "NS"`,
+	}, {
+		rw: &LegacyRewrite{
+			Domain:     "example.com",
+			RecordType: "TXT",
+		},
+		name:       "no_answer",
+		wantErrMsg: "answer: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			err := tc.rw.normalize(ctx, testLogger)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
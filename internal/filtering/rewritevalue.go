@@ -0,0 +1,98 @@
+package filtering
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/urlfilter/rules"
+	"github.com/miekg/dns"
+)
+
+// rewriteRecordTypes are the types of the records legacy rewrites support in
+// addition to A, AAAA, and CNAME.
+var rewriteRecordTypes = container.NewMapSet[rules.RRType](
+	dns.TypeCAA,
+	dns.TypeHTTPS,
+	dns.TypeMX,
+	dns.TypePTR,
+	dns.TypeSRV,
+	dns.TypeTXT,
+)
+
+// DNSCAA is the value of a CAA resource record, see RFC 8659.
+type DNSCAA struct {
+	// Tag is the property tag, for example "issue".
+	Tag string
+
+	// Value is the property value, for example "letsencrypt.org".
+	Value string
+
+	// Flag is the issuer critical flag.
+	Flag uint8
+}
+
+// parseRewriteValue parses the value of a legacy rewrite record of type rr from
+// s.  rr must be within [rewriteRecordTypes].  The values use the format of
+// the $dnsrewrite rules, except for CAA records, which use the format
+// "<flag> <tag> <value>".
+func parseRewriteValue(rr rules.RRType, s string) (v rules.RRValue, err error) {
+	switch rr {
+	case dns.TypeTXT:
+		// Don't parse TXT values, since they may contain the characters
+		// special to the filtering rules.
+		return s, nil
+	case dns.TypeCAA:
+		return parseCAA(s)
+	default:
+		// Go on.
+	}
+
+	// Use a filtering rule to parse the values exactly as the $dnsrewrite
+	// modifier does.
+	text := fmt.Sprintf(
+		"|rewrite.invalid^$dnsrewrite=NOERROR;%s;%s",
+		dns.TypeToString[rr],
+		strings.ReplaceAll(s, ",", `\,`),
+	)
+
+	nr, err := rules.NewNetworkRule(text, 0)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	dnsr := nr.DNSRewrite
+	if dnsr == nil || dnsr.RRType != rr || dnsr.Value == nil {
+		return nil, fmt.Errorf("bad %s value %q", dns.TypeToString[rr], s)
+	}
+
+	return dnsr.Value, nil
+}
+
+// parseCAA parses the value of a CAA record in the "<flag> <tag> <value>"
+// format.  The value may be enclosed in double quotes.
+func parseCAA(s string) (caa *DNSCAA, err error) {
+	parts := strings.SplitN(strings.TrimSpace(s), " ", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("caa: want 3 space-separated fields, got %d", len(parts))
+	}
+
+	flag, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("caa: flag: %w", err)
+	}
+
+	tag := strings.ToLower(parts[1])
+	if tag == "" {
+		return nil, fmt.Errorf("caa: tag: %w", errors.ErrEmptyValue)
+	}
+
+	return &DNSCAA{
+		Tag:   tag,
+		Value: strings.Trim(strings.TrimSpace(parts[2]), `"`),
+		Flag:  uint8(flag),
+	}, nil
+}
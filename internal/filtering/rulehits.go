@@ -0,0 +1,57 @@
+package filtering
+
+import (
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+)
+
+// ruleHitsJSON is the number of matches of a single user rule.
+type ruleHitsJSON struct {
+	// Text is the text of the rule.
+	Text string `json:"text"`
+
+	// Hits is the number of matches of the rule.
+	Hits uint64 `json:"hits"`
+}
+
+// ruleHits returns the numbers of matches of filtering rules.  hits is nil if
+// those aren't available.  complete is false if some of the matched rules may
+// be missing from hits.
+func (d *DNSFilter) ruleHits() (hits map[RuleKey]uint64, complete bool) {
+	if d.conf.RuleHits == nil {
+		return nil, false
+	}
+
+	return d.conf.RuleHits()
+}
+
+// listsHits returns the total numbers of matches of the rules of each filter
+// list.
+func listsHits(hits map[RuleKey]uint64) (listHits map[rulelist.APIID]uint64) {
+	listHits = map[rulelist.APIID]uint64{}
+	for k, n := range hits {
+		listHits[k.FilterListID] += n
+	}
+
+	return listHits
+}
+
+// userRulesHits returns the numbers of matches of each of the user rules.
+// Comments and empty lines are skipped.
+func userRulesHits(userRules []string, hits map[RuleKey]uint64) (res []*ruleHitsJSON) {
+	res = []*ruleHitsJSON{}
+	for _, r := range userRules {
+		r = strings.TrimSpace(r)
+		if r == "" || r[0] == '!' || r[0] == '#' {
+			continue
+		}
+
+		res = append(res, &ruleHitsJSON{
+			Text: r,
+			Hits: hits[RuleKey{Text: r, FilterListID: rulelist.APIIDCustom}],
+		})
+	}
+
+	return res
+}
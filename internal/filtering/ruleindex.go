@@ -0,0 +1,211 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// indexPaths returns the paths to the index of the filter list at filePath and
+// to the file with the rest of its rules, which cannot be indexed.
+func indexPaths(filePath string) (idxPath, restPath string) {
+	base := strings.TrimSuffix(filePath, ".txt")
+
+	return base + ".idx", base + ".rest.txt"
+}
+
+// indexFilters replaces the downloaded filter lists from filters with the
+// lists of their rules that cannot be indexed, if indexing is enabled.  idxs
+// are the indexes of the replaced lists by the name of their filter group, the
+// lists without a group are under the empty name.  The lists, which fail to be
+// indexed, are left as is.
+func (d *DNSFilter) indexFilters(
+	ctx context.Context,
+	filters []Filter,
+) (res []Filter, idxs map[string][]*rulelist.Index) {
+	if !d.conf.RuleIndexEnabled {
+		return filters, nil
+	}
+
+	res = make([]Filter, 0, len(filters))
+	for _, f := range filters {
+		d.rebuild.step()
+
+		if f.FilePath == "" || len(f.Data) != 0 {
+			res = append(res, f)
+
+			continue
+		}
+
+		idx, restPath, err := d.openFilterIndex(ctx, f)
+		if err != nil {
+			d.logger.WarnContext(ctx, "indexing filter", "id", f.ID, slogutil.KeyError, err)
+		}
+
+		if idx == nil {
+			res = append(res, f)
+
+			continue
+		}
+
+		if idxs == nil {
+			idxs = map[string][]*rulelist.Index{}
+		}
+
+		idxs[f.Group] = append(idxs[f.Group], idx)
+		res = append(res, Filter{
+			FilePath: restPath,
+			ID:       f.ID,
+			Group:    f.Group,
+		})
+	}
+
+	return res, idxs
+}
+
+// openFilterIndex opens the index of the filter list f and compiles it first,
+// if necessary.  idx is nil if the list hasn't been downloaded yet.
+func (d *DNSFilter) openFilterIndex(
+	ctx context.Context,
+	f Filter,
+) (idx *rulelist.Index, restPath string, err error) {
+	size, sum, err := fileChecksum(f.FilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	idxPath, restPath := indexPaths(f.FilePath)
+	idx, err = rulelist.OpenIndex(idxPath, f.ID, size, sum)
+	if err == nil {
+		return idx, restPath, nil
+	}
+
+	d.logger.DebugContext(ctx, "compiling index", "id", f.ID, "reason", err)
+
+	err = d.compileIndex(ctx, f.FilePath, idxPath, restPath)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, "", err
+	}
+
+	idx, err = rulelist.OpenIndex(idxPath, f.ID, size, sum)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, "", err
+	}
+
+	return idx, restPath, nil
+}
+
+// fileChecksum returns the size and the CRC-32 checksum of the file at path.
+func fileChecksum(path string) (size uint64, sum uint32, err error) {
+	// #nosec G304 -- Assume that path is always within DataDir.
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error, because it's checked by the caller.
+		return 0, 0, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	h := crc32.NewIEEE()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading filter file: %w", err)
+	}
+
+	// #nosec G115 -- The number of bytes read is never negative.
+	return uint64(n), h.Sum32(), nil
+}
+
+// compileIndex compiles the filter list at filePath into the index at idxPath
+// and the file with the rest of the rules at restPath.
+func (d *DNSFilter) compileIndex(
+	ctx context.Context,
+	filePath string,
+	idxPath string,
+	restPath string,
+) (err error) {
+	// #nosec G304 -- Assume that filePath is always within DataDir.
+	src, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("opening filter file: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, src.Close()) }()
+
+	idxFile, err := aghrenameio.NewPendingFile(idxPath, aghos.DefaultPermFile)
+	if err != nil {
+		return err
+	}
+
+	restFile, err := aghrenameio.NewPendingFile(restPath, aghos.DefaultPermFile)
+	if err != nil {
+		return errors.WithDeferred(err, idxFile.Cleanup())
+	}
+
+	bufPtr := d.bufPool.Get()
+	defer d.bufPool.Put(bufPtr)
+
+	res, err := rulelist.CompileIndex(idxFile, restFile, src, *bufPtr)
+
+	// Replace the file with the rest of the rules first, so that the index is
+	// only considered up to date when both files are.
+	err = aghrenameio.WithDeferredCleanup(err, restFile)
+	err = aghrenameio.WithDeferredCleanup(err, idxFile)
+	if err != nil {
+		return err
+	}
+
+	d.logger.InfoContext(
+		ctx,
+		"compiled index",
+		"path", idxPath,
+		"indexed_rules", res.IndexedRulesCount,
+		"rest_rules", res.RestRulesCount,
+	)
+
+	return nil
+}
+
+// removeIndex removes the index files of the filter list cached at filePath, if
+// any.
+func (d *DNSFilter) removeIndex(ctx context.Context, filePath string) {
+	idxPath, restPath := indexPaths(filePath)
+	for _, p := range []string{idxPath, restPath} {
+		err := os.Remove(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			d.logger.WarnContext(ctx, "removing index", "path", p, slogutil.KeyError, err)
+		}
+	}
+}
+
+// appendIndexes appends idxs to engs and returns the result.
+func appendIndexes(engs []dnsMatcher, idxs []*rulelist.Index) (res []dnsMatcher) {
+	res = engs
+	for _, idx := range idxs {
+		res = append(res, idx)
+	}
+
+	return res
+}
+
+// closeIndexes closes idxs and returns the joined error, if any.
+func closeIndexes(idxs []*rulelist.Index) (err error) {
+	var errs []error
+	for _, idx := range idxs {
+		errs = append(errs, idx.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,137 @@
+package filtering
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_CheckHost_ruleIndex(t *testing.T) {
+	const (
+		blockRules = "||blocked.example^\n" +
+			"0.0.0.0 hosts.example\n" +
+			"||important.example^$important\n" +
+			"||unblocked.example^\n"
+		allowRules = "@@||sub.blocked.example^\n" +
+			"@@||important.example^\n"
+		customRules = "@@||unblocked.example^\n"
+	)
+
+	dataDir := t.TempDir()
+	blockPath := filepath.Join(dataDir, "1.txt")
+	allowPath := filepath.Join(dataDir, "2.txt")
+
+	err := os.WriteFile(blockPath, []byte(blockRules), 0o600)
+	require.NoError(t, err)
+
+	err = os.WriteFile(allowPath, []byte(allowRules), 0o600)
+	require.NoError(t, err)
+
+	d, setts := newForTest(t, &Config{
+		DataDir:          dataDir,
+		RuleIndexEnabled: true,
+	}, nil)
+	t.Cleanup(d.Close)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	err = d.setFilters(ctx, []Filter{{
+		ID:   0,
+		Data: []byte(customRules),
+	}, {
+		ID:       1,
+		FilePath: blockPath,
+	}}, []Filter{{
+		ID:       2,
+		FilePath: allowPath,
+	}}, false)
+	require.NoError(t, err)
+
+	e := d.acquireEngines()
+	require.NotNil(t, e)
+
+	assert.Len(t, e.indexes, 1)
+	assert.Len(t, e.indexesAllow, 1)
+
+	e.release()
+
+	assert.FileExists(t, filepath.Join(dataDir, "1.idx"))
+
+	rest, err := os.ReadFile(filepath.Join(dataDir, "1.rest.txt"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "||important.example^$important\n", string(rest))
+
+	testCases := []struct {
+		name       string
+		host       string
+		wantRule   string
+		wantReason Reason
+	}{{
+		name:       "blocked",
+		host:       "blocked.example",
+		wantRule:   "||blocked.example^",
+		wantReason: FilteredBlockList,
+	}, {
+		name:       "subdomain",
+		host:       "other.blocked.example",
+		wantRule:   "||blocked.example^",
+		wantReason: FilteredBlockList,
+	}, {
+		name:       "allowlist",
+		host:       "sub.blocked.example",
+		wantRule:   "@@||sub.blocked.example^",
+		wantReason: NotFilteredAllowList,
+	}, {
+		name:       "hosts",
+		host:       "hosts.example",
+		wantRule:   "0.0.0.0 hosts.example",
+		wantReason: FilteredBlockList,
+	}, {
+		name:       "custom_exception",
+		host:       "unblocked.example",
+		wantRule:   "@@||unblocked.example^",
+		wantReason: NotFilteredAllowList,
+	}, {
+		name:       "not_found",
+		host:       "example.org",
+		wantRule:   "",
+		wantReason: NotFilteredNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, cErr := d.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, cErr)
+
+			assert.Equal(t, tc.wantReason, res.Reason)
+			if tc.wantRule == "" {
+				assert.Empty(t, res.Rules)
+
+				return
+			}
+
+			require.NotEmpty(t, res.Rules)
+
+			assert.Equal(t, tc.wantRule, res.Rules[0].Text)
+		})
+	}
+
+	t.Run("outdated", func(t *testing.T) {
+		err = os.WriteFile(blockPath, []byte("||new.example^\n"), 0o600)
+		require.NoError(t, err)
+
+		err = d.setFilters(ctx, []Filter{{
+			ID:       1,
+			FilePath: blockPath,
+		}}, nil, false)
+		require.NoError(t, err)
+
+		d.checkMatch(t, "new.example", setts)
+		d.checkMatchEmpty(t, "blocked.example", setts)
+	})
+}
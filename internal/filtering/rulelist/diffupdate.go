@@ -0,0 +1,307 @@
+package rulelist
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// maxPatches is the maximum number of differential update patches applied
+// during a single update of a filter list.  It protects from patches referring
+// to each other in a loop.
+const maxPatches = 100
+
+// fullUpdateIvl is the maximum period between the downloads of the whole
+// filter list supporting differential updates.  The patches may expire earlier
+// according to the header of the list.
+const fullUpdateIvl = 7 * timeutil.Day
+
+// errNoPatch is returned when the next differential update patch is empty,
+// meaning that the filter list is up to date.
+const errNoPatch errors.Error = "no patch available"
+
+// RawPath returns the path to the unprocessed copy of the contents of the
+// rule-list filter with the given UID.  The copy is only kept for the remote
+// lists supporting differential updates, since the patches refer to the lines
+// of the original list, while the file at [Storage.CachePath] has comments and
+// empty lines removed.  The modification time of the copy is the time of the
+// last download of the whole list, since it's kept when the patches are
+// applied.
+func (s *Storage) RawPath(uid UID) (p string) {
+	return strings.TrimSuffix(s.CachePath(uid), ".txt") + ".raw.txt"
+}
+
+// newRawCopy returns a pending file for the unprocessed copy of the contents of
+// f.  file is nil if f is a local file, since those aren't updated with
+// patches.
+func (s *Storage) newRawCopy(f *Filter) (file aghrenameio.PendingFile, err error) {
+	if f.isLocal() {
+		return nil, nil
+	}
+
+	file, err = aghrenameio.NewPendingFile(s.RawPath(f.uid), aghos.DefaultPermFile)
+	if err != nil {
+		return nil, fmt.Errorf("creating raw copy: %w", err)
+	}
+
+	return file, nil
+}
+
+// finalizeRawCopy saves the unprocessed copy of the contents of f if the list
+// supports differential updates and removes it otherwise.  res and returned are
+// the results of parsing the contents.
+func (s *Storage) finalizeRawCopy(
+	ctx context.Context,
+	file aghrenameio.PendingFile,
+	f *Filter,
+	res *ParseResult,
+	returned error,
+) (err error) {
+	if returned != nil {
+		return aghrenameio.WithDeferredCleanup(returned, file)
+	}
+
+	if res.DiffPath == "" {
+		s.removeRawCopy(ctx, f.uid)
+
+		return errors.Annotate(file.Cleanup(), "cleaning up raw copy: %w")
+	}
+
+	return errors.Annotate(file.CloseReplace(), "saving raw copy: %w")
+}
+
+// removeRawCopy removes the unprocessed copy of the contents of the rule-list
+// filter with the given UID, if any, so that the next update downloads the
+// whole list.
+func (s *Storage) removeRawCopy(ctx context.Context, uid UID) {
+	p := s.RawPath(uid)
+	err := os.Remove(p)
+	if err == nil {
+		return
+	}
+
+	lvl := slog.LevelWarn
+	if errors.Is(err, os.ErrNotExist) {
+		lvl = slog.LevelDebug
+	}
+
+	s.logger.Log(ctx, lvl, "removing raw copy", "uid", uid, "path", p, slogutil.KeyError, err)
+}
+
+// updateWithPatches tries to update f using the differential update patches.
+// It returns true in handled if the update has been performed this way, and ok
+// if the rules have changed as a result.  If handled is false, the whole list
+// should be downloaded, which is also the case when the patches have expired.
+//
+// See https://github.com/ameshkov/diffupdates.
+func (s *Storage) updateWithPatches(ctx context.Context, f *Filter) (ok, handled bool) {
+	if f.isLocal() {
+		return false, false
+	}
+
+	l := s.logger.With("uid", f.uid, "url", f.url)
+
+	rawPath := s.RawPath(f.uid)
+	fi, err := os.Stat(rawPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, false
+	} else if err != nil {
+		l.WarnContext(ctx, "checking raw copy", slogutil.KeyError, err)
+
+		return false, false
+	}
+
+	// #nosec G304 -- Assume that the path is always within cacheDir.
+	raw, err := os.ReadFile(rawPath)
+	if err != nil {
+		l.WarnContext(ctx, "reading raw copy", slogutil.KeyError, err)
+
+		return false, false
+	}
+
+	fullUpdated := fi.ModTime()
+	if s.patchesExpired(raw, fullUpdated) {
+		l.DebugContext(ctx, "patches expired; downloading whole list", "full_updated", fullUpdated)
+
+		return false, false
+	}
+
+	raw, applied, err := s.applyPatches(ctx, f.url, raw)
+	if err != nil {
+		l.WarnContext(ctx, "applying patches; downloading whole list", slogutil.KeyError, err)
+
+		return false, false
+	} else if applied == 0 {
+		l.DebugContext(ctx, "no new patches")
+
+		return false, true
+	}
+
+	l.DebugContext(ctx, "applied patches", "num", applied)
+
+	ok, err = s.savePatched(ctx, f, raw, fullUpdated)
+	if err != nil {
+		l.WarnContext(ctx, "saving patched list; downloading whole list", slogutil.KeyError, err)
+
+		return false, false
+	}
+
+	return ok, true
+}
+
+// patchesExpired returns true if the whole list with the unprocessed contents
+// raw, last downloaded at fullUpdated, should be downloaded again instead of
+// being patched.
+func (s *Storage) patchesExpired(raw []byte, fullUpdated time.Time) (ok bool) {
+	bufPtr := s.bufPool.Get()
+	defer s.bufPool.Put(bufPtr)
+
+	ivl := fullUpdateIvl
+	h, err := ParseDiffHeader(bytes.NewReader(raw), *bufPtr)
+	if err == nil && h.Expires > 0 {
+		ivl = min(ivl, h.Expires)
+	}
+
+	return time.Since(fullUpdated) >= ivl
+}
+
+// applyPatches downloads and applies the consecutive patches to raw, which is
+// the unprocessed contents of the list with the given URL.  applied is the
+// number of applied patches.
+func (s *Storage) applyPatches(
+	ctx context.Context,
+	listURL *url.URL,
+	raw []byte,
+) (res []byte, applied int, err error) {
+	bufPtr := s.bufPool.Get()
+	defer s.bufPool.Put(bufPtr)
+
+	diffPath, err := DiffPath(bytes.NewReader(raw), *bufPtr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for ; diffPath != "" && applied < maxPatches; applied++ {
+		var patch []byte
+		var resource string
+		patch, resource, err = s.fetchPatch(ctx, listURL, diffPath)
+		if errors.Is(err, errNoPatch) {
+			break
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("patch %q: %w", diffPath, err)
+		}
+
+		raw, err = ApplyPatch(raw, patch, resource)
+		if err != nil {
+			return nil, 0, fmt.Errorf("patch %q: %w", diffPath, err)
+		}
+
+		diffPath, err = DiffPath(bytes.NewReader(raw), *bufPtr)
+		if err != nil {
+			return nil, 0, fmt.Errorf("patch %q: %w", diffPath, err)
+		}
+	}
+
+	return raw, applied, nil
+}
+
+// fetchPatch downloads the patch at diffPath, which is relative to listURL.
+// resource is the name of the list within a batch patch, if any.  err is
+// [errNoPatch] if the patch is empty, meaning that it isn't available yet.
+func (s *Storage) fetchPatch(
+	ctx context.Context,
+	listURL *url.URL,
+	diffPath string,
+) (patch []byte, resource string, err error) {
+	ref, err := url.Parse(diffPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing diff path: %w", err)
+	}
+
+	u := listURL.ResolveReference(ref)
+	resource, u.Fragment = u.Fragment, ""
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating request: %w", err)
+	}
+
+	// #nosec G704 -- Trust the URL of the list explicitly given by the user.
+	resp, err := s.httpCli.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, "", err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		// A missing patch means that the list has been changed in a way the
+		// patches can't describe, so the whole list should be downloaded.
+		return nil, "", fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	patch, err = io.ReadAll(ioutil.LimitReader(resp.Body, s.maxSize.Bytes()))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading patch: %w", err)
+	} else if len(bytes.TrimSpace(patch)) == 0 {
+		// An empty patch means that there are no changes yet.
+		return nil, "", errNoPatch
+	}
+
+	return patch, resource, nil
+}
+
+// savePatched saves the patched unprocessed contents of f along with the
+// processed ones.  fullUpdated is the time of the last download of the whole
+// list, which is kept as the modification time of the unprocessed copy.  ok is
+// true if the rules have changed.
+func (s *Storage) savePatched(
+	ctx context.Context,
+	f *Filter,
+	raw []byte,
+	fullUpdated time.Time,
+) (ok bool, err error) {
+	var res *ParseResult
+
+	tmpFile, err := aghrenameio.NewPendingFile(s.CachePath(f.uid), aghos.DefaultPermFile)
+	if err != nil {
+		return false, err
+	}
+	defer func() { err = s.finalizeUpdate(ctx, tmpFile, f, res, err, ok) }()
+
+	rawFile, err := s.newRawCopy(f)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = rawFile.Write(raw)
+	if err != nil {
+		return false, aghrenameio.WithDeferredCleanup(fmt.Errorf("writing raw copy: %w", err), rawFile)
+	}
+
+	bufPtr := s.bufPool.Get()
+	defer s.bufPool.Put(bufPtr)
+
+	res, err = NewParser().Parse(tmpFile, bytes.NewReader(raw), *bufPtr)
+	err = s.finalizeRawCopy(ctx, rawFile, f, res, err)
+	if err == nil && res.DiffPath != "" {
+		err = os.Chtimes(s.RawPath(f.uid), fullUpdated, fullUpdated)
+		err = errors.Annotate(err, "keeping raw copy time: %w")
+	}
+
+	return err == nil && res.Checksum != f.checksum(), err
+}
@@ -0,0 +1,208 @@
+package rulelist_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_RefreshFilter_patches(t *testing.T) {
+	t.Parallel()
+
+	const (
+		listV1 = "! Title: Test\n" +
+			"! Diff-Path: patches/v1.patch\n" +
+			"||one.example^\n" +
+			"||two.example^\n"
+
+		listV2 = "! Title: Test\n" +
+			"! Diff-Path: patches/v2.patch\n" +
+			"||one.example^\n" +
+			"||three.example^\n" +
+			"||four.example^\n"
+
+		patchV1 = "d2 1\n" +
+			"a2 1\n" +
+			"! Diff-Path: patches/v2.patch\n" +
+			"d4 1\n" +
+			"a4 2\n" +
+			"||three.example^\n" +
+			"||four.example^\n"
+	)
+
+	var listReqs, patchReqs atomic.Int32
+	var patchAvailable atomic.Bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/list.txt", func(w http.ResponseWriter, _ *http.Request) {
+		listReqs.Add(1)
+		_, _ = w.Write([]byte(listV1))
+	})
+	mux.HandleFunc("/patches/v1.patch", func(w http.ResponseWriter, _ *http.Request) {
+		patchReqs.Add(1)
+		if patchAvailable.Load() {
+			_, _ = w.Write([]byte(patchV1))
+		}
+	})
+	mux.HandleFunc("/patches/v2.patch", func(_ http.ResponseWriter, _ *http.Request) {
+		patchReqs.Add(1)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	listURL, err := url.Parse(srv.URL + "/list.txt")
+	require.NoError(t, err)
+
+	f := newFilter(t, listURL, "")
+	uid := f.UID()
+	strg := newStorage(t, t.TempDir(), f)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	ok, err := strg.RefreshFilter(ctx, uid)
+	require.NoError(t, err)
+
+	assert.True(t, ok)
+	assert.Equal(t, 2, f.State().RulesCount)
+	assert.Equal(t, int32(1), listReqs.Load())
+
+	raw, err := os.ReadFile(strg.RawPath(uid))
+	require.NoError(t, err)
+
+	assert.Equal(t, listV1, string(raw))
+
+	t.Run("no_patch", func(t *testing.T) {
+		ok, err = strg.RefreshFilter(ctx, uid)
+		require.NoError(t, err)
+
+		assert.False(t, ok)
+		assert.Equal(t, int32(1), listReqs.Load())
+		assert.Equal(t, int32(1), patchReqs.Load())
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		patchAvailable.Store(true)
+
+		fi, statErr := os.Stat(strg.RawPath(uid))
+		require.NoError(t, statErr)
+
+		ok, err = strg.RefreshFilter(ctx, uid)
+		require.NoError(t, err)
+
+		assert.True(t, ok)
+		assert.Equal(t, 3, f.State().RulesCount)
+		assert.Equal(t, int32(1), listReqs.Load())
+		assert.Equal(t, int32(3), patchReqs.Load())
+
+		raw, err = os.ReadFile(strg.RawPath(uid))
+		require.NoError(t, err)
+
+		assert.Equal(t, listV2, string(raw))
+
+		// The time of the last download of the whole list is kept.
+		patchedFI, statErr := os.Stat(strg.RawPath(uid))
+		require.NoError(t, statErr)
+
+		assert.Equal(t, fi.ModTime(), patchedFI.ModTime())
+
+		err = strg.Load(ctx, uid)
+		require.NoError(t, err)
+
+		assert.Equal(t, 3, f.State().RulesCount)
+	})
+
+	t.Run("bad_patch", func(t *testing.T) {
+		mux.HandleFunc("/patches/bad.patch", func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("d100 1\n"))
+		})
+
+		err = os.WriteFile(
+			strg.RawPath(uid),
+			[]byte("! Diff-Path: patches/bad.patch\n||one.example^\n"),
+			0o600,
+		)
+		require.NoError(t, err)
+
+		// The whole list is downloaded instead.
+		ok, err = strg.RefreshFilter(ctx, uid)
+		require.NoError(t, err)
+
+		assert.True(t, ok)
+		assert.Equal(t, 2, f.State().RulesCount)
+		assert.Equal(t, int32(2), listReqs.Load())
+	})
+
+	t.Run("patch_not_found", func(t *testing.T) {
+		err = os.WriteFile(
+			strg.RawPath(uid),
+			[]byte("! Diff-Path: patches/missing.patch\n||one.example^\n"),
+			0o600,
+		)
+		require.NoError(t, err)
+
+		// The whole list is downloaded instead.
+		_, err = strg.RefreshFilter(ctx, uid)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(3), listReqs.Load())
+	})
+
+	testCases := []struct {
+		name    string
+		header  string
+		fullAge time.Duration
+	}{{
+		name:    "full_update_ivl",
+		header:  "",
+		fullAge: 7*timeutil.Day + time.Hour,
+	}, {
+		name:    "diff_expires",
+		header:  "! Diff-Expires: 1 hours\n",
+		fullAge: 2 * time.Hour,
+	}}
+
+	for _, tc := range testCases {
+		t.Run("expired_"+tc.name, func(t *testing.T) {
+			rawPath := strg.RawPath(uid)
+			err = os.WriteFile(rawPath, []byte(tc.header+listV1), 0o600)
+			require.NoError(t, err)
+
+			fullUpdated := time.Now().Add(-tc.fullAge)
+			err = os.Chtimes(rawPath, fullUpdated, fullUpdated)
+			require.NoError(t, err)
+
+			wantListReqs := listReqs.Load() + 1
+			wantPatchReqs := patchReqs.Load()
+
+			// The whole list is downloaded instead of being patched.
+			_, err = strg.RefreshFilter(ctx, uid)
+			require.NoError(t, err)
+
+			assert.Equal(t, wantListReqs, listReqs.Load())
+			assert.Equal(t, wantPatchReqs, patchReqs.Load())
+		})
+	}
+
+	t.Run("no_diff_path", func(t *testing.T) {
+		_, srvURL := newFilterLocations(t, t.TempDir(), "", testRuleTextBlocked)
+
+		// Setting a filter with another URL removes the raw copy.
+		strg.Set(ctx, newFilterWithUID(t, srvURL, uid))
+		assert.NoFileExists(t, strg.RawPath(uid))
+
+		ok, err = strg.RefreshFilter(ctx, uid)
+		require.NoError(t, err)
+
+		assert.True(t, ok)
+		assert.NoFileExists(t, strg.RawPath(uid))
+	})
+}
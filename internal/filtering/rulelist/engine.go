@@ -4,14 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"sync"
 
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/urlfilter"
 	"github.com/AdguardTeam/urlfilter/filterlist"
-	"github.com/c2h5oh/datasize"
 )
 
 // Engine is a single DNS filter based on one or more rule lists.  This
@@ -99,24 +97,15 @@ func (e *Engine) currentEngine() (engine *urlfilter.DNSEngine) {
 	return e.engine
 }
 
-// Refresh updates all rule lists in e.  ctx is used for cancellation.
-// parseBuf, cli, cacheDir, and maxSize are used for updates of rule-list
-// filters; see [Filter.Refresh].
-//
-// TODO(a.garipov): Unexport and test in an internal test or through engine
-// tests.
-func (e *Engine) Refresh(
-	ctx context.Context,
-	parseBuf []byte,
-	cli *http.Client,
-	cacheDir string,
-	maxSize datasize.ByteSize,
-) (err error) {
+// Refresh updates all enabled rule lists in e using s and recompiles the
+// engine from their cached contents.  ctx is used for cancellation.  The rule
+// lists need not be added to s.
+func (e *Engine) Refresh(ctx context.Context, s *Storage) (err error) {
 	defer func() { err = errors.Annotate(err, "updating engine %q: %w", e.name) }()
 
 	var filtersToRefresh []*Filter
 	for _, f := range e.filters {
-		if f.enabled {
+		if f.Enabled() {
 			filtersToRefresh = append(filtersToRefresh, f)
 		}
 	}
@@ -128,17 +117,14 @@ func (e *Engine) Refresh(
 	}
 
 	engRefr := &engineRefresh{
-		logger:   e.logger,
-		httpCli:  cli,
-		cacheDir: cacheDir,
-		parseBuf: parseBuf,
-		maxSize:  maxSize,
+		logger:  e.logger,
+		storage: s,
 	}
 
 	ruleLists, errs := engRefr.process(ctx, filtersToRefresh)
 	if isOneTimeoutError(errs) {
 		// Don't wrap the error since it's informative enough as is.
-		return err
+		return errs[0]
 	}
 
 	storage, err := filterlist.NewRuleStorage(ruleLists)
@@ -186,18 +172,15 @@ func isOneTimeoutError(errs []error) (ok bool) {
 
 // engineRefresh represents a single ongoing engine refresh.
 type engineRefresh struct {
-	logger   *slog.Logger
-	httpCli  *http.Client
-	cacheDir string
-	parseBuf []byte
-	maxSize  datasize.ByteSize
+	logger  *slog.Logger
+	storage *Storage
 }
 
-// process runs updates of all given rule-list filters.  All errors are logged
-// as they appear, since the update can take a significant amount of time.
-// errs contains all errors that happened during the update, unless the context
-// is canceled or its deadline is reached, in which case errs will only contain
-// a single timeout error.
+// process runs updates of all given rule-list filters and opens their cached
+// contents.  All errors are logged as they appear, since the update can take a
+// significant amount of time.  errs contains all errors that happened during
+// the update, unless the context is canceled or its deadline is reached, in
+// which case errs will only contain a single timeout error.
 //
 // TODO(a.garipov): Think of a better way to communicate the timeout condition?
 func (r *engineRefresh) process(
@@ -208,14 +191,16 @@ func (r *engineRefresh) process(
 	for i, f := range filters {
 		select {
 		case <-ctx.Done():
+			closeRuleLists(ctx, r.logger, ruleLists)
+
 			return nil, []error{fmt.Errorf("timeout after updating %d filters: %w", i, ctx.Err())}
 		default:
 			// Go on.
 		}
 
-		err := r.processFilter(ctx, f)
+		rl, err := r.processFilter(ctx, f)
 		if err == nil {
-			ruleLists = append(ruleLists, f.ruleList)
+			ruleLists = append(ruleLists, rl)
 
 			continue
 		}
@@ -235,27 +220,46 @@ func (r *engineRefresh) process(
 	return ruleLists, errs
 }
 
-// processFilter runs an update of a single rule-list filter.
-func (r *engineRefresh) processFilter(ctx context.Context, f *Filter) (err error) {
-	prevChecksum := f.checksum
-	parseRes, err := f.Refresh(ctx, r.parseBuf, r.httpCli, r.cacheDir, r.maxSize)
+// processFilter runs an update of a single rule-list filter and opens its
+// cached contents.
+func (r *engineRefresh) processFilter(
+	ctx context.Context,
+	f *Filter,
+) (rl filterlist.Interface, err error) {
+	updated, err := r.storage.refresh(ctx, f)
 	if err != nil {
-		return fmt.Errorf("updating %s: %w", f.uid, err)
+		// Don't wrap the error since it's a *FilterError already.
+		return nil, err
 	}
 
-	if prevChecksum == parseRes.Checksum {
+	if updated {
+		st := f.State()
+		r.logger.InfoContext(ctx, "filter updated", "uid", f.uid, "rules", st.RulesCount)
+	} else {
 		r.logger.InfoContext(ctx, "no change in filter", "uid", f.uid)
+	}
 
-		return nil
+	rl, err = filterlist.NewFile(&filterlist.FileConfig{
+		ID:             f.urlFilterID,
+		Path:           r.storage.CachePath(f.uid),
+		IgnoreCosmetic: true,
+	})
+	if err != nil {
+		return nil, &FilterError{
+			Err: fmt.Errorf("opening rule list: %w", err),
+			UID: f.uid,
+		}
 	}
 
-	r.logger.InfoContext(
-		ctx,
-		"filter updated",
-		"uid", f.uid,
-		"bytes", parseRes.BytesWritten,
-		"rules", parseRes.RulesCount,
-	)
+	return rl, nil
+}
 
-	return nil
+// closeRuleLists closes ruleLists and logs the errors, if any.
+func closeRuleLists(ctx context.Context, l *slog.Logger, ruleLists []filterlist.Interface) {
+	for _, rl := range ruleLists {
+		err := rl.Close()
+		if err != nil {
+			l.WarnContext(ctx, "closing rule list", slogutil.KeyError, err)
+		}
+	}
 }
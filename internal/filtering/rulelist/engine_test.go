@@ -1,11 +1,14 @@
 package rulelist_test
 
 import (
-	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil/urlutil"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/AdguardTeam/urlfilter"
 	"github.com/miekg/dns"
@@ -31,13 +34,8 @@ func TestEngine_Refresh(t *testing.T) {
 	require.NotNil(t, eng)
 	testutil.CleanupAndRequireSuccess(t, eng.Close)
 
-	buf := make([]byte, rulelist.DefaultRuleBufSize)
-	cli := &http.Client{
-		Timeout: testTimeout,
-	}
-
 	ctx := testutil.ContextWithTimeout(t, testTimeout)
-	err := eng.Refresh(ctx, buf, cli, cacheDir, rulelist.DefaultMaxRuleListSize)
+	err := eng.Refresh(ctx, newStorage(t, cacheDir))
 	require.NoError(t, err)
 
 	fltReq := &urlfilter.DNSRequest{
@@ -62,3 +60,50 @@ func TestEngine_Refresh(t *testing.T) {
 
 	require.NotNil(t, fltRes)
 }
+
+func TestEngine_Refresh_filterError(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+
+	fileURL, _ := newFilterLocations(t, cacheDir, testRuleTextBlocked, "")
+
+	okFlt := newFilter(t, fileURL, "Good Filter")
+
+	uid := rulelist.MustNewUID()
+	badFlt, err := rulelist.NewFilter(&rulelist.FilterConfig{
+		URL: &url.URL{
+			Scheme: urlutil.SchemeFile,
+			Path:   filepath.Join(cacheDir, "nonexistent.txt"),
+		},
+		Name:        "Bad Filter",
+		UID:         uid,
+		URLFilterID: newURLFilterID(),
+		Enabled:     true,
+	})
+	require.NoError(t, err)
+
+	eng := rulelist.NewEngine(&rulelist.EngineConfig{
+		Logger:  slogutil.NewDiscardLogger(),
+		Name:    "Engine",
+		Filters: []*rulelist.Filter{okFlt, badFlt},
+	})
+	testutil.CleanupAndRequireSuccess(t, eng.Close)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	err = eng.Refresh(ctx, newStorage(t, cacheDir))
+	require.Error(t, err)
+
+	fltErr := &rulelist.FilterError{}
+	require.ErrorAs(t, err, &fltErr)
+
+	assert.Equal(t, uid, fltErr.UID)
+	assert.ErrorIs(t, fltErr, os.ErrNotExist)
+
+	// The good filter must still be used.
+	_, hasMatched := eng.FilterRequest(&urlfilter.DNSRequest{
+		Hostname: "blocked.example",
+		DNSType:  dns.TypeA,
+	})
+	assert.True(t, hasMatched)
+}
@@ -1,9 +1,36 @@
 package rulelist
 
-import "github.com/AdguardTeam/golibs/errors"
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
 
 // ErrHTML is returned by [Parser.Parse] if the data is likely to be HTML.
 //
 // TODO(a.garipov): This error is currently returned to the UI.  Stop that and
 // make it all-lowercase.
 const ErrHTML errors.Error = "data is HTML, not plain text"
+
+// FilterError is an error that occurred while updating or loading a single
+// rule-list filter.
+type FilterError struct {
+	// Err is the underlying error.  It must not be nil.
+	Err error
+
+	// UID is the unique ID of the rule-list filter.
+	UID UID
+}
+
+// type check
+var _ errors.Wrapper = (*FilterError)(nil)
+
+// Error implements the [error] interface for *FilterError.
+func (err *FilterError) Error() (msg string) {
+	return fmt.Sprintf("rule list %s: %s", err.UID, err.Err)
+}
+
+// Unwrap implements the [errors.Wrapper] interface for *FilterError.
+func (err *FilterError) Unwrap() (unwrapped error) {
+	return err.Err
+}
@@ -1,40 +1,31 @@
 package rulelist
 
 import (
-	"bytes"
-	"context"
+	"cmp"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
-	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
-	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
 	"github.com/AdguardTeam/golibs/errors"
-	"github.com/AdguardTeam/golibs/ioutil"
-	"github.com/AdguardTeam/urlfilter/filterlist"
 	"github.com/AdguardTeam/urlfilter/rules"
-	"github.com/c2h5oh/datasize"
 )
 
-// Filter contains information about a single rule-list filter.
-//
-// TODO(a.garipov): Use.
+// Filter contains information about a single rule-list filter.  The contents of
+// the filter are cached into a file within the cache directory of a [Storage];
+// see [Storage.CachePath].
 type Filter struct {
+	// mu protects enabled and state.
+	mu *sync.Mutex
+
 	// url is the URL of this rule list.  Supported schemes are:
 	//   - http
 	//   - https
 	//   - file
 	url *url.URL
 
-	// ruleList is the last successfully compiled [filterlist.RuleList].
-	ruleList filterlist.Interface
-
-	// updated is the time of the last successful update.
-	updated time.Time
+	// state is the state of the filter after its last loading or update.
+	state FilterState
 
 	// name is the human-readable name of this rule-list filter.
 	name string
@@ -45,17 +36,34 @@ type Filter struct {
 	// urlFilterID is used for working with package urlfilter.
 	urlFilterID rules.ListID
 
-	// rulesCount contains the number of rules in this rule-list filter.
-	rulesCount int
-
-	// checksum is a CRC32 hash used to quickly check if the rules within a list
-	// file have changed.
-	checksum uint32
-
 	// enabled, if true, means that this rule-list filter is used for filtering.
 	enabled bool
 }
 
+// FilterState is the state of a rule-list filter after its last loading or
+// update.
+type FilterState struct {
+	// Updated is the time of the last update of the filter, successful or not.
+	// If the filter has only been loaded from the cache, it's the modification
+	// time of the cache file.
+	Updated time.Time
+
+	// Err is the error of the last loading or update of the filter.  It's nil
+	// if the last loading or update has succeeded, and a *FilterError
+	// otherwise.
+	Err error
+
+	// Title is the title from the rule-list data, if any.
+	Title string
+
+	// RulesCount is the number of rules in the filter.
+	RulesCount int
+
+	// Checksum is a CRC32 hash used to quickly check if the rules within a list
+	// file have changed.
+	Checksum uint32
+}
+
 // FilterConfig contains the configuration for a [Filter].
 type FilterConfig struct {
 	// URL is the URL of this rule-list filter.  Supported schemes are:
@@ -79,8 +87,8 @@ type FilterConfig struct {
 	Enabled bool
 }
 
-// NewFilter creates a new rule-list filter.  The filter is not refreshed, so a
-// refresh should be performed before use.
+// NewFilter creates a new rule-list filter.  The filter is neither loaded nor
+// refreshed, so either should be performed using a [Storage] before use.
 func NewFilter(c *FilterConfig) (f *Filter, err error) {
 	if c.URL == nil {
 		return nil, errors.Error("no url")
@@ -94,6 +102,7 @@ func NewFilter(c *FilterConfig) (f *Filter, err error) {
 	}
 
 	return &Filter{
+		mu:          &sync.Mutex{},
 		url:         c.URL,
 		name:        c.Name,
 		uid:         c.UID,
@@ -102,209 +111,108 @@ func NewFilter(c *FilterConfig) (f *Filter, err error) {
 	}, nil
 }
 
-// Refresh updates the data in the rule-list filter.  parseBuf is the initial
-// buffer used to parse information from the data.  cli and maxSize are only
-// used when f is a URL-based list.
-//
-// TODO(a.garipov): Unexport and test in an internal test or through engine
-// tests.
-//
-// TODO(a.garipov): Consider not returning parseRes.
-func (f *Filter) Refresh(
-	ctx context.Context,
-	parseBuf []byte,
-	cli *http.Client,
-	cacheDir string,
-	maxSize datasize.ByteSize,
-) (parseRes *ParseResult, err error) {
-	cachePath := filepath.Join(cacheDir, f.uid.String()+".txt")
-
-	switch s := f.url.Scheme; s {
-	case "http", "https":
-		parseRes, err = f.setFromHTTP(ctx, parseBuf, cli, cachePath, maxSize.Bytes())
-	case "file":
-		parseRes, err = f.setFromFile(parseBuf, f.url.Path, cachePath)
-	default:
-		// Since the URL has been prevalidated in New, consider this a
-		// programmer error.
-		panic(fmt.Errorf("bad url scheme: %q", s))
-	}
-	if err != nil {
-		// Don't wrap the error, because it's informative enough as is.
-		return nil, err
-	}
-
-	if f.checksum != parseRes.Checksum {
-		f.checksum = parseRes.Checksum
-		f.rulesCount = parseRes.RulesCount
-		f.setName(parseRes.Title)
-		f.updated = time.Now()
-	}
-
-	return parseRes, nil
+// UID returns the unique ID of the rule-list filter.
+func (f *Filter) UID() (uid UID) {
+	return f.uid
 }
 
-// setFromHTTP sets the rule-list filter's data from its URL.  It also caches
-// the data into a file.
-func (f *Filter) setFromHTTP(
-	ctx context.Context,
-	parseBuf []byte,
-	cli *http.Client,
-	cachePath string,
-	maxSize uint64,
-) (parseRes *ParseResult, err error) {
-	defer func() { err = errors.Annotate(err, "setting from http: %w") }()
-
-	data, parseRes, err := f.readFromHTTP(ctx, parseBuf, cli, cachePath, maxSize)
-	if err != nil {
-		// Don't wrap the error, because it's informative enough as is.
-		return nil, err
-	}
+// URL returns the URL of the rule-list filter.  u must not be modified.
+func (f *Filter) URL() (u *url.URL) {
+	return f.url
+}
 
-	f.ruleList = filterlist.NewBytes(&filterlist.BytesConfig{
-		ID:             f.urlFilterID,
-		RulesText:      data,
-		IgnoreCosmetic: true,
-	})
+// Name returns the human-readable name of the rule-list filter: either the one
+// from its configuration, the title from the rule-list data, or a synthetic
+// one.
+func (f *Filter) Name() (name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	return parseRes, nil
+	return cmp.Or(f.name, f.state.Title, fmt.Sprintf("List %s", f.uid))
 }
 
-// readFromHTTP reads the data from the rule-list filter's URL into the cache
-// file as well as returns it as a string.  The data is filtered through a
-// parser and so is free from comments, unnecessary whitespace, etc.
-func (f *Filter) readFromHTTP(
-	ctx context.Context,
-	parseBuf []byte,
-	cli *http.Client,
-	cachePath string,
-	maxSize uint64,
-) (data []byte, parseRes *ParseResult, err error) {
-	urlStr := f.url.String()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
-	if err != nil {
-		return nil, nil, fmt.Errorf("making request for http url %q: %w", urlStr, err)
-	}
-
-	// #nosec G704 -- Trust the URL explicitly given by the user.
-	resp, err := cli.Do(req)
-	if err != nil {
-		return nil, nil, fmt.Errorf("requesting from http url: %w", err)
-	}
-	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+// Enabled returns true if the rule-list filter is used for filtering.
+func (f *Filter) Enabled() (ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	// TODO(a.garipov): Use [agdhttp.CheckStatus] when it's moved to golibs.
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
-	}
+	return f.enabled
+}
 
-	fltFile, err := aghrenameio.NewPendingFile(cachePath, aghos.DefaultPermFile)
-	if err != nil {
-		return nil, nil, fmt.Errorf("creating temp file: %w", err)
-	}
-	defer func() { err = aghrenameio.WithDeferredCleanup(err, fltFile) }()
+// SetEnabled sets whether the rule-list filter is used for filtering.
+func (f *Filter) SetEnabled(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	buf := &bytes.Buffer{}
-	mw := io.MultiWriter(buf, fltFile)
+	f.enabled = enabled
+}
 
-	parser := NewParser()
-	httpBody := ioutil.LimitReader(resp.Body, maxSize)
-	parseRes, err = parser.Parse(mw, httpBody, parseBuf)
-	if err != nil {
-		return nil, nil, fmt.Errorf("parsing response from http url %q: %w", urlStr, err)
-	}
+// State returns the state of the rule-list filter after its last loading or
+// update.
+func (f *Filter) State() (s FilterState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	return buf.Bytes(), parseRes, nil
+	return f.state
 }
 
-// setName sets the title using either the already-present name, the given title
-// from the rule-list data, or a synthetic name.
-func (f *Filter) setName(title string) {
-	if f.name != "" {
-		return
-	}
+// setParsed sets the data parsed from the contents of the rule-list filter.
+func (f *Filter) setParsed(res *ParseResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	if title != "" {
-		f.name = title
+	f.state.Title = res.Title
+	f.state.RulesCount = res.RulesCount
+	f.state.Checksum = res.Checksum
+}
 
-		return
-	}
+// checksum returns the checksum of the current contents of the rule-list
+// filter.
+func (f *Filter) checksum() (sum uint32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	f.name = fmt.Sprintf("List %s", f.uid)
+	return f.state.Checksum
 }
 
-// setFromFile sets the rule-list filter's data from a file path.  It also
-// caches the data into a file.
-//
-// TODO(a.garipov): Retest on Windows once rule-list updater is committed.  See
-// if calling Close is necessary here.
-func (f *Filter) setFromFile(
-	parseBuf []byte,
-	filePath string,
-	cachePath string,
-) (parseRes *ParseResult, err error) {
-	defer func() { err = errors.Annotate(err, "setting from file: %w") }()
-
-	parseRes, err = parseIntoCache(parseBuf, filePath, cachePath)
-	if err != nil {
-		// Don't wrap the error, because it's informative enough as is.
-		return nil, err
-	}
-
-	err = f.Close()
-	if err != nil {
-		return nil, fmt.Errorf("closing old rule list: %w", err)
-	}
+// setResult sets the time and the error of the last loading or update of the
+// rule-list filter.  err may be nil.
+func (f *Filter) setResult(updated time.Time, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	rl, err := filterlist.NewFile(&filterlist.FileConfig{
-		ID:             f.urlFilterID,
-		Path:           cachePath,
-		IgnoreCosmetic: true,
-	})
+	f.state.Updated = updated
+	f.state.Err = nil
 	if err != nil {
-		return nil, fmt.Errorf("opening new rule list: %w", err)
+		f.state.Err = &FilterError{
+			Err: err,
+			UID: f.uid,
+		}
 	}
+}
 
-	f.ruleList = rl
+// setError sets err as the error of the last loading or update of the rule-list
+// filter, keeping the time of the last update.  err may be nil.
+func (f *Filter) setError(err error) {
+	f.mu.Lock()
+	updated := f.state.Updated
+	f.mu.Unlock()
 
-	return parseRes, nil
+	f.setResult(updated, err)
 }
 
-// parseIntoCache copies the relevant the data from filePath into cachePath
-// while also parsing it.
-func parseIntoCache(
-	parseBuf []byte,
-	filePath string,
-	cachePath string,
-) (parseRes *ParseResult, err error) {
-	tmpFile, err := aghrenameio.NewPendingFile(cachePath, aghos.DefaultPermFile)
-	if err != nil {
-		return nil, fmt.Errorf("creating temp file: %w", err)
-	}
-	defer func() { err = aghrenameio.WithDeferredCleanup(err, tmpFile) }()
+// unload clears the data of the rule-list filter, keeping the time of its last
+// update.
+func (f *Filter) unload() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	// #nosec G304 -- Assume that cachePath is always cacheDir joined with a
-	// uid using [filepath.Join].
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("opening src file: %w", err)
+	f.state = FilterState{
+		Updated: f.state.Updated,
 	}
-	defer func() { err = errors.WithDeferred(err, f.Close()) }()
-
-	parser := NewParser()
-	parseRes, err = parser.Parse(tmpFile, f, parseBuf)
-	if err != nil {
-		return nil, fmt.Errorf("copying src file: %w", err)
-	}
-
-	return parseRes, nil
 }
 
-// Close closes the underlying rule list.
-func (f *Filter) Close() (err error) {
-	if f.ruleList == nil {
-		return nil
-	}
-
-	return f.ruleList.Close()
+// isLocal returns true if the rule-list filter is a local file.
+func (f *Filter) isLocal() (ok bool) {
+	return f.url.Scheme == "file"
 }
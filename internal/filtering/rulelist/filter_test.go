@@ -1,52 +1,46 @@
 package rulelist_test
 
 import (
-	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"testing"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/netutil/urlutil"
-	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func TestFilter_Refresh(t *testing.T) {
+func TestNewFilter(t *testing.T) {
 	t.Parallel()
 
-	cacheDir := t.TempDir()
-
-	const fltData = testRuleTextTitle + testRuleTextBlocked
-	fileURL, srvURL := newFilterLocations(t, cacheDir, fltData, fltData)
-
 	testCases := []struct {
-		url           *url.URL
-		name          string
-		wantNewErrMsg string
+		url        *url.URL
+		name       string
+		wantErrMsg string
 	}{{
-		url:           nil,
-		name:          "nil_url",
-		wantNewErrMsg: "no url",
+		url:        nil,
+		name:       "nil_url",
+		wantErrMsg: "no url",
 	}, {
 		url: &url.URL{
 			Scheme: "ftp",
 		},
-		name:          "bad_scheme",
-		wantNewErrMsg: `bad url scheme: "ftp"`,
+		name:       "bad_scheme",
+		wantErrMsg: `bad url scheme: "ftp"`,
 	}, {
-		name: "file",
 		url: &url.URL{
 			Scheme: urlutil.SchemeFile,
-			Path:   fileURL.Path,
+			Path:   "/tmp/list.txt",
 		},
-		wantNewErrMsg: "",
+		name:       "file",
+		wantErrMsg: "",
 	}, {
-		name:          "http",
-		url:           srvURL,
-		wantNewErrMsg: "",
+		url: &url.URL{
+			Scheme: urlutil.SchemeHTTPS,
+			Host:   "filters.example",
+		},
+		name:       "https",
+		wantErrMsg: "",
 	}}
 
 	for _, tc := range testCases {
@@ -56,37 +50,23 @@ func TestFilter_Refresh(t *testing.T) {
 			uid := rulelist.MustNewUID()
 			f, err := rulelist.NewFilter(&rulelist.FilterConfig{
 				URL:         tc.url,
-				Name:        tc.name,
 				UID:         uid,
 				URLFilterID: testURLFilterID,
 				Enabled:     true,
 			})
-			if tc.wantNewErrMsg != "" {
-				assert.EqualError(t, err, tc.wantNewErrMsg)
+			if tc.wantErrMsg != "" {
+				assert.EqualError(t, err, tc.wantErrMsg)
 
 				return
 			}
 
-			testutil.CleanupAndRequireSuccess(t, f.Close)
-
-			require.NotNil(t, f)
-
-			buf := make([]byte, rulelist.DefaultRuleBufSize)
-			cli := &http.Client{
-				Timeout: testTimeout,
-			}
-
-			ctx := testutil.ContextWithTimeout(t, testTimeout)
-			res, err := f.Refresh(ctx, buf, cli, cacheDir, rulelist.DefaultMaxRuleListSize)
 			require.NoError(t, err)
 
-			assert.Equal(t, testTitle, res.Title)
-			assert.Equal(t, len(testRuleTextBlocked), res.BytesWritten)
-			assert.Equal(t, 1, res.RulesCount)
-
-			// Check that the cached file exists.
-			_, err = os.Stat(filepath.Join(cacheDir, uid.String()+".txt"))
-			require.NoError(t, err)
+			assert.Equal(t, uid, f.UID())
+			assert.Equal(t, tc.url, f.URL())
+			assert.True(t, f.Enabled())
+			assert.Equal(t, "List "+uid.String(), f.Name())
+			assert.Equal(t, rulelist.FilterState{}, f.State())
 		})
 	}
 }
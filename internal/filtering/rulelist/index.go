@@ -0,0 +1,501 @@
+package rulelist
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// ErrIndexOutdated is returned by [OpenIndex] when the index has been compiled
+// from a different version of the filtering-rule list.
+const ErrIndexOutdated errors.Error = "index is outdated"
+
+// errBadIndexFormat is returned by [OpenIndex] when the file isn't an index.
+const errBadIndexFormat errors.Error = "bad index format"
+
+// indexMagic is the magic string at the end of the index file.  It also
+// contains the version of the format.
+const indexMagic = "AGHIDX01"
+
+// Sizes of the parts of the index file, in bytes.
+const (
+	indexEntrySize  = 20
+	indexFooterSize = 32
+)
+
+// Kinds of the indexed rules.
+const (
+	indexKindHost    byte = 1
+	indexKindNetwork byte = 2
+)
+
+// indexEntry is a single entry of the index.  The entries are stored sorted by
+// hash in the following format, all integers are little-endian:
+//
+//	hash     uint64  FNV-1a hash of the hostname
+//	ruleOff  uint32  offset of the rule text in the text section
+//	ruleLen  uint16  length of the rule text
+//	hostOff  uint16  offset of the hostname within the rule text
+//	hostLen  uint16  length of the hostname
+//	kind     uint8   indexKindHost or indexKindNetwork
+//	reserved uint8
+type indexEntry struct {
+	hash    uint64
+	ruleOff uint32
+	ruleLen uint16
+	hostOff uint16
+	hostLen uint16
+	kind    byte
+}
+
+// IndexResult contains information about the results of compiling an index by
+// [CompileIndex].
+type IndexResult struct {
+	// IndexedRulesCount is the number of rules written into the index.
+	IndexedRulesCount int
+
+	// RestRulesCount is the number of rules that cannot be indexed and have
+	// been written as text.
+	RestRulesCount int
+}
+
+// CompileIndex compiles the filtering-rule list from src into a compact index
+// of the hosts-file style rules and the plain blocking and exception rules for
+// domains, such as "||example.org^", and writes it to idx.  All other rules are
+// written into rest as text and should be loaded into a filtering engine as
+// usual.  src should be a list without comments, such as the ones produced by
+// [Parser].
+//
+// The index file has the following layout: the text of the indexed rules, the
+// sorted entries, see [indexEntry], and the footer.  The footer contains the
+// size and the CRC-32 checksum of src, which are used by [OpenIndex] to detect
+// outdated indexes.
+func CompileIndex(idx, rest io.Writer, src io.Reader, buf []byte) (res *IndexResult, err error) {
+	defer func() { err = errors.Annotate(err, "compiling index: %w") }()
+
+	sum := crc32.NewIEEE()
+	cw := &countWriter{}
+
+	s := bufio.NewScanner(io.TeeReader(src, io.MultiWriter(sum, cw)))
+	s.Buffer(buf, bufio.MaxScanTokenSize)
+
+	res = &IndexResult{}
+
+	var entries []indexEntry
+	var textSize uint64
+	for s.Scan() {
+		line := string(bytes.TrimSpace(s.Bytes()))
+		if line == "" {
+			continue
+		}
+
+		lineEntries := indexLine(line)
+		if len(lineEntries) == 0 || len(line) > math.MaxUint16 {
+			res.RestRulesCount++
+			_, err = io.WriteString(rest, line+"\n")
+			if err != nil {
+				return nil, fmt.Errorf("writing rule: %w", err)
+			}
+
+			continue
+		}
+
+		if textSize+uint64(len(line)) > math.MaxUint32 {
+			return nil, fmt.Errorf("text size: %w", errors.ErrOutOfRange)
+		}
+
+		for _, e := range lineEntries {
+			// #nosec G115 -- The size is checked above.
+			e.ruleOff = uint32(textSize)
+			entries = append(entries, e)
+		}
+
+		res.IndexedRulesCount++
+		textSize += uint64(len(line))
+		_, err = io.WriteString(idx, line)
+		if err != nil {
+			return nil, fmt.Errorf("writing rule: %w", err)
+		}
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, fmt.Errorf("scanning rules: %w", err)
+	}
+
+	return res, writeIndexTail(idx, entries, textSize, cw.n, sum.Sum32())
+}
+
+// countWriter is an [io.Writer] that only counts the written bytes.
+type countWriter struct {
+	n uint64
+}
+
+// type check
+var _ io.Writer = (*countWriter)(nil)
+
+// Write implements the [io.Writer] interface for *countWriter.
+func (w *countWriter) Write(b []byte) (n int, err error) {
+	w.n += uint64(len(b))
+
+	return len(b), nil
+}
+
+// writeIndexTail writes the sorted entries and the footer of the index to w.
+func writeIndexTail(
+	w io.Writer,
+	entries []indexEntry,
+	textSize uint64,
+	srcSize uint64,
+	srcSum uint32,
+) (err error) {
+	if uint64(len(entries)) > math.MaxUint32 {
+		return fmt.Errorf("entries: %w", errors.ErrOutOfRange)
+	}
+
+	slices.SortFunc(entries, func(a, b indexEntry) (res int) {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.ruleOff, b.ruleOff))
+	})
+
+	bw := bufio.NewWriter(w)
+	entryBuf := make([]byte, indexEntrySize)
+	for _, e := range entries {
+		binary.LittleEndian.PutUint64(entryBuf[0:], e.hash)
+		binary.LittleEndian.PutUint32(entryBuf[8:], e.ruleOff)
+		binary.LittleEndian.PutUint16(entryBuf[12:], e.ruleLen)
+		binary.LittleEndian.PutUint16(entryBuf[14:], e.hostOff)
+		binary.LittleEndian.PutUint16(entryBuf[16:], e.hostLen)
+		entryBuf[18] = e.kind
+		entryBuf[19] = 0
+
+		// Errors are returned by Flush.
+		_, _ = bw.Write(entryBuf)
+	}
+
+	footer := make([]byte, indexFooterSize)
+	binary.LittleEndian.PutUint64(footer[0:], srcSize)
+	binary.LittleEndian.PutUint32(footer[8:], srcSum)
+	// #nosec G115 -- The sizes are checked in CompileIndex and above.
+	binary.LittleEndian.PutUint32(footer[12:], uint32(textSize))
+	// #nosec G115 -- The sizes are checked in CompileIndex and above.
+	binary.LittleEndian.PutUint32(footer[16:], uint32(len(entries)))
+	copy(footer[24:], indexMagic)
+
+	_, _ = bw.Write(footer)
+
+	return errors.Annotate(bw.Flush(), "writing entries: %w")
+}
+
+// indexLine returns the index entries for the rule in line, or nil if the rule
+// cannot be indexed.  The ruleOff fields of the entries aren't set.
+func indexLine(line string) (entries []indexEntry) {
+	if host, off, ok := plainDomainRule(line); ok {
+		return []indexEntry{newIndexEntry(line, host, off, indexKindNetwork)}
+	}
+
+	r, err := rules.NewRule(line, 0)
+	if err != nil {
+		return nil
+	}
+
+	hr, ok := r.(*rules.HostRule)
+	if !ok {
+		return nil
+	}
+
+	// Find the offsets of the hostnames in the rule text, which is needed to
+	// compare them with the requested hostname without parsing the rule.
+	cur := 0
+	for _, h := range hr.Hostnames {
+		i := strings.Index(line[cur:], h)
+		if i == -1 || len(h) == 0 {
+			return nil
+		}
+
+		entries = append(entries, newIndexEntry(line, h, cur+i, indexKindHost))
+		cur += i + len(h)
+	}
+
+	return entries
+}
+
+// newIndexEntry returns a new entry for the hostname host at the offset off
+// within the rule text.  The length of line must fit into uint16.
+func newIndexEntry(line, host string, off int, kind byte) (e indexEntry) {
+	return indexEntry{
+		hash: hashHostname(host),
+		// #nosec G115 -- The length of the line is checked by the caller.
+		ruleLen: uint16(len(line)),
+		// #nosec G115 -- The length of the line is checked by the caller.
+		hostOff: uint16(off),
+		// #nosec G115 -- The length of the line is checked by the caller.
+		hostLen: uint16(len(host)),
+		kind:    kind,
+	}
+}
+
+// plainDomainRule returns the domain and its offset if line is a blocking or an
+// exception rule without modifiers matching a domain and its subdomains, for
+// example "||example.org^" or "@@||example.org^".
+func plainDomainRule(line string) (host string, off int, ok bool) {
+	off = 2
+	if strings.HasPrefix(line, "@@") {
+		off += 2
+	}
+
+	if !strings.HasPrefix(line[off-2:], "||") || !strings.HasSuffix(line, "^") {
+		return "", 0, false
+	}
+
+	host = line[off : len(line)-1]
+	if host == "" || host[0] == '.' || host[len(host)-1] == '.' {
+		return "", 0, false
+	}
+
+	for i := range len(host) {
+		c := host[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '.' && c != '-' && c != '_' {
+			return "", 0, false
+		}
+	}
+
+	return host, off, true
+}
+
+// hashHostname returns the 64-bit FNV-1a hash of host.
+func hashHostname(host string) (h uint64) {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+
+	h = offset64
+	for i := range len(host) {
+		h ^= uint64(host[i])
+		h *= prime64
+	}
+
+	return h
+}
+
+// Index is a compiled index of simple filtering rules, see [CompileIndex].
+// The index file is memory-mapped where possible, so that the rules don't
+// occupy the process memory.  It's safe for concurrent use.
+type Index struct {
+	// unmap releases data.
+	unmap func() (err error)
+
+	// text is the text section of data.
+	text []byte
+
+	// entries is the entries section of data.
+	entries []byte
+
+	// srcSize is the size of the source filtering-rule list.
+	srcSize uint64
+
+	// listID is the ID of the filtering-rule list used for the matched rules.
+	listID rules.ListID
+
+	// count is the number of entries.
+	count int
+
+	// srcSum is the CRC-32 checksum of the source filtering-rule list.
+	srcSum uint32
+}
+
+// type check
+var _ interface {
+	MatchRequestInto(req *urlfilter.DNSRequest, res *urlfilter.DNSResult) (matched bool)
+} = (*Index)(nil)
+
+// OpenIndex opens the index compiled by [CompileIndex] at path.  srcSize and
+// srcSum are the size and the CRC-32 checksum of the current version of the
+// source filtering-rule list.  If the index has been compiled from a different
+// version, err is [ErrIndexOutdated].  listID is used as the ID of the matched
+// rules.  idx must be closed after use.
+func OpenIndex(
+	path string,
+	listID rules.ListID,
+	srcSize uint64,
+	srcSum uint32,
+) (idx *Index, err error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening index: %w", err)
+	}
+
+	idx, err = newIndex(data, listID)
+	if err == nil && (idx.srcSize != srcSize || idx.srcSum != srcSum) {
+		err = ErrIndexOutdated
+	}
+
+	if err != nil {
+		return nil, errors.WithDeferred(fmt.Errorf("opening index: %w", err), unmap())
+	}
+
+	idx.unmap = unmap
+
+	return idx, nil
+}
+
+// newIndex parses the index data.
+func newIndex(data []byte, listID rules.ListID) (idx *Index, err error) {
+	if len(data) < indexFooterSize {
+		return nil, fmt.Errorf("size %d: %w", len(data), errors.ErrOutOfRange)
+	}
+
+	footer := data[len(data)-indexFooterSize:]
+	if string(footer[24:]) != indexMagic {
+		return nil, errBadIndexFormat
+	}
+
+	textSize := uint64(binary.LittleEndian.Uint32(footer[12:]))
+	count := uint64(binary.LittleEndian.Uint32(footer[16:]))
+	if textSize+count*indexEntrySize+indexFooterSize != uint64(len(data)) {
+		return nil, fmt.Errorf("size %d: %w", len(data), errors.ErrOutOfRange)
+	}
+
+	return &Index{
+		text:    data[:textSize],
+		entries: data[textSize : uint64(len(data))-indexFooterSize],
+		srcSize: binary.LittleEndian.Uint64(footer[0:]),
+		listID:  listID,
+		count:   int(count),
+		srcSum:  binary.LittleEndian.Uint32(footer[8:]),
+	}, nil
+}
+
+// Close releases the resources of the index.  The rules returned from it
+// remain valid.  Closing a closed index has no effect.
+func (idx *Index) Close() (err error) {
+	unmap := idx.unmap
+	if unmap == nil {
+		return nil
+	}
+
+	idx.unmap = nil
+
+	return errors.Annotate(unmap(), "closing index: %w")
+}
+
+// Len returns the number of entries in the index.
+func (idx *Index) Len() (n int) {
+	return idx.count
+}
+
+// MatchRequestInto matches the request against the index and appends the
+// matched rules to res.  Like [urlfilter.DNSEngine.MatchRequestInto], it
+// doesn't set res.NetworkRule, which is the responsibility of the caller
+// combining the results of several engines.  req and res must not be nil.
+func (idx *Index) MatchRequestInto(
+	req *urlfilter.DNSRequest,
+	res *urlfilter.DNSResult,
+) (matched bool) {
+	host := req.Hostname
+	if host == "" {
+		return false
+	}
+
+	for name := host; ; {
+		matched = idx.appendMatching(res, name, name == host) || matched
+
+		i := strings.IndexByte(name, '.')
+		if i == -1 {
+			break
+		}
+
+		name = name[i+1:]
+	}
+
+	return matched
+}
+
+// appendMatching appends the rules for name to res.  exact is true if name is
+// the requested hostname and not one of its parent domains, in which case the
+// hosts-file style rules are also matched.
+func (idx *Index) appendMatching(res *urlfilter.DNSResult, name string, exact bool) (ok bool) {
+	h := hashHostname(name)
+	i := sort.Search(idx.count, func(i int) (found bool) {
+		return idx.hashAt(i) >= h
+	})
+
+	for ; i < idx.count && idx.hashAt(i) == h; i++ {
+		e := idx.entryAt(i)
+		ruleEnd := uint64(e.ruleOff) + uint64(e.ruleLen)
+		hostEnd := int(e.hostOff) + int(e.hostLen)
+		if ruleEnd > uint64(len(idx.text)) || hostEnd > int(e.ruleLen) {
+			// Don't panic on corrupted indexes.
+			continue
+		}
+
+		rule := idx.text[e.ruleOff:ruleEnd]
+		if string(rule[e.hostOff:hostEnd]) != name {
+			continue
+		}
+
+		switch e.kind {
+		case indexKindHost:
+			if exact {
+				ok = appendHostRule(res, string(rule), idx.listID) || ok
+			}
+		case indexKindNetwork:
+			nr, err := rules.NewNetworkRule(string(rule), idx.listID)
+			if err == nil {
+				res.NetworkRules = append(res.NetworkRules, nr)
+				ok = true
+			}
+		default:
+			// Skip the unknown kinds for forward compatibility.
+		}
+	}
+
+	return ok
+}
+
+// appendHostRule parses the hosts-file style rule and appends it to res.
+func appendHostRule(res *urlfilter.DNSResult, text string, listID rules.ListID) (ok bool) {
+	hr, err := rules.NewHostRule(text, listID)
+	if err != nil {
+		return false
+	}
+
+	if hr.IP.Is4() {
+		res.HostRulesV4 = append(res.HostRulesV4, hr)
+	} else {
+		res.HostRulesV6 = append(res.HostRulesV6, hr)
+	}
+
+	return true
+}
+
+// hashAt returns the hash of the entry at i.
+func (idx *Index) hashAt(i int) (h uint64) {
+	return binary.LittleEndian.Uint64(idx.entries[i*indexEntrySize:])
+}
+
+// entryAt returns the entry at i.
+func (idx *Index) entryAt(i int) (e indexEntry) {
+	b := idx.entries[i*indexEntrySize : (i+1)*indexEntrySize]
+
+	return indexEntry{
+		hash:    binary.LittleEndian.Uint64(b[0:]),
+		ruleOff: binary.LittleEndian.Uint32(b[8:]),
+		ruleLen: binary.LittleEndian.Uint16(b[12:]),
+		hostOff: binary.LittleEndian.Uint16(b[14:]),
+		hostLen: binary.LittleEndian.Uint16(b[16:]),
+		kind:    b[18],
+	}
+}
@@ -0,0 +1,190 @@
+package rulelist_test
+
+import (
+	"bytes"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/AdguardTeam/urlfilter/rules"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIndexRules are the rules used to test the index.  The comments show
+// which of them are indexed.
+const testIndexRules = "||blocked.example^\n" + // Indexed.
+	"@@||allowed.blocked.example^\n" + // Indexed.
+	"0.0.0.0 host.example other.example\n" + // Indexed.
+	"::1 host.example\n" + // Indexed.
+	"plain.example\n" + // Indexed.
+	"||important.example^$important\n" +
+	"/regexp[0-9]+\\.example/\n" +
+	"||Upper.example^\n"
+
+// newTestIndex compiles rulesText into an index in a temporary directory and
+// returns it along with the rules that haven't been indexed.
+func newTestIndex(tb testing.TB, rulesText string) (idx *rulelist.Index, rest string) {
+	tb.Helper()
+
+	idxBuf, restBuf := &bytes.Buffer{}, &bytes.Buffer{}
+	buf := make([]byte, rulelist.DefaultRuleBufSize)
+	_, err := rulelist.CompileIndex(idxBuf, restBuf, strings.NewReader(rulesText), buf)
+	require.NoError(tb, err)
+
+	path := filepath.Join(tb.TempDir(), "1.idx")
+	err = os.WriteFile(path, idxBuf.Bytes(), 0o600)
+	require.NoError(tb, err)
+
+	sum := crc32.ChecksumIEEE([]byte(rulesText))
+	idx, err = rulelist.OpenIndex(path, testURLFilterID, uint64(len(rulesText)), sum)
+	require.NoError(tb, err)
+	testutil.CleanupAndRequireSuccess(tb, idx.Close)
+
+	return idx, restBuf.String()
+}
+
+func TestCompileIndex(t *testing.T) {
+	t.Parallel()
+
+	idxBuf, restBuf := &bytes.Buffer{}, &bytes.Buffer{}
+	buf := make([]byte, rulelist.DefaultRuleBufSize)
+	res, err := rulelist.CompileIndex(idxBuf, restBuf, strings.NewReader(testIndexRules), buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, &rulelist.IndexResult{
+		IndexedRulesCount: 5,
+		RestRulesCount:    3,
+	}, res)
+
+	assert.Equal(t, "||important.example^$important\n"+
+		"/regexp[0-9]+\\.example/\n"+
+		"||Upper.example^\n", restBuf.String())
+
+	idx, _ := newTestIndex(t, testIndexRules)
+	assert.Equal(t, 6, idx.Len())
+}
+
+func TestOpenIndex_outdated(t *testing.T) {
+	t.Parallel()
+
+	idxBuf := &bytes.Buffer{}
+	buf := make([]byte, rulelist.DefaultRuleBufSize)
+	_, err := rulelist.CompileIndex(idxBuf, &bytes.Buffer{}, strings.NewReader(testIndexRules), buf)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "1.idx")
+	err = os.WriteFile(path, idxBuf.Bytes(), 0o600)
+	require.NoError(t, err)
+
+	_, err = rulelist.OpenIndex(path, testURLFilterID, uint64(len(testIndexRules)), 0)
+	assert.ErrorIs(t, err, rulelist.ErrIndexOutdated)
+
+	err = os.WriteFile(path, []byte("not an index"), 0o600)
+	require.NoError(t, err)
+
+	_, err = rulelist.OpenIndex(path, testURLFilterID, 0, 0)
+	assert.Error(t, err)
+}
+
+func TestIndex_MatchRequestInto(t *testing.T) {
+	t.Parallel()
+
+	idx, rest := newTestIndex(t, testIndexRules)
+
+	// The results of the index combined with the engine for the rest of the
+	// rules must be the same as the ones of the engine for all rules.
+	wantEng := newTestDNSEngine(t, testIndexRules)
+	restEng := newTestDNSEngine(t, rest)
+
+	hosts := []string{
+		"blocked.example",
+		"sub.blocked.example",
+		"allowed.blocked.example",
+		"notblocked.example",
+		"host.example",
+		"sub.host.example",
+		"other.example",
+		"plain.example",
+		"important.example",
+		"regexp123.example",
+		"upper.example",
+		"example",
+	}
+
+	for _, host := range hosts {
+		t.Run(host, func(t *testing.T) {
+			t.Parallel()
+
+			req := &urlfilter.DNSRequest{
+				Hostname: host,
+				DNSType:  dns.TypeA,
+			}
+
+			want := &urlfilter.DNSResult{}
+			wantMatched := wantEng.MatchRequestInto(req, want)
+
+			got := &urlfilter.DNSResult{}
+			restEng.MatchRequestInto(req, got)
+			idx.MatchRequestInto(req, got)
+
+			got.NetworkRule = rules.GetDNSBasicRule(got.NetworkRules)
+			if got.NetworkRule != nil {
+				got.HostRulesV4, got.HostRulesV6 = nil, nil
+			}
+
+			gotMatched := got.NetworkRule != nil || len(got.HostRulesV4)+len(got.HostRulesV6) > 0
+			require.Equal(t, wantMatched, gotMatched)
+
+			assert.Equal(t, ruleText(want.NetworkRule), ruleText(got.NetworkRule))
+			assert.ElementsMatch(t, hostRulesText(want.HostRulesV4), hostRulesText(got.HostRulesV4))
+			assert.ElementsMatch(t, hostRulesText(want.HostRulesV6), hostRulesText(got.HostRulesV6))
+
+			if got.NetworkRule != nil {
+				assert.Equal(t, testURLFilterID, got.NetworkRule.GetFilterListID())
+			}
+		})
+	}
+}
+
+// newTestDNSEngine returns a new DNS engine with the rules from rulesText.
+func newTestDNSEngine(tb testing.TB, rulesText string) (eng *urlfilter.DNSEngine) {
+	tb.Helper()
+
+	rs, err := filterlist.NewRuleStorage([]filterlist.Interface{
+		filterlist.NewBytes(&filterlist.BytesConfig{
+			ID:             testURLFilterID,
+			RulesText:      []byte(rulesText),
+			IgnoreCosmetic: true,
+		}),
+	})
+	require.NoError(tb, err)
+	testutil.CleanupAndRequireSuccess(tb, rs.Close)
+
+	return urlfilter.NewDNSEngine(rs)
+}
+
+// ruleText returns the text of r or an empty string if r is nil.
+func ruleText(r *rules.NetworkRule) (text string) {
+	if r == nil {
+		return ""
+	}
+
+	return r.Text()
+}
+
+// hostRulesText returns the texts of rs.
+func hostRulesText(rs []*rules.HostRule) (texts []string) {
+	for _, r := range rs {
+		texts = append(texts, r.Text())
+	}
+
+	return texts
+}
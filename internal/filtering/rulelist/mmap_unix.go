@@ -0,0 +1,42 @@
+//go:build unix
+
+package rulelist
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the file at path into memory in read-only mode.  unmap must be
+// called to release the mapping.
+func mapFile(path string) (data []byte, unmap func() (err error), err error) {
+	// #nosec G304 -- Trust the path, which is within the data directory.
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting file info: %w", err)
+	}
+
+	size := fi.Size()
+	if size == 0 {
+		return nil, func() (err error) { return nil }, nil
+	} else if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("size %d: %w", size, errors.ErrOutOfRange)
+	}
+
+	data, err = unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mapping file: %w", err)
+	}
+
+	return data, func() (err error) { return unix.Munmap(data) }, nil
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package rulelist
+
+import (
+	"os"
+)
+
+// mapFile reads the file at path into memory.  On Windows, the file isn't
+// mapped, since a mapped file can't be replaced while it's being used.  unmap
+// is a no-op.
+func mapFile(path string) (data []byte, unmap func() (err error), err error) {
+	// #nosec G304 -- Trust the path, which is within the data directory.
+	data, err = os.ReadFile(path)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, nil, err
+	}
+
+	return data, func() (err error) { return nil }, nil
+}
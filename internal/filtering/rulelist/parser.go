@@ -15,6 +15,7 @@ import (
 // and the title, as well as counts rules and removes comments.
 type Parser struct {
 	title      string
+	diffPath   string
 	rulesCount int
 	written    int
 	checksum   uint32
@@ -32,6 +33,10 @@ type ParseResult struct {
 	// Title is the title contained within the filtering-rule list, if any.
 	Title string
 
+	// DiffPath is the path to the next differential update patch contained
+	// within the header of the filtering-rule list, if any.  See [ApplyPatch].
+	DiffPath string
+
 	// RulesCount is the number of rules in the list.  It excludes empty lines
 	// and comments.
 	RulesCount int
@@ -83,6 +88,7 @@ func (p *Parser) Parse(dst io.Writer, src io.Reader, buf []byte) (r *ParseResult
 func (p *Parser) result() (r *ParseResult) {
 	return &ParseResult{
 		Title:        p.title,
+		DiffPath:     p.diffPath,
 		RulesCount:   p.rulesCount,
 		BytesWritten: p.written,
 		Checksum:     p.checksum,
@@ -113,6 +119,8 @@ func (p *Parser) processLine(dst io.Writer, line []byte, lineNum int) (n int, er
 	}
 
 	if !isRule {
+		p.parseHeader(trimmed)
+
 		return 0, nil
 	}
 
@@ -126,6 +134,18 @@ func (p *Parser) processLine(dst io.Writer, line []byte, lineNum int) (n int, er
 	return n, errors.Annotate(err, "writing rule line: %w")
 }
 
+// parseHeader looks for the differential updates header in a non-rule line.
+// line is assumed to be trimmed of whitespace characters.
+func (p *Parser) parseHeader(line []byte) {
+	if p.rulesCount > 0 || p.diffPath != "" {
+		return
+	}
+
+	if diffPath, ok := parseDiffPath(line); ok {
+		p.diffPath = diffPath
+	}
+}
+
 // isHTMLLine returns true if line is likely an HTML line.  line is assumed to
 // be trimmed of whitespace characters.
 func isHTMLLine(line []byte) (isHTML bool) {
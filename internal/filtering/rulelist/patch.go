@@ -0,0 +1,331 @@
+package rulelist
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	// #nosec G505 -- SHA-1 is required by the differential updates format.
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// Prefixes of the header lines relevant to differential updates.
+const (
+	// diffPathPrefix is the prefix of the header line containing the path to
+	// the next differential update patch of a filtering-rule list.
+	diffPathPrefix = "! Diff-Path:"
+
+	// diffExpiresPrefix is the prefix of the header line containing the
+	// period after which the patches of a filtering-rule list expire.
+	diffExpiresPrefix = "! Diff-Expires:"
+
+	// expiresPrefix is the prefix of the header line containing the update
+	// period of a filtering-rule list.
+	expiresPrefix = "! Expires:"
+)
+
+// DiffHeader is the part of the header of a filtering-rule list relevant to
+// differential updates.
+type DiffHeader struct {
+	// Path is the path to the next patch.  It's empty if the list doesn't
+	// support differential updates.
+	Path string
+
+	// Expires is the period after which the patches expire and the whole list
+	// should be downloaded again.  It's taken from the "! Diff-Expires:"
+	// header or, if there is none, from the "! Expires:" one.  It's zero if
+	// the list has neither.
+	Expires time.Duration
+}
+
+// ParseDiffHeader returns the part of the header of the filtering-rule list
+// from src relevant to differential updates.  Only the lines before the first
+// rule are inspected.
+func ParseDiffHeader(src io.Reader, buf []byte) (h *DiffHeader, err error) {
+	s := bufio.NewScanner(src)
+	s.Buffer(buf, bufio.MaxScanTokenSize)
+
+	h = &DiffHeader{}
+	var diffExpires, expires time.Duration
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		} else if line[0] != '!' {
+			break
+		}
+
+		if p, ok := parseDiffPath(line); ok && h.Path == "" {
+			h.Path = p
+		} else if rest, found := bytes.CutPrefix(line, []byte(diffExpiresPrefix)); found {
+			diffExpires = parseExpires(rest)
+		} else if rest, found = bytes.CutPrefix(line, []byte(expiresPrefix)); found {
+			expires = parseExpires(rest)
+		}
+	}
+
+	h.Expires = cmp.Or(diffExpires, expires)
+
+	return h, errors.Annotate(s.Err(), "scanning filter header: %w")
+}
+
+// DiffPath returns the path to the next patch of the filtering-rule list from
+// src.  Only the header of the list, that is the lines before the first rule,
+// is inspected.  path is empty if the list doesn't support differential
+// updates.
+func DiffPath(src io.Reader, buf []byte) (path string, err error) {
+	h, err := ParseDiffHeader(src, buf)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return "", err
+	}
+
+	return h.Path, nil
+}
+
+// parseDiffPath returns the path from a "! Diff-Path:" header line.  line is
+// assumed to be trimmed of whitespace characters.
+func parseDiffPath(line []byte) (path string, ok bool) {
+	rest, ok := bytes.CutPrefix(line, []byte(diffPathPrefix))
+	if !ok {
+		return "", false
+	}
+
+	path = string(bytes.TrimSpace(rest))
+
+	return path, path != ""
+}
+
+// parseExpires parses the value of an expiration header, for example "4 days"
+// or "12 hours (update frequency)".  A number without a unit is the number of
+// days.  ivl is zero if val is invalid.
+func parseExpires(val []byte) (ivl time.Duration) {
+	fields := strings.Fields(string(val))
+	if len(fields) == 0 {
+		return 0
+	}
+
+	n, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil || n == 0 {
+		return 0
+	}
+
+	unit := timeutil.Day
+	if len(fields) > 1 && strings.HasPrefix(strings.ToLower(fields[1]), "hour") {
+		unit = time.Hour
+	}
+
+	return time.Duration(n) * unit
+}
+
+// ApplyPatch applies the RCS-style differential update patch to orig, which
+// must be the unprocessed contents of a filtering-rule list, and returns the
+// patched contents.  If resource is not empty, patch is considered a batch
+// patch, and only the part for this resource is applied.  If the patch contains
+// a checksum, it's validated against the result.
+//
+// See https://github.com/ameshkov/diffupdates.
+func ApplyPatch(orig, patch []byte, resource string) (res []byte, err error) {
+	defer func() { err = errors.Annotate(err, "applying patch: %w") }()
+
+	cmds, checksum, err := selectPatch(splitLines(patch), resource)
+	if err != nil {
+		// Don't wrap the error, because it's annotated above.
+		return nil, err
+	}
+
+	lines, err := applyRCS(splitLines(orig), cmds)
+	if err != nil {
+		// Don't wrap the error, because it's annotated above.
+		return nil, err
+	}
+
+	res = joinLines(lines)
+	if checksum == "" {
+		return res, nil
+	}
+
+	sum := sha1.Sum(res)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, checksum) {
+		return nil, fmt.Errorf("checksum: got %q, want %q", got, checksum)
+	}
+
+	return res, nil
+}
+
+// splitLines splits data into lines without the line terminators.  The final
+// line terminator, if any, doesn't produce an empty line.
+func splitLines(data []byte) (lines [][]byte) {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	if len(data) == 0 {
+		return nil
+	}
+
+	lines = bytes.Split(data, []byte("\n"))
+	for i, l := range lines {
+		lines[i] = bytes.TrimSuffix(l, []byte("\r"))
+	}
+
+	return lines
+}
+
+// joinLines is the reverse of [splitLines].
+func joinLines(lines [][]byte) (data []byte) {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return append(bytes.Join(lines, []byte("\n")), '\n')
+}
+
+// batchHeaderPrefix is the prefix of the line starting a part of a batch patch.
+const batchHeaderPrefix = "diff "
+
+// selectPatch returns the RCS commands of the part of the patch for resource
+// along with the expected checksum of the result, if any.  If patch doesn't
+// have batch headers, all of it is returned.
+func selectPatch(patch [][]byte, resource string) (cmds [][]byte, checksum string, err error) {
+	if len(patch) == 0 || !bytes.HasPrefix(patch[0], []byte(batchHeaderPrefix)) {
+		if resource != "" {
+			return nil, "", fmt.Errorf("resource %q: not a batch patch", resource)
+		}
+
+		return patch, "", nil
+	}
+
+	for len(patch) > 0 {
+		var name string
+		var n int
+		name, checksum, n, err = parseBatchHeader(patch[0])
+		if err != nil {
+			// Don't wrap the error, because it's informative enough as is.
+			return nil, "", err
+		}
+
+		patch = patch[1:]
+		if n > len(patch) {
+			return nil, "", fmt.Errorf("part %q: lines: %w", name, errors.ErrOutOfRange)
+		}
+
+		if resource == "" || name == resource {
+			return patch[:n], checksum, nil
+		}
+
+		patch = patch[n:]
+	}
+
+	return nil, "", fmt.Errorf("resource %q: not found", resource)
+}
+
+// parseBatchHeader parses a batch patch header line of the form:
+//
+//	diff name:NAME checksum:CHECKSUM lines:LINES
+func parseBatchHeader(line []byte) (name, checksum string, n int, err error) {
+	fields := strings.Fields(string(line))[1:]
+	for _, f := range fields {
+		k, v, _ := strings.Cut(f, ":")
+		switch k {
+		case "name":
+			name = v
+		case "checksum":
+			checksum = v
+		case "lines":
+			n, err = strconv.Atoi(v)
+			if err != nil {
+				return "", "", 0, fmt.Errorf("batch header: lines: %w", err)
+			}
+		default:
+			// Ignore unknown fields for forward compatibility.
+		}
+	}
+
+	if n < 0 {
+		return "", "", 0, fmt.Errorf("batch header: lines: %w", errors.ErrNegative)
+	}
+
+	return name, checksum, n, nil
+}
+
+// applyRCS applies the RCS diff commands to orig.  The line numbers in the
+// commands refer to orig and must be in the ascending order, which is what
+// "diff -n" produces.
+func applyRCS(orig, cmds [][]byte) (res [][]byte, err error) {
+	res = make([][]byte, 0, len(orig))
+
+	// cur is the number of lines of orig that have already been processed.
+	cur := 0
+	for i := 0; i < len(cmds); i++ {
+		cmd := cmds[i]
+
+		var op byte
+		var pos, n int
+		op, pos, n, err = parseRCSCommand(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch op {
+		case 'a':
+			if pos < cur || pos > len(orig) {
+				return nil, fmt.Errorf("line %d: position %d: %w", i+1, pos, errors.ErrOutOfRange)
+			} else if i+n >= len(cmds) {
+				return nil, fmt.Errorf("line %d: lines: %w", i+1, errors.ErrOutOfRange)
+			}
+
+			res = append(res, orig[cur:pos]...)
+			res = append(res, cmds[i+1:i+1+n]...)
+			cur = pos
+			i += n
+		case 'd':
+			start := pos - 1
+			if start < cur || start+n > len(orig) {
+				return nil, fmt.Errorf("line %d: position %d: %w", i+1, pos, errors.ErrOutOfRange)
+			}
+
+			res = append(res, orig[cur:start]...)
+			cur = start + n
+		default:
+			return nil, fmt.Errorf("line %d: command %q: %w", i+1, op, errors.ErrBadEnumValue)
+		}
+	}
+
+	return append(res, orig[cur:]...), nil
+}
+
+// parseRCSCommand parses a single RCS diff command of the form "aPOS N" or
+// "dPOS N".
+func parseRCSCommand(cmd []byte) (op byte, pos, n int, err error) {
+	if len(cmd) < 2 {
+		return 0, 0, 0, fmt.Errorf("command %q: %w", cmd, errors.ErrBadEnumValue)
+	}
+
+	op = cmd[0]
+	posStr, nStr, ok := strings.Cut(string(cmd[1:]), " ")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("command %q: no number of lines", cmd)
+	}
+
+	pos, err = strconv.Atoi(posStr)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("command %q: position: %w", cmd, err)
+	}
+
+	n, err = strconv.Atoi(nStr)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("command %q: number of lines: %w", cmd, err)
+	}
+
+	if pos < 0 || n < 0 {
+		return 0, 0, 0, fmt.Errorf("command %q: %w", cmd, errors.ErrNegative)
+	}
+
+	return op, pos, n, nil
+}
@@ -0,0 +1,239 @@
+package rulelist_test
+
+import (
+	// #nosec G505 -- SHA-1 is required by the differential updates format.
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		in   string
+		want string
+	}{{
+		name: "empty",
+		in:   "",
+		want: "",
+	}, {
+		name: "header",
+		in: "! Title: Test\n" +
+			"! Diff-Path: patches/v1.patch\n" +
+			"||example.org^\n",
+		want: "patches/v1.patch",
+	}, {
+		name: "batch",
+		in: "# Comment\n" +
+			"! Diff-Path: ../patches/batch.patch#list1\n" +
+			"||example.org^\n",
+		want: "../patches/batch.patch#list1",
+	}, {
+		name: "after_rules",
+		in: "||example.org^\n" +
+			"! Diff-Path: patches/v1.patch\n",
+		want: "",
+	}, {
+		name: "empty_path",
+		in:   "! Diff-Path: \n",
+		want: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := make([]byte, rulelist.DefaultRuleBufSize)
+			path, err := rulelist.DiffPath(strings.NewReader(tc.in), buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, path)
+
+			res, err := rulelist.NewParser().Parse(io.Discard, strings.NewReader(tc.in), buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, res.DiffPath)
+		})
+	}
+}
+
+func TestParseDiffHeader(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		in   string
+		want *rulelist.DiffHeader
+	}{{
+		name: "empty",
+		in:   "",
+		want: &rulelist.DiffHeader{},
+	}, {
+		name: "diff_expires",
+		in: "! Expires: 4 days\n" +
+			"! Diff-Path: patches/v1.patch\n" +
+			"! Diff-Expires: 12 hours\n" +
+			"||example.org^\n",
+		want: &rulelist.DiffHeader{
+			Path:    "patches/v1.patch",
+			Expires: 12 * time.Hour,
+		},
+	}, {
+		name: "expires",
+		in: "! Diff-Path: patches/v1.patch\n" +
+			"! Expires: 2 days (update frequency)\n" +
+			"||example.org^\n",
+		want: &rulelist.DiffHeader{
+			Path:    "patches/v1.patch",
+			Expires: 2 * timeutil.Day,
+		},
+	}, {
+		name: "no_unit",
+		in:   "! Diff-Expires: 3\n",
+		want: &rulelist.DiffHeader{
+			Expires: 3 * timeutil.Day,
+		},
+	}, {
+		name: "bad_expires",
+		in: "! Diff-Expires: soon\n" +
+			"! Expires: 0 days\n",
+		want: &rulelist.DiffHeader{},
+	}, {
+		name: "after_rules",
+		in: "||example.org^\n" +
+			"! Diff-Expires: 1 hours\n",
+		want: &rulelist.DiffHeader{},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := make([]byte, rulelist.DefaultRuleBufSize)
+			h, err := rulelist.ParseDiffHeader(strings.NewReader(tc.in), buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, h)
+		})
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	t.Parallel()
+
+	const (
+		orig = "! Diff-Path: v1.patch\n" +
+			"||one.example^\n" +
+			"||two.example^\n" +
+			"||three.example^\n"
+
+		want = "! Diff-Path: v2.patch\n" +
+			"||one.example^\n" +
+			"||three.example^\n" +
+			"||four.example^\n"
+
+		rcs = "d1 1\n" +
+			"a1 1\n" +
+			"! Diff-Path: v2.patch\n" +
+			"d3 1\n" +
+			"a4 1\n" +
+			"||four.example^\n"
+	)
+
+	sum := sha1.Sum([]byte(want))
+	checksum := hex.EncodeToString(sum[:])
+
+	testCases := []struct {
+		name       string
+		patch      string
+		resource   string
+		want       string
+		wantErrMsg string
+	}{{
+		name:       "rcs",
+		patch:      rcs,
+		resource:   "",
+		want:       want,
+		wantErrMsg: "",
+	}, {
+		name:       "empty",
+		patch:      "",
+		resource:   "",
+		want:       orig,
+		wantErrMsg: "",
+	}, {
+		name: "batch",
+		patch: "diff name:other checksum:0000 lines:1\n" +
+			"d1 1\n" +
+			"diff name:list checksum:" + checksum + " lines:6\n" +
+			rcs,
+		resource:   "list",
+		want:       want,
+		wantErrMsg: "",
+	}, {
+		name: "bad_checksum",
+		patch: "diff name:list checksum:0000 lines:6\n" +
+			rcs,
+		resource:   "list",
+		want:       "",
+		wantErrMsg: `applying patch: checksum: got "` + checksum + `", want "0000"`,
+	}, {
+		name:       "resource_not_found",
+		patch:      "diff name:other lines:1\nd1 1\n",
+		resource:   "list",
+		want:       "",
+		wantErrMsg: `applying patch: resource "list": not found`,
+	}, {
+		name:       "not_batch",
+		patch:      rcs,
+		resource:   "list",
+		want:       "",
+		wantErrMsg: `applying patch: resource "list": not a batch patch`,
+	}, {
+		name:       "out_of_range",
+		patch:      "d5 1\n",
+		resource:   "",
+		want:       "",
+		wantErrMsg: "applying patch: line 1: position 5: out of range",
+	}, {
+		name:       "unordered",
+		patch:      "d3 1\nd1 1\n",
+		resource:   "",
+		want:       "",
+		wantErrMsg: "applying patch: line 2: position 1: out of range",
+	}, {
+		name:       "bad_command",
+		patch:      "c1 1\n",
+		resource:   "",
+		want:       "",
+		wantErrMsg: `applying patch: line 1: command 'c': bad enum value`,
+	}, {
+		name:       "missing_lines",
+		patch:      "a1 2\n||four.example^\n",
+		resource:   "",
+		want:       "",
+		wantErrMsg: "applying patch: line 1: lines: out of range",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := rulelist.ApplyPatch([]byte(orig), []byte(tc.patch), tc.resource)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, string(res))
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package rulelist
 
 import (
+	"encoding"
 	"fmt"
 	"math"
 
@@ -37,6 +38,7 @@ const (
 	APIIDParentalControl APIID = -3
 	APIIDSafeBrowsing    APIID = -4
 	APIIDSafeSearch      APIID = -5
+	APIIDClientCustom    APIID = -6
 )
 
 // The IDs of built-in filter lists.  The IDs for the blocked-service and the
@@ -50,6 +52,7 @@ const (
 	IDCustom         rules.ListID = rules.ListID(APIIDCustom)
 	IDBlockedService rules.ListID = math.MaxUint64 - rules.ListID(-APIIDBlockedService) + 1
 	IDSafeSearch     rules.ListID = math.MaxUint64 - rules.ListID(-APIIDSafeSearch) + 1
+	IDClientCustom   rules.ListID = math.MaxUint64 - rules.ListID(-APIIDClientCustom) + 1
 )
 
 // UID is the type for the unique IDs of filtering-rule lists.
@@ -76,6 +79,22 @@ func MustNewUID() (uid UID) {
 // type check
 var _ fmt.Stringer = UID{}
 
+// type check
+var _ encoding.TextMarshaler = UID{}
+
+// MarshalText implements the [encoding.TextMarshaler] for UID.
+func (id UID) MarshalText() (text []byte, err error) {
+	return uuid.UUID(id).MarshalText()
+}
+
+// type check
+var _ encoding.TextUnmarshaler = (*UID)(nil)
+
+// UnmarshalText implements the [encoding.TextUnmarshaler] interface for UID.
+func (id *UID) UnmarshalText(data []byte) (err error) {
+	return (*uuid.UUID)(id).UnmarshalText(data)
+}
+
 // String implements the [fmt.Stringer] interface for UID.
 func (id UID) String() (s string) {
 	return uuid.UUID(id).String()
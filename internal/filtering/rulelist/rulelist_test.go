@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil/urlutil"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/AdguardTeam/urlfilter/rules"
@@ -51,9 +52,8 @@ func newURLFilterID() (id rules.ListID) {
 	return rules.ListID(urlFilterIDCounter.Add(1))
 }
 
-// newFilter is a helper for creating new filters in tests.  It does not
-// register the closing of the filter using t.Cleanup; callers must do that
-// either directly or by using the filter in an engine.
+// newFilter is a helper for creating new enabled filters with new UIDs in
+// tests.
 func newFilter(tb testing.TB, u *url.URL, name string) (f *rulelist.Filter) {
 	tb.Helper()
 
@@ -69,6 +69,38 @@ func newFilter(tb testing.TB, u *url.URL, name string) (f *rulelist.Filter) {
 	return f
 }
 
+// newFilterWithUID is a helper for creating new enabled filters with the given
+// UID in tests.
+func newFilterWithUID(tb testing.TB, u *url.URL, uid rulelist.UID) (f *rulelist.Filter) {
+	tb.Helper()
+
+	f, err := rulelist.NewFilter(&rulelist.FilterConfig{
+		URL:         u,
+		UID:         uid,
+		URLFilterID: newURLFilterID(),
+		Enabled:     true,
+	})
+	require.NoError(tb, err)
+
+	return f
+}
+
+// newStorage is a helper for creating a new storage with the given filters and
+// the cache in cacheDir in tests.
+func newStorage(tb testing.TB, cacheDir string, filters ...*rulelist.Filter) (s *rulelist.Storage) {
+	tb.Helper()
+
+	return rulelist.NewStorage(&rulelist.StorageConfig{
+		Logger: slogutil.NewDiscardLogger(),
+		HTTPClient: &http.Client{
+			Timeout: testTimeout,
+		},
+		CacheDir:            cacheDir,
+		Filters:             filters,
+		MaxRuleListTextSize: rulelist.DefaultMaxRuleListSize,
+	})
+}
+
 // newFilterLocations is a test helper that sets up both the filtering-rule list
 // file and the HTTP-server.  It also registers file removal and server stopping
 // using t.Cleanup.
@@ -128,4 +160,7 @@ func TestIDs(t *testing.T) {
 
 	id = rulelist.IDSafeSearch
 	assert.Equal(t, rulelist.APIIDSafeSearch, rulelist.APIID(id))
+
+	id = rulelist.IDClientCustom
+	assert.Equal(t, rulelist.APIIDClientCustom, rulelist.APIID(id))
 }
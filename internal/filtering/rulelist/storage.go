@@ -3,30 +3,61 @@ package rulelist
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
 	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/syncutil"
 	"github.com/c2h5oh/datasize"
 )
 
-// Storage contains the main filtering engines, including the allowlist, the
-// blocklist, and the user's custom filtering rules.
+// errNoFilter is returned by the methods of [Storage] when there is no
+// rule-list filter with the given UID.
+const errNoFilter errors.Error = "no such rule list"
+
+// Storage contains the rule-list filters by their UIDs and manages the cached
+// contents of the filters: loads them, updates them, and removes them.
 type Storage struct {
-	// refreshMu makes sure that only one update takes place at a time.
+	// logger is used to log the operation of the storage.
+	logger *slog.Logger
+
+	// mu protects filters.
+	mu *sync.RWMutex
+
+	// refreshMu makes sure that only one refresh of all filters takes place at
+	// a time.
 	refreshMu *sync.Mutex
 
-	allow    *Engine
-	block    *Engine
-	custom   *TextEngine
-	httpCli  *http.Client
+	// filters are the rule-list filters by their UIDs.
+	filters map[UID]*Filter
+
+	// httpCli is used to download the remote rule lists and their patches.
+	httpCli *http.Client
+
+	// bufPool is a pool of buffers used for rule-list parsing.
+	bufPool *syncutil.Pool[[]byte]
+
+	// checkFilePath, if not nil, is called before reading a local rule-list
+	// file.
+	checkFilePath func(filePath string) (err error)
+
+	// cacheDir is the directory with the cached contents of the filters.
 	cacheDir string
-	parseBuf []byte
-	maxSize  datasize.ByteSize
+
+	// maxSize is the maximum size of a rule-list file.
+	maxSize datasize.ByteSize
 }
 
-// StorageConfig is the configuration for the filtering-engine storage.
+// StorageConfig is the configuration for the rule-list filter storage.
 type StorageConfig struct {
 	// Logger is used to log the operation of the storage.  It must not be nil.
 	Logger *slog.Logger
@@ -35,80 +66,361 @@ type StorageConfig struct {
 	// It must not be nil.
 	HTTPClient *http.Client
 
+	// CheckFilePath, if not nil, is called with the path of a local rule-list
+	// file before reading it.  If it returns an error, the file isn't read and
+	// the error is returned as the error of the update.
+	CheckFilePath func(filePath string) (err error)
+
 	// CacheDir is the path to the directory used to cache rule-list files.
 	// It must be set.
 	CacheDir string
 
-	// AllowFilters are the filtering-rule lists used to exclude domain names
-	// from the filtering.  Each item must not be nil and must have unique IDs
-	// between AllowFilters and BlockFilters.
-	AllowFilters []*Filter
-
-	// BlockFilters are the filtering-rule lists used to block domain names.
-	// Each item must not be nil and must have unique IDs between AllowFilters
-	// and BlockFilters.
-	BlockFilters []*Filter
-
-	// CustomRules contains custom rules of the user.  They have priority over
-	// both allow- and blacklist rules.
-	CustomRules []string
+	// Filters are the initial rule-list filters.  Each item must not be nil
+	// and must have a unique UID.
+	Filters []*Filter
 
 	// MaxRuleListTextSize is the maximum size of a rule-list file.  It must be
 	// greater than zero.
 	MaxRuleListTextSize datasize.ByteSize
 }
 
-// NewStorage creates a new filtering-engine storage.  The engines are not
-// refreshed, so a refresh should be performed before use.
-func NewStorage(c *StorageConfig) (s *Storage, err error) {
-	custom, err := NewTextEngine(&TextEngineConfig{
-		Name:  EngineNameCustom,
-		Rules: c.CustomRules,
-		ID:    IDCustom,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("creating custom engine: %w", err)
+// NewStorage creates a new rule-list filter storage.  The filters are neither
+// loaded nor refreshed, so either should be performed before use.
+func NewStorage(c *StorageConfig) (s *Storage) {
+	filters := make(map[UID]*Filter, len(c.Filters))
+	for _, f := range c.Filters {
+		filters[f.uid] = f
 	}
 
 	return &Storage{
-		refreshMu: &sync.Mutex{},
-		allow: NewEngine(&EngineConfig{
-			Logger:  c.Logger.With("engine", EngineNameAllow),
-			Name:    EngineNameAllow,
-			Filters: c.AllowFilters,
-		}),
-		block: NewEngine(&EngineConfig{
-			Logger:  c.Logger.With("engine", EngineNameBlock),
-			Name:    EngineNameBlock,
-			Filters: c.BlockFilters,
-		}),
-		custom:   custom,
-		httpCli:  c.HTTPClient,
-		cacheDir: c.CacheDir,
-		parseBuf: make([]byte, DefaultRuleBufSize),
-		maxSize:  c.MaxRuleListTextSize,
-	}, nil
-}
-
-// Close closes the underlying rule-list engines.
-func (s *Storage) Close() (err error) {
-	// Don't wrap the errors since they are informative enough as is.
-	return errors.Join(
-		s.allow.Close(),
-		s.block.Close(),
-	)
+		logger:        c.Logger,
+		mu:            &sync.RWMutex{},
+		refreshMu:     &sync.Mutex{},
+		filters:       filters,
+		httpCli:       c.HTTPClient,
+		bufPool:       syncutil.NewSlicePool[byte](DefaultRuleBufSize),
+		checkFilePath: c.CheckFilePath,
+		cacheDir:      c.CacheDir,
+		maxSize:       c.MaxRuleListTextSize,
+	}
+}
+
+// CachePath returns the path to the cached contents of the rule-list filter
+// with the given UID.
+func (s *Storage) CachePath(uid UID) (p string) {
+	return filepath.Join(s.cacheDir, uid.String()+".txt")
+}
+
+// Filter returns the rule-list filter with the given UID, if any.
+func (s *Storage) Filter(uid UID) (f *Filter, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok = s.filters[uid]
+
+	return f, ok
+}
+
+// Set adds f to s, replacing the rule-list filter with the same UID, if any.
+// If the replaced filter has another URL, the unprocessed copy of its contents
+// is removed, since the differential updates of the previous list don't apply
+// to the new one.  f must not be nil.
+func (s *Storage) Set(ctx context.Context, f *Filter) {
+	s.mu.Lock()
+	prev, ok := s.filters[f.uid]
+	s.filters[f.uid] = f
+	s.mu.Unlock()
+
+	if ok && prev.url.String() != f.url.String() {
+		s.removeRawCopy(ctx, f.uid)
+	}
+}
+
+// Remove removes the rule-list filter with the given UID from s.  Its cached
+// contents are moved aside into a file with the ".old" suffix, and the
+// unprocessed copy, if any, is removed.
+func (s *Storage) Remove(ctx context.Context, uid UID) (err error) {
+	s.mu.Lock()
+	delete(s.filters, uid)
+	s.mu.Unlock()
+
+	p := s.CachePath(uid)
+	err = os.Rename(p, p+".old")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("renaming cache file: %w", err)
+	}
+
+	s.removeRawCopy(ctx, uid)
+
+	return nil
 }
 
-// Refresh updates all engines in s.
-//
-// TODO(a.garipov): Refresh allow and block separately?
+// Unload disables the rule-list filter with the given UID and clears its data,
+// keeping the time of its last update.
+func (s *Storage) Unload(uid UID) {
+	f, ok := s.Filter(uid)
+	if ok {
+		f.SetEnabled(false)
+		f.unload()
+	}
+}
+
+// Load loads the data of the rule-list filter with the given UID from its
+// cached contents, if there are any.  The error is also set as the error of the
+// filter; see [FilterState.Err].
+func (s *Storage) Load(ctx context.Context, uid UID) (err error) {
+	f, ok := s.Filter(uid)
+	if !ok {
+		return &FilterError{
+			Err: errNoFilter,
+			UID: uid,
+		}
+	}
+
+	err = s.load(ctx, f)
+	f.setError(err)
+
+	return f.State().Err
+}
+
+// load parses the cached contents of f and sets its data.
+func (s *Storage) load(ctx context.Context, f *Filter) (err error) {
+	cachePath := s.CachePath(f.uid)
+
+	s.logger.DebugContext(ctx, "loading filter", "uid", f.uid, "path", cachePath)
+
+	// #nosec G304 -- Assume that cachePath is always cacheDir joined with a
+	// uid using [filepath.Join].
+	file, err := os.Open(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		// Do nothing, file doesn't exist.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("opening filter file: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, file.Close()) }()
+
+	st, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("getting filter file stat: %w", err)
+	}
+
+	s.logger.DebugContext(ctx, "filter file", "uid", f.uid, "path", cachePath, "len", st.Size())
+
+	bufPtr := s.bufPool.Get()
+	defer s.bufPool.Put(bufPtr)
+
+	res, err := NewParser().Parse(io.Discard, file, *bufPtr)
+	if err != nil {
+		return fmt.Errorf("parsing filter file: %w", err)
+	}
+
+	f.setParsed(res)
+	f.setResult(st.ModTime(), nil)
+
+	return nil
+}
+
+// Refresh updates all enabled rule-list filters in s.  err contains the
+// *FilterError of each filter that has failed to update.
 func (s *Storage) Refresh(ctx context.Context) (err error) {
 	s.refreshMu.Lock()
 	defer s.refreshMu.Unlock()
 
+	s.mu.RLock()
+	filters := make([]*Filter, 0, len(s.filters))
+	for _, f := range s.filters {
+		filters = append(filters, f)
+	}
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, f := range filters {
+		if !f.Enabled() {
+			continue
+		}
+
+		_, err = s.refresh(ctx, f)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	// Don't wrap the errors since they are informative enough as is.
-	return errors.Join(
-		s.allow.Refresh(ctx, s.parseBuf, s.httpCli, s.cacheDir, s.maxSize),
-		s.block.Refresh(ctx, s.parseBuf, s.httpCli, s.cacheDir, s.maxSize),
+	return errors.Join(errs...)
+}
+
+// RefreshFilter updates the rule-list filter with the given UID.  updated is
+// true if the rules of the filter have changed.  err is a *FilterError, which
+// is also set as the error of the filter; see [FilterState.Err].
+func (s *Storage) RefreshFilter(ctx context.Context, uid UID) (updated bool, err error) {
+	f, ok := s.Filter(uid)
+	if !ok {
+		return false, &FilterError{
+			Err: errNoFilter,
+			UID: uid,
+		}
+	}
+
+	return s.refresh(ctx, f)
+}
+
+// refresh updates f and sets the time and the error of the update.  It also
+// updates the modification time of the cached contents if they haven't
+// changed.
+func (s *Storage) refresh(ctx context.Context, f *Filter) (updated bool, err error) {
+	updated, err = s.update(ctx, f)
+	now := time.Now()
+	f.setResult(now, err)
+	if !updated {
+		chErr := os.Chtimes(s.CachePath(f.uid), now, now)
+		if chErr != nil && !errors.Is(chErr, os.ErrNotExist) {
+			s.logger.ErrorContext(ctx, "changing last modified time", slogutil.KeyError, chErr)
+		}
+	}
+
+	return updated, f.State().Err
+}
+
+// update updates the cached contents of f.  It returns true if the rules have
+// changed.
+func (s *Storage) update(ctx context.Context, f *Filter) (ok bool, err error) {
+	ok, handled := s.updateWithPatches(ctx, f)
+	if handled {
+		return ok, nil
+	}
+
+	s.logger.DebugContext(ctx, "downloading update for filter", "uid", f.uid, "url", f.url)
+
+	var res *ParseResult
+
+	tmpFile, err := aghrenameio.NewPendingFile(s.CachePath(f.uid), aghos.DefaultPermFile)
+	if err != nil {
+		return false, err
+	}
+	defer func() { err = s.finalizeUpdate(ctx, tmpFile, f, res, err, ok) }()
+
+	r, err := s.reader(ctx, f)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return false, err
+	}
+	defer func() { err = errors.WithDeferred(err, r.Close()) }()
+
+	rawFile, err := s.newRawCopy(f)
+	if err != nil {
+		return false, err
+	}
+
+	src := io.Reader(r)
+	if !f.isLocal() {
+		src = ioutil.LimitReader(r, s.maxSize.Bytes())
+	}
+
+	if rawFile != nil {
+		src = io.TeeReader(src, rawFile)
+	}
+
+	bufPtr := s.bufPool.Get()
+	defer s.bufPool.Put(bufPtr)
+
+	res, err = NewParser().Parse(tmpFile, src, *bufPtr)
+	if rawFile != nil {
+		err = s.finalizeRawCopy(ctx, rawFile, f, res, err)
+	}
+
+	return err == nil && res.Checksum != f.checksum(), err
+}
+
+// finalizeUpdate closes and gets rid of the temporary file with the contents of
+// f according to updated.  It also saves the new data of f if succeeded.
+func (s *Storage) finalizeUpdate(
+	ctx context.Context,
+	file aghrenameio.PendingFile,
+	f *Filter,
+	res *ParseResult,
+	returned error,
+	updated bool,
+) (err error) {
+	if !updated {
+		if returned == nil {
+			s.logger.DebugContext(ctx, "skipping filter with no changes", "uid", f.uid, "url", f.url)
+		}
+
+		return errors.WithDeferred(returned, file.Cleanup())
+	}
+
+	s.logger.InfoContext(ctx, "saving contents", "uid", f.uid, "path", s.CachePath(f.uid))
+
+	err = file.CloseReplace()
+	if err != nil {
+		return fmt.Errorf("finalizing update: %w", err)
+	}
+
+	s.logger.InfoContext(
+		ctx,
+		"filter updated",
+		"uid", f.uid,
+		"bytes_written", res.BytesWritten,
+		"rules_count", res.RulesCount,
 	)
+
+	f.setParsed(res)
+
+	return nil
+}
+
+// reader returns an io.ReadCloser reading the rule-list data of f from either a
+// file on the filesystem or the HTTP URL.
+func (s *Storage) reader(ctx context.Context, f *Filter) (r io.ReadCloser, err error) {
+	if !f.isLocal() {
+		r, err = s.readerFromURL(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("reading from url: %w", err)
+		}
+
+		return r, nil
+	}
+
+	filePath := filepath.Clean(f.url.Path)
+	if s.checkFilePath != nil {
+		err = s.checkFilePath(filePath)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	// #nosec G304 -- Trust the path explicitly given by the user and checked
+	// by checkFilePath.
+	r, err = os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+
+	return r, nil
+}
+
+// readerFromURL returns an io.ReadCloser reading the rule-list data of f from
+// its HTTP URL.
+func (s *Storage) readerFromURL(ctx context.Context, f *Filter) (r io.ReadCloser, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+
+	// #nosec G704 -- Trust the URL explicitly given by the user.
+	resp, err := s.httpCli.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+
+		return nil, errors.WithDeferred(err, resp.Body.Close())
+	}
+
+	return resp.Body, nil
 }
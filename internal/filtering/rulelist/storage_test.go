@@ -1,49 +1,144 @@
 package rulelist_test
 
 import (
-	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
-	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil/urlutil"
 	"github.com/AdguardTeam/golibs/testutil"
-	"github.com/c2h5oh/datasize"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+func TestStorage_RefreshFilter(t *testing.T) {
+	t.Parallel()
+
+	const fltData = testRuleTextTitle + testRuleTextBlocked
+
+	srcDir := t.TempDir()
+	fileURL, srvURL := newFilterLocations(t, srcDir, fltData, fltData)
+
+	testCases := []struct {
+		url  *url.URL
+		name string
+	}{{
+		url:  fileURL,
+		name: "file",
+	}, {
+		url:  srvURL,
+		name: "http",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := newFilter(t, tc.url, "")
+			uid := f.UID()
+			strg := newStorage(t, t.TempDir(), f)
+
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			updated, err := strg.RefreshFilter(ctx, uid)
+			require.NoError(t, err)
+
+			assert.True(t, updated)
+
+			st := f.State()
+			assert.Equal(t, testTitle, st.Title)
+			assert.Equal(t, 1, st.RulesCount)
+			assert.NoError(t, st.Err)
+			assert.False(t, st.Updated.IsZero())
+			assert.Equal(t, testTitle, f.Name())
+
+			data, err := os.ReadFile(strg.CachePath(uid))
+			require.NoError(t, err)
+
+			assert.Equal(t, testRuleTextBlocked, string(data))
+
+			updated, err = strg.RefreshFilter(ctx, uid)
+			require.NoError(t, err)
+
+			assert.False(t, updated)
+
+			// The data is loaded from the cache by a new storage.
+			loaded := newFilterWithUID(t, tc.url, uid)
+			err = newStorage(t, filepath.Dir(strg.CachePath(uid)), loaded).Load(ctx, uid)
+			require.NoError(t, err)
+
+			assert.Equal(t, 1, loaded.State().RulesCount)
+		})
+	}
+}
+
+func TestStorage_RefreshFilter_error(t *testing.T) {
+	t.Parallel()
+
+	badURL := &url.URL{
+		Scheme: urlutil.SchemeFile,
+		Path:   filepath.Join(t.TempDir(), "nonexistent.txt"),
+	}
+
+	f := newFilter(t, badURL, "Bad Filter")
+	uid := f.UID()
+	strg := newStorage(t, t.TempDir(), f)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	_, err := strg.RefreshFilter(ctx, uid)
+	require.Error(t, err)
+
+	fltErr := &rulelist.FilterError{}
+	require.ErrorAs(t, err, &fltErr)
+
+	assert.Equal(t, uid, fltErr.UID)
+	assert.ErrorIs(t, fltErr, os.ErrNotExist)
+	assert.Equal(t, err, f.State().Err)
+
+	_, err = strg.RefreshFilter(ctx, rulelist.MustNewUID())
+	assert.Error(t, err)
+}
+
+func TestStorage_Remove(t *testing.T) {
+	t.Parallel()
+
+	fileURL, _ := newFilterLocations(t, t.TempDir(), testRuleTextBlocked, "")
+	f := newFilter(t, fileURL, "")
+	uid := f.UID()
+	strg := newStorage(t, t.TempDir(), f)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	_, err := strg.RefreshFilter(ctx, uid)
+	require.NoError(t, err)
+
+	err = strg.Remove(ctx, uid)
+	require.NoError(t, err)
+
+	_, ok := strg.Filter(uid)
+	assert.False(t, ok)
+
+	assert.NoFileExists(t, strg.CachePath(uid))
+	assert.FileExists(t, strg.CachePath(uid)+".old")
+}
+
 func TestStorage_Refresh(t *testing.T) {
 	t.Parallel()
 
-	cacheDir := t.TempDir()
+	srcDir := t.TempDir()
 
-	allowedFileURL, _ := newFilterLocations(t, cacheDir, testRuleTextAllowed, "")
+	allowedFileURL, _ := newFilterLocations(t, srcDir, testRuleTextAllowed, "")
 	allowedFlt := newFilter(t, allowedFileURL, "Allowed 1")
 
-	blockedFileURL, _ := newFilterLocations(t, cacheDir, testRuleTextBlocked, "")
+	blockedFileURL, _ := newFilterLocations(t, srcDir, testRuleTextBlocked, "")
 	blockedFlt := newFilter(t, blockedFileURL, "Blocked 1")
 
-	strg, err := rulelist.NewStorage(&rulelist.StorageConfig{
-		Logger: slogutil.NewDiscardLogger(),
-		HTTPClient: &http.Client{
-			Timeout: testTimeout,
-		},
-		CacheDir: cacheDir,
-		AllowFilters: []*rulelist.Filter{
-			allowedFlt,
-		},
-		BlockFilters: []*rulelist.Filter{
-			blockedFlt,
-		},
-		CustomRules: []string{
-			testRuleTextBlocked2,
-		},
-		MaxRuleListTextSize: 1 * datasize.KB,
-	})
-	require.NoError(t, err)
-	testutil.CleanupAndRequireSuccess(t, strg.Close)
+	strg := newStorage(t, t.TempDir(), allowedFlt, blockedFlt)
 
 	ctx := testutil.ContextWithTimeout(t, testTimeout)
-	err = strg.Refresh(ctx)
-	assert.NoError(t, err)
+	err := strg.Refresh(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, allowedFlt.State().RulesCount)
+	assert.Equal(t, 1, blockedFlt.State().RulesCount)
 }
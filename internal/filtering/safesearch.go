@@ -1,6 +1,12 @@
 package filtering
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
 
 // SafeSearch interface describes a service for search engines hosts rewrites.
 //
@@ -32,6 +38,41 @@ type SafeSearchConfig struct {
 	Pixabay    bool `yaml:"pixabay" json:"pixabay"`
 	Yandex     bool `yaml:"yandex" json:"yandex"`
 	YouTube    bool `yaml:"youtube" json:"youtube"`
+
+	// Providers maps the IDs of the custom safe search providers to the flags
+	// indicating if they are enabled.  Providers missing from it are disabled.
+	// It must not be modified after it's set.
+	Providers map[string]bool `yaml:"providers,omitempty" json:"providers,omitempty"`
+}
+
+// ValidateProviderIDs returns an error if c contains the flags of the providers
+// that aren't among ps.
+func (c *SafeSearchConfig) ValidateProviderIDs(ps []*SafeSearchProvider) (err error) {
+	var errs []error
+	for id := range c.Providers {
+		if !slices.ContainsFunc(ps, func(p *SafeSearchProvider) (ok bool) { return p.ID == id }) {
+			errs = append(errs, fmt.Errorf("providers: unknown provider %q", id))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SafeSearchProvider is a custom safe search provider defined by the
+// administrator in addition to the builtin services.
+type SafeSearchProvider struct {
+	// ID is the unique identifier of the provider, which is used as the key in
+	// [SafeSearchConfig.Providers].  It must not be empty and must not be the
+	// same as the one of a builtin service.
+	ID string `yaml:"id" json:"id"`
+
+	// Name is the human-readable name of the provider.
+	Name string `yaml:"name" json:"name"`
+
+	// Hosts maps the domain names of the provider to the safe hosts, which are
+	// either the domain names used as CNAME or IP addresses.  It must not be
+	// empty.
+	Hosts map[string]string `yaml:"hosts" json:"hosts"`
 }
 
 // checkSafeSearch checks host with safe search engine.  Matches
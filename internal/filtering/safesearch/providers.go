@@ -0,0 +1,100 @@
+package safesearch
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// ValidateProviders returns an error if any of the custom safe search
+// providers is invalid.
+func ValidateProviders(ps []*filtering.SafeSearchProvider) (err error) {
+	ids := container.NewMapSet[string]()
+	for i, p := range ps {
+		err = validateProvider(p)
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		if ids.Has(p.ID) {
+			return fmt.Errorf("at index %d: id: %w: %q", i, errors.ErrDuplicated, p.ID)
+		}
+
+		ids.Add(p.ID)
+	}
+
+	return nil
+}
+
+// validateProvider returns an error if p is invalid.
+func validateProvider(p *filtering.SafeSearchProvider) (err error) {
+	switch {
+	case p == nil:
+		return errors.ErrNoValue
+	case p.ID == "":
+		return fmt.Errorf("id: %w", errors.ErrEmptyValue)
+	case isBuiltinService(p.ID):
+		return fmt.Errorf("id: %w: %q is a builtin service", errors.ErrDuplicated, p.ID)
+	case len(p.Hosts) == 0:
+		return fmt.Errorf("hosts: %w", errors.ErrEmptyValue)
+	}
+
+	for host, safe := range p.Hosts {
+		err = netutil.ValidateHostname(host)
+		if err != nil {
+			return fmt.Errorf("hosts: %q: %w", host, err)
+		}
+
+		if _, ipErr := netip.ParseAddr(safe); ipErr == nil {
+			continue
+		}
+
+		err = netutil.ValidateHostname(safe)
+		if err != nil {
+			return fmt.Errorf("hosts: %q: safe host: %w", host, err)
+		}
+	}
+
+	return nil
+}
+
+// isBuiltinService returns true if id is the name of a builtin service.
+func isBuiltinService(id string) (ok bool) {
+	_, ok = safeSearchRules[Service(id)]
+
+	return ok
+}
+
+// providerRules returns the text of the DNS rewrite rules of the custom safe
+// search provider.  p must be valid.
+func providerRules(p *filtering.SafeSearchProvider) (text string) {
+	hosts := make([]string, 0, len(p.Hosts))
+	for host := range p.Hosts {
+		hosts = append(hosts, host)
+	}
+
+	slices.Sort(hosts)
+
+	var sb strings.Builder
+	for _, host := range hosts {
+		safe := p.Hosts[host]
+
+		rrType := "CNAME"
+		if ip, err := netip.ParseAddr(safe); err == nil {
+			rrType = "A"
+			if ip.Is6() {
+				rrType = "AAAA"
+			}
+		}
+
+		_, _ = fmt.Fprintf(&sb, "|%s^$dnsrewrite=NOERROR;%s;%s\n", strings.ToLower(host), rrType, safe)
+	}
+
+	return sb.String()
+}
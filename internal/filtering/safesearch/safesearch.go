@@ -84,6 +84,10 @@ type DefaultConfig struct {
 	// ServicesConfig contains safe search settings for services.  It must not
 	// be nil.
 	ServicesConfig filtering.SafeSearchConfig
+
+	// Providers are the custom safe search providers, which are used when
+	// enabled in ServicesConfig.  They must be valid, see [ValidateProviders].
+	Providers []*filtering.SafeSearchProvider
 }
 
 // Default is the default safe search filter that uses filtering rules with the
@@ -104,6 +108,9 @@ type Default struct {
 
 	// cacheTTL is the Time to Live duration for cached items.
 	cacheTTL time.Duration
+
+	// providers are the custom safe search providers.
+	providers []*filtering.SafeSearchProvider
 }
 
 // NewDefault returns an initialized default safe search filter.  ctx is used
@@ -116,7 +123,8 @@ func NewDefault(ctx context.Context, conf *DefaultConfig) (ss *Default, err erro
 			EnableLRU: true,
 			MaxSize:   conf.CacheSize,
 		}),
-		cacheTTL: conf.CacheTTL,
+		cacheTTL:  conf.CacheTTL,
+		providers: conf.Providers,
 	}
 
 	// TODO(s.chzhen):  Move to [Default.InitialRefresh].
@@ -149,6 +157,12 @@ func (ss *Default) resetEngine(
 		}
 	}
 
+	for _, p := range ss.providers {
+		if conf.Providers[p.ID] {
+			sb.WriteString(providerRules(p))
+		}
+	}
+
 	strList := []filterlist.Interface{
 		filterlist.NewString(&filterlist.StringConfig{
 			ID:             id,
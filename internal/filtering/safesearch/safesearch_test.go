@@ -223,3 +223,105 @@ func TestDefault_Update(t *testing.T) {
 
 	assert.False(t, res.IsFiltered)
 }
+
+func TestDefault_CheckHost_providers(t *testing.T) {
+	safeIP := netip.MustParseAddr("192.0.2.1")
+
+	providers := []*filtering.SafeSearchProvider{{
+		ID:   "brave",
+		Name: "Brave Search",
+		Hosts: map[string]string{
+			"search.brave.com": "safesearch.brave.com",
+		},
+	}, {
+		ID:   "startpage",
+		Name: "Startpage",
+		Hosts: map[string]string{
+			"www.startpage.com": safeIP.String(),
+		},
+	}}
+
+	conf := testConf
+	conf.Providers = map[string]bool{
+		"brave":     true,
+		"startpage": true,
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	ss, err := safesearch.NewDefault(ctx, &safesearch.DefaultConfig{
+		Logger:         testLogger,
+		ServicesConfig: conf,
+		CacheSize:      testCacheSize,
+		CacheTTL:       testCacheTTL,
+		Providers:      providers,
+	})
+	require.NoError(t, err)
+
+	res, err := ss.CheckHost(ctx, "search.brave.com", testQType)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+	assert.Equal(t, "safesearch.brave.com", res.CanonName)
+
+	res, err = ss.CheckHost(ctx, "www.startpage.com", testQType)
+	require.NoError(t, err)
+
+	require.Len(t, res.Rules, 1)
+	assert.Equal(t, safeIP, res.Rules[0].IP)
+
+	conf.Providers = map[string]bool{
+		"brave": true,
+	}
+
+	err = ss.Update(ctx, conf)
+	require.NoError(t, err)
+
+	res, err = ss.CheckHost(ctx, "www.startpage.com", testQType)
+	require.NoError(t, err)
+
+	assert.False(t, res.IsFiltered)
+}
+
+func TestValidateProviders(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		providers  []*filtering.SafeSearchProvider
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		providers: []*filtering.SafeSearchProvider{{
+			ID:    "qwant",
+			Hosts: map[string]string{"www.qwant.com": "safeapi.qwant.com"},
+		}},
+	}, {
+		name:       "builtin",
+		wantErrMsg: `at index 0: id: duplicated value: "google" is a builtin service`,
+		providers: []*filtering.SafeSearchProvider{{
+			ID:    "google",
+			Hosts: map[string]string{"www.google.com": "forcesafesearch.google.com"},
+		}},
+	}, {
+		name:       "no_hosts",
+		wantErrMsg: "at index 0: hosts: empty value",
+		providers: []*filtering.SafeSearchProvider{{
+			ID: "qwant",
+		}},
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `at index 1: id: duplicated value: "qwant"`,
+		providers: []*filtering.SafeSearchProvider{{
+			ID:    "qwant",
+			Hosts: map[string]string{"www.qwant.com": "safeapi.qwant.com"},
+		}, {
+			ID:    "qwant",
+			Hosts: map[string]string{"qwant.com": "safeapi.qwant.com"},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, safesearch.ValidateProviders(tc.providers))
+		})
+	}
+}
@@ -54,6 +54,13 @@ func (d *DNSFilter) handleSafeSearchSettings(w http.ResponseWriter, r *http.Requ
 	}
 
 	conf := *req
+	err = d.validateSafeSearchProviderIDs(&conf)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "validating: %s", err)
+
+		return
+	}
+
 	err = d.safeSearch.Update(ctx, conf)
 	if err != nil {
 		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "updating: %s", err)
@@ -72,3 +79,35 @@ func (d *DNSFilter) handleSafeSearchSettings(w http.ResponseWriter, r *http.Requ
 
 	aghhttp.OK(ctx, l, w)
 }
+
+// safeSearchProvidersJSON is the response body for the GET
+// /control/safesearch/providers HTTP API.
+type safeSearchProvidersJSON struct {
+	Providers []*SafeSearchProvider `json:"providers"`
+}
+
+// handleSafeSearchProviders is the handler for GET
+// /control/safesearch/providers HTTP API.
+func (d *DNSFilter) handleSafeSearchProviders(w http.ResponseWriter, r *http.Request) {
+	resp := &safeSearchProvidersJSON{
+		Providers: []*SafeSearchProvider{},
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		resp.Providers = append(resp.Providers, d.conf.SafeSearchProviders...)
+	}()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
+}
+
+// validateSafeSearchProviderIDs returns an error if conf contains the flags of
+// unknown custom safe search providers.
+func (d *DNSFilter) validateSafeSearchProviderIDs(conf *SafeSearchConfig) (err error) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	return conf.ValidateProviderIDs(d.conf.SafeSearchProviders)
+}
@@ -0,0 +1,322 @@
+package filtering
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// ScheduledSettings are the filtering settings applied to a client only within
+// the time ranges of a schedule.  Outside of the schedule, the settings of the
+// client are left as is.
+type ScheduledSettings struct {
+	// Schedule is the weekly schedule within which the settings are applied.
+	// It must not be nil.
+	Schedule *schedule.Weekly `json:"schedule" yaml:"schedule"`
+
+	// FilteringEnabled, if not nil, overrides the filtering setting of the
+	// client.
+	FilteringEnabled *bool `json:"filtering_enabled,omitempty" yaml:"filtering_enabled,omitempty"`
+
+	// ParentalEnabled, if not nil, overrides the parental control setting of
+	// the client.
+	ParentalEnabled *bool `json:"parental_enabled,omitempty" yaml:"parental_enabled,omitempty"`
+
+	// SafeSearchEnabled, if not nil, overrides the safe search setting of the
+	// client.
+	SafeSearchEnabled *bool `json:"safesearch_enabled,omitempty" yaml:"safesearch_enabled,omitempty"`
+
+	// FilterGroups are the names of the filter groups additionally applied to
+	// the client.
+	FilterGroups []string `json:"filter_groups,omitempty" yaml:"filter_groups,omitempty"`
+}
+
+// Clone returns a deep copy of ss.
+func (ss *ScheduledSettings) Clone() (c *ScheduledSettings) {
+	if ss == nil {
+		return nil
+	}
+
+	return &ScheduledSettings{
+		Schedule:          ss.Schedule.Clone(),
+		FilteringEnabled:  cloneBoolPtr(ss.FilteringEnabled),
+		ParentalEnabled:   cloneBoolPtr(ss.ParentalEnabled),
+		SafeSearchEnabled: cloneBoolPtr(ss.SafeSearchEnabled),
+		FilterGroups:      slices.Clone(ss.FilterGroups),
+	}
+}
+
+// CloneScheduledSettings returns a deep copy of sss.
+func CloneScheduledSettings(sss []*ScheduledSettings) (clone []*ScheduledSettings) {
+	if sss == nil {
+		return nil
+	}
+
+	clone = make([]*ScheduledSettings, 0, len(sss))
+	for _, ss := range sss {
+		clone = append(clone, ss.Clone())
+	}
+
+	return clone
+}
+
+// cloneBoolPtr returns a pointer to a copy of the value of p or nil if p is
+// nil.
+func cloneBoolPtr(p *bool) (c *bool) {
+	if p == nil {
+		return nil
+	}
+
+	v := *p
+
+	return &v
+}
+
+// validate returns an error if ss is invalid.
+func (ss *ScheduledSettings) validate() (err error) {
+	switch {
+	case ss == nil:
+		return errors.ErrNoValue
+	case ss.Schedule == nil:
+		return fmt.Errorf("schedule: %w", errors.ErrNoValue)
+	case ss.FilteringEnabled == nil &&
+		ss.ParentalEnabled == nil &&
+		ss.SafeSearchEnabled == nil &&
+		len(ss.FilterGroups) == 0:
+		return errors.Error("no settings to apply")
+	}
+
+	groups := container.NewMapSet[string]()
+	for i, g := range ss.FilterGroups {
+		switch {
+		case g == "":
+			return fmt.Errorf("filter_groups: at index %d: %w", i, errors.ErrEmptyValue)
+		case groups.Has(g):
+			return fmt.Errorf("filter_groups: at index %d: %w: %q", i, errors.ErrDuplicated, g)
+		default:
+			groups.Add(g)
+		}
+	}
+
+	return nil
+}
+
+// ValidateScheduledSettings returns an error if any of the scheduled settings
+// is invalid.  Several items may be used to apply the same settings within
+// several time ranges of a day.
+func ValidateScheduledSettings(sss []*ScheduledSettings) (err error) {
+	for i, ss := range sss {
+		err = ss.validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// apply overrides the settings in setts if the schedule contains now.  setts
+// must not be nil.
+func (ss *ScheduledSettings) apply(setts *Settings, now time.Time) {
+	if !ss.Schedule.Contains(now) {
+		return
+	}
+
+	if ss.FilteringEnabled != nil {
+		setts.FilteringEnabled = *ss.FilteringEnabled
+	}
+
+	if ss.ParentalEnabled != nil {
+		setts.ParentalEnabled = *ss.ParentalEnabled
+	}
+
+	if ss.SafeSearchEnabled != nil {
+		setts.SafeSearchEnabled = *ss.SafeSearchEnabled
+	}
+
+	for _, g := range ss.FilterGroups {
+		if !slices.Contains(setts.FilterGroups, g) {
+			setts.FilterGroups = append(setts.FilterGroups, g)
+		}
+	}
+}
+
+// TagSchedules are the scheduled settings applied to all clients with a tag.
+type TagSchedules struct {
+	// Tag is the client tag.  It must not be empty.
+	Tag string `json:"tag" yaml:"tag"`
+
+	// Schedules are the scheduled settings of the tag.  Items must not be nil.
+	Schedules []*ScheduledSettings `json:"schedules" yaml:"schedules"`
+}
+
+// validateTagSchedules returns an error if tagSchedules are invalid.
+func validateTagSchedules(tagSchedules []*TagSchedules) (err error) {
+	defer func() { err = errors.Annotate(err, "tag_schedules: %w") }()
+
+	tags := container.NewMapSet[string]()
+	for i, ts := range tagSchedules {
+		switch {
+		case ts == nil:
+			return fmt.Errorf("at index %d: %w", i, errors.ErrNoValue)
+		case ts.Tag == "":
+			return fmt.Errorf("at index %d: tag: %w", i, errors.ErrEmptyValue)
+		case tags.Has(ts.Tag):
+			return fmt.Errorf("at index %d: tag: %w: %q", i, errors.ErrDuplicated, ts.Tag)
+		default:
+			tags.Add(ts.Tag)
+		}
+
+		err = ValidateScheduledSettings(ts.Schedules)
+		if err != nil {
+			return fmt.Errorf("at index %d: schedules: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateScheduledGroups returns an error if any of the scheduled settings
+// refers to a filter group that isn't configured.
+func (d *DNSFilter) ValidateScheduledGroups(sss []*ScheduledSettings) (err error) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	return d.validateScheduledGroups(sss)
+}
+
+// validateScheduledGroups returns an error if any of the scheduled settings
+// refers to a filter group that isn't configured.  d.confMu is expected to be
+// locked.
+func (d *DNSFilter) validateScheduledGroups(sss []*ScheduledSettings) (err error) {
+	for i, ss := range sss {
+		for _, g := range ss.FilterGroups {
+			if !d.hasFilterGroup(g) {
+				return fmt.Errorf("at index %d: filter_groups: unknown group %q", i, g)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateKnownTagSchedules returns an error if tagSchedules refer to client
+// tags that aren't available or to filter groups that aren't configured.
+// d.confMu is expected to be locked.
+func (d *DNSFilter) validateKnownTagSchedules(tagSchedules []*TagSchedules) (err error) {
+	defer func() { err = errors.Annotate(err, "tag_schedules: %w") }()
+
+	for i, ts := range tagSchedules {
+		if _, ok := slices.BinarySearch(d.conf.ClientTags, ts.Tag); !ok {
+			return fmt.Errorf("at index %d: tag: %w: %q", i, errors.ErrBadEnumValue, ts.Tag)
+		}
+
+		err = d.validateScheduledGroups(ts.Schedules)
+		if err != nil {
+			return fmt.Errorf("at index %d: schedules: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// applySchedules applies the scheduled settings of the client tags and then
+// the ones of the client itself from setts to setts, so that the latter take
+// precedence.  Within a single list, the later items take precedence.  setts
+// must not be nil.
+func (d *DNSFilter) applySchedules(setts *Settings, now time.Time) {
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		for _, ts := range d.conf.TagSchedules {
+			if !slices.Contains(setts.ClientTags, ts.Tag) {
+				continue
+			}
+
+			for _, ss := range ts.Schedules {
+				ss.apply(setts, now)
+			}
+		}
+	}()
+
+	for _, ss := range setts.ClientSchedules {
+		ss.apply(setts, now)
+	}
+}
+
+// tagSchedulesListJSON is the request and response body for the tag schedules
+// HTTP API.
+type tagSchedulesListJSON struct {
+	Tags []*TagSchedules `json:"tags"`
+}
+
+// handleTagSchedules is the handler for the GET /control/filtering/tag_schedules
+// HTTP API.
+func (d *DNSFilter) handleTagSchedules(w http.ResponseWriter, r *http.Request) {
+	resp := &tagSchedulesListJSON{
+		Tags: []*TagSchedules{},
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		for _, ts := range d.conf.TagSchedules {
+			resp.Tags = append(resp.Tags, &TagSchedules{
+				Tag:       ts.Tag,
+				Schedules: CloneScheduledSettings(ts.Schedules),
+			})
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
+}
+
+// handleTagSchedulesUpdate is the handler for the PUT
+// /control/filtering/tag_schedules/update HTTP API.
+func (d *DNSFilter) handleTagSchedulesUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := d.logger
+
+	req := &tagSchedulesListJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = validateTagSchedules(req.Tags)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		err = d.validateKnownTagSchedules(req.Tags)
+		if err == nil {
+			d.conf.TagSchedules = req.Tags
+		}
+	}()
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	l.DebugContext(ctx, "updated tag schedules", "num", len(req.Tags))
+
+	d.conf.ConfModifier.Apply(ctx)
+}
@@ -0,0 +1,235 @@
+package filtering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_applySchedules(t *testing.T) {
+	var (
+		enabled  = true
+		disabled = false
+	)
+
+	const clientID = "kid"
+
+	clientSchedules := []*ScheduledSettings{{
+		Schedule:          schedule.FullWeekly(),
+		SafeSearchEnabled: &enabled,
+	}, {
+		Schedule:        schedule.EmptyWeekly(),
+		ParentalEnabled: &enabled,
+	}}
+
+	d, _ := newForTest(t, &Config{
+		ApplyClientFiltering: func(id string, _ netip.Addr, setts *Settings) {
+			setts.ClientTags = []string{"user_child"}
+			if id == clientID {
+				setts.ClientSchedules = clientSchedules
+			}
+		},
+		BlockedServices: &BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+		},
+		TagSchedules: []*TagSchedules{{
+			Tag: "user_child",
+			Schedules: []*ScheduledSettings{{
+				Schedule:          schedule.FullWeekly(),
+				FilteringEnabled:  &disabled,
+				SafeSearchEnabled: &disabled,
+				FilterGroups:      []string{"social"},
+			}},
+		}, {
+			Tag: "device_pc",
+			Schedules: []*ScheduledSettings{{
+				Schedule:        schedule.FullWeekly(),
+				ParentalEnabled: &enabled,
+			}},
+		}},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	testCases := []struct {
+		name           string
+		clientID       string
+		wantGroups     []string
+		wantFiltering  bool
+		wantSafeSearch bool
+		wantParental   bool
+	}{{
+		name:           "client",
+		clientID:       clientID,
+		wantGroups:     []string{"social"},
+		wantFiltering:  false,
+		wantSafeSearch: true,
+		wantParental:   false,
+	}, {
+		name:           "tag",
+		clientID:       "",
+		wantGroups:     []string{"social"},
+		wantFiltering:  false,
+		wantSafeSearch: false,
+		wantParental:   false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setts := &Settings{
+				ProtectionEnabled: true,
+				FilteringEnabled:  true,
+			}
+
+			d.ApplyAdditionalFiltering(netip.Addr{}, tc.clientID, setts)
+
+			assert.Equal(t, tc.wantGroups, setts.FilterGroups)
+			assert.Equal(t, tc.wantFiltering, setts.FilteringEnabled)
+			assert.Equal(t, tc.wantSafeSearch, setts.SafeSearchEnabled)
+			assert.Equal(t, tc.wantParental, setts.ParentalEnabled)
+		})
+	}
+}
+
+func TestValidateTagSchedules(t *testing.T) {
+	enabled := true
+
+	testCases := []struct {
+		name         string
+		wantErrMsg   string
+		tagSchedules []*TagSchedules
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		tagSchedules: []*TagSchedules{{
+			Tag: "user_child",
+			Schedules: []*ScheduledSettings{{
+				Schedule:         schedule.EmptyWeekly(),
+				FilteringEnabled: &enabled,
+			}, {
+				Schedule:     schedule.FullWeekly(),
+				FilterGroups: []string{"social"},
+			}},
+		}},
+	}, {
+		name:       "duplicate_tag",
+		wantErrMsg: `tag_schedules: at index 1: tag: duplicated value: "user_child"`,
+		tagSchedules: []*TagSchedules{{
+			Tag: "user_child",
+		}, {
+			Tag: "user_child",
+		}},
+	}, {
+		name:       "no_schedule",
+		wantErrMsg: "tag_schedules: at index 0: schedules: at index 0: schedule: no value",
+		tagSchedules: []*TagSchedules{{
+			Tag: "user_child",
+			Schedules: []*ScheduledSettings{{
+				FilteringEnabled: &enabled,
+			}},
+		}},
+	}, {
+		name:       "no_settings",
+		wantErrMsg: "tag_schedules: at index 0: schedules: at index 0: no settings to apply",
+		tagSchedules: []*TagSchedules{{
+			Tag: "user_child",
+			Schedules: []*ScheduledSettings{{
+				Schedule: schedule.FullWeekly(),
+			}},
+		}},
+	}, {
+		name: "duplicate_group",
+		wantErrMsg: `tag_schedules: at index 0: schedules: at index 0: ` +
+			`filter_groups: at index 1: duplicated value: "social"`,
+		tagSchedules: []*TagSchedules{{
+			Tag: "user_child",
+			Schedules: []*ScheduledSettings{{
+				Schedule:     schedule.FullWeekly(),
+				FilterGroups: []string{"social", "social"},
+			}},
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateTagSchedules(tc.tagSchedules))
+		})
+	}
+}
+
+func TestDNSFilter_handleTagSchedulesUpdate(t *testing.T) {
+	d, _ := newForTest(t, &Config{
+		ConfModifier: &aghtest.ConfigModifier{
+			OnApply: func(_ context.Context) {},
+		},
+		BlockedServices: &BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+		},
+		FilterGroups: []*FilterGroup{{
+			Name: "social",
+		}},
+		ClientTags: []string{"device_tv", "user_child"},
+	}, nil)
+
+	enabled := true
+
+	testCases := []struct {
+		name     string
+		tag      string
+		group    string
+		wantCode int
+	}{{
+		name:     "valid",
+		tag:      "user_child",
+		group:    "social",
+		wantCode: http.StatusOK,
+	}, {
+		name:     "unknown_tag",
+		tag:      "user_robot",
+		group:    "social",
+		wantCode: http.StatusBadRequest,
+	}, {
+		name:     "unknown_group",
+		tag:      "device_tv",
+		group:    "games",
+		wantCode: http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := json.Marshal(&tagSchedulesListJSON{
+				Tags: []*TagSchedules{{
+					Tag: tc.tag,
+					Schedules: []*ScheduledSettings{{
+						Schedule:         schedule.FullWeekly(),
+						FilteringEnabled: &enabled,
+						FilterGroups:     []string{tc.group},
+					}},
+				}},
+			})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(b))
+			d.handleTagSchedulesUpdate(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+
+			d.confMu.RLock()
+			defer d.confMu.RUnlock()
+
+			require.Len(t, d.conf.TagSchedules, 1)
+
+			assert.Equal(t, "user_child", d.conf.TagSchedules[0].Tag)
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package filtering
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// knownService is a blocked service with parsed filtering rules.
+type knownService struct {
+	// info is the information about the service.  It must not be nil.
+	info *blockedService
+
+	// rules are the parsed filtering rules of the service.
+	rules []*rules.NetworkRule
+}
+
+// services is the registry of all known blocked services.
+var services = &serviceRegistry{
+	mu: &sync.RWMutex{},
+}
+
+// serviceRegistry contains the builtin blocked services, the custom ones, and
+// the ones from the service catalogs.  The IDs of the builtin services take
+// precedence over the custom ones, which in turn take precedence over the ones
+// from the catalogs.  It's safe for concurrent use.
+type serviceRegistry struct {
+	// mu protects all the fields below.
+	mu *sync.RWMutex
+
+	// builtin are the services generated from the upstream services index.
+	builtin []*knownService
+
+	// custom are the services defined in the configuration.
+	custom []*knownService
+
+	// catalogs maps the URL of a service catalog to its services.
+	catalogs map[string][]*knownService
+
+	// catalogURLs are the URLs of the service catalogs in the order of
+	// precedence.
+	catalogURLs []string
+
+	// merged are all the known services sorted by ID.
+	merged []*knownService
+
+	// byID maps the ID of a service to the service from merged.
+	byID map[string]*knownService
+
+	// groups are all the known service groups.
+	groups []serviceGroup
+}
+
+// setBuiltin sets the builtin services.  l must not be nil.
+func (reg *serviceRegistry) setBuiltin(ctx context.Context, l *slog.Logger, svcs []*knownService) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.builtin = svcs
+	reg.merge(ctx, l)
+}
+
+// setCustom sets the custom services and the URLs of the service catalogs and
+// removes the services of the catalogs that aren't within urls.  l must not be
+// nil.
+func (reg *serviceRegistry) setCustom(
+	ctx context.Context,
+	l *slog.Logger,
+	svcs []*knownService,
+	urls []string,
+) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.custom = svcs
+	reg.catalogURLs = urls
+
+	catalogs := make(map[string][]*knownService, len(urls))
+	for _, u := range urls {
+		catalogs[u] = reg.catalogs[u]
+	}
+
+	reg.catalogs = catalogs
+	reg.merge(ctx, l)
+}
+
+// setCatalog sets the services of the service catalog with the given URL.  It
+// does nothing if the URL is unknown.  l must not be nil.
+func (reg *serviceRegistry) setCatalog(
+	ctx context.Context,
+	l *slog.Logger,
+	catalogURL string,
+	svcs []*knownService,
+) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if !slices.Contains(reg.catalogURLs, catalogURL) {
+		return
+	}
+
+	if svcs == nil {
+		// Mark the catalog as loaded, see [serviceRegistry.mayHave].
+		svcs = []*knownService{}
+	}
+
+	reg.catalogs[catalogURL] = svcs
+	reg.merge(ctx, l)
+}
+
+// merge rebuilds the merged data of reg.  Services of the catalogs with the
+// IDs that are already known are skipped.  reg.mu must be locked.
+func (reg *serviceRegistry) merge(ctx context.Context, l *slog.Logger) {
+	reg.byID = make(map[string]*knownService, len(reg.builtin)+len(reg.custom))
+	reg.merged = reg.merged[:0]
+
+	add := func(s *knownService, src string) {
+		id := s.info.ID
+		if _, ok := reg.byID[id]; ok {
+			l.WarnContext(ctx, "skipping duplicated service", "id", id, "src", src)
+
+			return
+		}
+
+		reg.byID[id] = s
+		reg.merged = append(reg.merged, s)
+	}
+
+	for _, s := range reg.builtin {
+		add(s, "builtin")
+	}
+
+	for _, s := range reg.custom {
+		add(s, "custom")
+	}
+
+	for _, u := range reg.catalogURLs {
+		for _, s := range reg.catalogs[u] {
+			add(s, u)
+		}
+	}
+
+	slices.SortFunc(reg.merged, func(a, b *knownService) (res int) {
+		return strings.Compare(a.info.ID, b.info.ID)
+	})
+
+	reg.groups = slices.Clone(serviceGroups)
+	known := container.NewMapSet[string]()
+	for _, g := range reg.groups {
+		known.Add(g.ID)
+	}
+
+	for _, s := range reg.merged {
+		if g := s.info.GroupID; !known.Has(g) {
+			known.Add(g)
+			reg.groups = append(reg.groups, serviceGroup{ID: g})
+		}
+	}
+}
+
+// has returns true if the service with id is known.
+func (reg *serviceRegistry) has(id string) (ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	_, ok = reg.byID[id]
+
+	return ok
+}
+
+// mayHave returns true if the service with id is known or if it may be
+// provided by a configured service catalog that hasn't been loaded yet.
+func (reg *serviceRegistry) mayHave(id string) (ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	if _, ok = reg.byID[id]; ok {
+		return true
+	}
+
+	return slices.ContainsFunc(reg.catalogURLs, func(u string) (pending bool) {
+		return reg.catalogs[u] == nil
+	})
+}
+
+// isBuiltin returns true if id is the ID of a builtin service.
+func (reg *serviceRegistry) isBuiltin(id string) (ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	return slices.ContainsFunc(reg.builtin, func(s *knownService) (found bool) {
+		return s.info.ID == id
+	})
+}
+
+// rules returns the filtering rules of the service with id.  ok is false if
+// the service is unknown.
+func (reg *serviceRegistry) rules(id string) (rs []*rules.NetworkRule, ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	s, ok := reg.byID[id]
+	if !ok {
+		return nil, false
+	}
+
+	return s.rules, true
+}
+
+// ids returns the IDs of all known services sorted alphabetically.
+func (reg *serviceRegistry) ids() (ids []string) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	ids = make([]string, 0, len(reg.merged))
+	for _, s := range reg.merged {
+		ids = append(ids, s.info.ID)
+	}
+
+	return ids
+}
+
+// all returns the information about all known services sorted by ID and all
+// known service groups.  svcs must not be modified.
+func (reg *serviceRegistry) all() (svcs []*blockedService, groups []serviceGroup) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	svcs = make([]*blockedService, 0, len(reg.merged))
+	for _, s := range reg.merged {
+		svcs = append(svcs, s.info)
+	}
+
+	return svcs, slices.Clone(reg.groups)
+}
@@ -0,0 +1,527 @@
+package filtering
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+const (
+	// DefaultUnblockGrantDuration is the default duration of the allow rule
+	// created when an unblock request is approved.
+	DefaultUnblockGrantDuration = timeutil.Day
+
+	// maxPendingUnblockRequests is the maximum number of the unblock requests
+	// waiting for a decision.
+	maxPendingUnblockRequests = 100
+
+	// maxJustificationLen is the maximum length of the justification of an
+	// unblock request in bytes.
+	maxJustificationLen = 1024
+
+	// unblockCleanupIvl is the interval between the removals of the expired
+	// unblock grants and the outdated denied requests.
+	unblockCleanupIvl = 1 * time.Minute
+
+	// deniedUnblockRetention is the time after which the denied unblock
+	// requests are removed.
+	deniedUnblockRetention = 7 * timeutil.Day
+)
+
+// UnblockStatus is the status of an [UnblockRequest].
+type UnblockStatus string
+
+// Valid unblock request statuses.
+const (
+	// UnblockStatusPending means that the request waits for a decision of an
+	// administrator.
+	UnblockStatusPending UnblockStatus = "pending"
+
+	// UnblockStatusApproved means that the domain is unblocked for the client
+	// until the request expires.
+	UnblockStatusApproved UnblockStatus = "approved"
+
+	// UnblockStatusDenied means that the request has been denied or the grant
+	// has been revoked.
+	UnblockStatusDenied UnblockStatus = "denied"
+)
+
+// UnblockRequest is a request of a client to unblock a domain.
+type UnblockRequest struct {
+	// Created is the time when the request has been submitted.
+	Created time.Time `yaml:"created"`
+
+	// Decided is the time when the request has been approved or denied.  It's
+	// zero for pending requests.
+	Decided time.Time `yaml:"decided,omitempty"`
+
+	// ExpiresAt is the time when the allow rule of an approved request
+	// expires.  It's zero for requests that aren't approved.
+	ExpiresAt time.Time `yaml:"expires_at,omitempty"`
+
+	// rules is the compiled allow rule of an approved request.  It's nil for
+	// requests that aren't approved.
+	rules *ClientRules
+
+	// Domain is the domain name to unblock in lower case.  It must be a valid
+	// hostname.
+	Domain string `yaml:"domain"`
+
+	// Justification is the explanation of the client why the domain should be
+	// unblocked.
+	Justification string `yaml:"justification"`
+
+	// ClientName is the name of the persistent client that has submitted the
+	// request.  If it's empty, the request applies to ClientIP only.
+	ClientName string `yaml:"client_name,omitempty"`
+
+	// Status is the status of the request.
+	Status UnblockStatus `yaml:"status"`
+
+	// ClientIP is the address of the client that has submitted the request.
+	ClientIP netip.Addr `yaml:"client_ip"`
+
+	// ID is the unique identifier of the request.  It must not be zero.
+	ID uint64 `yaml:"id"`
+}
+
+// compile compiles the allow rule of an approved request.
+func (ur *UnblockRequest) compile() (err error) {
+	if ur.Status != UnblockStatusApproved {
+		ur.rules = nil
+
+		return nil
+	}
+
+	// Use the important modifier so that the administrator's decision takes
+	// precedence over the important blocking rules as well.
+	ur.rules, err = NewClientRules([]string{"@@||" + ur.Domain + "^$important"})
+
+	return err
+}
+
+// isActiveFor returns true if ur is an unexpired approved request of the
+// client described by setts.
+func (ur *UnblockRequest) isActiveFor(setts *Settings, now time.Time) (ok bool) {
+	if ur.rules == nil || !now.Before(ur.ExpiresAt) {
+		return false
+	}
+
+	if ur.ClientName != "" {
+		return ur.ClientName == setts.ClientName
+	}
+
+	return ur.ClientIP == setts.ClientIP.Unmap()
+}
+
+// sameClient returns true if ur and other have been submitted by the same
+// client.
+func (ur *UnblockRequest) sameClient(other *UnblockRequest) (ok bool) {
+	if ur.ClientName != "" || other.ClientName != "" {
+		return ur.ClientName == other.ClientName
+	}
+
+	return ur.ClientIP == other.ClientIP
+}
+
+// validate returns an error if ur is invalid.
+func (ur *UnblockRequest) validate() (err error) {
+	if ur == nil {
+		return errors.ErrNoValue
+	}
+
+	var errs []error
+	if ur.ID == 0 {
+		errs = append(errs, fmt.Errorf("id: %w", errors.ErrEmptyValue))
+	}
+
+	err = netutil.ValidateHostname(ur.Domain)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("domain: %w", err))
+	}
+
+	switch ur.Status {
+	case UnblockStatusPending, UnblockStatusApproved, UnblockStatusDenied:
+		// Go on.
+	default:
+		errs = append(errs, fmt.Errorf("status: %w: %q", errors.ErrBadEnumValue, ur.Status))
+	}
+
+	return errors.Join(errs...)
+}
+
+// prepareUnblockRequests validates the configured unblock requests and compiles
+// the allow rules of the approved ones.
+func (d *DNSFilter) prepareUnblockRequests() (err error) {
+	defer func() { err = errors.Annotate(err, "unblock_requests: %w") }()
+
+	ids := container.NewMapSet[uint64]()
+	for i, ur := range d.conf.UnblockRequests {
+		err = ur.validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+
+		if ids.Has(ur.ID) {
+			return fmt.Errorf("at index %d: id: %w: %d", i, errors.ErrDuplicated, ur.ID)
+		}
+
+		ids.Add(ur.ID)
+		d.conf.UnblockRequestsLastID = max(d.conf.UnblockRequestsLastID, ur.ID)
+
+		err = ur.compile()
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// applyUnblockGrants adds the allow rules of the approved unblock requests of
+// the client described by setts to setts.  setts must not be nil.
+func (d *DNSFilter) applyUnblockGrants(setts *Settings) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	now := time.Now()
+	for _, ur := range d.conf.UnblockRequests {
+		if ur.isActiveFor(setts, now) {
+			setts.ClientRules = append(setts.ClientRules, ur.rules)
+		}
+	}
+}
+
+// SubmitUnblockRequest saves the request of the client with the given address
+// to unblock domain.  The client is identified using the persistent client
+// information, if any.  It is safe for concurrent use.
+func (d *DNSFilter) SubmitUnblockRequest(
+	ctx context.Context,
+	client netip.Addr,
+	domain string,
+	justification string,
+) (err error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	err = netutil.ValidateHostname(domain)
+	if err != nil {
+		return fmt.Errorf("domain: %w", err)
+	}
+
+	justification = strings.TrimSpace(justification)
+	switch {
+	case justification == "":
+		return fmt.Errorf("justification: %w", errors.ErrEmptyValue)
+	case len(justification) > maxJustificationLen:
+		return fmt.Errorf(
+			"justification: too long: got %d bytes, max %d",
+			len(justification),
+			maxJustificationLen,
+		)
+	case !utf8.ValidString(justification):
+		return errors.Error("justification: invalid utf-8")
+	}
+
+	setts := &Settings{}
+	d.applyClientFiltering("", client, setts)
+
+	ur := &UnblockRequest{
+		Created:       time.Now(),
+		Domain:        domain,
+		Justification: justification,
+		ClientName:    setts.ClientName,
+		Status:        UnblockStatusPending,
+		ClientIP:      client.Unmap(),
+	}
+
+	err = d.addUnblockRequest(ur)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	d.logger.InfoContext(
+		ctx,
+		"unblock request submitted",
+		"id", ur.ID,
+		"domain", domain,
+		"client_name", ur.ClientName,
+		"client_ip", ur.ClientIP,
+	)
+
+	d.conf.ConfModifier.Apply(ctx)
+
+	return nil
+}
+
+// addUnblockRequest assigns an ID to ur and adds it to the configuration.  It
+// returns an error if there are too many pending requests or the client has
+// already requested or been granted the domain.
+func (d *DNSFilter) addUnblockRequest(ur *UnblockRequest) (err error) {
+	d.confMu.Lock()
+	defer d.confMu.Unlock()
+
+	var pending int
+	for _, other := range d.conf.UnblockRequests {
+		switch other.Status {
+		case UnblockStatusPending:
+			pending++
+		case UnblockStatusApproved:
+			if !ur.Created.Before(other.ExpiresAt) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if other.Domain == ur.Domain && other.sameClient(ur) {
+			return fmt.Errorf("request for %q: %w", ur.Domain, errors.ErrDuplicated)
+		}
+	}
+
+	if pending >= maxPendingUnblockRequests {
+		return fmt.Errorf("too many pending requests: max %d", maxPendingUnblockRequests)
+	}
+
+	d.conf.UnblockRequestsLastID++
+	ur.ID = d.conf.UnblockRequestsLastID
+	d.conf.UnblockRequests = append(d.conf.UnblockRequests, ur)
+
+	return nil
+}
+
+// cleanupUnblockRequests removes the expired approved unblock requests and the
+// outdated denied ones.
+func (d *DNSFilter) cleanupUnblockRequests(ctx context.Context) {
+	now := time.Now()
+
+	var removed int
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		l := len(d.conf.UnblockRequests)
+		d.conf.UnblockRequests = slices.DeleteFunc(d.conf.UnblockRequests, func(ur *UnblockRequest) bool {
+			switch ur.Status {
+			case UnblockStatusApproved:
+				return !now.Before(ur.ExpiresAt)
+			case UnblockStatusDenied:
+				return now.Sub(ur.Decided) > deniedUnblockRetention
+			default:
+				return false
+			}
+		})
+
+		removed = l - len(d.conf.UnblockRequests)
+	}()
+
+	if removed == 0 {
+		return
+	}
+
+	d.logger.DebugContext(ctx, "removed outdated unblock requests", "num", removed)
+
+	d.conf.ConfModifier.Apply(ctx)
+}
+
+// unblockRequestJSON is the JSON representation of an [UnblockRequest].
+type unblockRequestJSON struct {
+	Created       time.Time     `json:"created"`
+	Decided       *time.Time    `json:"decided,omitempty"`
+	ExpiresAt     *time.Time    `json:"expires_at,omitempty"`
+	Domain        string        `json:"domain"`
+	Justification string        `json:"justification"`
+	ClientName    string        `json:"client_name"`
+	Status        UnblockStatus `json:"status"`
+	ClientIP      netip.Addr    `json:"client_ip"`
+	ID            uint64        `json:"id"`
+}
+
+// newUnblockRequestJSON returns the JSON representation of ur.
+func newUnblockRequestJSON(ur *UnblockRequest) (j *unblockRequestJSON) {
+	j = &unblockRequestJSON{
+		Created:       ur.Created,
+		Domain:        ur.Domain,
+		Justification: ur.Justification,
+		ClientName:    ur.ClientName,
+		Status:        ur.Status,
+		ClientIP:      ur.ClientIP,
+		ID:            ur.ID,
+	}
+
+	if !ur.Decided.IsZero() {
+		j.Decided = &ur.Decided
+	}
+
+	if !ur.ExpiresAt.IsZero() {
+		j.ExpiresAt = &ur.ExpiresAt
+	}
+
+	return j
+}
+
+// unblockRequestsJSON is the response body for the GET
+// /control/unblock_requests HTTP API.
+type unblockRequestsJSON struct {
+	Requests []*unblockRequestJSON `json:"requests"`
+}
+
+// handleUnblockRequests is the handler for the GET /control/unblock_requests
+// HTTP API.
+func (d *DNSFilter) handleUnblockRequests(w http.ResponseWriter, r *http.Request) {
+	resp := &unblockRequestsJSON{
+		Requests: []*unblockRequestJSON{},
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		now := time.Now()
+		for _, ur := range d.conf.UnblockRequests {
+			if ur.Status == UnblockStatusApproved && !now.Before(ur.ExpiresAt) {
+				// Will be removed by the cleanup shortly.
+				continue
+			}
+
+			resp.Requests = append(resp.Requests, newUnblockRequestJSON(ur))
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(r.Context(), d.logger, w, r, resp)
+}
+
+// unblockDecisionJSON is the request body for the POST
+// /control/unblock_requests/approve and /control/unblock_requests/deny HTTP
+// APIs.
+type unblockDecisionJSON struct {
+	// Duration is the duration of the grant in milliseconds.  If it's zero,
+	// the configured default is used.  It's only used for approvals.
+	Duration int64 `json:"duration"`
+
+	// ID is the identifier of the request.
+	ID uint64 `json:"id"`
+}
+
+// handleUnblockRequestApprove is the handler for the POST
+// /control/unblock_requests/approve HTTP API.
+func (d *DNSFilter) handleUnblockRequestApprove(w http.ResponseWriter, r *http.Request) {
+	d.handleUnblockDecision(w, r, UnblockStatusApproved)
+}
+
+// handleUnblockRequestDeny is the handler for the POST
+// /control/unblock_requests/deny HTTP API.
+func (d *DNSFilter) handleUnblockRequestDeny(w http.ResponseWriter, r *http.Request) {
+	d.handleUnblockDecision(w, r, UnblockStatusDenied)
+}
+
+// handleUnblockDecision sets the status of the unblock request from the request
+// body to status.
+func (d *DNSFilter) handleUnblockDecision(
+	w http.ResponseWriter,
+	r *http.Request,
+	status UnblockStatus,
+) {
+	ctx := r.Context()
+	l := d.logger
+
+	req := &unblockDecisionJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	ur, code, err := d.decideUnblockRequest(req, status)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, code, "%s", err)
+
+		return
+	}
+
+	l.InfoContext(
+		ctx,
+		"unblock request decided",
+		"id", ur.ID,
+		"domain", ur.Domain,
+		"status", status,
+	)
+
+	d.conf.ConfModifier.Apply(ctx)
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, ur)
+}
+
+// decideUnblockRequest sets the status of the unblock request described by req
+// and returns its JSON representation.  Approving is only possible for pending
+// requests, while denying an approved request revokes the grant.  code is the
+// HTTP status code to respond with in case of an error.
+func (d *DNSFilter) decideUnblockRequest(
+	req *unblockDecisionJSON,
+	status UnblockStatus,
+) (ur *unblockRequestJSON, code int, err error) {
+	dur, err := durationFromMs(req.Duration)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	d.confMu.Lock()
+	defer d.confMu.Unlock()
+
+	i := slices.IndexFunc(d.conf.UnblockRequests, func(ur *UnblockRequest) bool {
+		return ur.ID == req.ID
+	})
+	if i < 0 {
+		return nil, http.StatusNotFound, fmt.Errorf("unblock request %d not found", req.ID)
+	}
+
+	existing := d.conf.UnblockRequests[i]
+	switch {
+	case existing.Status == UnblockStatusPending:
+		// Go on.
+	case existing.Status == UnblockStatusApproved && status == UnblockStatusDenied:
+		// Revoke the grant.
+	default:
+		return nil, http.StatusConflict, fmt.Errorf(
+			"unblock request %d: cannot change status from %s to %s",
+			req.ID,
+			existing.Status,
+			status,
+		)
+	}
+
+	// Don't change the request in place, so that it's left intact on errors.
+	updated := *existing
+	updated.Status = status
+	updated.Decided = time.Now()
+	updated.ExpiresAt = time.Time{}
+	if status == UnblockStatusApproved {
+		if dur == 0 {
+			dur = cmp.Or(time.Duration(d.conf.UnblockGrantDuration), DefaultUnblockGrantDuration)
+		}
+
+		updated.ExpiresAt = updated.Decided.Add(dur)
+	}
+
+	err = updated.compile()
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("compiling allow rule: %w", err)
+	}
+
+	d.conf.UnblockRequests[i] = &updated
+
+	return newUnblockRequestJSON(&updated), http.StatusOK, nil
+}
@@ -0,0 +1,242 @@
+package filtering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Common addresses for the unblock requests tests.
+var (
+	testNamedClientIP = netip.MustParseAddr("192.0.2.1")
+	testOtherClientIP = netip.MustParseAddr("192.0.2.2")
+)
+
+// newUnblockTestFilter returns a new filter blocking the domains of the unblock
+// requests tests.  The client with testNamedClientIP is persistent and is named
+// "laptop".
+func newUnblockTestFilter(tb testing.TB) (d *DNSFilter) {
+	tb.Helper()
+
+	d, _ = newForTest(tb, &Config{
+		ApplyClientFiltering: func(_ string, addr netip.Addr, setts *Settings) {
+			if addr == testNamedClientIP {
+				setts.ClientName = "laptop"
+			}
+		},
+		BlockedServices: &BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+		},
+		ConfModifier: &aghtest.ConfigModifier{
+			OnApply: func(_ context.Context) {},
+		},
+	}, []Filter{{
+		ID:   rulelist.IDCustom,
+		Data: []byte("||blocked.example^\n||important.example^$important\n"),
+	}})
+	tb.Cleanup(d.Close)
+
+	return d
+}
+
+// checkUnblocked returns true if host isn't blocked for the client with addr.
+func checkUnblocked(tb testing.TB, d *DNSFilter, addr netip.Addr, host string) (ok bool) {
+	tb.Helper()
+
+	setts := &Settings{
+		ProtectionEnabled: true,
+		FilteringEnabled:  true,
+	}
+	d.ApplyAdditionalFiltering(addr, "", setts)
+
+	res, err := d.CheckHost(host, dns.TypeA, setts)
+	require.NoError(tb, err)
+
+	return !res.IsFiltered
+}
+
+// decide calls the handler of the unblock request decision with the given
+// body and returns the response.
+func decide(
+	tb testing.TB,
+	h http.HandlerFunc,
+	req *unblockDecisionJSON,
+) (w *httptest.ResponseRecorder) {
+	tb.Helper()
+
+	b, err := json.Marshal(req)
+	require.NoError(tb, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	w = httptest.NewRecorder()
+	h(w, r)
+
+	return w
+}
+
+func TestDNSFilter_unblockRequests(t *testing.T) {
+	d := newUnblockTestFilter(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	require.False(t, checkUnblocked(t, d, testNamedClientIP, "blocked.example"))
+
+	err := d.SubmitUnblockRequest(ctx, testNamedClientIP, "Blocked.Example.", " needed for work ")
+	require.NoError(t, err)
+
+	err = d.SubmitUnblockRequest(ctx, testOtherClientIP, "important.example", "please")
+	require.NoError(t, err)
+
+	t.Run("list", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		d.handleUnblockRequests(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp := &unblockRequestsJSON{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+		require.Len(t, resp.Requests, 2)
+
+		got := resp.Requests[0]
+		assert.Equal(t, uint64(1), got.ID)
+		assert.Equal(t, "blocked.example", got.Domain)
+		assert.Equal(t, "needed for work", got.Justification)
+		assert.Equal(t, "laptop", got.ClientName)
+		assert.Equal(t, testNamedClientIP, got.ClientIP)
+		assert.Equal(t, UnblockStatusPending, got.Status)
+		assert.Nil(t, got.ExpiresAt)
+
+		assert.Equal(t, uint64(2), resp.Requests[1].ID)
+		assert.Empty(t, resp.Requests[1].ClientName)
+	})
+
+	t.Run("approve", func(t *testing.T) {
+		w := decide(t, d.handleUnblockRequestApprove, &unblockDecisionJSON{ID: 1})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.True(t, checkUnblocked(t, d, testNamedClientIP, "blocked.example"))
+		assert.False(t, checkUnblocked(t, d, testOtherClientIP, "blocked.example"))
+
+		w = decide(t, d.handleUnblockRequestApprove, &unblockDecisionJSON{
+			ID:       2,
+			Duration: time.Hour.Milliseconds(),
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp := &unblockRequestJSON{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+		require.NotNil(t, resp.ExpiresAt)
+
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *resp.ExpiresAt, time.Minute)
+		assert.True(t, checkUnblocked(t, d, testOtherClientIP, "important.example"))
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		err = d.SubmitUnblockRequest(ctx, testNamedClientIP, "blocked.example", "again")
+		assert.ErrorIs(t, err, errors.ErrDuplicated)
+	})
+
+	t.Run("bad_decision", func(t *testing.T) {
+		w := decide(t, d.handleUnblockRequestApprove, &unblockDecisionJSON{ID: 1})
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = decide(t, d.handleUnblockRequestDeny, &unblockDecisionJSON{ID: 42})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = decide(t, d.handleUnblockRequestApprove, &unblockDecisionJSON{
+			ID:       2,
+			Duration: math.MaxInt64,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		w := decide(t, d.handleUnblockRequestDeny, &unblockDecisionJSON{ID: 1})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.False(t, checkUnblocked(t, d, testNamedClientIP, "blocked.example"))
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		func() {
+			d.confMu.Lock()
+			defer d.confMu.Unlock()
+
+			d.conf.UnblockRequests[1].ExpiresAt = time.Now().Add(-time.Second)
+		}()
+
+		assert.False(t, checkUnblocked(t, d, testOtherClientIP, "important.example"))
+
+		d.cleanupUnblockRequests(ctx)
+
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		require.Len(t, d.conf.UnblockRequests, 1)
+
+		assert.Equal(t, UnblockStatusDenied, d.conf.UnblockRequests[0].Status)
+	})
+
+	t.Run("id_not_reused", func(t *testing.T) {
+		err = d.SubmitUnblockRequest(ctx, testOtherClientIP, "blocked.example", "please")
+		require.NoError(t, err)
+
+		c := &Config{}
+		d.WriteDiskConfig(c)
+
+		require.Len(t, c.UnblockRequests, 2)
+
+		assert.Equal(t, uint64(3), c.UnblockRequests[1].ID)
+		assert.Equal(t, uint64(3), c.UnblockRequestsLastID)
+	})
+}
+
+func TestDNSFilter_SubmitUnblockRequest_errors(t *testing.T) {
+	d := newUnblockTestFilter(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	testCases := []struct {
+		name          string
+		domain        string
+		justification string
+		wantErrMsg    string
+	}{{
+		name:          "bad_domain",
+		domain:        "bad domain",
+		justification: "please",
+		wantErrMsg: `domain: bad hostname "bad domain": ` +
+			`bad top-level domain name label "bad domain": ` +
+			`bad top-level domain name label rune ' '`,
+	}, {
+		name:          "empty_justification",
+		domain:        "blocked.example",
+		justification: " ",
+		wantErrMsg:    "justification: empty value",
+	}, {
+		name:          "long_justification",
+		domain:        "blocked.example",
+		justification: strings.Repeat("a", maxJustificationLen+1),
+		wantErrMsg:    "justification: too long: got 1025 bytes, max 1024",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := d.SubmitUnblockRequest(ctx, testOtherClientIP, tc.domain, tc.justification)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
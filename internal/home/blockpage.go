@@ -0,0 +1,129 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/blockpage"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil/urlutil"
+)
+
+// blockPageDir is the name of the directory within the data directory where
+// the certificate authority of the block page is stored.
+const blockPageDir = "block_page"
+
+// blockPageConfig is the configuration of the page served for the domains
+// blocked with the custom_ip blocking mode.
+type blockPageConfig struct {
+	// UnblockURL is the URL of the page to request unblocking of a domain.  If
+	// it's empty, the link to request unblocking is not shown.
+	UnblockURL string `yaml:"unblock_url"`
+
+	// BindHosts are the IP addresses to serve the block page on.  If it's
+	// empty, the block page is served on all addresses.
+	BindHosts []netip.Addr `yaml:"bind_hosts"`
+
+	// PortHTTP is the port to serve the block page over HTTP on.  If it's
+	// zero, the block page isn't served over HTTP.
+	PortHTTP uint16 `yaml:"port_http"`
+
+	// PortHTTPS is the port to serve the block page over HTTPS on.  If it's
+	// zero, the block page isn't served over HTTPS.
+	PortHTTPS uint16 `yaml:"port_https"`
+
+	// UnblockRequests defines if the clients can request unblocking of the
+	// domains from the block page.  The requests are then approved or denied
+	// by the administrator.  If it's true, UnblockURL isn't used.
+	UnblockRequests bool `yaml:"unblock_requests"`
+
+	// Enabled defines if the block page is served.
+	Enabled bool `yaml:"enabled"`
+}
+
+// validate returns an error if the enabled block page configuration is
+// invalid.
+func (c *blockPageConfig) validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	var errs []error
+	if c.PortHTTP == 0 && c.PortHTTPS == 0 {
+		errs = append(errs, fmt.Errorf("port_http and port_https: %w", errors.ErrNoValue))
+	}
+
+	if c.UnblockURL != "" {
+		var u *url.URL
+		u, err = url.Parse(c.UnblockURL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unblock_url: %w", err))
+		} else if err = urlutil.ValidateHTTPURL(u); err != nil {
+			errs = append(errs, fmt.Errorf("unblock_url: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// addrs returns the addresses to serve the block page on with the given port.
+// addrs is nil if port is zero.
+func (c *blockPageConfig) addrs(port uint16) (addrs []netip.AddrPort) {
+	if port == 0 {
+		return nil
+	}
+
+	hosts := c.BindHosts
+	if len(hosts) == 0 {
+		hosts = []netip.Addr{netip.IPv6Unspecified()}
+	}
+
+	for _, h := range hosts {
+		addrs = append(addrs, netip.AddrPortFrom(h, port))
+	}
+
+	return addrs
+}
+
+// newBlockPage returns a new block page server if it's enabled in conf.  srv
+// is nil if the block page is disabled.
+func newBlockPage(
+	ctx context.Context,
+	baseLogger *slog.Logger,
+	conf *blockPageConfig,
+	filters *filtering.DNSFilter,
+	httpReg aghhttp.Registrar,
+	workDir string,
+) (srv *blockpage.Server, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	var unblocker blockpage.Unblocker
+	if conf.UnblockRequests {
+		unblocker = filters
+	}
+
+	srv, err = blockpage.New(ctx, &blockpage.Config{
+		Logger:     baseLogger.With(slogutil.KeyPrefix, "blockpage"),
+		ListNamer:  filters,
+		Unblocker:  unblocker,
+		HTTPReg:    httpReg,
+		DataDir:    filepath.Join(workDir, dataDir, blockPageDir),
+		UnblockURL: conf.UnblockURL,
+		HTTPAddrs:  conf.addrs(conf.PortHTTP),
+		HTTPSAddrs: conf.addrs(conf.PortHTTPS),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("block page: %w", err)
+	}
+
+	return srv, nil
+}
@@ -0,0 +1,66 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockPageConfig_validate(t *testing.T) {
+	testCases := []struct {
+		conf       *blockPageConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf: &blockPageConfig{
+			Enabled: false,
+		},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &blockPageConfig{
+			UnblockURL: "https://adguard.example/unblock",
+			PortHTTP:   80,
+			Enabled:    true,
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &blockPageConfig{
+			Enabled: true,
+		},
+		name:       "no_ports",
+		wantErrMsg: "port_http and port_https: no value",
+	}, {
+		conf: &blockPageConfig{
+			UnblockURL: "ftp://adguard.example/unblock",
+			PortHTTPS:  443,
+			Enabled:    true,
+		},
+		name: "bad_url",
+		wantErrMsg: `unblock_url: bad http(s) url "ftp://adguard.example/unblock": ` +
+			`scheme: bad enum value: "ftp"; want "http" or "https"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
+
+func TestBlockPageConfig_addrs(t *testing.T) {
+	conf := &blockPageConfig{}
+
+	assert.Nil(t, conf.addrs(0))
+	assert.Equal(t, []netip.AddrPort{netip.MustParseAddrPort("[::]:80")}, conf.addrs(80))
+
+	conf.BindHosts = []netip.Addr{netip.MustParseAddr("192.0.2.1")}
+	assert.Equal(t, []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:443")}, conf.addrs(443))
+}
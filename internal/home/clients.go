@@ -61,6 +61,14 @@ type clientsContainer struct {
 	// safeSearchCacheTTL is the TTL of the safe search cache to use for
 	// persistent clients.
 	safeSearchCacheTTL time.Duration
+
+	// safeSearchProviders are the custom safe search providers to use for
+	// persistent clients.
+	safeSearchProviders []*filtering.SafeSearchProvider
+
+	// checkers are the configurations of the named checkers persistent clients
+	// may refer to.
+	checkers []*filtering.CheckerConfig
 }
 
 // BlockedClientChecker checks if a client is blocked by the current access
@@ -97,13 +105,21 @@ func (clients *clientsContainer) Init(
 	clients.logger = baseLogger.With(slogutil.KeyPrefix, "client_container")
 	clients.safeSearchCacheSize = filteringConf.SafeSearchCacheSize
 	clients.safeSearchCacheTTL = time.Minute * time.Duration(filteringConf.CacheTime)
+	clients.safeSearchProviders = filteringConf.SafeSearchProviders
+	clients.checkers = filteringConf.Checkers
 	clients.confModifier = confModifier
 	clients.httpReg = httpReg
 
 	confClients := make([]*client.Persistent, 0, len(objects))
 	for i, o := range objects {
 		var p *client.Persistent
-		p, err = o.toPersistent(ctx, baseLogger, clients.safeSearchCacheSize, clients.safeSearchCacheTTL)
+		p, err = o.toPersistent(
+			ctx,
+			baseLogger,
+			clients.safeSearchCacheSize,
+			clients.safeSearchCacheTTL,
+			clients.safeSearchProviders,
+		)
 		if err != nil {
 			return fmt.Errorf("init persistent client at index %d: %w", i, err)
 		}
@@ -127,6 +143,7 @@ func (clients *clientsContainer) Init(
 		Logger:                 baseLogger.With(slogutil.KeyPrefix, "client_storage"),
 		Clock:                  timeutil.SystemClock{},
 		InitialClients:         confClients,
+		InitialTagPauses:       config.Clients.PausedTags,
 		DHCP:                   dhcpServer,
 		EtcHosts:               hosts,
 		ARPDB:                  arpDB,
@@ -173,6 +190,23 @@ type clientObject struct {
 	Tags      []string `yaml:"tags"`
 	Upstreams []string `yaml:"upstreams"`
 
+	// FilterGroups are the names of the filter groups selected for the client.
+	FilterGroups []string `yaml:"filter_groups,omitempty"`
+
+	// Schedules are the filtering settings applied to the client within the
+	// time ranges of their schedules.
+	Schedules []*filtering.ScheduledSettings `yaml:"schedules,omitempty"`
+
+	// Checkers are the names of the named checkers applied to the client.
+	Checkers []string `yaml:"checkers,omitempty"`
+
+	// UserRules are the custom filtering rules of the client.
+	UserRules []string `yaml:"user_rules,omitempty"`
+
+	// ProtectionPausedUntil is the time until which the protection is paused
+	// for the client, if it's paused.
+	ProtectionPausedUntil time.Time `yaml:"protection_paused_until,omitempty"`
+
 	// UID is the unique identifier of the persistent client.
 	UID client.UID `yaml:"uid"`
 
@@ -200,6 +234,7 @@ func (o *clientObject) toPersistent(
 	baseLogger *slog.Logger,
 	safeSearchCacheSize uint,
 	safeSearchCacheTTL time.Duration,
+	safeSearchProviders []*filtering.SafeSearchProvider,
 ) (cli *client.Persistent, err error) {
 	cli = &client.Persistent{
 		Name: o.Name,
@@ -208,6 +243,8 @@ func (o *clientObject) toPersistent(
 
 		UID: o.UID,
 
+		ProtectionPausedUntil: o.ProtectionPausedUntil,
+
 		UseOwnSettings:        !o.UseGlobalSettings,
 		FilteringEnabled:      o.FilteringEnabled,
 		ParentalEnabled:       o.ParentalEnabled,
@@ -244,6 +281,7 @@ func (o *clientObject) toPersistent(
 			ClientName:     cli.Name,
 			CacheSize:      safeSearchCacheSize,
 			CacheTTL:       safeSearchCacheTTL,
+			Providers:      safeSearchProviders,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("init safesearch %q: %w", cli.Name, err)
@@ -267,6 +305,15 @@ func (o *clientObject) toPersistent(
 	cli.BlockedServices = o.BlockedServices.Clone()
 
 	cli.Tags = slices.Clone(o.Tags)
+	cli.FilterGroups = slices.Clone(o.FilterGroups)
+	cli.Schedules = filtering.CloneScheduledSettings(o.Schedules)
+	cli.Checkers = slices.Clone(o.Checkers)
+
+	cli.UserRules = slices.Clone(o.UserRules)
+	cli.ClientRules, err = filtering.NewClientRules(cli.UserRules)
+	if err != nil {
+		return nil, fmt.Errorf("init user rules %q: %w", cli.Name, err)
+	}
 
 	return cli, nil
 }
@@ -277,8 +324,15 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 	clients.lock.Lock()
 	defer clients.lock.Unlock()
 
+	now := time.Now()
+
 	objs = make([]*clientObject, 0, clients.storage.Size())
 	clients.storage.RangeByName(func(cli *client.Persistent) (cont bool) {
+		var pausedUntil time.Time
+		if now.Before(cli.ProtectionPausedUntil) {
+			pausedUntil = cli.ProtectionPausedUntil
+		}
+
 		objs = append(objs, &clientObject{
 			Name: cli.Name,
 
@@ -288,8 +342,15 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 			Tags:      slices.Clone(cli.Tags),
 			Upstreams: slices.Clone(cli.Upstreams),
 
+			FilterGroups: slices.Clone(cli.FilterGroups),
+			Schedules:    filtering.CloneScheduledSettings(cli.Schedules),
+			Checkers:     slices.Clone(cli.Checkers),
+			UserRules:    slices.Clone(cli.UserRules),
+
 			UID: cli.UID,
 
+			ProtectionPausedUntil: pausedUntil,
+
 			UseGlobalSettings:        !cli.UseOwnSettings,
 			FilteringEnabled:         cli.FilteringEnabled,
 			ParentalEnabled:          cli.ParentalEnabled,
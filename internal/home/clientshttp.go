@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/netip"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
@@ -14,6 +15,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 )
 
@@ -41,6 +43,11 @@ type clientJSON struct {
 	// Schedule is blocked services schedule for every day of the week.
 	Schedule *schedule.Weekly `json:"blocked_services_schedule"`
 
+	// ProtectionPausedUntil is the time until which the protection is paused
+	// for the client.  It's nil if the protection isn't paused.  It's ignored
+	// in requests.
+	ProtectionPausedUntil *time.Time `json:"protection_paused_until,omitempty"`
+
 	Name string `json:"name"`
 
 	// BlockedServices is the names of blocked services.
@@ -49,6 +56,19 @@ type clientJSON struct {
 	Tags            []string `json:"tags"`
 	Upstreams       []string `json:"upstreams"`
 
+	// FilterGroups are the names of the filter groups selected for the client.
+	FilterGroups []string `json:"filter_groups"`
+
+	// Schedules are the filtering settings applied to the client within the
+	// time ranges of their schedules.
+	Schedules []*filtering.ScheduledSettings `json:"schedules"`
+
+	// Checkers are the names of the named checkers applied to the client.
+	Checkers []string `json:"checkers"`
+
+	// UserRules are the custom filtering rules of the client.
+	UserRules []string `json:"user_rules"`
+
 	FilteringEnabled    bool `json:"filtering_enabled"`
 	ParentalEnabled     bool `json:"parental_enabled"`
 	SafeBrowsingEnabled bool `json:"safebrowsing_enabled"`
@@ -132,6 +152,7 @@ func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, r *http
 // client properties.
 func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err error) {
 	var (
+		pausedUntil      time.Time
 		uid              client.UID
 		ignoreQueryLog   bool
 		ignoreStatistics bool
@@ -140,6 +161,7 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 	)
 
 	if prev != nil {
+		pausedUntil = prev.ProtectionPausedUntil
 		uid = prev.UID
 		ignoreQueryLog = prev.IgnoreQueryLog
 		ignoreStatistics = prev.IgnoreStatistics
@@ -174,6 +196,7 @@ func initPrev(cj clientJSON, prev *client.Persistent) (c *client.Persistent, err
 
 	return &client.Persistent{
 		BlockedServices:       svcs,
+		ProtectionPausedUntil: pausedUntil,
 		UID:                   uid,
 		IgnoreQueryLog:        ignoreQueryLog,
 		IgnoreStatistics:      ignoreStatistics,
@@ -202,8 +225,29 @@ func (clients *clientsContainer) jsonToClient(
 	}
 
 	c.SafeSearchConf = copySafeSearch(cj.SafeSearchConf, cj.SafeSearchEnabled)
+	err = c.SafeSearchConf.ValidateProviderIDs(clients.safeSearchProviders)
+	if err != nil {
+		return nil, fmt.Errorf("safe_search: %w", err)
+	}
+
+	err = filtering.ValidateCheckerNames(clients.checkers, cj.Checkers)
+	if err != nil {
+		return nil, fmt.Errorf("checkers: %w", err)
+	}
+
+	if globalContext.filters != nil {
+		err = globalContext.filters.ValidateScheduledGroups(cj.Schedules)
+		if err != nil {
+			return nil, fmt.Errorf("schedules: %w", err)
+		}
+	}
+
 	c.Name = cj.Name
 	c.Tags = cj.Tags
+	c.FilterGroups = cj.FilterGroups
+	c.Schedules = cj.Schedules
+	c.Checkers = cj.Checkers
+	c.UserRules = cj.UserRules
 	c.Upstreams = cj.Upstreams
 	c.UseOwnSettings = !cj.UseGlobalSettings
 	c.FilteringEnabled = cj.FilteringEnabled
@@ -223,6 +267,7 @@ func (clients *clientsContainer) jsonToClient(
 			ClientName:     c.Name,
 			CacheSize:      clients.safeSearchCacheSize,
 			CacheTTL:       clients.safeSearchCacheTTL,
+			Providers:      clients.safeSearchProviders,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("creating safesearch for client %q: %w", c.Name, err)
@@ -231,6 +276,11 @@ func (clients *clientsContainer) jsonToClient(
 		c.SafeSearch = ss
 	}
 
+	c.ClientRules, err = filtering.NewClientRules(c.UserRules)
+	if err != nil {
+		return nil, fmt.Errorf("compiling user rules for client %q: %w", c.Name, err)
+	}
+
 	return c, nil
 }
 
@@ -299,7 +349,14 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 	cloneVal := c.SafeSearchConf
 	safeSearchConf := &cloneVal
 
+	var pausedUntil *time.Time
+	if time.Now().Before(c.ProtectionPausedUntil) {
+		pausedUntil = &c.ProtectionPausedUntil
+	}
+
 	return &clientJSON{
+		ProtectionPausedUntil: pausedUntil,
+
 		Name:                c.Name,
 		IDs:                 c.Identifiers(),
 		Tags:                c.Tags,
@@ -317,6 +374,11 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 
 		Upstreams: c.Upstreams,
 
+		FilterGroups: c.FilterGroups,
+		Schedules:    c.Schedules,
+		Checkers:     c.Checkers,
+		UserRules:    c.UserRules,
+
 		IgnoreQueryLog:   aghalg.BoolToNullBool(c.IgnoreQueryLog),
 		IgnoreStatistics: aghalg.BoolToNullBool(c.IgnoreStatistics),
 
@@ -615,7 +677,167 @@ func (clients *clientsContainer) registerWebHandlers() {
 	clients.httpReg.Register(http.MethodPost, "/control/clients/delete", clients.handleDelClient)
 	clients.httpReg.Register(http.MethodPost, "/control/clients/update", clients.handleUpdateClient)
 	clients.httpReg.Register(http.MethodPost, "/control/clients/search", clients.handleSearchClient)
+	clients.httpReg.Register(
+		http.MethodGet,
+		"/control/clients/protection",
+		clients.handleProtectionPauses,
+	)
+	clients.httpReg.Register(
+		http.MethodPost,
+		"/control/clients/protection/pause",
+		clients.handleProtectionPause,
+	)
+	clients.httpReg.Register(
+		http.MethodPost,
+		"/control/clients/protection/resume",
+		clients.handleProtectionResume,
+	)
 
 	// Deprecated handler.
 	clients.httpReg.Register(http.MethodGet, "/control/clients/find", clients.handleFindClient)
 }
+
+// protectionPauseJSON is the request body for the POST
+// /control/clients/protection/pause and /control/clients/protection/resume
+// HTTP APIs.  Exactly one of Name and Tag must be set.
+type protectionPauseJSON struct {
+	// Name is the name of the persistent client.
+	Name string `json:"name,omitempty"`
+
+	// Tag is the client tag.
+	Tag string `json:"tag,omitempty"`
+
+	// Duration is the duration of the pause in milliseconds.  It's ignored
+	// when resuming.
+	Duration int64 `json:"duration,omitempty"`
+}
+
+// validate returns an error if the target of the request is invalid.
+func (req *protectionPauseJSON) validate() (err error) {
+	switch {
+	case req.Name == "" && req.Tag == "":
+		return errors.Error("name or tag must be set")
+	case req.Name != "" && req.Tag != "":
+		return errors.Error("only one of name and tag must be set")
+	default:
+		return nil
+	}
+}
+
+// setProtectionPause pauses the protection for the target of req until the
+// given time or resumes it, if until is zero.
+func (clients *clientsContainer) setProtectionPause(
+	ctx context.Context,
+	req *protectionPauseJSON,
+	until time.Time,
+) (err error) {
+	if req.Name != "" {
+		return clients.storage.PauseClientProtection(ctx, req.Name, until)
+	}
+
+	return clients.storage.PauseTagProtection(ctx, req.Tag, until)
+}
+
+// handleProtectionPause is the handler for the POST
+// /control/clients/protection/pause HTTP API.
+func (clients *clientsContainer) handleProtectionPause(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := clients.logger
+
+	req := &protectionPauseJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = req.validate()
+	if err == nil && req.Duration <= 0 {
+		err = fmt.Errorf("duration: %w", errors.ErrNotPositive)
+	}
+
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	until := time.Now().Add(time.Duration(req.Duration) * time.Millisecond)
+	err = clients.setProtectionPause(ctx, req, until)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "pausing protection: %s", err)
+
+		return
+	}
+
+	clients.confModifier.Apply(ctx)
+
+	aghhttp.OK(ctx, l, w)
+}
+
+// handleProtectionResume is the handler for the POST
+// /control/clients/protection/resume HTTP API.
+func (clients *clientsContainer) handleProtectionResume(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := clients.logger
+
+	req := &protectionPauseJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = req.validate()
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	err = clients.setProtectionPause(ctx, req, time.Time{})
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "resuming protection: %s", err)
+
+		return
+	}
+
+	clients.confModifier.Apply(ctx)
+
+	aghhttp.OK(ctx, l, w)
+}
+
+// protectionPausesJSON is the response body for the GET
+// /control/clients/protection HTTP API.
+type protectionPausesJSON struct {
+	// Clients are the times until which the protection is paused for the
+	// persistent clients by their names.
+	Clients map[string]time.Time `json:"clients"`
+
+	// Tags are the times until which the protection is paused for the
+	// clients with the tags.
+	Tags map[string]time.Time `json:"tags"`
+}
+
+// handleProtectionPauses is the handler for the GET
+// /control/clients/protection HTTP API.
+func (clients *clientsContainer) handleProtectionPauses(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	resp := &protectionPausesJSON{
+		Clients: map[string]time.Time{},
+		Tags:    clients.storage.TagProtectionPauses(),
+	}
+
+	clients.storage.RangeByName(func(c *client.Persistent) (cont bool) {
+		if now.Before(c.ProtectionPausedUntil) {
+			resp.Clients[c.Name] = c.ProtectionPausedUntil
+		}
+
+		return true
+	})
+
+	aghhttp.WriteJSONResponseOK(r.Context(), clients.logger, w, r, resp)
+}
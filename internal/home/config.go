@@ -20,6 +20,8 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
@@ -94,6 +96,10 @@ type clientsConfig struct {
 	Sources *clientSourcesConfig `yaml:"runtime_sources"`
 	// Persistent are the configured clients.
 	Persistent []*clientObject `yaml:"persistent"`
+
+	// PausedTags are the times until which the protection is paused for the
+	// clients with the tags.
+	PausedTags map[string]time.Time `yaml:"paused_tags,omitempty"`
 }
 
 // clientSourceConfig is used to configure where the runtime clients will be
@@ -153,6 +159,10 @@ type configuration struct {
 	DHCP      *dhcpd.ServerConfig `yaml:"dhcp"`
 	Filtering *filtering.Config   `yaml:"filtering"`
 
+	// BlockPage is the configuration of the page served for the domains
+	// blocked with the custom_ip blocking mode.
+	BlockPage *blockPageConfig `yaml:"block_page"`
+
 	// Clients contains the YAML representations of the persistent clients.
 	// This field is only used for reading and writing persistent client data.
 	// Keep this field sorted to ensure consistent ordering.
@@ -518,6 +528,12 @@ var config = &configuration{
 		Ignored:        []string{},
 		IgnoredEnabled: false,
 	},
+	BlockPage: &blockPageConfig{
+		BindHosts: []netip.Addr{},
+		PortHTTP:  80,
+		PortHTTPS: 443,
+		Enabled:   false,
+	},
 	// NOTE: Keep these parameters in sync with the one put into
 	// client/src/helpers/filters/filters.ts by scripts/vetted-filters.
 	//
@@ -570,6 +586,8 @@ var config = &configuration{
 
 		ParentalBlockHost:     defaultParentalBlockHost,
 		SafeBrowsingBlockHost: defaultSafeBrowsingBlockHost,
+
+		UnblockGrantDuration: timeutil.Duration(filtering.DefaultUnblockGrantDuration),
 	},
 	DHCP: &dhcpd.ServerConfig{
 		LocalDomainName: "lan",
@@ -772,29 +790,30 @@ func validateConfig(ctx context.Context, l *slog.Logger, fileData []byte) (err e
 		return err
 	}
 
-	tcpPorts := aghalg.UniqChecker[tcpPort]{}
-	addPorts(tcpPorts, tcpPort(config.HTTPConfig.Address.Port()))
+	err = checkPorts()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
 
-	udpPorts := aghalg.UniqChecker[udpPort]{}
-	addPorts(udpPorts, udpPort(config.DNS.Port))
+	err = config.BlockPage.validate()
+	if err != nil {
+		return fmt.Errorf("block_page: %w", err)
+	}
 
-	if config.TLS.Enabled {
-		addPorts(
-			tcpPorts,
-			tcpPort(config.TLS.PortHTTPS),
-			tcpPort(config.TLS.PortDNSOverTLS),
-			tcpPort(config.TLS.PortDNSCrypt),
-		)
+	err = safesearch.ValidateProviders(config.Filtering.SafeSearchProviders)
+	if err != nil {
+		return fmt.Errorf("filtering: safe_search_providers: %w", err)
+	}
 
-		// TODO(e.burkov):  Consider adding a udpPort with the same value when
-		// we add support for HTTP/3 for web admin interface.
-		addPorts(udpPorts, udpPort(config.TLS.PortDNSOverQUIC))
+	err = filtering.ValidateCheckers(config.Filtering.Checkers)
+	if err != nil {
+		return fmt.Errorf("filtering: checkers: %w", err)
 	}
 
-	if err = tcpPorts.Validate(); err != nil {
-		return fmt.Errorf("validating tcp ports: %w", err)
-	} else if err = udpPorts.Validate(); err != nil {
-		return fmt.Errorf("validating udp ports: %w", err)
+	err = validateHashPrefixDatabases(config.Filtering)
+	if err != nil {
+		return fmt.Errorf("filtering: %w", err)
 	}
 
 	if !filtering.ValidateUpdateIvl(config.Filtering.FiltersUpdateIntervalHours) {
@@ -816,6 +835,26 @@ func validateConfig(ctx context.Context, l *slog.Logger, fileData []byte) (err e
 	return nil
 }
 
+// validateHashPrefixDatabases returns an error if the sources of the offline
+// hash-prefix databases within conf are invalid.  conf must not be nil.
+func validateHashPrefixDatabases(conf *filtering.Config) (err error) {
+	if src := conf.SafeBrowsingDatabase; src != "" {
+		err = hashprefix.ValidateSource(src)
+		if err != nil {
+			return fmt.Errorf("safebrowsing_database: %w", err)
+		}
+	}
+
+	if src := conf.ParentalDatabase; src != "" {
+		err = hashprefix.ValidateSource(src)
+		if err != nil {
+			return fmt.Errorf("parental_database: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // udpPort is the port number for UDP protocol.
 type udpPort uint16
 
@@ -919,6 +958,7 @@ func (c *configuration) write(
 	}
 
 	config.Clients.Persistent = globalContext.clients.forConfig()
+	config.Clients.PausedTags = globalContext.clients.storage.TagProtectionPauses()
 
 	confPath = configFilePath(ctx, l, workDir, confPath)
 	l.DebugContext(ctx, "writing config file", "path", confPath)
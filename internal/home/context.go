@@ -54,3 +54,14 @@ func webUserFromContext(ctx context.Context) (u *aghuser.User, ok bool) {
 
 	return u, true
 }
+
+// webUserLogin returns the login of the web user from the context or an empty
+// string if there is none.
+func webUserLogin(ctx context.Context) (login string) {
+	u, ok := webUserFromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	return string(u.Login)
+}
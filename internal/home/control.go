@@ -198,6 +198,7 @@ func (web *webAPI) registerControlHandlers() {
 	)
 	web.httpReg.Register(http.MethodGet, "/control/profile", web.handleGetProfile)
 	web.httpReg.Register(http.MethodPut, "/control/profile/update", web.handlePutProfile)
+	web.httpReg.Register(http.MethodPost, "/control/import/pihole", web.handleImportPihole)
 
 	// No authentication is required for DoH/DoT configuration endpoints.
 	mux.Handle(
@@ -20,6 +20,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
 	"github.com/AdguardTeam/golibs/errors"
@@ -102,12 +103,26 @@ func initDNS(
 		return fmt.Errorf("init querylog: %w", err)
 	}
 
+	config.Filtering.RuleHits = statsRuleHits
 	globalContext.filters, err = filtering.New(config.Filtering, nil)
 	if err != nil {
 		// Don't wrap the error, since it's informative enough as is.
 		return err
 	}
 
+	globalContext.blockPage, err = newBlockPage(
+		ctx,
+		baseLogger,
+		config.BlockPage,
+		globalContext.filters,
+		httpReg,
+		workDir,
+	)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
 	return initDNSServer(
 		ctx,
 		globalContext.filters,
@@ -123,6 +138,33 @@ func initDNS(
 	)
 }
 
+// statsRuleHits returns the numbers of matches of filtering rules collected by
+// the statistics module.  hits is nil if the statistics are disabled.
+// complete is false if some of the matched rules may be missing from hits.
+func statsRuleHits() (hits map[filtering.RuleKey]uint64, complete bool) {
+	sts := globalContext.stats
+	if sts == nil {
+		return nil, false
+	}
+
+	statsHits, complete := sts.RuleHits()
+	if statsHits == nil {
+		return nil, false
+	}
+
+	hits = make(map[filtering.RuleKey]uint64, len(statsHits))
+	for r, n := range statsHits {
+		hits[filtering.RuleKey{
+			Text: r.Text,
+			// #nosec G115 -- The overflow is required for backwards
+			// compatibility.
+			FilterListID: rulelist.APIID(r.FilterListID),
+		}] = n
+	}
+
+	return hits, complete
+}
+
 // initDNSServer initializes the [context.dnsServer].  To only use the internal
 // proxy, none of the arguments are required, but tlsMgr and l still must not be
 // nil, in other cases all the arguments also must not be nil.  It also must not
@@ -152,6 +194,8 @@ func initDNSServer(
 		DHCPServer:  dhcpSrv,
 		EtcHosts:    globalContext.etcHosts,
 		LocalDomain: config.DHCP.LocalDomainName,
+
+		BlockedRecorder: blockedRecorder(),
 	})
 	defer func() {
 		if err != nil {
@@ -495,9 +539,26 @@ func startDNSServer() error {
 		return fmt.Errorf("starting query log: %w", err)
 	}
 
+	if globalContext.blockPage != nil {
+		err = globalContext.blockPage.Start(ctx)
+		if err != nil {
+			return fmt.Errorf("starting block page: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// blockedRecorder returns the recorder of the requests blocked with the
+// custom_ip blocking mode.
+func blockedRecorder() (r dnsforward.BlockedRecorder) {
+	if globalContext.blockPage == nil {
+		return dnsforward.EmptyBlockedRecorder{}
+	}
+
+	return globalContext.blockPage
+}
+
 func stopDNSServer(ctx context.Context) (err error) {
 	if !isRunning() {
 		return nil
@@ -543,6 +604,15 @@ func closeDNSServer(ctx context.Context) {
 		}
 	}
 
+	if globalContext.blockPage != nil {
+		err := globalContext.blockPage.Shutdown(ctx)
+		if err != nil {
+			log.Error("closing block page: %s", err)
+		}
+
+		globalContext.blockPage = nil
+	}
+
 	log.Debug("all dns modules are closed")
 }
 
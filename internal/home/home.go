@@ -27,10 +27,13 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghslog"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
 	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
+	"github.com/AdguardTeam/AdGuardHome/internal/blockpage"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/lookup"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
 	"github.com/AdguardTeam/AdGuardHome/internal/permcheck"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
@@ -66,6 +69,10 @@ type homeContext struct {
 	// configuration files, for example /etc/hosts.
 	etcHosts *aghnet.HostsContainer
 
+	// blockPage serves the page for the domains blocked with the custom_ip
+	// blocking mode.  It's nil if the block page is disabled.
+	blockPage *blockpage.Server
+
 	// Runtime properties
 	// --
 
@@ -401,6 +408,63 @@ func setupBindOpts(opts options) (err error) {
 	return nil
 }
 
+// hashPrefixDir is the name of the directory within the data directory
+// containing the cached copies of the downloaded hash-prefix databases.
+const hashPrefixDir = "hashprefix"
+
+// newHashPrefixDatabase returns a new offline hash-prefix database for the
+// service loaded from src, or nil if src is empty.  l and conf must not be nil.
+func newHashPrefixDatabase(
+	ctx context.Context,
+	l *slog.Logger,
+	conf *filtering.Config,
+	src string,
+	workDir string,
+	svc string,
+) (db *hashprefix.Database, err error) {
+	if src == "" {
+		return nil, nil
+	}
+
+	return hashprefix.NewDatabase(ctx, &hashprefix.DatabaseConfig{
+		Logger:     l,
+		HTTPClient: conf.HTTPClient,
+		Source:     src,
+		CachePath:  filepath.Join(workDir, dataDir, hashPrefixDir, svc+".txt"),
+		MaxSize:    uint64(rulelist.DefaultMaxRuleListSize),
+	})
+}
+
+// setupNamedCheckers creates the named checkers from the configuration.  All
+// arguments must not be nil.
+func setupNamedCheckers(
+	ctx context.Context,
+	baseLogger *slog.Logger,
+	conf *filtering.Config,
+	workDir string,
+) (err error) {
+	conf.NamedCheckers = make([]*filtering.NamedChecker, 0, len(conf.Checkers))
+	for _, c := range conf.Checkers {
+		fileName := "checker_" + url.PathEscape(c.Name) + ".txt"
+
+		var nc *filtering.NamedChecker
+		nc, err = lookup.New(ctx, &lookup.Config{
+			Logger:     baseLogger.With(slogutil.KeyPrefix, "checker", "checker", c.Name),
+			HTTPClient: conf.HTTPClient,
+			Checker:    c,
+			CachePath:  filepath.Join(workDir, dataDir, hashPrefixDir, fileName),
+			MaxSize:    uint64(rulelist.DefaultMaxRuleListSize),
+		})
+		if err != nil {
+			return fmt.Errorf("initializing named checker: %w", err)
+		}
+
+		conf.NamedCheckers = append(conf.NamedCheckers, nc)
+	}
+
+	return nil
+}
+
 // setupDNSFilteringConf sets up DNS filtering configuration settings.  All
 // arguments must not be nil.
 func setupDNSFilteringConf(
@@ -434,12 +498,28 @@ func setupDNSFilteringConf(
 
 	conf.ConfModifier = confModifier
 	conf.HTTPReg = httpReg
+	conf.WebUserLogin = webUserLogin
+	conf.ClientTags = globalContext.clients.storage.AllowedTags()
 	conf.DataDir = filepath.Join(workDir, dataDir)
 	conf.Filters = slices.Clone(config.Filters)
 	conf.WhitelistFilters = slices.Clone(config.WhitelistFilters)
 	conf.UserRules = slices.Clone(config.UserRules)
 	conf.HTTPClient = httpClient(tlsMgr)
 
+	conf.Watcher, err = aghos.NewOSWatcher(&aghos.OSWatcherConfig{
+		Logger: baseLogger.With(slogutil.KeyPrefix, "filters_watcher"),
+	})
+	if err != nil {
+		conf.Logger.WarnContext(
+			ctx,
+			"initializing filesystem watcher; not watching for changes",
+			slogutil.KeyError,
+			err,
+		)
+
+		conf.Watcher = aghos.EmptyFSWatcher{}
+	}
+
 	cacheTime := time.Duration(conf.CacheTime) * time.Minute
 
 	upsOpts := &upstream.Options{
@@ -462,12 +542,19 @@ func setupDNSFilteringConf(
 		return fmt.Errorf("converting safe browsing server: %w", err)
 	}
 
+	sbLogger := baseLogger.With(slogutil.KeyPrefix, sbService)
+	sbDB, err := newHashPrefixDatabase(ctx, sbLogger, conf, conf.SafeBrowsingDatabase, workDir, sbService)
+	if err != nil {
+		return fmt.Errorf("initializing safe browsing database: %w", err)
+	}
+
 	conf.SafeBrowsingChecker = hashprefix.New(&hashprefix.Config{
-		Logger:    baseLogger.With(slogutil.KeyPrefix, sbService),
+		Logger:    sbLogger,
 		Upstream:  sbUps,
 		TXTSuffix: sbTXTSuffix,
 		CacheTime: cacheTime,
 		CacheSize: conf.SafeBrowsingCacheSize,
+		Database:  sbDB,
 	})
 
 	// Protect against invalid configuration, see #6181.
@@ -490,12 +577,19 @@ func setupDNSFilteringConf(
 		return fmt.Errorf("converting parental server: %w", err)
 	}
 
+	pcLogger := baseLogger.With(slogutil.KeyPrefix, pcService)
+	pcDB, err := newHashPrefixDatabase(ctx, pcLogger, conf, conf.ParentalDatabase, workDir, pcService)
+	if err != nil {
+		return fmt.Errorf("initializing parental control database: %w", err)
+	}
+
 	conf.ParentalControlChecker = hashprefix.New(&hashprefix.Config{
-		Logger:    baseLogger.With(slogutil.KeyPrefix, pcService),
+		Logger:    pcLogger,
 		Upstream:  parUps,
 		TXTSuffix: pcTXTSuffix,
 		CacheTime: cacheTime,
 		CacheSize: conf.ParentalCacheSize,
+		Database:  pcDB,
 	})
 
 	// Protect against invalid configuration, see #6181.
@@ -513,12 +607,19 @@ func setupDNSFilteringConf(
 		conf.ParentalBlockHost = host
 	}
 
+	err = setupNamedCheckers(ctx, baseLogger, conf, workDir)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
 	logger := baseLogger.With(slogutil.KeyPrefix, safesearch.LogPrefix)
 	conf.SafeSearch, err = safesearch.NewDefault(ctx, &safesearch.DefaultConfig{
 		Logger:         logger,
 		ServicesConfig: conf.SafeSearchConf,
 		CacheSize:      conf.SafeSearchCacheSize,
 		CacheTTL:       cacheTime,
+		Providers:      conf.SafeSearchProviders,
 	})
 	if err != nil {
 		return fmt.Errorf("initializing safesearch: %w", err)
@@ -527,7 +628,9 @@ func setupDNSFilteringConf(
 	return nil
 }
 
-// checkPorts is a helper for ports validation in config.
+// checkPorts is a helper for ports validation in config.  It returns an error
+// if any of the TCP or UDP ports, including the ones of the block page, are
+// duplicated.
 func checkPorts() (err error) {
 	tcpPorts := aghalg.UniqChecker[tcpPort]{}
 	addPorts(tcpPorts, tcpPort(config.HTTPConfig.Address.Port()))
@@ -543,9 +646,15 @@ func checkPorts() (err error) {
 			tcpPort(config.TLS.PortDNSCrypt),
 		)
 
+		// TODO(e.burkov):  Consider adding a udpPort with the same value when
+		// we add support for HTTP/3 for web admin interface.
 		addPorts(udpPorts, udpPort(config.TLS.PortDNSOverQUIC))
 	}
 
+	if bp := config.BlockPage; bp != nil && bp.Enabled {
+		addPorts(tcpPorts, tcpPort(bp.PortHTTP), tcpPort(bp.PortHTTPS))
+	}
+
 	if err = tcpPorts.Validate(); err != nil {
 		return fmt.Errorf("validating tcp ports: %w", err)
 	} else if err = udpPorts.Validate(); err != nil {
@@ -762,6 +871,9 @@ func run(
 	// data first, but also to avoid relying on automatic Go init() function.
 	filtering.InitModule(ctx, baseLogger)
 
+	err = filtering.InitServices(ctx, baseLogger, config.Filtering, filepath.Join(workDir, dataDir))
+	fatalOnError(err)
+
 	confModifier := newDefaultConfigModifier(
 		config,
 		baseLogger.With(slogutil.KeyPrefix, "config_modifier"),
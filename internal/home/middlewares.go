@@ -46,7 +46,7 @@ func expectsLargerRequests(r *http.Request) (ok bool) {
 	}
 
 	switch r.URL.Path {
-	case "/control/access/set", "/control/filtering/set_rules":
+	case "/control/access/set", "/control/filtering/set_rules", "/control/import/pihole":
 		return true
 	default:
 		return false
@@ -0,0 +1,139 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/pihole"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// piholeImportJSON is the response body for the POST /control/import/pihole
+// HTTP API.  The numbers are those of the entries converted from the backup.
+type piholeImportJSON struct {
+	// Unmapped are the descriptions of the files and entries of the backup
+	// which couldn't be converted or added.
+	Unmapped []string `json:"unmapped"`
+
+	FilterGroups uint `json:"filter_groups"`
+	Filters      uint `json:"filters"`
+	UserRules    uint `json:"user_rules"`
+	Rewrites     uint `json:"rewrites"`
+	Clients      uint `json:"clients"`
+	Leases       uint `json:"leases"`
+}
+
+// handleImportPihole is the handler for the POST /control/import/pihole HTTP
+// API.  The request body is a Pi-hole Teleporter backup.  The converted
+// configuration is merged into the current one.
+func (web *webAPI) handleImportPihole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := web.logger
+
+	res, err := pihole.Read(r.Body)
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusBadRequest, "reading backup: %s", err)
+
+		return
+	}
+
+	resp := &piholeImportJSON{
+		Unmapped:     append([]string{}, res.Unmapped...),
+		FilterGroups: uint(len(res.FilterGroups)),
+		Filters:      uint(len(res.Filters)),
+		UserRules:    uint(len(res.UserRules)),
+		Rewrites:     uint(len(res.Rewrites)),
+	}
+
+	skipped, err := globalContext.filters.Import(ctx, &filtering.ImportConfig{
+		FilterGroups: res.FilterGroups,
+		Filters:      res.Filters,
+		UserRules:    res.UserRules,
+		Rewrites:     res.Rewrites,
+	})
+	if err != nil {
+		aghhttp.ErrorAndLog(ctx, l, r, w, http.StatusInternalServerError, "importing filtering: %s", err)
+
+		return
+	}
+
+	for _, skipErr := range skipped {
+		resp.Unmapped = append(resp.Unmapped, skipErr.Error())
+	}
+
+	for _, c := range res.Clients {
+		err = addPiholeClient(ctx, c)
+		if err != nil {
+			resp.Unmapped = append(resp.Unmapped, fmt.Sprintf("client %q: %s", c.Name, err))
+		} else {
+			resp.Clients++
+		}
+	}
+
+	for _, lease := range res.Leases {
+		err = addPiholeLease(lease)
+		if err != nil {
+			resp.Unmapped = append(resp.Unmapped, fmt.Sprintf("lease %s: %s", lease.IP, err))
+		} else {
+			resp.Leases++
+		}
+	}
+
+	web.confModifier.Apply(ctx)
+
+	l.InfoContext(
+		ctx,
+		"imported pi-hole backup",
+		"clients", resp.Clients,
+		"leases", resp.Leases,
+		"unmapped", len(resp.Unmapped),
+	)
+
+	aghhttp.WriteJSONResponseOK(ctx, l, w, r, resp)
+}
+
+// addPiholeClient adds c as a persistent client using the global settings.
+// The groups of c which names are valid client tags are also set as its tags.
+func addPiholeClient(ctx context.Context, c *pihole.Client) (err error) {
+	clients := &globalContext.clients
+	allowedTags := clients.storage.AllowedTags()
+
+	var tags []string
+	for _, g := range c.Groups {
+		if _, ok := slices.BinarySearch(allowedTags, g); ok {
+			tags = append(tags, g)
+		}
+	}
+
+	p, err := clients.jsonToClient(ctx, clientJSON{
+		Name:                     c.Name,
+		IDs:                      c.IDs,
+		Tags:                     tags,
+		FilterGroups:             c.Groups,
+		FilteringEnabled:         true,
+		UseGlobalBlockedServices: true,
+		UseGlobalSettings:        true,
+	}, nil)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	// Don't wrap the error, since it's informative enough as is.
+	return clients.storage.Add(ctx, p)
+}
+
+// addPiholeLease adds l as a static DHCP lease.
+func addPiholeLease(l *dhcpsvc.Lease) (err error) {
+	if globalContext.dhcpServer == nil {
+		return errors.Error("dhcp is not available")
+	}
+
+	// Don't wrap the error, since it's informative enough as is.
+	return globalContext.dhcpServer.AddStaticLease(l)
+}
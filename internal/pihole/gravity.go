@@ -0,0 +1,314 @@
+package pihole
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// defaultGroupID is the ID of the Pi-hole default group, which applies to all
+// clients that aren't assigned to other groups.
+const defaultGroupID int64 = 0
+
+// domainType is the type of a Pi-hole domain list entry.
+type domainType int
+
+// Valid domain types.
+const (
+	domainTypeAllowExact domainType = 0
+	domainTypeBlockExact domainType = 1
+	domainTypeAllowRegex domainType = 2
+	domainTypeBlockRegex domainType = 3
+)
+
+// group is an entry of the Pi-hole "group" table.
+type group struct {
+	Name    string `json:"name"`
+	ID      int64  `json:"id"`
+	Enabled int    `json:"enabled"`
+}
+
+// adlist is an entry of the Pi-hole "adlist" table.
+type adlist struct {
+	Address string `json:"address"`
+	Comment string `json:"comment"`
+	ID      int64  `json:"id"`
+	Enabled int    `json:"enabled"`
+}
+
+// domain is an entry of the Pi-hole "domainlist" table.
+type domain struct {
+	Domain  string     `json:"domain"`
+	Comment string     `json:"comment"`
+	ID      int64      `json:"id"`
+	Type    domainType `json:"type"`
+	Enabled int        `json:"enabled"`
+}
+
+// client is an entry of the Pi-hole "client" table.
+type client struct {
+	IP      string `json:"ip"`
+	Comment string `json:"comment"`
+	ID      int64  `json:"id"`
+}
+
+// groupLink is an entry of one of the Pi-hole tables assigning adlists,
+// domains, and clients to groups.
+type groupLink struct {
+	AdlistID int64 `json:"adlist_id"`
+	DomainID int64 `json:"domainlist_id"`
+	ClientID int64 `json:"client_id"`
+	GroupID  int64 `json:"group_id"`
+}
+
+// gravity is the contents of the Pi-hole gravity database.
+type gravity struct {
+	// groupNames are the names of the enabled groups by their IDs.
+	groupNames map[int64]string
+
+	// adlistGroups, domainGroups, and clientGroups are the IDs of the groups of
+	// the adlists, domains, and clients respectively.  Each of them is nil if
+	// the backup doesn't contain the corresponding table.
+	adlistGroups map[int64][]int64
+	domainGroups map[int64][]int64
+	clientGroups map[int64][]int64
+
+	groups  []*group
+	adlists []*adlist
+	domains []*domain
+	clients []*client
+}
+
+// decode decodes the gravity tables from files.
+func (g *gravity) decode(files map[string][]byte) (err error) {
+	var errs []error
+	for _, t := range []struct {
+		v    any
+		name string
+	}{{
+		v:    &g.groups,
+		name: fileGroup,
+	}, {
+		v:    &g.adlists,
+		name: fileAdlist,
+	}, {
+		v:    &g.clients,
+		name: fileClient,
+	}} {
+		errs = append(errs, decodeTable(t.name, files[t.name], t.v))
+	}
+
+	for _, name := range []string{fileBlockExact, fileBlockRegex, fileAllowExact, fileAllowRegex} {
+		var domains []*domain
+		errs = append(errs, decodeTable(name, files[name], &domains))
+		g.domains = append(g.domains, domains...)
+	}
+
+	for _, t := range []struct {
+		links *map[int64][]int64
+		key   func(l *groupLink) (id int64)
+		name  string
+	}{{
+		links: &g.adlistGroups,
+		key:   func(l *groupLink) (id int64) { return l.AdlistID },
+		name:  fileAdlistByGroup,
+	}, {
+		links: &g.domainGroups,
+		key:   func(l *groupLink) (id int64) { return l.DomainID },
+		name:  fileDomainByGroup,
+	}, {
+		links: &g.clientGroups,
+		key:   func(l *groupLink) (id int64) { return l.ClientID },
+		name:  fileClientByGroup,
+	}} {
+		data, ok := files[t.name]
+		if !ok {
+			continue
+		}
+
+		var links []*groupLink
+		errs = append(errs, decodeTable(t.name, data, &links))
+
+		*t.links = map[int64][]int64{}
+		for _, l := range links {
+			id := t.key(l)
+			(*t.links)[id] = append((*t.links)[id], l.GroupID)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// groupsOf returns the names of the enabled non-default groups from links that
+// the entry with the given ID is assigned to.  isGlobal is true if the entry is
+// assigned to the enabled default group or if links is nil.
+func (g *gravity) groupsOf(links map[int64][]int64, id int64) (names []string, isGlobal bool) {
+	if links == nil {
+		return nil, true
+	}
+
+	for _, gid := range links[id] {
+		name, ok := g.groupNames[gid]
+		switch {
+		case !ok:
+			// Disabled or unknown group.
+		case gid == defaultGroupID:
+			isGlobal = true
+		default:
+			names = append(names, name)
+		}
+	}
+
+	return names, isGlobal
+}
+
+// convert converts the gravity tables and adds them to res.
+func (g *gravity) convert(res *Result) {
+	g.groupNames = map[int64]string{}
+	for _, grp := range g.groups {
+		if grp.Enabled == 0 {
+			res.Unmapped = append(res.Unmapped, fmt.Sprintf("group %q: disabled", grp.Name))
+
+			continue
+		}
+
+		g.groupNames[grp.ID] = grp.Name
+		if grp.ID != defaultGroupID {
+			res.FilterGroups = append(res.FilterGroups, &filtering.FilterGroup{
+				Name: grp.Name,
+			})
+		}
+	}
+
+	for _, a := range g.adlists {
+		res.Filters = append(res.Filters, g.convertAdlist(res, a))
+	}
+
+	for _, d := range g.domains {
+		names, isGlobal := g.groupsOf(g.domainGroups, d.ID)
+		rule, err := convertDomain(d)
+		if err == nil && !isGlobal && len(names) == 0 {
+			err = errors.Error("not assigned to any enabled group")
+		}
+
+		if err != nil {
+			res.Unmapped = append(res.Unmapped, fmt.Sprintf("domain %q: %s", d.Domain, err))
+
+			continue
+		}
+
+		if !isGlobal {
+			res.Unmapped = append(res.Unmapped, fmt.Sprintf(
+				"domain %q: only assigned to groups %q, applied to all clients",
+				d.Domain,
+				names,
+			))
+		}
+
+		res.UserRules = append(res.UserRules, rule)
+	}
+
+	for _, c := range g.clients {
+		names, isGlobal := g.groupsOf(g.clientGroups, c.ID)
+		if !isGlobal {
+			res.Unmapped = append(res.Unmapped, fmt.Sprintf(
+				"client %q: not assigned to the default group, global filters still apply",
+				c.IP,
+			))
+		}
+
+		res.Clients = append(res.Clients, &Client{
+			Name:   cmp.Or(c.Comment, c.IP),
+			IDs:    []string{c.IP},
+			Groups: names,
+		})
+	}
+}
+
+// convertAdlist converts a into a filter list.  Since a filter list can only
+// belong to a single group, the adlists assigned to several non-default groups
+// are only added to the first one.
+func (g *gravity) convertAdlist(res *Result, a *adlist) (f filtering.FilterYAML) {
+	f = filtering.FilterYAML{
+		Enabled: a.Enabled != 0,
+		URL:     a.Address,
+		Name:    cmp.Or(a.Comment, a.Address),
+	}
+
+	names, isGlobal := g.groupsOf(g.adlistGroups, a.ID)
+	switch {
+	case isGlobal:
+		// Apply to all clients.
+	case len(names) == 0:
+		f.Enabled = false
+		res.Unmapped = append(res.Unmapped, fmt.Sprintf(
+			"adlist %q: not assigned to any enabled group, added disabled",
+			a.Address,
+		))
+	default:
+		f.Group = names[0]
+		if len(names) > 1 {
+			res.Unmapped = append(res.Unmapped, fmt.Sprintf(
+				"adlist %q: assigned to several groups, only added to %q",
+				a.Address,
+				f.Group,
+			))
+		}
+	}
+
+	return f
+}
+
+// convertDomain converts d into a filtering rule.
+func convertDomain(d *domain) (rule string, err error) {
+	if d.Enabled == 0 {
+		return "", errors.Error("disabled")
+	}
+
+	switch d.Type {
+	case domainTypeAllowExact, domainTypeBlockExact:
+		rule = "|" + d.Domain + "^"
+	case domainTypeAllowRegex, domainTypeBlockRegex:
+		rule, err = regexRule(d.Domain)
+		if err != nil {
+			// Don't wrap the error, since it's informative enough as is.
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("type: %w: %d", errors.ErrBadEnumValue, d.Type)
+	}
+
+	if d.Type == domainTypeAllowExact || d.Type == domainTypeAllowRegex {
+		rule = "@@" + rule
+	}
+
+	return rule, nil
+}
+
+// wildcardRegex matches the regular expressions Pi-hole uses for the wildcard
+// domains, for example "(\.|^)example\.com$".
+var wildcardRegex = regexp.MustCompile(`^\(\\\.\|\^\)((?:[[:alnum:]_-]+\\\.)*[[:alnum:]_-]+)\$$`)
+
+// regexExtensions are the Pi-hole extensions of the regular expression
+// syntax, which filtering rules don't support.
+var regexExtensions = []string{";querytype=", ";invert", ";reply="}
+
+// regexRule converts the Pi-hole regular expression re into a filtering rule.
+// The wildcard domains are converted into the domain rules.
+func regexRule(re string) (rule string, err error) {
+	for _, ext := range regexExtensions {
+		if strings.Contains(re, ext) {
+			return "", fmt.Errorf("regex extension %q isn't supported", ext)
+		}
+	}
+
+	if m := wildcardRegex.FindStringSubmatch(re); m != nil {
+		return "||" + strings.ReplaceAll(m[1], `\.`, ".") + "^", nil
+	}
+
+	return "/" + re + "/", nil
+}
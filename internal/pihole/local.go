@@ -0,0 +1,96 @@
+package pihole
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
+)
+
+// convertRecords converts the local DNS records from the file with the given
+// name and adds them to res.
+func (res *Result) convertRecords(name string, data []byte) {
+	items, skipped, err := rewrite.Parse(rewrite.FormatPihole, bytes.NewReader(data))
+	if err != nil {
+		res.Unmapped = append(res.Unmapped, fmt.Sprintf("file %q: %s", name, err))
+
+		return
+	}
+
+	for _, skipErr := range skipped {
+		res.Unmapped = append(res.Unmapped, fmt.Sprintf("%s: %s", name, skipErr))
+	}
+
+	res.Rewrites = append(res.Rewrites, items...)
+}
+
+// convertStaticLeases converts the "dhcp-host" options of the Pi-hole static
+// DHCP configuration file and adds them to res.
+func (res *Result) convertStaticLeases(data []byte) {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		l, err := parseDHCPHost(line)
+		if err != nil {
+			res.Unmapped = append(res.Unmapped, fmt.Sprintf(
+				"%s: line %d: %s",
+				fileStaticDHCP,
+				lineNum,
+				err,
+			))
+
+			continue
+		}
+
+		res.Leases = append(res.Leases, l)
+	}
+
+	err := s.Err()
+	if err != nil {
+		res.Unmapped = append(res.Unmapped, fmt.Sprintf("file %q: %s", fileStaticDHCP, err))
+	}
+}
+
+// parseDHCPHost parses a dnsmasq "dhcp-host" option, for example
+// "dhcp-host=00:11:22:33:44:55,192.168.1.10,host".  Only the options with a
+// MAC address and an IPv4 address are converted.
+func parseDHCPHost(line string) (l *dhcpsvc.Lease, err error) {
+	opt, val, _ := strings.Cut(line, "=")
+	if opt = strings.TrimSpace(opt); opt != "dhcp-host" {
+		return nil, fmt.Errorf("option %q isn't supported", opt)
+	}
+
+	l = &dhcpsvc.Lease{
+		IsStatic: true,
+	}
+
+	for _, field := range strings.Split(val, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if mac, macErr := net.ParseMAC(field); macErr == nil && l.HWAddr == nil {
+			l.HWAddr = mac
+		} else if ip, ipErr := netip.ParseAddr(field); ipErr == nil && !l.IP.IsValid() {
+			l.IP = ip
+		} else {
+			l.Hostname = field
+		}
+	}
+
+	if l.HWAddr == nil || !l.IP.Is4() {
+		return nil, fmt.Errorf("dhcp-host: want mac and ipv4 address")
+	}
+
+	return l, nil
+}
@@ -0,0 +1,201 @@
+// Package pihole converts the Pi-hole Teleporter backups into the AdGuard Home
+// configuration.
+package pihole
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+)
+
+// maxFileSize is the maximum size of a single file within a backup.
+const maxFileSize = 16 << 20
+
+// Names of the files within a Pi-hole v5 Teleporter backup.
+const (
+	fileAdlist        = "adlist.json"
+	fileAdlistByGroup = "adlist_by_group.json"
+	fileAllowExact    = "whitelist.exact.json"
+	fileAllowRegex    = "whitelist.regex.json"
+	fileBlockExact    = "blacklist.exact.json"
+	fileBlockRegex    = "blacklist.regex.json"
+	fileClient        = "client.json"
+	fileClientByGroup = "client_by_group.json"
+	fileCNAME         = "05-pihole-custom-cname.conf"
+	fileCustomList    = "custom.list"
+	fileDomainByGroup = "domainlist_by_group.json"
+	fileGroup         = "group.json"
+	fileStaticDHCP    = "04-pihole-static-dhcp.conf"
+)
+
+// knownFiles are the names of the files which are converted.
+var knownFiles = []string{
+	fileAdlist,
+	fileAdlistByGroup,
+	fileAllowExact,
+	fileAllowRegex,
+	fileBlockExact,
+	fileBlockRegex,
+	fileClient,
+	fileClientByGroup,
+	fileCNAME,
+	fileCustomList,
+	fileDomainByGroup,
+	fileGroup,
+	fileStaticDHCP,
+}
+
+// Client is a persistent client converted from a Pi-hole client.
+type Client struct {
+	// Name is the comment of the Pi-hole client or, if it's empty, its
+	// identifier.
+	Name string
+
+	// IDs are the identifiers of the client, such as IP addresses, subnets, or
+	// MAC addresses.
+	IDs []string
+
+	// Groups are the names of the enabled Pi-hole groups of the client except
+	// for the default one.  These groups are converted into filter groups.
+	Groups []string
+}
+
+// Result is the configuration converted from a Pi-hole Teleporter backup.
+type Result struct {
+	// FilterGroups are the enabled Pi-hole groups except for the default one.
+	FilterGroups []*filtering.FilterGroup
+
+	// Filters are the adlists.  The adlists which are only assigned to
+	// non-default groups belong to the filter group of the same name.
+	Filters []filtering.FilterYAML
+
+	// UserRules are the rules converted from the exact, regex, and wildcard
+	// domain lists.
+	UserRules []string
+
+	// Rewrites are the local DNS and CNAME records.
+	Rewrites []*rewrite.Item
+
+	// Clients are the Pi-hole clients.
+	Clients []*Client
+
+	// Leases are the static DHCP leases.
+	Leases []*dhcpsvc.Lease
+
+	// Unmapped are the descriptions of the files and entries of the backup
+	// which couldn't be converted or were converted only partially.
+	Unmapped []string
+}
+
+// Read reads a Pi-hole v5 Teleporter backup, which is a gzipped tar archive,
+// from r and converts it.  The unknown files and the entries that can't be
+// converted are reported in res.Unmapped.
+func Read(r io.Reader) (res *Result, err error) {
+	files, unknown, err := readArchive(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+
+	res = &Result{}
+	for _, name := range unknown {
+		res.Unmapped = append(res.Unmapped, fmt.Sprintf("file %q: not supported", name))
+	}
+
+	g := &gravity{}
+	err = g.decode(files)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return nil, err
+	}
+
+	g.convert(res)
+
+	for _, name := range []string{fileCustomList, fileCNAME} {
+		data, ok := files[name]
+		if ok {
+			res.convertRecords(name, data)
+		}
+	}
+
+	if data, ok := files[fileStaticDHCP]; ok {
+		res.convertStaticLeases(data)
+	}
+
+	return res, nil
+}
+
+// readArchive returns the contents of the known files from the archive read
+// from r, keyed by their base names, as well as the names of the unknown files.
+func readArchive(r io.Reader) (files map[string][]byte, unknown []string, err error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	if string(magic) == "PK" {
+		return nil, nil, errors.Error("zip archives of pi-hole v6 aren't supported")
+	}
+
+	gzr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening gzip: %w", err)
+	}
+
+	files = map[string][]byte{}
+	tr := tar.NewReader(gzr)
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("reading tar: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Base(hdr.Name)
+		if !slices.Contains(knownFiles, name) {
+			unknown = append(unknown, hdr.Name)
+
+			continue
+		}
+
+		files[name], err = io.ReadAll(ioutil.LimitReader(tr, maxFileSize))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %q: %w", hdr.Name, err)
+		}
+	}
+
+	return files, unknown, nil
+}
+
+// decodeTable decodes the JSON-encoded gravity table from data into v, if data
+// isn't empty.
+func decodeTable(name string, data []byte, v any) (err error) {
+	if len(data) == 0 {
+		return nil
+	}
+
+	err = json.NewDecoder(bytes.NewReader(data)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package pihole_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rewrite"
+	"github.com/AdguardTeam/AdGuardHome/internal/pihole"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newArchive returns a gzipped tar archive with the given files.
+func newArchive(tb testing.TB, files map[string]string) (data []byte) {
+	tb.Helper()
+
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		require.NoError(tb, err)
+
+		_, err = tw.Write([]byte(content))
+		require.NoError(tb, err)
+	}
+
+	require.NoError(tb, tw.Close())
+	require.NoError(tb, gzw.Close())
+
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	data := newArchive(t, map[string]string{
+		"group.json": `[
+			{"id":0,"enabled":1,"name":"Default"},
+			{"id":1,"enabled":1,"name":"kids"},
+			{"id":2,"enabled":0,"name":"old"}
+		]`,
+		"adlist.json": `[
+			{"id":1,"address":"https://lists.example/ads.txt","enabled":1,"comment":"Ads"},
+			{"id":2,"address":"https://lists.example/adult.txt","enabled":1,"comment":null},
+			{"id":3,"address":"https://lists.example/old.txt","enabled":1,"comment":""}
+		]`,
+		"adlist_by_group.json": `[
+			{"adlist_id":1,"group_id":0},
+			{"adlist_id":2,"group_id":1},
+			{"adlist_id":3,"group_id":2}
+		]`,
+		"blacklist.exact.json": `[
+			{"id":1,"type":1,"domain":"ads.example","enabled":1},
+			{"id":2,"type":1,"domain":"off.example","enabled":0}
+		]`,
+		"blacklist.regex.json": `[
+			{"id":3,"type":3,"domain":"(\\.|^)tracker\\.example$","enabled":1},
+			{"id":4,"type":3,"domain":"^ad[0-9]+\\.","enabled":1},
+			{"id":5,"type":3,"domain":"^mail\\.;querytype=MX","enabled":1}
+		]`,
+		"whitelist.exact.json": `[
+			{"id":6,"type":0,"domain":"ok.example","enabled":1}
+		]`,
+		"domainlist_by_group.json": `[
+			{"domainlist_id":1,"group_id":0},
+			{"domainlist_id":3,"group_id":0},
+			{"domainlist_id":4,"group_id":1},
+			{"domainlist_id":5,"group_id":0},
+			{"domainlist_id":6,"group_id":2}
+		]`,
+		"client.json": `[
+			{"id":1,"ip":"192.168.1.20","comment":"Tablet"},
+			{"id":2,"ip":"192.168.1.0/24","comment":""}
+		]`,
+		"client_by_group.json": `[
+			{"client_id":1,"group_id":0},
+			{"client_id":1,"group_id":1},
+			{"client_id":2,"group_id":1}
+		]`,
+		"etc/pihole/custom.list":                "192.168.1.10 nas.lan\nbad\n",
+		"dnsmasq.d/05-pihole-custom-cname.conf": "cname=files.lan,nas.lan\n",
+		"dnsmasq.d/04-pihole-static-dhcp.conf":  "dhcp-host=00:11:22:33:44:55,192.168.1.10,nas\ndhcp-host=00:11:22:33:44:66\n",
+		"etc/pihole/setupVars.conf":             "PIHOLE_INTERFACE=eth0\n",
+	})
+
+	res, err := pihole.Read(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	wantFilters := []filtering.FilterYAML{{
+		Enabled: true,
+		URL:     "https://lists.example/ads.txt",
+		Name:    "Ads",
+	}, {
+		Enabled: true,
+		URL:     "https://lists.example/adult.txt",
+		Name:    "https://lists.example/adult.txt",
+		Filter: filtering.Filter{
+			Group: "kids",
+		},
+	}, {
+		Enabled: false,
+		URL:     "https://lists.example/old.txt",
+		Name:    "https://lists.example/old.txt",
+	}}
+
+	assert.Equal(t, []*filtering.FilterGroup{{Name: "kids"}}, res.FilterGroups)
+	assert.Equal(t, wantFilters, res.Filters)
+	assert.Equal(t, []string{
+		"|ads.example^",
+		"||tracker.example^",
+		"/^ad[0-9]+\\./",
+	}, res.UserRules)
+	assert.Equal(t, []*rewrite.Item{
+		{Domain: "nas.lan", Answer: "192.168.1.10", Enabled: true},
+		{Domain: "files.lan", Answer: "nas.lan", Enabled: true},
+	}, res.Rewrites)
+	assert.Equal(t, []*pihole.Client{{
+		Name:   "Tablet",
+		IDs:    []string{"192.168.1.20"},
+		Groups: []string{"kids"},
+	}, {
+		Name:   "192.168.1.0/24",
+		IDs:    []string{"192.168.1.0/24"},
+		Groups: []string{"kids"},
+	}}, res.Clients)
+	assert.Equal(t, []*dhcpsvc.Lease{{
+		IP:       netip.MustParseAddr("192.168.1.10"),
+		Hostname: "nas",
+		HWAddr:   net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		IsStatic: true,
+	}}, res.Leases)
+
+	assert.ElementsMatch(t, []string{
+		`file "etc/pihole/setupVars.conf": not supported`,
+		`group "old": disabled`,
+		`adlist "https://lists.example/old.txt": not assigned to any enabled group, added disabled`,
+		`domain "off.example": disabled`,
+		`domain "^ad[0-9]+\\.": only assigned to groups ["kids"], applied to all clients`,
+		`domain "^mail\\.;querytype=MX": regex extension ";querytype=" isn't supported`,
+		`domain "ok.example": not assigned to any enabled group`,
+		`client "192.168.1.0/24": not assigned to the default group, global filters still apply`,
+		`custom.list: line 2: want address and hostnames`,
+		`04-pihole-static-dhcp.conf: line 2: dhcp-host: want mac and ipv4 address`,
+	}, res.Unmapped)
+}
+
+func TestRead_bad(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         []byte
+		wantErrMsg string
+	}{{
+		name:       "zip",
+		in:         []byte("PK\x03\x04"),
+		wantErrMsg: "reading archive: zip archives of pi-hole v6 aren't supported",
+	}, {
+		name:       "not_gzip",
+		in:         []byte("not an archive"),
+		wantErrMsg: "reading archive: opening gzip: gzip: invalid header",
+	}, {
+		name: "bad_json",
+		in: newArchive(t, map[string]string{
+			"adlist.json": "{",
+		}),
+		wantErrMsg: "decoding adlist.json: unexpected EOF",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pihole.Read(bytes.NewReader(tc.in))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
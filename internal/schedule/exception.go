@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+)
+
+// date is a calendar date without a time zone.
+type date struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+// type check
+var _ fmt.Stringer = date{}
+
+// String implements the [fmt.Stringer] interface for date.  The result is in
+// the [time.DateOnly] format.
+func (d date) String() (s string) {
+	return fmt.Sprintf("%04d-%02d-%02d", d.year, d.month, d.day)
+}
+
+// compare returns -1 if d is before other, 1 if it's after, and 0 if they are
+// the same.
+func (d date) compare(other date) (res int) {
+	return cmp.Or(
+		cmp.Compare(d.year, other.year),
+		cmp.Compare(d.month, other.month),
+		cmp.Compare(d.day, other.day),
+	)
+}
+
+// exceptionConfigYAML is the YAML configuration structure of the day ranges of
+// a particular date.
+type exceptionConfigYAML struct {
+	// Date is the date in the [time.DateOnly] format.
+	Date string `yaml:"date"`
+
+	// Ranges are the day ranges of the date.  If empty, the schedule doesn't
+	// contain any time of the date.
+	Ranges []dayConfigYAML `yaml:"ranges"`
+}
+
+// exceptionConfigJSON is the JSON configuration structure of the day ranges of
+// a particular date.
+type exceptionConfigJSON struct {
+	// Date is the date in the [time.DateOnly] format.
+	Date string `json:"date"`
+
+	// Ranges are the day ranges of the date.  If empty, the schedule doesn't
+	// contain any time of the date.  Items must not be nil.
+	Ranges []*dayConfigJSON `json:"ranges"`
+}
@@ -2,8 +2,12 @@
 package schedule
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
@@ -12,15 +16,22 @@ import (
 	yaml "go.yaml.in/yaml/v4"
 )
 
-// Weekly is a schedule for one week.  Each day of the week has one range with
-// a beginning and an end.
+// Weekly is a schedule for one week.  Each day of the week has zero or more
+// non-overlapping ranges with a beginning and an end.  Particular dates may
+// have exceptions that replace the ranges of their weekdays.
 type Weekly struct {
 	// location is used to calculate the offsets of the day ranges.
 	location *time.Location
 
+	// exceptions are the day ranges for particular dates, which are used
+	// instead of the ones of their weekdays.  A nil slice means that the
+	// schedule doesn't contain any time of the date.
+	exceptions map[date][]dayRange
+
 	// days are the day ranges of this schedule.  The indexes of this array are
-	// the [time.Weekday] values.
-	days [7]dayRange
+	// the [time.Weekday] values.  The ranges of each day are sorted and don't
+	// overlap.
+	days [7][]dayRange
 }
 
 // EmptyWeekly creates empty weekly schedule with local time zone.
@@ -34,11 +45,11 @@ func EmptyWeekly() (w *Weekly) {
 //
 // TODO(s.chzhen):  Consider moving into tests.
 func FullWeekly() (w *Weekly) {
-	fullDay := dayRange{start: 0, end: maxDayRange}
+	fullDay := []dayRange{{start: 0, end: maxDayRange}}
 
 	return &Weekly{
 		location: time.Local,
-		days: [7]dayRange{
+		days: [7][]dayRange{
 			time.Sunday:    fullDay,
 			time.Monday:    fullDay,
 			time.Tuesday:   fullDay,
@@ -58,18 +69,28 @@ func (w *Weekly) Clone() (c *Weekly) {
 
 	// NOTE:  Do not use time.LoadLocation, because the results will be
 	// different on time zone database update.
-	return &Weekly{
+	c = &Weekly{
 		location: w.location,
-		days:     w.days,
 	}
+
+	for i, rs := range w.days {
+		c.days[i] = slices.Clone(rs)
+	}
+
+	if w.exceptions != nil {
+		c.exceptions = make(map[date][]dayRange, len(w.exceptions))
+		for d, rs := range w.exceptions {
+			c.exceptions[d] = slices.Clone(rs)
+		}
+	}
+
+	return c
 }
 
-// Contains returns true if t is within the corresponding day range of the
-// schedule in the schedule's time zone.
+// Contains returns true if t is within any of the corresponding day ranges of
+// the schedule in the schedule's time zone.
 func (w *Weekly) Contains(t time.Time) (ok bool) {
 	t = t.In(w.location)
-	wd := t.Weekday()
-	dr := w.days[wd]
 
 	// Calculate the offset of the day range.
 	//
@@ -78,7 +99,14 @@ func (w *Weekly) Contains(t time.Time) (ok bool) {
 	day := time.Date(y, m, d, 0, 0, 0, 0, w.location)
 	offset := t.Sub(day)
 
-	return dr.contains(offset)
+	ranges, ok := w.exceptions[date{year: y, month: m, day: d}]
+	if !ok {
+		ranges = w.days[t.Weekday()]
+	}
+
+	return slices.ContainsFunc(ranges, func(r dayRange) (found bool) {
+		return r.contains(offset)
+	})
 }
 
 // type check
@@ -99,7 +127,7 @@ func (w *Weekly) UnmarshalJSON(data []byte) (err error) {
 		return err
 	}
 
-	days := []*dayConfigJSON{
+	days := []dayConfigsJSON{
 		time.Sunday:    conf.Sunday,
 		time.Monday:    conf.Monday,
 		time.Tuesday:   conf.Tuesday,
@@ -109,21 +137,21 @@ func (w *Weekly) UnmarshalJSON(data []byte) (err error) {
 		time.Saturday:  conf.Saturday,
 	}
 	for i, d := range days {
-		var r dayRange
+		weekly.days[i], err = w.newDayRanges(d.toDayRanges())
+		if err != nil {
+			return fmt.Errorf("weekday %s: %w", time.Weekday(i), err)
+		}
+	}
 
-		if d != nil {
-			r = dayRange{
-				start: time.Duration(d.Start),
-				end:   time.Duration(d.End),
-			}
+	for i, e := range conf.Exceptions {
+		if e == nil || slices.Contains(e.Ranges, nil) {
+			return fmt.Errorf("exceptions: at index %d: %w", i, errors.ErrNoValue)
 		}
 
-		err = w.validate(r)
+		err = weekly.addException(e.Date, dayConfigsJSON(e.Ranges).toDayRanges())
 		if err != nil {
-			return fmt.Errorf("weekday %s: %w", time.Weekday(i), err)
+			return fmt.Errorf("exceptions: at index %d: %w", i, err)
 		}
-
-		weekly.days[i] = r
 	}
 
 	*w = weekly
@@ -152,7 +180,7 @@ func (w *Weekly) UnmarshalYAML(value *yaml.Node) (err error) {
 		return err
 	}
 
-	days := []dayConfigYAML{
+	days := []dayConfigsYAML{
 		time.Sunday:    conf.Sunday,
 		time.Monday:    conf.Monday,
 		time.Tuesday:   conf.Tuesday,
@@ -162,17 +190,21 @@ func (w *Weekly) UnmarshalYAML(value *yaml.Node) (err error) {
 		time.Saturday:  conf.Saturday,
 	}
 	for i, d := range days {
-		r := dayRange{
-			start: time.Duration(d.Start),
-			end:   time.Duration(d.End),
-		}
-
-		err = w.validate(r)
+		weekly.days[i], err = w.newDayRanges(d.toDayRanges())
 		if err != nil {
 			return fmt.Errorf("weekday %s: %w", time.Weekday(i), err)
 		}
+	}
 
-		weekly.days[i] = r
+	for i, e := range conf.Exceptions {
+		if e == nil {
+			return fmt.Errorf("exceptions: at index %d: %w", i, errors.ErrNoValue)
+		}
+
+		err = weekly.addException(e.Date, dayConfigsYAML(e.Ranges).toDayRanges())
+		if err != nil {
+			return fmt.Errorf("exceptions: at index %d: %w", i, err)
+		}
 	}
 
 	*w = weekly
@@ -187,13 +219,16 @@ type weeklyConfigYAML struct {
 
 	// Days of the week.
 
-	Sunday    dayConfigYAML `yaml:"sun,omitempty"`
-	Monday    dayConfigYAML `yaml:"mon,omitempty"`
-	Tuesday   dayConfigYAML `yaml:"tue,omitempty"`
-	Wednesday dayConfigYAML `yaml:"wed,omitempty"`
-	Thursday  dayConfigYAML `yaml:"thu,omitempty"`
-	Friday    dayConfigYAML `yaml:"fri,omitempty"`
-	Saturday  dayConfigYAML `yaml:"sat,omitempty"`
+	Sunday    dayConfigsYAML `yaml:"sun,omitempty"`
+	Monday    dayConfigsYAML `yaml:"mon,omitempty"`
+	Tuesday   dayConfigsYAML `yaml:"tue,omitempty"`
+	Wednesday dayConfigsYAML `yaml:"wed,omitempty"`
+	Thursday  dayConfigsYAML `yaml:"thu,omitempty"`
+	Friday    dayConfigsYAML `yaml:"fri,omitempty"`
+	Saturday  dayConfigsYAML `yaml:"sat,omitempty"`
+
+	// Exceptions are the day ranges for particular dates.
+	Exceptions []*exceptionConfigYAML `yaml:"exceptions,omitempty"`
 }
 
 // dayConfigYAML is the YAML configuration structure of dayRange.
@@ -202,6 +237,66 @@ type dayConfigYAML struct {
 	End   timeutil.Duration `yaml:"end"`
 }
 
+// dayConfigsYAML is the YAML configuration structure of the day ranges of a
+// single day.
+type dayConfigsYAML []dayConfigYAML
+
+// type check
+var _ yaml.Unmarshaler = (*dayConfigsYAML)(nil)
+
+// UnmarshalYAML implements the [yaml.Unmarshaler] interface for
+// *dayConfigsYAML.  Besides a list of ranges, it accepts a single range, which
+// is the format used before schema version 34.
+func (c *dayConfigsYAML) UnmarshalYAML(value *yaml.Node) (err error) {
+	if value.Kind == yaml.MappingNode {
+		conf := dayConfigYAML{}
+		err = value.Decode(&conf)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		*c = dayConfigsYAML{conf}
+
+		return nil
+	}
+
+	var confs []dayConfigYAML
+	err = value.Decode(&confs)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	*c = confs
+
+	return nil
+}
+
+// toDayRanges converts c into day ranges.
+func (c dayConfigsYAML) toDayRanges() (rs []dayRange) {
+	for _, conf := range c {
+		rs = append(rs, dayRange{
+			start: time.Duration(conf.Start),
+			end:   time.Duration(conf.End),
+		})
+	}
+
+	return rs
+}
+
+// newDayConfigsYAML returns the YAML configuration of the day ranges.
+func newDayConfigsYAML(rs []dayRange) (c dayConfigsYAML) {
+	for _, r := range rs {
+		c = append(c, dayConfigYAML{
+			Start: timeutil.Duration(r.start),
+			End:   timeutil.Duration(r.end),
+		})
+	}
+
+	return c
+}
+
 // maxDayRange is the maximum value for day range end.
 const maxDayRange = 24 * time.Hour
 
@@ -228,6 +323,68 @@ func (w *Weekly) validate(r dayRange) (err error) {
 	}
 }
 
+// newDayRanges validates rs and returns the non-empty ones sorted by their
+// beginnings.  It returns an error if any of the ranges overlap.
+func (w *Weekly) newDayRanges(rs []dayRange) (sorted []dayRange, err error) {
+	for _, r := range rs {
+		err = w.validate(r)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+
+		if r != (dayRange{}) {
+			sorted = append(sorted, r)
+		}
+	}
+
+	slices.SortFunc(sorted, func(a, b dayRange) (res int) {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1], sorted[i]
+		if cur.start < prev.end {
+			return nil, fmt.Errorf("day ranges %s and %s overlap", prev, cur)
+		}
+	}
+
+	return sorted, nil
+}
+
+// addException validates and adds the exception for the date in the
+// [time.DateOnly] format.  w.exceptions is initialized if necessary.
+func (w *Weekly) addException(dateStr string, rs []dayRange) (err error) {
+	t, err := time.Parse(time.DateOnly, dateStr)
+	if err != nil {
+		return fmt.Errorf("date: %w", err)
+	}
+
+	y, m, d := t.Date()
+	key := date{year: y, month: m, day: d}
+	if _, ok := w.exceptions[key]; ok {
+		return fmt.Errorf("date: %w: %q", errors.ErrDuplicated, dateStr)
+	}
+
+	rs, err = w.newDayRanges(rs)
+	if err != nil {
+		return fmt.Errorf("date %s: %w", dateStr, err)
+	}
+
+	if w.exceptions == nil {
+		w.exceptions = map[date][]dayRange{}
+	}
+
+	w.exceptions[key] = rs
+
+	return nil
+}
+
+// sortedExceptionDates returns the dates of the exceptions in ascending order.
+func (w *Weekly) sortedExceptionDates() (dates []date) {
+	return slices.SortedFunc(maps.Keys(w.exceptions), date.compare)
+}
+
 // type check
 var _ json.Marshaler = (*Weekly)(nil)
 
@@ -235,13 +392,20 @@ var _ json.Marshaler = (*Weekly)(nil)
 func (w *Weekly) MarshalJSON() (data []byte, err error) {
 	c := &weeklyConfigJSON{
 		TimeZone:  w.location.String(),
-		Sunday:    w.days[time.Sunday].toDayConfigJSON(),
-		Monday:    w.days[time.Monday].toDayConfigJSON(),
-		Tuesday:   w.days[time.Tuesday].toDayConfigJSON(),
-		Wednesday: w.days[time.Wednesday].toDayConfigJSON(),
-		Thursday:  w.days[time.Thursday].toDayConfigJSON(),
-		Friday:    w.days[time.Friday].toDayConfigJSON(),
-		Saturday:  w.days[time.Saturday].toDayConfigJSON(),
+		Sunday:    newDayConfigsJSON(w.days[time.Sunday]),
+		Monday:    newDayConfigsJSON(w.days[time.Monday]),
+		Tuesday:   newDayConfigsJSON(w.days[time.Tuesday]),
+		Wednesday: newDayConfigsJSON(w.days[time.Wednesday]),
+		Thursday:  newDayConfigsJSON(w.days[time.Thursday]),
+		Friday:    newDayConfigsJSON(w.days[time.Friday]),
+		Saturday:  newDayConfigsJSON(w.days[time.Saturday]),
+	}
+
+	for _, d := range w.sortedExceptionDates() {
+		c.Exceptions = append(c.Exceptions, &exceptionConfigJSON{
+			Date:   d.String(),
+			Ranges: append([]*dayConfigJSON{}, newDayConfigsJSON(w.exceptions[d])...),
+		})
 	}
 
 	return json.Marshal(c)
@@ -252,37 +416,25 @@ var _ yaml.Marshaler = (*Weekly)(nil)
 
 // MarshalYAML implements the [yaml.Marshaler] interface for *Weekly.
 func (w *Weekly) MarshalYAML() (v any, err error) {
-	return weeklyConfigYAML{
-		TimeZone: w.location.String(),
-		Sunday: dayConfigYAML{
-			Start: timeutil.Duration(w.days[time.Sunday].start),
-			End:   timeutil.Duration(w.days[time.Sunday].end),
-		},
-		Monday: dayConfigYAML{
-			Start: timeutil.Duration(w.days[time.Monday].start),
-			End:   timeutil.Duration(w.days[time.Monday].end),
-		},
-		Tuesday: dayConfigYAML{
-			Start: timeutil.Duration(w.days[time.Tuesday].start),
-			End:   timeutil.Duration(w.days[time.Tuesday].end),
-		},
-		Wednesday: dayConfigYAML{
-			Start: timeutil.Duration(w.days[time.Wednesday].start),
-			End:   timeutil.Duration(w.days[time.Wednesday].end),
-		},
-		Thursday: dayConfigYAML{
-			Start: timeutil.Duration(w.days[time.Thursday].start),
-			End:   timeutil.Duration(w.days[time.Thursday].end),
-		},
-		Friday: dayConfigYAML{
-			Start: timeutil.Duration(w.days[time.Friday].start),
-			End:   timeutil.Duration(w.days[time.Friday].end),
-		},
-		Saturday: dayConfigYAML{
-			Start: timeutil.Duration(w.days[time.Saturday].start),
-			End:   timeutil.Duration(w.days[time.Saturday].end),
-		},
-	}, nil
+	c := weeklyConfigYAML{
+		TimeZone:  w.location.String(),
+		Sunday:    newDayConfigsYAML(w.days[time.Sunday]),
+		Monday:    newDayConfigsYAML(w.days[time.Monday]),
+		Tuesday:   newDayConfigsYAML(w.days[time.Tuesday]),
+		Wednesday: newDayConfigsYAML(w.days[time.Wednesday]),
+		Thursday:  newDayConfigsYAML(w.days[time.Thursday]),
+		Friday:    newDayConfigsYAML(w.days[time.Friday]),
+		Saturday:  newDayConfigsYAML(w.days[time.Saturday]),
+	}
+
+	for _, d := range w.sortedExceptionDates() {
+		c.Exceptions = append(c.Exceptions, &exceptionConfigYAML{
+			Date:   d.String(),
+			Ranges: append([]dayConfigYAML{}, newDayConfigsYAML(w.exceptions[d])...),
+		})
+	}
+
+	return c, nil
 }
 
 // dayRange represents a single interval within a day.  The interval begins at
@@ -298,6 +450,14 @@ type dayRange struct {
 	end time.Duration
 }
 
+// type check
+var _ fmt.Stringer = dayRange{}
+
+// String implements the [fmt.Stringer] interface for dayRange.
+func (r dayRange) String() (s string) {
+	return fmt.Sprintf("%s-%s", r.start, r.end)
+}
+
 // validate returns the day range validation errors, if any.
 func (r dayRange) validate() (err error) {
 	switch {
@@ -341,16 +501,19 @@ func (r dayRange) toDayConfigJSON() (j *dayConfigJSON) {
 type weeklyConfigJSON struct {
 	// Days of the week.
 
-	Sunday    *dayConfigJSON `json:"sun,omitempty"`
-	Monday    *dayConfigJSON `json:"mon,omitempty"`
-	Tuesday   *dayConfigJSON `json:"tue,omitempty"`
-	Wednesday *dayConfigJSON `json:"wed,omitempty"`
-	Thursday  *dayConfigJSON `json:"thu,omitempty"`
-	Friday    *dayConfigJSON `json:"fri,omitempty"`
-	Saturday  *dayConfigJSON `json:"sat,omitempty"`
+	Sunday    dayConfigsJSON `json:"sun,omitempty"`
+	Monday    dayConfigsJSON `json:"mon,omitempty"`
+	Tuesday   dayConfigsJSON `json:"tue,omitempty"`
+	Wednesday dayConfigsJSON `json:"wed,omitempty"`
+	Thursday  dayConfigsJSON `json:"thu,omitempty"`
+	Friday    dayConfigsJSON `json:"fri,omitempty"`
+	Saturday  dayConfigsJSON `json:"sat,omitempty"`
 
 	// TimeZone is the local time zone.
 	TimeZone string `json:"time_zone"`
+
+	// Exceptions are the day ranges for particular dates.
+	Exceptions []*exceptionConfigJSON `json:"exceptions,omitempty"`
 }
 
 // dayConfigJSON is the JSON configuration structure of dayRange.
@@ -358,3 +521,77 @@ type dayConfigJSON struct {
 	Start aghhttp.JSONDuration `json:"start"`
 	End   aghhttp.JSONDuration `json:"end"`
 }
+
+// dayConfigsJSON is the JSON configuration structure of the day ranges of a
+// single day.  Items must not be nil.
+type dayConfigsJSON []*dayConfigJSON
+
+// type check
+var _ json.Unmarshaler = (*dayConfigsJSON)(nil)
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface for
+// *dayConfigsJSON.  Besides an array of ranges, it accepts a single range
+// object for compatibility.
+func (c *dayConfigsJSON) UnmarshalJSON(data []byte) (err error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		conf := &dayConfigJSON{}
+		err = json.Unmarshal(data, conf)
+		if err != nil {
+			return err
+		}
+
+		*c = dayConfigsJSON{conf}
+
+		return nil
+	}
+
+	var confs []*dayConfigJSON
+	err = json.Unmarshal(data, &confs)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(confs, nil) {
+		return errors.ErrNoValue
+	}
+
+	*c = confs
+
+	return nil
+}
+
+// type check
+var _ json.Marshaler = dayConfigsJSON(nil)
+
+// MarshalJSON implements the [json.Marshaler] interface for dayConfigsJSON.  A
+// single range is encoded as an object for compatibility.
+func (c dayConfigsJSON) MarshalJSON() (data []byte, err error) {
+	if len(c) == 1 {
+		return json.Marshal(c[0])
+	}
+
+	return json.Marshal([]*dayConfigJSON(c))
+}
+
+// toDayRanges converts c into day ranges.
+func (c dayConfigsJSON) toDayRanges() (rs []dayRange) {
+	for _, conf := range c {
+		rs = append(rs, dayRange{
+			start: time.Duration(conf.Start),
+			end:   time.Duration(conf.End),
+		})
+	}
+
+	return rs
+}
+
+// newDayConfigsJSON returns the JSON configuration of the day ranges.
+func newDayConfigsJSON(rs []dayRange) (c dayConfigsJSON) {
+	for _, r := range rs {
+		if j := r.toDayConfigJSON(); j != nil {
+			c = append(c, j)
+		}
+	}
+
+	return c
+}
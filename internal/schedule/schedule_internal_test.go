@@ -22,24 +22,24 @@ func TestWeekly_Contains(t *testing.T) {
 
 	// baseSchedule, 12:00 to 14:00.
 	baseSchedule := &Weekly{
-		days: [7]dayRange{
-			time.Friday: {start: 12 * time.Hour, end: 14 * time.Hour},
+		days: [7][]dayRange{
+			time.Friday: {{start: 12 * time.Hour, end: 14 * time.Hour}},
 		},
 		location: time.UTC,
 	}
 
 	// allDaySchedule, 00:00 to 24:00.
 	allDaySchedule := &Weekly{
-		days: [7]dayRange{
-			time.Friday: {start: 0, end: 24 * time.Hour},
+		days: [7][]dayRange{
+			time.Friday: {{start: 0, end: 24 * time.Hour}},
 		},
 		location: time.UTC,
 	}
 
 	// oneMinSchedule, 00:00 to 00:01.
 	oneMinSchedule := &Weekly{
-		days: [7]dayRange{
-			time.Friday: {start: 0, end: 1 * time.Minute},
+		days: [7][]dayRange{
+			time.Friday: {{start: 0, end: 1 * time.Minute}},
 		},
 		location: time.UTC,
 	}
@@ -155,10 +155,10 @@ yaml: "bad"
 	require.NoError(t, err)
 
 	brusselsWeekly := &Weekly{
-		days: [7]dayRange{{
+		days: [7][]dayRange{{{
 			start: time.Hour * 12,
 			end:   time.Hour * 14,
-		}},
+		}}},
 		location: brusseltsTZ,
 	}
 
@@ -225,10 +225,10 @@ func TestWeekly_MarshalYAML(t *testing.T) {
 	require.NoError(t, err)
 
 	brusselsWeekly := &Weekly{
-		days: [7]dayRange{time.Sunday: {
+		days: [7][]dayRange{time.Sunday: {{
 			start: time.Hour * 12,
 			end:   time.Hour * 14,
-		}},
+		}}},
 		location: brusselsTZ,
 	}
 
@@ -410,10 +410,10 @@ func TestWeekly_UnmarshalJSON(t *testing.T) {
 	require.NoError(t, err)
 
 	brusselsWeekly := &Weekly{
-		days: [7]dayRange{{
+		days: [7][]dayRange{{{
 			start: time.Hour * 12,
 			end:   time.Hour * 14,
-		}},
+		}}},
 		location: brusseltsTZ,
 	}
 
@@ -475,10 +475,10 @@ func TestWeekly_MarshalJSON(t *testing.T) {
 	require.NoError(t, err)
 
 	brusselsWeekly := &Weekly{
-		days: [7]dayRange{time.Sunday: {
+		days: [7][]dayRange{time.Sunday: {{
 			start: time.Hour * 12,
 			end:   time.Hour * 14,
-		}},
+		}}},
 		location: brusselsTZ,
 	}
 
@@ -514,3 +514,213 @@ func TestWeekly_MarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestWeekly_Contains_ranges(t *testing.T) {
+	// friday is 2021-01-01, which is a Friday.
+	friday := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	nextFriday := friday.Add(7 * timeutil.Day)
+
+	schoolHours := []dayRange{{
+		start: 8 * time.Hour,
+		end:   12 * time.Hour,
+	}, {
+		start: 13 * time.Hour,
+		end:   17 * time.Hour,
+	}}
+
+	w := &Weekly{
+		days: [7][]dayRange{
+			time.Friday: schoolHours,
+		},
+		exceptions: map[date][]dayRange{
+			{year: 2021, month: time.January, day: 1}: nil,
+			{year: 2021, month: time.January, day: 2}: {{
+				start: 10 * time.Hour,
+				end:   11 * time.Hour,
+			}},
+		},
+		location: time.UTC,
+	}
+
+	testCases := []struct {
+		assert assert.BoolAssertionFunc
+		t      time.Time
+		name   string
+	}{{
+		assert: assert.True,
+		t:      nextFriday.Add(9 * time.Hour),
+		name:   "first_range",
+	}, {
+		assert: assert.False,
+		t:      nextFriday.Add(12*time.Hour + 30*time.Minute),
+		name:   "lunch_break",
+	}, {
+		assert: assert.True,
+		t:      nextFriday.Add(16 * time.Hour),
+		name:   "second_range",
+	}, {
+		assert: assert.False,
+		t:      nextFriday.Add(17 * time.Hour),
+		name:   "after_ranges",
+	}, {
+		assert: assert.False,
+		t:      friday.Add(9 * time.Hour),
+		name:   "holiday",
+	}, {
+		assert: assert.True,
+		t:      friday.Add(34 * time.Hour),
+		name:   "exception_inside",
+	}, {
+		assert: assert.False,
+		t:      nextFriday.Add(34 * time.Hour),
+		name:   "exception_other_week",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.assert(t, w.Contains(tc.t))
+		})
+	}
+}
+
+func TestWeekly_UnmarshalYAML_ranges(t *testing.T) {
+	const (
+		rangesYAML = `
+time_zone: UTC
+mon:
+  - start: 13h
+    end: 17h
+  - start: 8h
+    end: 12h
+exceptions:
+  - date: "2021-12-24"
+    ranges:
+      - start: 8h
+        end: 10h
+  - date: "2021-12-27"
+    ranges: []
+`
+		overlapYAML = `
+time_zone: UTC
+mon:
+  - start: 8h
+    end: 12h
+  - start: 11h
+    end: 13h
+`
+		dupDateYAML = `
+time_zone: UTC
+exceptions:
+  - date: "2021-12-24"
+  - date: "2021-12-24"
+`
+		badDateYAML = `
+time_zone: UTC
+exceptions:
+  - date: "24.12.2021"
+`
+	)
+
+	testCases := []struct {
+		want       *Weekly
+		name       string
+		wantErrMsg string
+		data       string
+	}{{
+		want: &Weekly{
+			location: time.UTC,
+			days: [7][]dayRange{
+				time.Monday: {{
+					start: 8 * time.Hour,
+					end:   12 * time.Hour,
+				}, {
+					start: 13 * time.Hour,
+					end:   17 * time.Hour,
+				}},
+			},
+			exceptions: map[date][]dayRange{
+				{year: 2021, month: time.December, day: 24}: {{
+					start: 8 * time.Hour,
+					end:   10 * time.Hour,
+				}},
+				{year: 2021, month: time.December, day: 27}: nil,
+			},
+		},
+		name:       "ranges",
+		wantErrMsg: "",
+		data:       rangesYAML,
+	}, {
+		want: &Weekly{},
+		name: "overlap",
+		wantErrMsg: "yaml: unmarshal errors:\n" +
+			"  line 2: weekday Monday: day ranges 8h0m0s-12h0m0s and " +
+			"11h0m0s-13h0m0s overlap",
+		data: overlapYAML,
+	}, {
+		want: &Weekly{},
+		name: "duplicate_date",
+		wantErrMsg: "yaml: unmarshal errors:\n" +
+			`  line 2: exceptions: at index 1: date: duplicated value: "2021-12-24"`,
+		data: dupDateYAML,
+	}, {
+		want: &Weekly{},
+		name: "bad_date",
+		wantErrMsg: "yaml: unmarshal errors:\n" +
+			`  line 2: exceptions: at index 0: date: parsing time "24.12.2021" ` +
+			`as "2006-01-02": cannot parse "24.12.2021" as "2006"`,
+		data: badDateYAML,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &Weekly{}
+			err := yaml.Unmarshal([]byte(tc.data), w)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, w)
+		})
+	}
+}
+
+func TestWeekly_MarshalJSON_ranges(t *testing.T) {
+	w := &Weekly{
+		location: time.UTC,
+		days: [7][]dayRange{
+			time.Sunday: {{
+				start: 12 * time.Hour,
+				end:   14 * time.Hour,
+			}},
+			time.Monday: {{
+				start: 8 * time.Hour,
+				end:   12 * time.Hour,
+			}, {
+				start: 13 * time.Hour,
+				end:   17 * time.Hour,
+			}},
+		},
+		exceptions: map[date][]dayRange{
+			{year: 2021, month: time.December, day: 27}: nil,
+		},
+	}
+
+	const wantJSON = `{
+  "sun": {"start": 43200000, "end": 50400000},
+  "mon": [
+    {"start": 28800000, "end": 43200000},
+    {"start": 46800000, "end": 61200000}
+  ],
+  "time_zone": "UTC",
+  "exceptions": [{"date": "2021-12-27", "ranges": []}]
+}`
+
+	data, err := json.Marshal(w)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, wantJSON, string(data))
+
+	got := &Weekly{}
+	err = json.Unmarshal(data, got)
+	require.NoError(t, err)
+
+	assert.Equal(t, w, got)
+}
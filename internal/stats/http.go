@@ -3,10 +3,13 @@
 package stats
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
@@ -281,6 +284,81 @@ func (s *StatsCtx) handlePutStatsConfig(w http.ResponseWriter, r *http.Request)
 	s.enabled = reqData.Enabled == aghalg.NBTrue
 }
 
+// ruleHitJSON is the number of matches of a single filtering rule.
+type ruleHitJSON struct {
+	// Text is the text of the rule.
+	Text string `json:"text"`
+
+	// FilterListID is the ID of the rule's filter list.
+	FilterListID int64 `json:"filter_list_id"`
+
+	// Hits is the number of matches of the rule.
+	Hits uint64 `json:"hits"`
+}
+
+// ruleHitsResp is the response to the GET /control/stats/rules HTTP API.
+type ruleHitsResp struct {
+	// Rules are the matched rules sorted by the number of matches in the
+	// descending order.
+	Rules []*ruleHitJSON `json:"rules"`
+}
+
+// handleStatsRules is the handler for the GET /control/stats/rules HTTP API.
+// The optional filter_list_id query parameter limits the response to the rules
+// of a single filter list.
+func (s *StatsCtx) handleStatsRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var fltID int64
+	var filterByID bool
+	if idStr := r.URL.Query().Get("filter_list_id"); idStr != "" {
+		var err error
+		fltID, err = strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			aghhttp.ErrorAndLog(
+				ctx,
+				s.logger,
+				r,
+				w,
+				http.StatusBadRequest,
+				"filter_list_id: %s",
+				err,
+			)
+
+			return
+		}
+
+		filterByID = true
+	}
+
+	resp := &ruleHitsResp{
+		Rules: []*ruleHitJSON{},
+	}
+
+	hits, _ := s.RuleHits()
+	for rule, n := range hits {
+		if filterByID && rule.FilterListID != fltID {
+			continue
+		}
+
+		resp.Rules = append(resp.Rules, &ruleHitJSON{
+			Text:         rule.Text,
+			FilterListID: rule.FilterListID,
+			Hits:         n,
+		})
+	}
+
+	slices.SortFunc(resp.Rules, func(a, b *ruleHitJSON) (res int) {
+		return cmp.Or(
+			cmp.Compare(b.Hits, a.Hits),
+			cmp.Compare(a.FilterListID, b.FilterListID),
+			strings.Compare(a.Text, b.Text),
+		)
+	})
+
+	aghhttp.WriteJSONResponseOK(ctx, s.logger, w, r, resp)
+}
+
 // handleStatsReset is the handler for the POST /control/stats_reset HTTP API.
 func (s *StatsCtx) handleStatsReset(w http.ResponseWriter, r *http.Request) {
 	err := s.clear()
@@ -303,6 +381,7 @@ func (s *StatsCtx) initWeb() {
 	s.httpReg.Register(http.MethodPost, "/control/stats_reset", s.handleStatsReset)
 	s.httpReg.Register(http.MethodGet, "/control/stats/config", s.handleGetStatsConfig)
 	s.httpReg.Register(http.MethodPut, "/control/stats/config/update", s.handlePutStatsConfig)
+	s.httpReg.Register(http.MethodGet, "/control/stats/rules", s.handleStatsRules)
 
 	// Deprecated handlers.
 	s.httpReg.Register(http.MethodGet, "/control/stats_info", s.handleStatsInfo)
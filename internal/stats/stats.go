@@ -103,6 +103,12 @@ type Interface interface {
 
 	// ShouldCount returns true if request for the host should be counted.
 	ShouldCount(host string, qType, qClass uint16, ids []string) bool
+
+	// RuleHits returns the number of matches of each filtering rule within the
+	// statistics retention interval.  hits is nil if the statistics are
+	// disabled.  complete is false if some of the matched rules have been
+	// dropped from the stored statistics, so that hits may lack them.
+	RuleHits() (hits map[Rule]uint64, complete bool)
 }
 
 // StatsCtx collects the statistics and flushes it to the database.  Its default
@@ -117,6 +123,13 @@ type StatsCtx struct {
 	// curr is the actual statistics collection result.
 	curr *unit
 
+	// ruleHitsMu protects storedRuleHits.
+	ruleHitsMu *sync.Mutex
+
+	// storedRuleHits is the cache of the numbers of matches of filtering rules
+	// within the units stored in the database.  It's nil if there is no cache.
+	storedRuleHits *ruleHitsCache
+
 	// db is the opened statistics database, if any.
 	db atomic.Pointer[bbolt.DB]
 
@@ -167,6 +180,7 @@ func New(conf Config) (s *StatsCtx, err error) {
 	s = &StatsCtx{
 		logger:         conf.Logger,
 		currMu:         &sync.RWMutex{},
+		ruleHitsMu:     &sync.Mutex{},
 		httpReg:        conf.HTTPReg,
 		configModifier: conf.ConfigModifier,
 		filename:       conf.Filename,
@@ -345,6 +359,135 @@ func (s *StatsCtx) TopClientsIP(maxCount uint) (ips []netip.Addr) {
 	return ips
 }
 
+// ruleHitsCache is the cached numbers of matches of filtering rules within the
+// units stored in the database.  Those units only change when the current unit
+// is flushed, when the limit is changed, or when the statistics are cleared.
+type ruleHitsCache struct {
+	// hits are the numbers of matches of each rule.
+	hits map[Rule]uint64
+
+	// complete is false if some of the units have been stored with the matched
+	// rules truncated.
+	complete bool
+
+	// curID is the ID of the current unit at the moment of caching.
+	curID uint32
+
+	// limit is the number of units at the moment of caching.
+	limit uint32
+}
+
+// RuleHits implements the [Interface] interface for *StatsCtx.  The matches
+// within the stored units are cached, so that only the current unit is read on
+// each call.
+func (s *StatsCtx) RuleHits() (hits map[Rule]uint64, complete bool) {
+	s.confMu.RLock()
+	defer s.confMu.RUnlock()
+
+	limit := uint32(s.limit.Hours())
+	if !s.enabled || limit == 0 {
+		return nil, false
+	}
+
+	var curID uint32
+	var curTruncated bool
+	hits = map[Rule]uint64{}
+	func() {
+		s.currMu.RLock()
+		defer s.currMu.RUnlock()
+
+		if s.curr == nil {
+			curID = s.unitIDGen()
+
+			return
+		}
+
+		curID = s.curr.id
+		curTruncated = s.curr.rulesTruncated
+		for r, n := range s.curr.rules {
+			hits[r] += n
+		}
+	}()
+
+	stored, storedComplete, ok := s.cachedRuleHits(curID, limit)
+	if !ok {
+		return nil, false
+	}
+
+	for r, n := range stored {
+		hits[r] += n
+	}
+
+	return hits, storedComplete && !curTruncated
+}
+
+// cachedRuleHits returns the numbers of matches of filtering rules within the
+// units stored in the database preceding the unit with curID, loading them if
+// the cache is stale.  complete is false if some of these units have been
+// stored with the matched rules truncated.  ok is false if the database isn't
+// available.
+func (s *StatsCtx) cachedRuleHits(
+	curID uint32,
+	limit uint32,
+) (hits map[Rule]uint64, complete, ok bool) {
+	s.ruleHitsMu.Lock()
+	defer s.ruleHitsMu.Unlock()
+
+	c := s.storedRuleHits
+	if c != nil && c.curID == curID && c.limit == limit {
+		return c.hits, c.complete, true
+	}
+
+	db := s.db.Load()
+	if db == nil {
+		return nil, false, false
+	}
+
+	tx, err := db.Begin(false)
+	if err != nil {
+		s.logger.Error("opening transaction", slogutil.KeyError, err)
+
+		return nil, false, false
+	}
+
+	hits = map[Rule]uint64{}
+	complete = true
+	for id := curID - limit + 1; id != curID; id++ {
+		u := s.loadUnitFromDB(tx, id)
+		if u == nil {
+			continue
+		}
+
+		complete = complete && !u.RulesTruncated
+
+		for _, it := range u.Rules {
+			hits[Rule{Text: it.Text, FilterListID: it.FilterListID}] += it.Count
+		}
+	}
+
+	err = finishTxn(tx, false)
+	if err != nil {
+		s.logger.Error("finishing transaction", slogutil.KeyError, err)
+	}
+
+	s.storedRuleHits = &ruleHitsCache{
+		hits:     hits,
+		complete: complete,
+		curID:    curID,
+		limit:    limit,
+	}
+
+	return hits, complete, true
+}
+
+// resetRuleHitsCache removes the cached numbers of matches of filtering rules.
+func (s *StatsCtx) resetRuleHitsCache() {
+	s.ruleHitsMu.Lock()
+	defer s.ruleHitsMu.Unlock()
+
+	s.storedRuleHits = nil
+}
+
 // deleteOldUnits walks the buckets available to tx and deletes old units.  It
 // returns the number of deletions performed.
 func (s *StatsCtx) deleteOldUnits(tx *bbolt.Tx, firstID uint32) (deleted int) {
@@ -556,6 +699,8 @@ func (s *StatsCtx) clear() (err error) {
 	// Use defer to unlock the mutex as soon as possible.
 	defer s.logger.Debug("cleared")
 
+	s.resetRuleHitsCache()
+
 	s.currMu.Lock()
 	defer s.currMu.Unlock()
 
@@ -173,6 +173,106 @@ func TestStats(t *testing.T) {
 	})
 }
 
+func TestStatsCtx_RuleHits(t *testing.T) {
+	const (
+		blockRule = "||blocked.example^"
+		allowRule = "@@||allowed.example^"
+	)
+
+	handlers := map[string]http.Handler{}
+	conf := stats.Config{
+		Logger:            slogutil.NewDiscardLogger(),
+		ShouldCountClient: func([]string) bool { return true },
+		Filename:          filepath.Join(t.TempDir(), "stats.db"),
+		Limit:             timeutil.Day,
+		Enabled:           true,
+		// Use a large enough unit ID so that the unit isn't considered
+		// outdated on reopening.
+		UnitID: func() (id uint32) { return 100 },
+		HTTPReg: &aghtest.Registrar{
+			OnRegister: func(_, url string, handler http.HandlerFunc) {
+				handlers[url] = handler
+			},
+		},
+	}
+
+	s, err := stats.New(conf)
+	require.NoError(t, err)
+
+	for range 2 {
+		s.Update(&stats.Entry{
+			Domain: "blocked.example",
+			Client: "127.0.0.1",
+			Result: stats.RFiltered,
+			Rules:  []stats.Rule{{Text: blockRule, FilterListID: 1}},
+		})
+	}
+
+	s.Update(&stats.Entry{
+		Domain: "allowed.example",
+		Client: "127.0.0.1",
+		Result: stats.RNotFiltered,
+		Rules:  []stats.Rule{{Text: allowRule, FilterListID: 0}},
+	})
+
+	// Make sure the hits are persisted.
+	require.NoError(t, s.Close())
+
+	s, err = stats.New(conf)
+	require.NoError(t, err)
+
+	s.Start()
+	testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	wantHits := map[stats.Rule]uint64{
+		{Text: blockRule, FilterListID: 1}: 2,
+		{Text: allowRule, FilterListID: 0}: 1,
+	}
+	hits, complete := s.RuleHits()
+	assert.Equal(t, wantHits, hits)
+	assert.True(t, complete)
+
+	// The matches within the current unit must be counted even if the stored
+	// ones are cached.
+	s.Update(&stats.Entry{
+		Domain: "blocked.example",
+		Client: "127.0.0.1",
+		Result: stats.RFiltered,
+		Rules:  []stats.Rule{{Text: blockRule, FilterListID: 1}},
+	})
+
+	wantHits[stats.Rule{Text: blockRule, FilterListID: 1}]++
+	hits, complete = s.RuleHits()
+	assert.Equal(t, wantHits, hits)
+	assert.True(t, complete)
+
+	t.Run("http", func(t *testing.T) {
+		var resp struct {
+			Rules []struct {
+				Text         string `json:"text"`
+				FilterListID int64  `json:"filter_list_id"`
+				Hits         uint64 `json:"hits"`
+			} `json:"rules"`
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/control/stats/rules", nil)
+		assertSuccessAndUnmarshal(t, &resp, handlers["/control/stats/rules"], req)
+
+		require.Len(t, resp.Rules, 2)
+
+		assert.Equal(t, blockRule, resp.Rules[0].Text)
+		assert.Equal(t, uint64(3), resp.Rules[0].Hits)
+		assert.Equal(t, allowRule, resp.Rules[1].Text)
+
+		req = httptest.NewRequest(http.MethodGet, "/control/stats/rules?filter_list_id=0", nil)
+		assertSuccessAndUnmarshal(t, &resp, handlers["/control/stats/rules"], req)
+
+		require.Len(t, resp.Rules, 1)
+
+		assert.Equal(t, allowRule, resp.Rules[0].Text)
+	})
+}
+
 func TestLargeNumbers(t *testing.T) {
 	var curHour uint32 = 1
 	handlers := map[string]http.Handler{}
@@ -2,6 +2,7 @@ package stats
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
 	"encoding/gob"
 	"fmt"
@@ -25,6 +26,10 @@ const (
 
 	// maxUpstreams is the max number of top upstreams to return.
 	maxUpstreams = 100
+
+	// maxRules is the max number of matched filtering rules to store for each
+	// unit.
+	maxRules = 10_000
 )
 
 // UnitIDGenFunc is the signature of a function that generates a unique ID for
@@ -70,11 +75,24 @@ type Entry struct {
 	// Result is the result of processing the request.
 	Result Result
 
+	// Rules are the filtering rules that matched the request, if any.
+	Rules []Rule
+
 	// ProcessingTime is the duration of the request processing from the start
 	// of the request including timeouts.
 	ProcessingTime time.Duration
 }
 
+// Rule is a filtering rule that matched a request.
+type Rule struct {
+	// Text is the text of the rule.
+	Text string
+
+	// FilterListID is the ID of the rule's filter list as used in the HTTP
+	// API.
+	FilterListID int64
+}
+
 // validate returns an error if entry is not valid.
 func (e *Entry) validate() (err error) {
 	switch {
@@ -110,6 +128,13 @@ type unit struct {
 	// microseconds to each upstream.
 	upstreamsTimeSum map[string]uint64
 
+	// rules stores the number of matches of each filtering rule.
+	rules map[Rule]uint64
+
+	// rulesTruncated is true if some of the matched rules have been dropped
+	// from the unit when it was stored into the database.
+	rulesTruncated bool
+
 	// nResult stores the number of requests grouped by it's result.
 	nResult []uint64
 
@@ -136,6 +161,7 @@ func newUnit(id uint32) (u *unit) {
 		clients:            map[string]uint64{},
 		upstreamsResponses: map[string]uint64{},
 		upstreamsTimeSum:   map[string]uint64{},
+		rules:              map[Rule]uint64{},
 		nResult:            make([]uint64, resultLast),
 		id:                 id,
 	}
@@ -148,6 +174,14 @@ type countPair struct {
 	Count uint64
 }
 
+// ruleCountPair is a single rule-number pair for serializing statistics data
+// into the database.
+type ruleCountPair struct {
+	Text         string
+	FilterListID int64
+	Count        uint64
+}
+
 // unitDB is the structure for serializing statistics data into the database.
 //
 // NOTE: Do not change the names or types of fields, as this structure is used
@@ -172,12 +206,19 @@ type unitDB struct {
 	// responses from each upstream.
 	UpstreamsTimeSum []countPair
 
+	// Rules is the number of matches of each filtering rule.
+	Rules []ruleCountPair
+
 	// NTotal is the total number of requests.
 	NTotal uint64
 
 	// TimeAvg is the average of processing times in microseconds of all the
 	// requests in the unit.
 	TimeAvg uint32
+
+	// RulesTruncated is true if Rules only contains the most matched rules and
+	// the rest of them have been dropped.
+	RulesTruncated bool
 }
 
 // newUnitID is the default UnitIDGenFunc that generates the unique id hourly.
@@ -253,6 +294,30 @@ func convertSliceToMap(a []countPair) (m map[string]uint64) {
 	return m
 }
 
+// convertRulesToSlice returns at most maxVal of the most matched rules from m.
+func convertRulesToSlice(m map[Rule]uint64, maxVal int) (s []ruleCountPair) {
+	s = make([]ruleCountPair, 0, len(m))
+	for r, n := range m {
+		s = append(s, ruleCountPair{Text: r.Text, FilterListID: r.FilterListID, Count: n})
+	}
+
+	slices.SortFunc(s, func(a, b ruleCountPair) (res int) {
+		return cmp.Compare(b.Count, a.Count)
+	})
+
+	return s[:min(maxVal, len(s))]
+}
+
+// convertSliceToRules is the inverse of [convertRulesToSlice].
+func convertSliceToRules(a []ruleCountPair) (m map[Rule]uint64) {
+	m = make(map[Rule]uint64, len(a))
+	for _, it := range a {
+		m[Rule{Text: it.Text, FilterListID: it.FilterListID}] = it.Count
+	}
+
+	return m
+}
+
 // serialize converts u to the *unitDB.  It's safe for concurrent use.  u must
 // not be nil.
 func (u *unit) serialize() (udb *unitDB) {
@@ -269,7 +334,9 @@ func (u *unit) serialize() (udb *unitDB) {
 		Clients:            convertMapToSlice(u.clients, maxClients),
 		UpstreamsResponses: convertMapToSlice(u.upstreamsResponses, maxUpstreams),
 		UpstreamsTimeSum:   convertMapToSlice(u.upstreamsTimeSum, maxUpstreams),
+		Rules:              convertRulesToSlice(u.rules, maxRules),
 		TimeAvg:            timeAvg,
+		RulesTruncated:     u.rulesTruncated || len(u.rules) > maxRules,
 	}
 }
 
@@ -311,6 +378,8 @@ func (u *unit) deserialize(udb *unitDB) {
 	u.clients = convertSliceToMap(udb.Clients)
 	u.upstreamsResponses = convertSliceToMap(udb.UpstreamsResponses)
 	u.upstreamsTimeSum = convertSliceToMap(udb.UpstreamsTimeSum)
+	u.rules = convertSliceToRules(udb.Rules)
+	u.rulesTruncated = udb.RulesTruncated
 	u.timeSum = uint64(udb.TimeAvg) * udb.NTotal
 }
 
@@ -323,6 +392,10 @@ func (u *unit) add(e *Entry) {
 		u.blockedDomains[e.Domain]++
 	}
 
+	for _, r := range e.Rules {
+		u.rules[r]++
+	}
+
 	u.clients[e.Client]++
 	pt := uint64(e.ProcessingTime.Microseconds())
 	u.timeSum += pt
@@ -1,6 +1,7 @@
 package stats
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,6 +25,7 @@ func TestUnit_Deserialize(t *testing.T) {
 			timeSum:            0,
 			upstreamsResponses: map[string]uint64{},
 			upstreamsTimeSum:   map[string]uint64{},
+			rules:              map[Rule]uint64{},
 		},
 		db: &unitDB{
 			NResult:            []uint64{0, 0, 0, 0, 0, 0},
@@ -57,6 +59,9 @@ func TestUnit_Deserialize(t *testing.T) {
 			upstreamsTimeSum: map[string]uint64{
 				"1.2.3.4": 246912,
 			},
+			rules: map[Rule]uint64{
+				{Text: "||example.net^", FilterListID: 1}: 1,
+			},
 		},
 		db: &unitDB{
 			NResult: []uint64{0, 1, 1, 0, 0, 0},
@@ -77,6 +82,11 @@ func TestUnit_Deserialize(t *testing.T) {
 			UpstreamsTimeSum: []countPair{{
 				"1.2.3.4", 246912,
 			}},
+			Rules: []ruleCountPair{{
+				Text:         "||example.net^",
+				FilterListID: 1,
+				Count:        1,
+			}},
 		},
 	}}
 
@@ -89,6 +99,27 @@ func TestUnit_Deserialize(t *testing.T) {
 	}
 }
 
+func TestUnit_Serialize_rulesTruncated(t *testing.T) {
+	u := newUnit(0)
+	for i := range maxRules {
+		u.rules[Rule{Text: "||" + strconv.Itoa(i) + ".example^"}] = 1
+	}
+
+	udb := u.serialize()
+	assert.Len(t, udb.Rules, maxRules)
+	assert.False(t, udb.RulesTruncated)
+
+	u.rules[Rule{Text: "||extra.example^"}] = 1
+
+	udb = u.serialize()
+	assert.Len(t, udb.Rules, maxRules)
+	assert.True(t, udb.RulesTruncated)
+
+	got := newUnit(0)
+	got.deserialize(udb)
+	assert.True(t, got.serialize().RulesTruncated)
+}
+
 func TestTopUpstreamsPairs(t *testing.T) {
 	testCases := []struct {
 		db            *unitDB